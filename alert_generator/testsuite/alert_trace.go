@@ -0,0 +1,129 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/notifier"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// alertTraceEntry is a single line of the alert trace, which is newline delimited JSON.
+// The first line has the zero times of the test cases and the rest have the alerts received.
+type alertTraceEntry struct {
+	// Time is when the test started for the first line, and when the alerts were received for the rest.
+	Time time.Time `json:"time"`
+	// ZeroTimes are the zero times of the test cases by their group name. Only set in the first line.
+	ZeroTimes map[string]int64 `json:"zero_times,omitempty"`
+	// QueryCacheStaleness is TestSuiteOptions.QueryCacheStaleness of the test plus the slack measured by
+	// TestSuiteOptions.Calibrate, which are both added to the time tolerance of the expected alerts. Only set in the first line.
+	QueryCacheStaleness time.Duration `json:"query_cache_staleness,omitempty"`
+	// Alerts are the alerts received in a single request.
+	Alerts []notifier.Alert `json:"alerts,omitempty"`
+}
+
+// alertTrace writes all the alerts received by the alert receiving server to a file,
+// to be replayed later via ReplayAlertTrace().
+type alertTrace struct {
+	mtx     sync.Mutex
+	f       *os.File
+	enc     *json.Encoder
+	started bool
+	pending []alertTraceEntry // Alerts received before the zero times were written.
+}
+
+func newAlertTrace(path string) (*alertTrace, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &alertTrace{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// writeStart writes the zero times of the test cases and the query cache staleness as the first line,
+// followed by the alerts that were received before this was called.
+func (t *alertTrace) writeStart(now time.Time, zeroTimes map[string]int64, queryCacheStaleness time.Duration) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.started = true
+	if err := t.enc.Encode(alertTraceEntry{Time: now, ZeroTimes: zeroTimes, QueryCacheStaleness: queryCacheStaleness}); err != nil {
+		return err
+	}
+	for _, e := range t.pending {
+		if err := t.enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	t.pending = nil
+	return nil
+}
+
+// writeAlerts writes the alerts received at the given time.
+func (t *alertTrace) writeAlerts(now time.Time, alerts []notifier.Alert) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	e := alertTraceEntry{Time: now, Alerts: alerts}
+	if !t.started {
+		t.pending = append(t.pending, e)
+		return nil
+	}
+	return t.enc.Encode(e)
+}
+
+func (t *alertTrace) close() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.f.Close()
+}
+
+// ReplayAlertTrace matches the alerts in the trace written via TestSuiteOptions.AlertTraceFile with the
+// expected alerts of the given test cases, as if they were received at the time they were traced.
+// The test cases that are not in the trace are skipped. No alert generator is needed for this, which
+// helps in telling apart a bug in the test suite from a bug in the alert generator.
+func ReplayAlertTrace(r io.Reader, cs []cases.TestCase, logger log.Logger) (yes bool, describe string, err error) {
+	dec := json.NewDecoder(r)
+	var start alertTraceEntry
+	if err := dec.Decode(&start); err != nil {
+		return false, "", errors.Wrap(err, "decode the first line of the trace")
+	}
+	if len(start.ZeroTimes) == 0 {
+		return false, "", errors.New("no zero times found in the first line of the trace")
+	}
+
+	as := newAlertsServer("", logger)
+	for _, c := range cs {
+		groupName, _ := c.Describe()
+		zeroTime, ok := start.ZeroTimes[groupName]
+		if !ok {
+			continue
+		}
+		c.Init(zeroTime)
+		as.addExpectedAlerts(withQueryCacheStaleness(c.ExpectedAlerts(), start.QueryCacheStaleness)...)
+	}
+
+	for {
+		var e alertTraceEntry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, "", errors.Wrap(err, "decode the trace")
+		}
+		as.processAlerts(e.Time, e.Alerts)
+	}
+
+	groupsFacingErrors := as.groupsFacingErrors()
+	if len(groupsFacingErrors) == 0 {
+		return true, "All the alerts in the trace are as expected", nil
+	}
+	return false, describeAlertReceptionErrors(groupsFacingErrors, as.groupError()), nil
+}
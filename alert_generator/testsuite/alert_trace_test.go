@@ -0,0 +1,80 @@
+package testsuite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestAlertTraceReplay(t *testing.T) {
+	zeroTime := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	tc := cases.PendingAndFiringAndResolved()
+	groupName, _ := tc.Describe()
+	tc.Init(timestamp.FromTime(zeroTime))
+	ea := tc.ExpectedAlerts()[0]
+
+	// The first firing alert as the alert generator would send it.
+	recvTime := ea.Ts.Add(time.Second)
+	alert := notifier.Alert{
+		Labels:      ea.Alert.Labels,
+		Annotations: ea.Alert.Annotations,
+		StartsAt:    ea.Alert.StartsAt.Add(time.Second),
+		EndsAt:      recvTime.Add(ea.EndsAtDelta).Add(time.Second),
+	}
+	unexpected := notifier.Alert{
+		Labels:   labels.FromStrings("alertname", "Unknown", "rulegroup", groupName),
+		StartsAt: recvTime,
+	}
+
+	writeTrace := func(recvTime time.Time, staleness time.Duration, alerts ...notifier.Alert) string {
+		path := filepath.Join(t.TempDir(), "trace.json")
+		trace, err := newAlertTrace(path)
+		require.NoError(t, err)
+		// The alerts received before the start are written after the zero times.
+		require.NoError(t, trace.writeAlerts(recvTime, alerts[:1]))
+		require.NoError(t, trace.writeStart(zeroTime, map[string]int64{groupName: timestamp.FromTime(zeroTime)}, staleness))
+		for _, a := range alerts[1:] {
+			require.NoError(t, trace.writeAlerts(recvTime, []notifier.Alert{a}))
+		}
+		require.NoError(t, trace.close())
+		return path
+	}
+	replay := func(path string) (bool, string) {
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		yes, describe, err := ReplayAlertTrace(bytes.NewReader(b), []cases.TestCase{cases.PendingAndFiringAndResolved()}, log.NewNopLogger())
+		require.NoError(t, err)
+		return yes, describe
+	}
+
+	yes, describe := replay(writeTrace(recvTime, 0, alert))
+	require.True(t, yes, describe)
+
+	// An alert later than the tolerance only matches with the query cache staleness of the test.
+	late := alert
+	late.StartsAt = late.StartsAt.Add(ea.TimeTolerance)
+	late.EndsAt = late.EndsAt.Add(ea.TimeTolerance)
+	yes, _ = replay(writeTrace(recvTime.Add(ea.TimeTolerance), 0, late))
+	require.False(t, yes)
+	yes, describe = replay(writeTrace(recvTime.Add(ea.TimeTolerance), ea.TimeTolerance, late))
+	require.True(t, yes, describe)
+
+	yes, describe = replay(writeTrace(recvTime, 0, alert, unexpected))
+	require.False(t, yes)
+	require.Contains(t, describe, "Group Name: "+groupName)
+	require.Contains(t, describe, "Unexpected alerts")
+	require.Contains(t, describe, `alertname="Unknown"`)
+
+	_, _, err := ReplayAlertTrace(bytes.NewReader([]byte(`{"time":"2022-01-10T10:00:00Z"}`)), cases.AllCases, log.NewNopLogger())
+	require.EqualError(t, err, "no zero times found in the first line of the trace")
+}
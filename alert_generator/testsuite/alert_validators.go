@@ -0,0 +1,147 @@
+package testsuite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/notifier"
+)
+
+// maxDescribedViolations is the max number of violations described per validator in the report.
+const maxDescribedViolations = 10
+
+// AlertValidator is a custom check run against every alert received from the alert generator, in addition
+// to matching it with the expected alerts, e.g. to check the policies of an organization on the alerts.
+// The alerts of all the rule groups are validated, including the ones whose notifications are not checked.
+// A violation fails the test and is reported once per validator and labels of the alert.
+// The validators are set via TestSuiteOptions.AlertValidators.
+type AlertValidator interface {
+	// Name identifies the validator in the report.
+	Name() string
+	// Validate returns an error describing the violation if the alert does not pass the check.
+	// It must be safe to call concurrently.
+	Validate(alert notifier.Alert) error
+}
+
+// RequiredLabelsValidator is an AlertValidator that requires all the alerts to have the given labels with a non empty value.
+type RequiredLabelsValidator struct {
+	Labels []string
+}
+
+func (v RequiredLabelsValidator) Name() string {
+	return "required-labels"
+}
+
+func (v RequiredLabelsValidator) Validate(alert notifier.Alert) error {
+	var missing []string
+	for _, l := range v.Labels {
+		if alert.Labels.Get(l) == "" {
+			missing = append(missing, l)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing the required labels %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// AnnotationLengthValidator is an AlertValidator that limits the length of the values of all the annotations in bytes.
+type AnnotationLengthValidator struct {
+	MaxLength int
+}
+
+func (v AnnotationLengthValidator) Name() string {
+	return "annotation-length"
+}
+
+func (v AnnotationLengthValidator) Validate(alert notifier.Alert) error {
+	var long []string
+	for _, a := range alert.Annotations {
+		if len(a.Value) > v.MaxLength {
+			long = append(long, fmt.Sprintf("%s (%d)", a.Name, len(a.Value)))
+		}
+	}
+	if len(long) > 0 {
+		return fmt.Errorf("annotations longer than %d: %s", v.MaxLength, strings.Join(long, ", "))
+	}
+	return nil
+}
+
+type alertViolation struct {
+	t     time.Time
+	alert notifier.Alert
+	err   error
+}
+
+// validateAlerts runs all the validators against the received alerts and records the first violation
+// of every validator for the labels of an alert.
+func (as *alertsServer) validateAlerts(now time.Time, alerts []notifier.Alert) {
+	if len(as.validators) == 0 {
+		return
+	}
+
+	as.violationsMtx.Lock()
+	defer as.violationsMtx.Unlock()
+	for _, al := range alerts {
+		id := al.Labels.String()
+		for _, v := range as.validators {
+			name := v.Name()
+			if as.violations[name] == nil {
+				as.violations[name] = make(map[string]alertViolation)
+			}
+			if _, ok := as.violations[name][id]; ok {
+				continue
+			}
+			if err := v.Validate(al); err != nil {
+				as.violations[name][id] = alertViolation{t: now, alert: al, err: err}
+			}
+		}
+	}
+}
+
+// describeViolations describes the violations of the validators, in the order of the validators
+// and then the time of the violation.
+func (as *alertsServer) describeViolations() (describe string) {
+	as.violationsMtx.Lock()
+	defer as.violationsMtx.Unlock()
+
+	for _, v := range as.validators {
+		byID := as.violations[v.Name()]
+		if len(byID) == 0 {
+			continue
+		}
+		if describe == "" {
+			describe += "------------------------------------------\n"
+			describe += "The received alerts failed the following validators:\n"
+		}
+
+		violations := make([]alertViolation, 0, len(byID))
+		for _, vl := range byID {
+			violations = append(violations, vl)
+		}
+		sort.Slice(violations, func(i, j int) bool {
+			if violations[i].t.Equal(violations[j].t) {
+				return violations[i].alert.Labels.String() < violations[j].alert.Labels.String()
+			}
+			return violations[i].t.Before(violations[j].t)
+		})
+
+		describe += fmt.Sprintf("\nValidator: %s (%d alerts)\n", v.Name(), len(violations))
+		for i, vl := range violations {
+			if i == maxDescribedViolations {
+				describe += fmt.Sprintf("\t\t... and %d more\n", len(violations)-maxDescribedViolations)
+				break
+			}
+			describe += fmt.Sprintf("\t\t%d: At %s, Labels: %s, Annotations: %s, Error: %s\n",
+				i+1,
+				vl.t.Format(time.RFC3339Nano),
+				vl.alert.Labels.String(),
+				vl.alert.Annotations.String(),
+				vl.err.Error(),
+			)
+		}
+	}
+	return describe
+}
@@ -0,0 +1,62 @@
+package testsuite
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExampleAlertValidators(t *testing.T) {
+	alert := notifier.Alert{
+		Labels:      labels.FromStrings("alertname", "A", "severity", "page", "team", ""),
+		Annotations: labels.FromStrings("summary", "short", "description", strings.Repeat("x", 20)),
+	}
+
+	require.NoError(t, RequiredLabelsValidator{Labels: []string{"severity"}}.Validate(alert))
+	err := RequiredLabelsValidator{Labels: []string{"severity", "team", "owner"}}.Validate(alert)
+	require.EqualError(t, err, "missing the required labels team, owner")
+
+	require.NoError(t, AnnotationLengthValidator{MaxLength: 20}.Validate(alert))
+	err = AnnotationLengthValidator{MaxLength: 10}.Validate(alert)
+	require.EqualError(t, err, "annotations longer than 10: description (20)")
+}
+
+func TestAlertsServerValidators(t *testing.T) {
+	as := newAlertsServer("", log.NewNopLogger())
+	as.validators = []AlertValidator{
+		RequiredLabelsValidator{Labels: []string{"severity"}},
+		AnnotationLengthValidator{MaxLength: 10},
+	}
+	require.Equal(t, "", as.describeViolations())
+
+	now := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	valid := notifier.Alert{Labels: labels.FromStrings("alertname", "A", "rulegroup", "G", "severity", "page")}
+	noSeverity := notifier.Alert{Labels: labels.FromStrings("alertname", "B", "rulegroup", "G")}
+	as.processAlerts(now, []notifier.Alert{valid, noSeverity})
+	// The resends of the same alert are reported once.
+	as.processAlerts(now.Add(time.Minute), []notifier.Alert{valid, noSeverity})
+
+	describe := as.describeViolations()
+	require.Contains(t, describe, "Validator: required-labels (1 alerts)")
+	require.Contains(t, describe, `Labels: {alertname="B", rulegroup="G"}, Annotations: {}, Error: missing the required labels severity`)
+	require.NotContains(t, describe, "annotation-length")
+
+	// Only a limited number of violations are described.
+	var alerts []notifier.Alert
+	for i := 0; i < maxDescribedViolations+2; i++ {
+		alerts = append(alerts, notifier.Alert{
+			Labels:      labels.FromStrings("alertname", fmt.Sprintf("C%d", i), "rulegroup", "G", "severity", "page"),
+			Annotations: labels.FromStrings("summary", "too long for the limit"),
+		})
+	}
+	as.processAlerts(now.Add(2*time.Minute), alerts)
+	describe = as.describeViolations()
+	require.Contains(t, describe, fmt.Sprintf("Validator: annotation-length (%d alerts)", maxDescribedViolations+2))
+	require.Contains(t, describe, "... and 2 more")
+}
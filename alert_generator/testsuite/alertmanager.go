@@ -0,0 +1,216 @@
+package testsuite
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// alertmanagerChecker verifies the alerts present in a real Alertmanager that sits
+// between the alert generator and the test suite. It does not look at the timing of
+// individual notifications (that is done by the alertsServer), but checks that the alerts
+// that must be active by now are present in the Alertmanager intact, and the alerts that
+// must have been resolved are gone.
+type alertmanagerChecker struct {
+	mtx sync.Mutex
+	// Group name -> labels string of the alert -> all the expected alerts with that labels.
+	expectedAlerts map[string]map[string][]cases.ExpectedAlert
+}
+
+func newAlertmanagerChecker() *alertmanagerChecker {
+	return &alertmanagerChecker{
+		expectedAlerts: make(map[string]map[string][]cases.ExpectedAlert),
+	}
+}
+
+func (ac *alertmanagerChecker) addExpectedAlerts(alerts ...cases.ExpectedAlert) {
+	ac.mtx.Lock()
+	defer ac.mtx.Unlock()
+
+	for _, a := range alerts {
+		gn := a.Alert.Labels.Get("rulegroup")
+		if ac.expectedAlerts[gn] == nil {
+			ac.expectedAlerts[gn] = make(map[string][]cases.ExpectedAlert)
+		}
+		id := a.Alert.Labels.String()
+		ac.expectedAlerts[gn][id] = append(ac.expectedAlerts[gn][id], a)
+	}
+	for _, byID := range ac.expectedAlerts {
+		for _, eas := range byID {
+			sort.Slice(eas, func(i, j int) bool {
+				return eas[i].OrderingID < eas[j].OrderingID
+			})
+		}
+	}
+}
+
+// alertEpisode is a single firing->resolved cycle of an alert.
+type alertEpisode struct {
+	firing   []cases.ExpectedAlert
+	resolved *cases.ExpectedAlert // The first resolved alert, nil if it never gets resolved.
+}
+
+// mustBeActive tells if the alert of this episode must be active in the Alertmanager at the given time.
+func (ep alertEpisode) mustBeActive(now time.Time) bool {
+	first := ep.firing[0]
+	if first.CanBeIgnored() {
+		// It can get into next state before being sent.
+		return false
+	}
+	if first.Ts.Add(first.TimeTolerance + 2*cases.MaxRTT).After(now) {
+		// Not yet sent.
+		return false
+	}
+	return first.ResolvedTime.Equal(time.Time{}) || now.Before(first.ResolvedTime)
+}
+
+// mayBeActive tells if the alert of this episode may be active in the Alertmanager at the given time.
+func (ep alertEpisode) mayBeActive(now time.Time) bool {
+	if ep.firing[0].Ts.After(now) {
+		return false
+	}
+	if ep.resolved == nil {
+		return true
+	}
+	return ep.resolved.Ts.Add(ep.resolved.TimeTolerance + 2*cases.MaxRTT).After(now)
+}
+
+func toEpisodes(eas []cases.ExpectedAlert) []alertEpisode {
+	var episodes []alertEpisode
+	var curr *alertEpisode
+	for i, ea := range eas {
+		if ea.Resolved {
+			if curr != nil && curr.resolved == nil {
+				curr.resolved = &eas[i]
+			}
+			continue
+		}
+		if curr == nil || curr.resolved != nil || !curr.firing[0].Alert.StartsAt.Equal(ea.Alert.StartsAt) {
+			episodes = append(episodes, alertEpisode{})
+			curr = &episodes[len(episodes)-1]
+		}
+		curr.firing = append(curr.firing, ea)
+	}
+	return episodes
+}
+
+// check returns nil if the alerts of the given group as seen in the Alertmanager at the given time
+// are as expected. Returns an error otherwise describing what is the problem.
+func (ac *alertmanagerChecker) check(now time.Time, groupName string, alerts []AlertmanagerAlert) error {
+	ac.mtx.Lock()
+	defer ac.mtx.Unlock()
+
+	got := make(map[string]AlertmanagerAlert, len(alerts))
+	for _, a := range alerts {
+		got[a.Labels.String()] = a
+	}
+
+	merr := NewMulti()
+	for id, eas := range ac.expectedAlerts[groupName] {
+		a, ok := got[id]
+		delete(got, id)
+
+		episodes := toEpisodes(eas)
+		var mustEp, mayEp *alertEpisode
+		for i := range episodes {
+			if episodes[i].mustBeActive(now) {
+				mustEp = &episodes[i]
+			}
+			if episodes[i].mayBeActive(now) {
+				mayEp = &episodes[i]
+			}
+		}
+
+		if mustEp == nil {
+			if ok && mayEp == nil {
+				merr.Add(fmt.Errorf("alert with labels %s is active in the Alertmanager when it should not be", id))
+			}
+			if ok && mayEp != nil {
+				merr.Add(matchAlertmanagerEndsAt(now, *mayEp, a))
+			}
+			continue
+		}
+		if !ok {
+			merr.Add(fmt.Errorf("alert with labels %s not found in the Alertmanager", id))
+			continue
+		}
+		merr.Add(matchAlertmanagerAlert(now, *mustEp, a))
+	}
+
+	for id := range got {
+		merr.Add(fmt.Errorf("unexpected alert with labels %s found in the Alertmanager", id))
+	}
+
+	return merr.Err()
+}
+
+// matchAlertmanagerAlert checks if the alert from the Alertmanager is intact for the given episode.
+func matchAlertmanagerAlert(now time.Time, ep alertEpisode, a AlertmanagerAlert) error {
+	if a.Status.State != "active" {
+		return fmt.Errorf("alert with labels %s is in %q state in the Alertmanager, expected \"active\"", a.Labels.String(), a.Status.State)
+	}
+
+	annotationsMatch := false
+	for _, ea := range ep.firing {
+		if labels.Compare(ea.Alert.Annotations, a.Annotations) == 0 {
+			annotationsMatch = true
+			break
+		}
+	}
+	if !annotationsMatch {
+		return fmt.Errorf("annotations mismatch for alert with labels %s, expected: %s, got: %s",
+			a.Labels.String(), ep.firing[0].Alert.Annotations.String(), a.Annotations.String())
+	}
+
+	first := ep.firing[0]
+	if a.StartsAt.Before(first.Alert.StartsAt) || !a.StartsAt.Before(first.Alert.StartsAt.Add(first.TimeTolerance)) {
+		return fmt.Errorf("mismatch in StartsAt for alert with labels %s, expected range: [%s, %s), got: %s",
+			a.Labels.String(),
+			first.Alert.StartsAt.Format(time.RFC3339Nano),
+			first.Alert.StartsAt.Add(first.TimeTolerance).Format(time.RFC3339Nano),
+			a.StartsAt.Format(time.RFC3339Nano),
+		)
+	}
+
+	if !a.EndsAt.After(now) {
+		return fmt.Errorf("EndsAt for firing alert with labels %s is not in the future, now: %s, got: %s",
+			a.Labels.String(), now.Format(time.RFC3339Nano), a.EndsAt.Format(time.RFC3339Nano))
+	}
+
+	if a.GeneratorURL == "" {
+		return fmt.Errorf("empty generator URL for alert with labels %s", a.Labels.String())
+	}
+	if u, err := url.Parse(a.GeneratorURL); err != nil || !u.IsAbs() {
+		return fmt.Errorf("generator URL %q for alert with labels %s is not an absolute URL", a.GeneratorURL, a.Labels.String())
+	}
+
+	return nil
+}
+
+// matchAlertmanagerEndsAt checks the EndsAt of the alert from the Alertmanager that may or may not
+// be active for the given episode. If the alert has ended already, the EndsAt must match the time
+// when the alert was resolved.
+func matchAlertmanagerEndsAt(now time.Time, ep alertEpisode, a AlertmanagerAlert) error {
+	if ep.resolved == nil || a.EndsAt.After(now) {
+		// Still firing as far as the Alertmanager knows.
+		return nil
+	}
+
+	resolved := ep.resolved
+	if a.EndsAt.Before(resolved.ResolvedTime) || a.EndsAt.After(resolved.ResolvedTime.Add(resolved.TimeTolerance)) {
+		return fmt.Errorf("mismatch in EndsAt for resolved alert with labels %s, expected range: [%s, %s], got: %s",
+			a.Labels.String(),
+			resolved.ResolvedTime.Format(time.RFC3339Nano),
+			resolved.ResolvedTime.Add(resolved.TimeTolerance).Format(time.RFC3339Nano),
+			a.EndsAt.Format(time.RFC3339Nano),
+		)
+	}
+
+	return nil
+}
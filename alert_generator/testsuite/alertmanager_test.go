@@ -0,0 +1,80 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestAlertmanagerChecker(t *testing.T) {
+	tc := cases.TemplateFunctions()
+	groupName, _ := tc.Describe()
+	zeroTime := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	tc.SamplesToRemoteWrite()
+	tc.Init(timestamp.FromTime(zeroTime))
+
+	ac := newAlertmanagerChecker()
+	expAlerts := tc.ExpectedAlerts()
+	ac.addExpectedAlerts(expAlerts...)
+
+	firing := expAlerts[0]
+	amAlert := AlertmanagerAlert{
+		Alert: notifier.Alert{
+			Labels:       firing.Alert.Labels,
+			Annotations:  firing.Alert.Annotations,
+			StartsAt:     firing.Alert.StartsAt.Add(time.Second),
+			EndsAt:       firing.Alert.StartsAt.Add(4 * time.Minute),
+			GeneratorURL: "http://localhost:9090/graph",
+		},
+		Status: AlertmanagerAlertStatus{State: "active"},
+	}
+
+	// Before the alert is sent, it is fine to not have it.
+	require.NoError(t, ac.check(zeroTime, groupName, nil))
+
+	// Firing alert must be present.
+	firingTime := firing.Ts.Add(firing.TimeTolerance + 3*cases.MaxRTT)
+	require.NoError(t, ac.check(firingTime, groupName, []AlertmanagerAlert{amAlert}))
+	require.Error(t, ac.check(firingTime, groupName, nil))
+
+	// Modified alerts are caught.
+	modified := amAlert
+	modified.Annotations = nil
+	require.Error(t, ac.check(firingTime, groupName, []AlertmanagerAlert{modified}))
+	modified = amAlert
+	modified.GeneratorURL = ""
+	require.Error(t, ac.check(firingTime, groupName, []AlertmanagerAlert{modified}))
+	modified = amAlert
+	modified.Status.State = "suppressed"
+	require.Error(t, ac.check(firingTime, groupName, []AlertmanagerAlert{modified}))
+	modified = amAlert
+	modified.EndsAt = firingTime.Add(-time.Second)
+	require.Error(t, ac.check(firingTime, groupName, []AlertmanagerAlert{modified}))
+
+	// StartsAt at exactly the expected time, when the evaluation lands on it, and within the tolerance only.
+	modified = amAlert
+	modified.StartsAt = firing.Alert.StartsAt
+	require.NoError(t, ac.check(firingTime, groupName, []AlertmanagerAlert{modified}))
+	modified.StartsAt = firing.Alert.StartsAt.Add(-time.Millisecond)
+	require.Error(t, ac.check(firingTime, groupName, []AlertmanagerAlert{modified}))
+	modified.StartsAt = firing.Alert.StartsAt.Add(firing.TimeTolerance)
+	require.Error(t, ac.check(firingTime, groupName, []AlertmanagerAlert{modified}))
+
+	// Just resolved alert may still be present, with the EndsAt at the resolved time.
+	justResolvedTime := firing.ResolvedTime.Add(time.Second)
+	resolved := amAlert
+	resolved.EndsAt = firing.ResolvedTime
+	require.NoError(t, ac.check(justResolvedTime, groupName, []AlertmanagerAlert{resolved}))
+	resolved.EndsAt = firing.ResolvedTime.Add(-time.Minute)
+	require.Error(t, ac.check(justResolvedTime, groupName, []AlertmanagerAlert{resolved}))
+
+	// Resolved alert must be gone.
+	resolvedTime := firing.ResolvedTime.Add(10 * time.Minute)
+	require.NoError(t, ac.check(resolvedTime, groupName, nil))
+	require.Error(t, ac.check(resolvedTime, groupName, []AlertmanagerAlert{amAlert}))
+}
@@ -0,0 +1,141 @@
+package testsuite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/promql"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// alertsTimelineStep is the step of the range query of the ALERTS series for TestSuiteOptions.VerifyAlertsTimeline.
+const alertsTimelineStep = time.Second
+
+// verifyAlertsTimeline checks the ALERTS series of the finished test cases that have not failed already
+// over their entire duration via a range query, as if the metrics were checked at every step of the query.
+// This catches the wrong states that lasted shorter than the interval of the metrics check.
+func (ts *TestSuite) verifyAlertsTimeline() {
+	nowTs := timestamp.FromTime(ts.clock.Now().Add(-ts.opts.ReplicaLag))
+	for _, c := range ts.opts.Cases {
+		gn, _ := c.Describe()
+		ts.ruleGroupTestsMtx.RLock()
+		failed := len(ts.ruleGroupTestErrors[gn]) > 0
+		ts.ruleGroupTestsMtx.RUnlock()
+		from, end := ts.assertWindow(gn, c)
+		if failed || end > nowTs {
+			continue
+		}
+
+		zeroTime := ts.caseStartTimes[gn]
+		query := fmt.Sprintf("ALERTS{rulegroup=%q}", gn)
+		mappedSeries, err := ts.queryRange(query, from, end, alertsTimelineStep)
+		if err != nil {
+			level.Error(ts.logger).Log("msg", "Error in fetching the ALERTS timeline", "query", query, "err", err)
+			continue
+		}
+
+		if err := checkAlertsTimeline(c, ts.checkOpts, mappedSeries[gn], zeroTime, from, end, alertsTimelineStep, ts.opts.QueryCacheStaleness); err != nil {
+			ts.ruleGroupTestsMtx.Lock()
+			ts.ruleGroupTestErrors[gn] = append(ts.ruleGroupTestErrors[gn], checkError{check: checkNameAlertsTimeline, err: err})
+			ts.ruleGroupTestsMtx.Unlock()
+			ts.streamResult(c, checkError{check: checkNameAlertsTimeline, err: err})
+			level.Error(ts.logger).Log("msg", "ALERTS timeline check failed for a rule group", "rulegroup", gn, "err", err)
+			continue
+		}
+		level.Info(ts.logger).Log("msg", "ALERTS timeline check passed for a rule group", "rulegroup", gn)
+	}
+}
+
+// queryRange runs the range query and returns the result grouped by the rulegroup label.
+func (ts *TestSuite) queryRange(query string, start, end int64, step time.Duration) (map[string][]promql.Series, error) {
+	u := *ts.promqlURL
+	u.Path += "_range"
+	q := u.Query()
+	q.Set("query", query)
+	q.Set("start", timestamp.Time(start).Format(time.RFC3339Nano))
+	q.Set("end", timestamp.Time(end).Format(time.RFC3339Nano))
+	q.Set("step", model.Duration(step).String())
+	u.RawQuery = q.Encode()
+
+	b, err := ts.client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	mappedSeries, err := ParseAndGroupMatrix(b)
+	return mappedSeries, errors.Wrap(err, "parse range query response")
+}
+
+// checkAlertsTimeline checks the ALERTS series of the test case at every step from the first whole second
+// after from, which is at or after its zero time, until end. It returns an error with the timeline of the alert
+// states for the first step that does not match, where the times are relative to the zero time.
+// A step also matches if the ALERTS at it match the expected ones of an earlier time within the lag,
+// since a stale cached query result can delay the state changes.
+func checkAlertsTimeline(c cases.TestCase, opts cases.CheckOptions, series []promql.Series, zeroTime, from, end int64, step, lag time.Duration) error {
+	stepMs := int64(step / time.Millisecond)
+	start := (from/1000 + 1) * 1000
+
+	samplesAt := make(map[int64][]promql.Sample)
+	for _, s := range series {
+		for _, p := range s.Points {
+			samplesAt[p.T] = append(samplesAt[p.T], promql.Sample{
+				Point:  promql.Point{T: p.T / 1000, V: p.V},
+				Metric: s.Metric,
+			})
+		}
+	}
+
+	// The points of a range query are at the steps, whatever the alignment of the instant queries.
+	opts.StepAlignment = cases.QueryStepAlignmentNone
+	for t := start; t <= end; t += stepMs {
+		err := c.CheckMetrics(t, samplesAt[t], opts)
+		for lt := t - stepMs; err != nil && lt >= t-int64(lag/time.Millisecond); lt -= stepMs {
+			if c.CheckMetrics(lt, samplesAtTime(samplesAt[t], lt, opts), opts) == nil {
+				err = nil
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "ALERTS at %s (+%s) in the timeline %s",
+				timestamp.Time(t).Format(time.RFC3339Nano), time.Duration(t-zeroTime)*time.Millisecond,
+				describeAlertsTimeline(samplesAt, zeroTime, start, end, stepMs))
+		}
+	}
+	return nil
+}
+
+// describeAlertsTimeline describes the changes in the alert states of the ALERTS series relative to the zero time,
+// e.g. "+1s inactive, +20s pending, +50s firing, +2m20s inactive". The alert state at a step is all the
+// alertstate label values present at that step, and inactive if none.
+func describeAlertsTimeline(samplesAt map[int64][]promql.Sample, zeroTime, start, end, stepMs int64) string {
+	var (
+		changes []string
+		prev    string
+	)
+	for t := start; t <= end; t += stepMs {
+		states := map[string]bool{}
+		for _, s := range samplesAt[t] {
+			states[s.Metric.Get("alertstate")] = true
+		}
+		var stateNames []string
+		for st := range states {
+			stateNames = append(stateNames, st)
+		}
+		sort.Strings(stateNames)
+		state := strings.Join(stateNames, "+")
+		if state == "" {
+			state = "inactive"
+		}
+		if state != prev {
+			changes = append(changes, fmt.Sprintf("+%s %s", time.Duration(t-zeroTime)*time.Millisecond, state))
+			prev = state
+		}
+	}
+	return strings.Join(changes, ", ")
+}
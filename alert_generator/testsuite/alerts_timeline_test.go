@@ -0,0 +1,90 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestCheckAlertsTimeline(t *testing.T) {
+	c := cases.ForBetweenEvaluations()
+	zeroTime := int64(100000)
+	c.SamplesToRemoteWrite()
+	c.Init(zeroTime)
+
+	// alertsSeries returns the ALERTS series at every second with the alert being pending and firing
+	// in the given ranges of seconds relative to zeroTime, end exclusive.
+	alertsSeries := func(pendingFrom, firingFrom, firingUntil int64) []promql.Series {
+		var res []promql.Series
+		for _, st := range []struct {
+			state      string
+			start, end int64
+		}{
+			{"pending", pendingFrom, firingFrom},
+			{"firing", firingFrom, firingUntil},
+		} {
+			s := promql.Series{Metric: labels.FromStrings(
+				"__name__", "ALERTS", "alertstate", st.state, "alertname", "ForBetweenEvaluations_Alert", "foo", "bar", "rulegroup", "ForBetweenEvaluations",
+			)}
+			for sec := st.start; sec < st.end; sec++ {
+				s.Points = append(s.Points, promql.Point{T: zeroTime + 1000*sec, V: 1})
+			}
+			res = append(res, s)
+		}
+		return res
+	}
+
+	// With the evaluations at 5s, 15s, 25s and so on, the alert is active at 25s and fires at 55s
+	// once the for duration of 25s has elapsed. The sample that resolves it is at 140s.
+	require.NoError(t, checkAlertsTimeline(c, cases.CheckOptions{}, alertsSeries(25, 55, 145), zeroTime, zeroTime, c.TestUntil(), time.Second, 0))
+
+	// Firing an evaluation early.
+	err := checkAlertsTimeline(c, cases.CheckOptions{}, alertsSeries(25, 45, 145), zeroTime, zeroTime, c.TestUntil(), time.Second, 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "(+45s) in the timeline +1s inactive, +25s pending, +45s firing, +2m25s inactive")
+
+	// A blip of firing that the periodic checks can miss.
+	series := alertsSeries(25, 55, 145)
+	series = append(series, promql.Series{
+		Metric: series[1].Metric,
+		Points: []promql.Point{{T: zeroTime + 30000, V: 1}},
+	})
+	err = checkAlertsTimeline(c, cases.CheckOptions{}, series, zeroTime, zeroTime, c.TestUntil(), time.Second, 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "(+30s) in the timeline +1s inactive, +25s pending, +30s firing+pending, +31s pending, +55s firing, +2m25s inactive")
+
+	// The blip is not checked when the assertion window starts after it.
+	require.NoError(t, checkAlertsTimeline(c, cases.CheckOptions{}, series, zeroTime, zeroTime+40000, c.TestUntil(), time.Second, 0))
+
+	// Resolved 15s late, which only passes if the state changes can be delayed that much by a stale query cache.
+	err = checkAlertsTimeline(c, cases.CheckOptions{}, alertsSeries(25, 55, 160), zeroTime, zeroTime, c.TestUntil(), time.Second, 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "+2m40s inactive")
+	require.NoError(t, checkAlertsTimeline(c, cases.CheckOptions{}, alertsSeries(25, 55, 160), zeroTime, zeroTime, c.TestUntil(), time.Second, 15*time.Second))
+	// Firing early is not tolerated by the lag.
+	require.Error(t, checkAlertsTimeline(c, cases.CheckOptions{}, alertsSeries(25, 45, 145), zeroTime, zeroTime, c.TestUntil(), time.Second, 15*time.Second))
+}
+
+func TestParseAndGroupMatrix(t *testing.T) {
+	b := []byte(`{"status":"success","data":{"resultType":"matrix","result":[
+		{"metric":{"__name__":"ALERTS","alertstate":"pending","rulegroup":"a"},"values":[[100.5,"1"],[101.5,"1"]]},
+		{"metric":{"__name__":"ALERTS","alertstate":"firing","rulegroup":"b"},"values":[[102,"1"]]}
+	]}}`)
+	mapped, err := ParseAndGroupMatrix(b)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]promql.Series{
+		"a": {{
+			Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "pending", "rulegroup", "a"),
+			Points: []promql.Point{{T: 100500, V: 1}, {T: 101500, V: 1}},
+		}},
+		"b": {{
+			Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "rulegroup", "b"),
+			Points: []promql.Point{{T: 102000, V: 1}},
+		}},
+	}, mapped)
+}
@@ -0,0 +1,125 @@
+package testsuite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	v1 "github.com/prometheus/prometheus/web/api/v1"
+)
+
+// APICompat is how strictly the responses of GET /api/v1/rules and GET /api/v1/alerts of the alert generator are
+// decoded, for the alert generators whose responses differ from Prometheus in the cosmetics of the schema.
+// The fields that are unknown to the test suite, e.g. keepFiringSince, are ignored at all the levels.
+type APICompat string
+
+const (
+	// APICompatStrict decodes the responses as Prometheus serves them. It is the default.
+	APICompatStrict APICompat = "strict"
+	// APICompatRelaxed additionally tolerates the following in the responses, which are then not verified:
+	// * The case of the type, health and state of the rules and the state of the alerts, e.g. "Firing".
+	// * A missing type of a rule, which is then alerting if it has any of the fields of an alerting rule
+	//   (alerts, duration or state) and recording otherwise.
+	// * A number instead of a string as the value of the alerts.
+	APICompatRelaxed APICompat = "relaxed"
+)
+
+func validateAPICompat(c APICompat) error {
+	switch c {
+	case "", APICompatStrict, APICompatRelaxed:
+		return nil
+	}
+	return fmt.Errorf("unknown API compat %q, must be one of %q and %q", c, APICompatStrict, APICompatRelaxed)
+}
+
+// parseAndGroupRulesCompat is ParseAndGroupRules after the response is normalized for the given compat.
+func parseAndGroupRulesCompat(b []byte, compat APICompat) (map[string]*v1.RuleGroup, error) {
+	b, err := normalizeAPIResponse(b, compat, func(data map[string]interface{}) {
+		for _, g := range objects(data["groups"]) {
+			for _, r := range objects(g["rules"]) {
+				normalizeRule(r)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ParseAndGroupRules(b)
+}
+
+// parseAndGroupAlertsCompat is ParseAndGroupAlerts after the response is normalized for the given compat.
+func parseAndGroupAlertsCompat(b []byte, compat APICompat) (map[string][]v1.Alert, error) {
+	b, err := normalizeAPIResponse(b, compat, func(data map[string]interface{}) {
+		for _, a := range objects(data["alerts"]) {
+			normalizeAlert(a)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ParseAndGroupAlerts(b)
+}
+
+// normalizeAPIResponse rewrites the data of the response with the given function for the relaxed compat, so that
+// it decodes into the v1 types like a response of Prometheus. The response is returned as it is for the strict compat.
+func normalizeAPIResponse(b []byte, compat APICompat, normalizeData func(data map[string]interface{})) ([]byte, error) {
+	if compat != APICompatRelaxed {
+		return b, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// Keeps the numeric values as they are written in the response.
+	dec.UseNumber()
+	var res map[string]interface{}
+	if err := dec.Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "unmarshal response into json")
+	}
+	if data, ok := res["data"].(map[string]interface{}); ok {
+		normalizeData(data)
+	}
+	return json.Marshal(res)
+}
+
+func normalizeRule(r map[string]interface{}) {
+	if _, ok := r["type"]; !ok {
+		r["type"] = "recording"
+		for _, f := range []string{"alerts", "duration", "state"} {
+			if _, ok := r[f]; ok {
+				r["type"] = "alerting"
+			}
+		}
+	}
+	lowerCase(r, "type", "health", "state")
+	for _, a := range objects(r["alerts"]) {
+		normalizeAlert(a)
+	}
+}
+
+func normalizeAlert(a map[string]interface{}) {
+	lowerCase(a, "state")
+	if v, ok := a["value"].(json.Number); ok {
+		a["value"] = v.String()
+	}
+}
+
+// lowerCase lower cases the string values of the given fields of the object.
+func lowerCase(o map[string]interface{}, fields ...string) {
+	for _, f := range fields {
+		if s, ok := o[f].(string); ok {
+			o[f] = strings.ToLower(s)
+		}
+	}
+}
+
+// objects returns the JSON objects in the given JSON array, skipping anything else.
+func objects(v interface{}) []map[string]interface{} {
+	arr, _ := v.([]interface{})
+	var res []map[string]interface{}
+	for _, e := range arr {
+		if o, ok := e.(map[string]interface{}); ok {
+			res = append(res, o)
+		}
+	}
+	return res
+}
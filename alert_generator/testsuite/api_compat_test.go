@@ -0,0 +1,53 @@
+package testsuite
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	v1 "github.com/prometheus/prometheus/web/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPICompat(t *testing.T) {
+	rules := []byte(`{"status":"success","data":{"groups":[{"name":"G","interval":10,"rules":[
+		{"name":"A","query":"up > 0","duration":30,"health":"OK","type":"Alerting","state":"Firing",
+			"keepFiringSince":"2022-01-10T00:00:00Z",
+			"alerts":[{"labels":{"alertname":"A","rulegroup":"G"},"state":"Firing","value":1.5e+00}]},
+		{"name":"g:up","query":"up","labels":{"rulegroup":"G"},"health":"ok"}
+	]}]}}`)
+	alerts := []byte(`{"status":"success","data":{"alerts":[{"labels":{"alertname":"A","rulegroup":"G"},"state":"Pending","value":2}]}}`)
+
+	// The value as a number does not decode in the strict compat.
+	_, err := parseAndGroupRulesCompat(rules, APICompatStrict)
+	require.Error(t, err)
+	_, err = parseAndGroupAlertsCompat(alerts, "")
+	require.Error(t, err)
+
+	groups, err := parseAndGroupRulesCompat(rules, APICompatRelaxed)
+	require.NoError(t, err)
+	require.Len(t, groups["G"].Rules, 2)
+	ar, ok := groups["G"].Rules[0].(v1.AlertingRule)
+	require.True(t, ok)
+	require.Equal(t, "alerting", ar.Type)
+	require.Equal(t, "ok", string(ar.Health))
+	require.Equal(t, "firing", ar.State)
+	require.Equal(t, []*v1.Alert{{
+		Labels: labels.FromStrings("alertname", "A", "rulegroup", "G"),
+		State:  "firing",
+		Value:  "1.5e+00",
+	}}, ar.Alerts)
+	// The type is inferred from the fields.
+	rr, ok := groups["G"].Rules[1].(v1.RecordingRule)
+	require.True(t, ok)
+	require.Equal(t, "recording", rr.Type)
+
+	mapped, err := parseAndGroupAlertsCompat(alerts, APICompatRelaxed)
+	require.NoError(t, err)
+	require.Equal(t, []v1.Alert{{
+		Labels: labels.FromStrings("alertname", "A", "rulegroup", "G"),
+		State:  "pending",
+		Value:  "2",
+	}}, mapped["G"])
+
+	require.EqualError(t, validateAPICompat("loose"), `unknown API compat "loose", must be one of "strict" and "relaxed"`)
+}
@@ -0,0 +1,61 @@
+package testsuite
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/prometheus/notifier"
+)
+
+// batchSplitWindow is the window within which the alerts of a rule group received in another request are
+// split from the batch of the previous request. The alerts of an evaluation of a rule group are sent together,
+// while the evaluations are a group interval apart, which is longer than this for all the test cases.
+const batchSplitWindow = time.Second
+
+type batchErr struct {
+	t time.Time
+	// prevT is the time of the previous request with the alerts of the rule group if the alerts were split.
+	// Zero if the request had more alerts than the max batch size.
+	prevT time.Time
+	size  int // Number of alerts in the request.
+}
+
+func (e batchErr) String() string {
+	if e.prevT.IsZero() {
+		return fmt.Sprintf("At %s, %d alerts in a single request", e.t.Format(time.RFC3339Nano), e.size)
+	}
+	return fmt.Sprintf("At %s and %s, alerts of the rule group in separate requests", e.prevT.Format(time.RFC3339Nano), e.t.Format(time.RFC3339Nano))
+}
+
+// checkBatching records the batching of the alerts received in a single request that was other than asserted
+// as batch errors of their rule groups, i.e. a request with more than maxBatchSize alerts, and with batchByGroup,
+// the alerts of a rule group received in more than one request within batchSplitWindow.
+// It must be called with expectedAlertsMtx held.
+func (as *alertsServer) checkBatching(now time.Time, alerts []notifier.Alert) {
+	if !as.batchByGroup && as.maxBatchSize <= 0 {
+		return
+	}
+
+	groups := make(map[string]bool)
+	for _, al := range alerts {
+		rg := al.Labels.Get("rulegroup")
+		if as.ignoredGroups[rg] || !as.inAssertWindow(rg, now) {
+			continue
+		}
+		groups[rg] = true
+	}
+	for rg := range groups {
+		if as.maxBatchSize > 0 && len(alerts) > as.maxBatchSize {
+			errs := as.getErr(rg)
+			errs.batchErrs = append(errs.batchErrs, batchErr{t: now, size: len(alerts)})
+		}
+		if !as.batchByGroup {
+			continue
+		}
+		if prev, ok := as.lastBatch[rg]; ok && now.Sub(prev) < batchSplitWindow {
+			errs := as.getErr(rg)
+			errs.batchErrs = append(errs.batchErrs, batchErr{t: now, prevT: prev, size: len(alerts)})
+		}
+		as.lastBatch[rg] = now
+	}
+}
@@ -0,0 +1,66 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertsServerBatching(t *testing.T) {
+	now := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	alert := func(name, group string) notifier.Alert {
+		return notifier.Alert{Labels: labels.FromStrings("alertname", name, "rulegroup", group)}
+	}
+	send := func(as *alertsServer) {
+		// G is sent in a single request and H is split into 2 requests in the same evaluation.
+		as.processAlerts(now, []notifier.Alert{alert("A", "G"), alert("B", "G"), alert("C", "H")})
+		as.processAlerts(now.Add(100*time.Millisecond), []notifier.Alert{alert("D", "H")})
+		// The next evaluation is not a split.
+		as.processAlerts(now.Add(10*time.Second), []notifier.Alert{alert("A", "G")})
+	}
+
+	for _, tc := range []struct {
+		name         string
+		byGroup      bool
+		maxBatchSize int
+		expG, expH   []batchErr
+	}{
+		{name: "disabled"},
+		{
+			name:    "by group",
+			byGroup: true,
+			expH:    []batchErr{{t: now.Add(100 * time.Millisecond), prevT: now, size: 1}},
+		},
+		{
+			name:         "max batch size",
+			maxBatchSize: 2,
+			expG:         []batchErr{{t: now, size: 3}},
+			expH:         []batchErr{{t: now, size: 3}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			as := newAlertsServer("", log.NewNopLogger())
+			as.batchByGroup = tc.byGroup
+			as.maxBatchSize = tc.maxBatchSize
+			send(as)
+
+			require.Equal(t, tc.expG, as.getErr("G").batchErrs)
+			require.Equal(t, tc.expH, as.getErr("H").batchErrs)
+			if len(tc.expH) > 0 {
+				describe := describeAlertReceptionErrors(as.groupsFacingErrors(), as.groupError())
+				require.Contains(t, describe, "Reason: Alerts batched in the requests other than asserted\n")
+			}
+		})
+	}
+	// The batch errors alone fail the rule group.
+	as := newAlertsServer("", log.NewNopLogger())
+	as.getErr("G").batchErrs = []batchErr{{t: now, size: 3}}
+	require.True(t, as.groupsFacingErrors()["G"])
+
+	require.Contains(t, batchErr{t: now, size: 3}.String(), "3 alerts in a single request")
+	require.Contains(t, batchErr{t: now, prevT: now, size: 1}.String(), "alerts of the rule group in separate requests")
+}
@@ -0,0 +1,203 @@
+package testsuite
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// CalibrationRules is a rule file with an alert that always fires, which is used by TestSuiteOptions.Calibrate to
+// measure the timings of the alert generator before the test. It is written by the rule_config_builder via
+// -calibration-rules-file-path, to be loaded into the alert generator together with the rules of the test cases.
+const CalibrationRules = `groups:
+  - name: Calibration
+    interval: 10s
+    rules:
+      - alert: Calibration_Alert
+        expr: vector(1)
+        labels:
+          rulegroup: Calibration
+`
+
+// calibrationGroup is the name of the rule group in CalibrationRules, whose alerts are never checked, also when
+// the calibration rules are loaded into the alert generator without TestSuiteOptions.Calibrate.
+const calibrationGroup = "Calibration"
+
+const (
+	// CalibrationDuration is how long TestSuiteOptions.Calibrate runs, which is long enough to receive the firing
+	// calibration alert at least twice to measure the resend delay.
+	CalibrationDuration = 2*cases.ResendDelay + 30*time.Second
+	// calibrationPollInterval is the interval at which the last evaluation of the calibration group is polled.
+	calibrationPollInterval = time.Second
+)
+
+// calibration is the timings of the alert generator measured with CalibrationRules.
+type calibration struct {
+	groupInterval time.Duration // As reported by the rules API.
+	evaluations   []time.Time   // The distinct last evaluations of the group seen, in order.
+	notifications []time.Time   // The times the firing calibration alert was received.
+}
+
+// addEvaluation records the last evaluation of the calibration group if it is new.
+func (c *calibration) addEvaluation(t time.Time) {
+	if t.IsZero() || (len(c.evaluations) > 0 && !t.After(c.evaluations[len(c.evaluations)-1])) {
+		return
+	}
+	c.evaluations = append(c.evaluations, t)
+}
+
+// meanGap returns the mean time between the consecutive times, or 0 if there are less than two.
+func meanGap(ts []time.Time) time.Duration {
+	if len(ts) < 2 {
+		return 0
+	}
+	return ts[len(ts)-1].Sub(ts[0]) / time.Duration(len(ts)-1)
+}
+
+// evaluationCadence returns the measured time between the evaluations of the calibration group.
+func (c *calibration) evaluationCadence() time.Duration {
+	return meanGap(c.evaluations)
+}
+
+// resendInterval returns the measured time between the notifications of the firing calibration alert.
+func (c *calibration) resendInterval() time.Duration {
+	return meanGap(c.notifications)
+}
+
+// notificationLatency returns the max time between an evaluation and the notification received after it, before the
+// next evaluation. Since the evaluation is timed by the clock of the alert generator and the notification by the clock
+// of the test suite, it includes the skew between the clocks, which delays the alerts w.r.t. the expectations all the same.
+func (c *calibration) notificationLatency() time.Duration {
+	var latency time.Duration
+	for _, n := range c.notifications {
+		i := sort.Search(len(c.evaluations), func(i int) bool { return c.evaluations[i].After(n) })
+		if i == 0 {
+			// Received before the first evaluation seen.
+			continue
+		}
+		if l := n.Sub(c.evaluations[i-1]); l > latency {
+			latency = l
+		}
+	}
+	return latency
+}
+
+// toleranceSlack returns how much the time tolerance of the expected alerts is to be increased, which is how much the
+// notification latency exceeds the 2*cases.MaxRTT allowed for it, rounded up to a second.
+func (c *calibration) toleranceSlack() time.Duration {
+	slack := c.notificationLatency() - 2*cases.MaxRTT
+	if slack <= 0 {
+		return 0
+	}
+	return (slack + time.Second - 1).Truncate(time.Second)
+}
+
+// warnings returns the measured timings that are different from what the test cases assume, which can not be adapted to.
+func (c *calibration) warnings() []string {
+	var warnings []string
+	if cadence := c.evaluationCadence(); cadence > 0 && c.groupInterval > 0 {
+		if diff := cadence - c.groupInterval; diff > c.groupInterval/10 || diff < -c.groupInterval/10 {
+			warnings = append(warnings, fmt.Sprintf("the rule group is evaluated every %s instead of its interval of %s", cadence.Round(time.Millisecond), c.groupInterval))
+		}
+	}
+	if resend := c.resendInterval(); resend > 0 {
+		// The alert is resent at the first evaluation after the resend delay is over.
+		if resend < cases.ResendDelay-cases.MaxRTT || resend > cases.ResendDelay+c.groupInterval+2*cases.MaxRTT {
+			warnings = append(warnings, fmt.Sprintf("the firing alert is resent every %s while the test cases assume a resend delay of %s", resend.Round(time.Millisecond), cases.ResendDelay))
+		}
+	}
+	return warnings
+}
+
+// String returns the measured timings as shown in the report.
+func (c *calibration) String() string {
+	s := fmt.Sprintf("Timings of the alert generator measured by the calibration over %d evaluations and %d notifications:\n", len(c.evaluations), len(c.notifications))
+	s += fmt.Sprintf("\tevaluation cadence    %s (interval %s)\n", c.evaluationCadence().Round(time.Millisecond), c.groupInterval)
+	s += fmt.Sprintf("\tnotification latency  %s\n", c.notificationLatency().Round(time.Millisecond))
+	s += fmt.Sprintf("\tresend interval       %s (resend delay %s)\n", c.resendInterval().Round(time.Millisecond), cases.ResendDelay)
+	s += fmt.Sprintf("\ttime tolerance slack  %s\n", c.toleranceSlack())
+	for _, w := range c.warnings() {
+		s += fmt.Sprintf("\tWarning: %s\n", w)
+	}
+	return s
+}
+
+// runCalibration measures the evaluation cadence, the notification latency and the resend delay of the alert generator
+// with the always firing alert of CalibrationRules, and adds the notification latency beyond what is allowed to the time
+// tolerance of the expected alerts.
+func (ts *TestSuite) runCalibration() {
+	ts.as.startCalibration()
+
+	c := &calibration{}
+	end := time.After(CalibrationDuration)
+	tick := time.NewTicker(calibrationPollInterval)
+	defer tick.Stop()
+Loop:
+	for {
+		select {
+		case <-ts.stopc:
+			break Loop
+		case <-end:
+			break Loop
+		case <-tick.C:
+		}
+		b, err := ts.client.Get(ts.rulesAPIURL)
+		if err != nil {
+			level.Error(ts.logger).Log("msg", "Error in fetching the rules for the calibration", "url", ts.rulesAPIURL, "err", err)
+			continue
+		}
+		groups, err := parseAndGroupRulesCompat(b, ts.opts.APICompat)
+		if err != nil {
+			level.Error(ts.logger).Log("msg", "Error in parsing the rules for the calibration", "url", ts.rulesAPIURL, "err", err)
+			continue
+		}
+		if rg, ok := groups[calibrationGroup]; ok {
+			c.groupInterval = time.Duration(rg.Interval * float64(time.Second))
+			c.addEvaluation(rg.LastEvaluation)
+		}
+	}
+	c.notifications = ts.as.stopCalibration()
+
+	if len(c.evaluations) < 2 || len(c.notifications) < 2 {
+		err := errors.Errorf("got %d evaluations and %d notifications, the calibration rules may not be loaded", len(c.evaluations), len(c.notifications))
+		level.Warn(ts.logger).Log("msg", "Calibration failed, the default timings are assumed", "err", err)
+		return
+	}
+	ts.calibration = c
+	level.Info(ts.logger).Log("msg", "Calibration done", "evaluation_cadence", c.evaluationCadence(), "notification_latency", c.notificationLatency(),
+		"resend_interval", c.resendInterval(), "time_tolerance_slack", c.toleranceSlack())
+	for _, w := range c.warnings() {
+		level.Warn(ts.logger).Log("msg", "Calibration found a timing that the test cases do not adapt to", "warning", w)
+	}
+}
+
+// timeToleranceSlack is the time added to the time tolerance of all the expected alerts, which is the query cache
+// staleness plus the slack measured by the calibration.
+func (ts *TestSuite) timeToleranceSlack() time.Duration {
+	slack := ts.opts.QueryCacheStaleness
+	if ts.calibration != nil {
+		slack += ts.calibration.toleranceSlack()
+	}
+	return slack
+}
+
+// startCalibration makes the firing alerts of the calibration group to be recorded until stopCalibration.
+func (as *alertsServer) startCalibration() {
+	as.expectedAlertsMtx.Lock()
+	defer as.expectedAlertsMtx.Unlock()
+	as.calibrating = true
+	as.calibrationReceived = nil
+}
+
+// stopCalibration returns the times the firing alerts of the calibration group were received since startCalibration.
+func (as *alertsServer) stopCalibration() []time.Time {
+	as.expectedAlertsMtx.Lock()
+	defer as.expectedAlertsMtx.Unlock()
+	as.calibrating = false
+	return as.calibrationReceived
+}
@@ -0,0 +1,79 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalibrationRules(t *testing.T) {
+	rgs, errs := rulefmt.Parse([]byte(CalibrationRules))
+	require.Empty(t, errs)
+	require.Len(t, rgs.Groups, 1)
+	require.Equal(t, calibrationGroup, rgs.Groups[0].Name)
+	require.Equal(t, calibrationGroup, rgs.Groups[0].Rules[0].Labels["rulegroup"])
+}
+
+func TestCalibration(t *testing.T) {
+	start := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	c := &calibration{groupInterval: 10 * time.Second}
+	for i := 0; i <= 20; i++ {
+		c.addEvaluation(start.Add(time.Duration(i) * 10 * time.Second))
+		// The same last evaluation is seen at every poll until the next evaluation.
+		c.addEvaluation(start.Add(time.Duration(i) * 10 * time.Second))
+	}
+	c.notifications = []time.Time{
+		start.Add(-time.Second), // Before the first evaluation seen.
+		start.Add(60*time.Second + 500*time.Millisecond),
+		start.Add(120*time.Second + 6*time.Second),
+		start.Add(190 * time.Second),
+	}
+
+	require.Len(t, c.evaluations, 21)
+	require.Equal(t, 10*time.Second, c.evaluationCadence())
+	require.Equal(t, 6*time.Second, c.notificationLatency())
+	require.Equal(t, (191*time.Second)/3, c.resendInterval())
+	// 2s above the 4s allowed for the notification.
+	require.Equal(t, 2*time.Second, c.toleranceSlack())
+	require.Empty(t, c.warnings())
+	require.Contains(t, c.String(), "time tolerance slack  2s\n")
+
+	// Evaluated every 15s and resent every 2m.
+	c = &calibration{groupInterval: 10 * time.Second}
+	for i := 0; i <= 10; i++ {
+		c.addEvaluation(start.Add(time.Duration(i) * 15 * time.Second))
+	}
+	c.notifications = []time.Time{start.Add(time.Second), start.Add(121 * time.Second)}
+	require.Equal(t, time.Duration(0), c.toleranceSlack())
+	require.Len(t, c.warnings(), 2)
+	require.Contains(t, c.String(), "Warning: the rule group is evaluated every 15s instead of its interval of 10s\n")
+	require.Contains(t, c.String(), "Warning: the firing alert is resent every 2m0s while the test cases assume a resend delay of 1m0s\n")
+}
+
+func TestAlertsServerCalibration(t *testing.T) {
+	as := newAlertsServer("", log.NewNopLogger())
+	now := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	firing := notifier.Alert{
+		Labels:   labels.FromStrings("alertname", "Calibration_Alert", "rulegroup", calibrationGroup),
+		StartsAt: now.Add(-time.Hour),
+		EndsAt:   now.Add(4 * time.Minute),
+	}
+	resolved := firing
+	resolved.EndsAt = now.Add(-time.Second)
+
+	// Not recorded before the calibration, and never unexpected.
+	as.processAlerts(now, []notifier.Alert{firing})
+	as.startCalibration()
+	as.processAlerts(now.Add(time.Minute), []notifier.Alert{firing})
+	as.processAlerts(now.Add(2*time.Minute), []notifier.Alert{resolved})
+	as.processAlerts(now.Add(3*time.Minute), []notifier.Alert{firing})
+	require.Equal(t, []time.Time{now.Add(time.Minute), now.Add(3 * time.Minute)}, as.stopCalibration())
+	as.processAlerts(now.Add(4*time.Minute), []notifier.Alert{firing})
+
+	require.Empty(t, as.groupsFacingErrors())
+}
@@ -1,5 +1,10 @@
 package cases
 
+import (
+	"math/rand"
+	"time"
+)
+
 // AllCases contains all the usable test cases in this package.
 // It is recommended to keep the name of rule group same as the corresponding function calls
 // for easy debugging.
@@ -8,4 +13,74 @@ var AllCases = []TestCase{
 	PendingAndResolved_AlwaysInactive(),
 	ZeroFor_SmallFor(),
 	NewAlerts_OrderCheck(),
+	TemplateFunctions(),
+	StaggeredResolve(),
+	AbsentOverTime(),
+	RecordingRuleStaleness(),
+	IncreaseOverOneInterval(),
+	TopKChurn(),
+	LossyIngestion(),
+	HistoricalBackfill(),
+	BurnRateHumanizeDuration(),
+	NonVectorExpr(),
+	QuantileOverTime(),
+	LabelJoin(),
+	ForBetweenEvaluations(),
+	LabelPrecedence(),
+	MissingLabelTemplate(),
+	NeverResolves(),
+	Changes(),
+	ForMixedUnits(),
+	ErroringRecordingRule(),
+	ExactThreshold(),
+	TemplatedLabels(),
+	NegativeThreshold(),
+	SubSecondFor(),
+	WideLabels(),
+	UnicodeLabels(),
+	RefiringAfterDip(),
+	ConstantVector(),
+	ExternalURLTemplate(),
+	RecordingRuleLimit(),
+	SetOperations(),
+	EvaluationBoundaryResolve(),
+	SameAlertName_GroupA(),
+	SameAlertName_GroupB(),
+	SortedTopK(),
+	DerivDecline(),
+	RecordedRatioStaleness(),
+	ManyToManyMatch(),
+	RuleLabels(),
+	ForWithDataGaps(),
+	TemplateControlFlow(),
+	CommentedRuleGroup(),
+	AbsentLabelSynthesis(),
+	MaxSamplesExceeded(),
+	PresentOverTime(),
+	RoundedValue(),
+	LabelsAnnotationsSeparation(),
+	SentinelValue(),
+	AbsentAggregation(),
+	SeverityTiers(),
+	CardinalityChurn(),
+}
+
+// Shuffle returns a copy of the given test cases in a random order decided by the seed.
+// The same seed always gives the same order for the same input.
+func Shuffle(cs []TestCase, seed int64) []TestCase {
+	shuffled := make([]TestCase, len(cs))
+	copy(shuffled, cs)
+	rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
+
+// PickSeed returns the given seed, or a time based seed if the given seed is 0.
+// All the binaries use this so that -seed=0 means the same everywhere.
+func PickSeed(seed int64) int64 {
+	if seed == 0 {
+		return time.Now().UnixNano()
+	}
+	return seed
 }
@@ -0,0 +1,36 @@
+package cases
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShuffle(t *testing.T) {
+	names := func(cs []TestCase) []string {
+		var res []string
+		for _, c := range cs {
+			gn, _ := c.Describe()
+			res = append(res, gn)
+		}
+		return res
+	}
+	orgNames := names(AllCases)
+
+	s1, s2 := Shuffle(AllCases, 42), Shuffle(AllCases, 42)
+	require.Equal(t, names(s1), names(s2), "same seed must give the same order")
+	require.ElementsMatch(t, orgNames, names(s1))
+	require.Equal(t, orgNames, names(AllCases), "original slice must not be modified")
+
+	differs := false
+	for seed := int64(1); seed <= 10 && !differs; seed++ {
+		differs = !reflect.DeepEqual(orgNames, names(Shuffle(AllCases, seed)))
+	}
+	require.True(t, differs, "expected some seed to change the order")
+}
+
+func TestPickSeed(t *testing.T) {
+	require.Equal(t, int64(42), PickSeed(42))
+	require.NotEqual(t, int64(0), PickSeed(0))
+}
@@ -0,0 +1,228 @@
+package cases
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// AbsentAggregation tests the following cases:
+// * Alerts based on absent() wrapped in an aggregation, whose labels are the labels synthesized by absent()
+//   from the equality matchers of the selector (see AbsentLabelSynthesis) that are left by the aggregation:
+//   - `sum by (job) (absent(...))` has only 'job'.
+//   - `sum by (job, instance) (absent(...))` with a regex matcher of 'instance' has only 'job', since absent()
+//     drops 'instance' before the aggregation could keep it.
+//   - `max without (job) (absent(...))` has the synthetic labels except 'job', including the ones of the
+//     selector that are overridden by the labels of the rule.
+// * The alerts go from pending->firing->inactive when their series are marked stale and come back.
+// This is an advanced case where the expected labels can only be computed by applying the label synthesis of
+// absent() and then the aggregation, hence it counts less in the compliance score than the basic cases.
+func AbsentAggregation() TestCase {
+	groupName := "AbsentAggregation"
+	controlLbls := labels.NewBuilder(metricLabels(groupName, groupName+"_Control")).
+		Set("__name__", sourceTimeSeriesName+"_control").
+		Labels()
+	tc := &absentAggregation{
+		groupName:     groupName,
+		controlLabels: controlLbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		forDuration:   model.Duration(30 * time.Second),
+	}
+	tc.rules = []absentAggregationRule{
+		{
+			alertName:   groupName + "_SumByJob",
+			aggregation: "sum by (job)",
+			matchers:    `instance="api-1", job="api"`,
+			alertLabels: []string{"job", "api"},
+		},
+		{
+			alertName:   groupName + "_SumByDroppedLabel",
+			aggregation: "sum by (job, instance)",
+			matchers:    `instance=~"api-.*", job="api"`,
+			alertLabels: []string{"job", "api"},
+		},
+		{
+			alertName:   groupName + "_MaxWithoutJob",
+			aggregation: "max without (job)",
+			matchers:    `instance="api-1", job="api"`,
+			alertLabels: []string{"instance", "api-1"},
+		},
+	}
+	for i := range tc.rules {
+		r := &tc.rules[i]
+		r.metricLabels = labels.NewBuilder(metricLabels(groupName, r.alertName)).Set("job", "api").Set("instance", "api-1").Labels()
+		// Both the series end together, hence the series is never absent while the control series is present.
+		r.query = fmt.Sprintf(`%s (absent(%s{alertname="%s", %s, rulegroup="%s"})) and on() %s`,
+			r.aggregation, sourceTimeSeriesName, r.alertName, r.matchers, groupName, controlLbls.String())
+	}
+	tc.stateMachine = tc.newStateMachine()
+	return tc
+}
+
+// absentAggregationRule is an alerting rule on absent() of its own series wrapped in an aggregation.
+type absentAggregationRule struct {
+	alertName    string
+	aggregation  string // Aggregation with its grouping.
+	matchers     string // Matchers of the selector besides the alertname and the rulegroup.
+	query        string
+	metricLabels labels.Labels
+	alertLabels  []string // Labels of the alert besides the ones of the rule, as name and value pairs.
+}
+
+// newStateMachine returns the expected states of the alerts, which all go into pending at the 13th sample where
+// their series are marked stale, into firing after the 'for' duration, and get resolved at the 37th sample where
+// the series come back.
+func (tc *absentAggregation) newStateMachine() *StateMachine {
+	_13th := 12 * tc.rwInterval
+	_37th := 36 * tc.rwInterval
+	sm := &StateMachine{
+		GroupName:     tc.groupName,
+		GroupInterval: tc.groupInterval,
+	}
+	for _, r := range tc.rules {
+		alertLabels := labels.NewBuilder(labels.FromStrings(r.alertLabels...)).
+			Set("alertname", r.alertName).
+			Set("foo", "bar").
+			Set("rulegroup", tc.groupName).
+			Labels()
+		sm.Rules = append(sm.Rules, RuleStateMachine{
+			Rule: v1.AlertingRule{
+				Name:        r.alertName,
+				Query:       r.query,
+				Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+				Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "Absent with job={{$labels.job}} instance={{$labels.instance}}"),
+				Health:      "ok",
+				Type:        "alerting",
+			},
+			Alerts: []AlertStateMachine{
+				{
+					Labels:      alertLabels,
+					Annotations: labels.FromStrings("description", fmt.Sprintf("Absent with job=%s instance=%s", alertLabels.Get("job"), alertLabels.Get("instance"))),
+					Transitions: []Transition{
+						{From: AlertInactive, To: AlertPending, At: _13th, Value: "1"},
+						{From: AlertPending, To: AlertFiring, At: _13th + time.Duration(tc.forDuration)},
+						{From: AlertFiring, To: AlertInactive, At: _37th},
+					},
+				},
+			},
+		})
+	}
+	return sm
+}
+
+type absentAggregation struct {
+	groupName                 string
+	rules                     []absentAggregationRule
+	controlLabels             labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+	stateMachine              *StateMachine
+
+	zeroTime int64
+}
+
+func (tc *absentAggregation) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alerts based on absent() wrapped in an aggregation, whose labels are the labels synthesized by absent() from the equality matchers of the selector that are left by the aggregation: " +
+			"'sum by (job)' has only 'job', 'sum by (job, instance)' with a regex matcher of 'instance' has only 'job', and 'max without (job)' has the synthetic labels except 'job'. " +
+			"(2) The alerts go from pending->firing->inactive when their series are marked stale and come back."
+}
+
+func (tc *absentAggregation) RuleGroup() (rulefmt.RuleGroup, error) {
+	rg := rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+	}
+	for _, r := range tc.rules {
+		var alert, expr yaml.Node
+		if err := alert.Encode(r.alertName); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+		if err := expr.Encode(r.query); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+		rg.Rules = append(rg.Rules, rulefmt.RuleNode{
+			Alert:       alert,
+			Expr:        expr,
+			For:         tc.forDuration,
+			Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+			Annotations: map[string]string{"description": "Absent with job={{$labels.job}} instance={{$labels.instance}}"},
+		})
+	}
+	return rg, nil
+}
+
+// Weight implements Weighted. The interaction of absent() with the aggregations is an edge case.
+func (tc *absentAggregation) Weight() float64 {
+	return 0.5
+}
+
+func (tc *absentAggregation) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		"1", "0x11", // 1m of data.
+		"0x23", // 2m of absence, it will be replaced with a stale marker below.
+		"0x23", // 2m of data. Resolved.
+	)
+	tc.totalSamples = len(samples) + 12 // We want to wait for 1m more to see the resolved alerts.
+
+	// The series are marked stale at the 13th sample, and have no samples till the 37th sample.
+	var withGap []prompb.Sample
+	withGap = append(withGap, samples[:12]...)
+	withGap = append(withGap, prompb.Sample{
+		Timestamp: samples[12].Timestamp,
+		Value:     math.Float64frombits(value.StaleNaN),
+	})
+	withGap = append(withGap, samples[36:]...)
+
+	series := []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.controlLabels),
+			Samples: samples,
+		},
+	}
+	for _, r := range tc.rules {
+		series = append(series, prompb.TimeSeries{
+			Labels:  toProtoLabels(r.metricLabels),
+			Samples: withGap,
+		})
+	}
+	return series
+}
+
+func (tc *absentAggregation) Init(zt int64) {
+	tc.zeroTime = zt
+	tc.stateMachine.Init(zt)
+}
+
+func (tc *absentAggregation) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *absentAggregation) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	return tc.stateMachine.CheckAlerts(ts, alerts)
+}
+
+func (tc *absentAggregation) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	return tc.stateMachine.CheckRuleGroup(ts, rg, opts)
+}
+
+func (tc *absentAggregation) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	return tc.stateMachine.CheckMetrics(ts, samples, opts)
+}
+
+func (tc *absentAggregation) ExpectedAlerts() []ExpectedAlert {
+	return tc.stateMachine.ExpectedAlerts()
+}
@@ -0,0 +1,208 @@
+package cases
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// AbsentLabelSynthesis tests the following cases:
+// * Alert based on absent() of a selector that mixes equality, regex and negative matchers, whose alert
+//   only has the labels of the equality matchers. absent() synthesizes the labels of its result from the
+//   matchers of the selector as follows:
+//   - The metric name is never a label of the result.
+//   - A label with a single equality matcher gets the value of the matcher.
+//   - A label with a regex or a negative matcher is dropped, and so is a label with more than one matcher,
+//     even if one of them is an equality matcher.
+// * The series that do not match the regex or the negative matcher do not stop the alert from becoming active.
+// * The alert goes from pending->firing->inactive when the series is marked stale and comes back.
+func AbsentLabelSynthesis() TestCase {
+	groupName := "AbsentLabelSynthesis"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	// The series matched by the selector.
+	matchedLbls := labels.NewBuilder(lbls).
+		Set("job", "api").
+		Set("env", "prod").
+		Set("instance", "api-1").
+		Set("region", "us").
+		Labels()
+	controlLbls := labels.NewBuilder(lbls).Set("__name__", sourceTimeSeriesName+"_control").Labels()
+	tc := &absentLabelSynthesis{
+		groupName:     groupName,
+		alertName:     alertName,
+		matchedLabels: matchedLbls,
+		// The series that match the equality matchers but not the regex or the negative matcher.
+		unmatchedLabels: []labels.Labels{
+			labels.NewBuilder(matchedLbls).Set("instance", "web-1").Labels(),
+			labels.NewBuilder(matchedLbls).Set("instance", "api-2").Set("region", "eu").Labels(),
+		},
+		controlLabels: controlLbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	// 'env' has both an equality and a regex matcher, hence it is dropped like 'instance' and 'region'.
+	// Both the series end together, hence the matched series is never absent while the control series is present.
+	tc.query = fmt.Sprintf(`absent(%s{alertname="%s", env="prod", env=~"p.*", instance=~"api-.*", job="api", region!="eu", rulegroup="%s"}) and on() %s`,
+		sourceTimeSeriesName, alertName, groupName, controlLbls.String())
+	tc.forDuration = model.Duration(6 * tc.rwInterval)
+	tc.stateMachine = tc.newStateMachine()
+	return tc
+}
+
+// newStateMachine returns the expected states of the alert, which goes into pending at the 13th sample where
+// the matched series is marked stale, into firing after the 'for' duration, and gets resolved at the 37th sample
+// where the matched series comes back.
+func (tc *absentLabelSynthesis) newStateMachine() *StateMachine {
+	_13th := 12 * tc.rwInterval
+	_37th := 36 * tc.rwInterval
+	description := "Absent with the synthetic labels job={{$labels.job}} env={{$labels.env}} instance={{$labels.instance}} region={{$labels.region}}"
+	return &StateMachine{
+		GroupName:     tc.groupName,
+		GroupInterval: tc.groupInterval,
+		Rules: []RuleStateMachine{
+			{
+				Rule: v1.AlertingRule{
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", description),
+					Health:      "ok",
+					Type:        "alerting",
+				},
+				Alerts: []AlertStateMachine{
+					{
+						// Only 'job' of the labels of the matched series, besides the ones of the rule.
+						Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "job", "api", "rulegroup", tc.groupName),
+						Annotations: labels.FromStrings("description", "Absent with the synthetic labels job=api env= instance= region="),
+						Transitions: []Transition{
+							{From: AlertInactive, To: AlertPending, At: _13th, Value: "1"},
+							{From: AlertPending, To: AlertFiring, At: _13th + time.Duration(tc.forDuration)},
+							{From: AlertFiring, To: AlertInactive, At: _37th},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+type absentLabelSynthesis struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	matchedLabels             labels.Labels
+	unmatchedLabels           []labels.Labels
+	controlLabels             labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+	stateMachine              *StateMachine
+
+	zeroTime int64
+}
+
+func (tc *absentLabelSynthesis) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert based on absent() of a selector that mixes equality, regex and negative matchers, whose alert only has the labels of the equality matchers, " +
+			"and not the labels that also have a regex matcher. " +
+			"(2) The series that do not match the regex or the negative matcher do not stop the alert from becoming active. " +
+			"(3) The alert goes from pending->firing->inactive when the series is marked stale and comes back."
+}
+
+func (tc *absentLabelSynthesis) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "Absent with the synthetic labels job={{$labels.job}} env={{$labels.env}} instance={{$labels.instance}} region={{$labels.region}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *absentLabelSynthesis) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"1", "0x11", // 3m of data.
+		"0x23", // 6m of absence, it will be replaced with a stale marker below.
+		"0x23", // 6m of data. Resolved.
+	)
+	tc.totalSamples = len(samples) + 12 // We want to wait for 3m more to see the resolved alerts.
+
+	// The matched series is marked stale at the 13th sample, and has no samples till the 37th sample.
+	var withGap []prompb.Sample
+	withGap = append(withGap, samples[:12]...)
+	withGap = append(withGap, prompb.Sample{
+		Timestamp: samples[12].Timestamp,
+		Value:     math.Float64frombits(value.StaleNaN),
+	})
+	withGap = append(withGap, samples[36:]...)
+
+	series := []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.matchedLabels),
+			Samples: withGap,
+		},
+		{
+			Labels:  toProtoLabels(tc.controlLabels),
+			Samples: samples,
+		},
+	}
+	for _, lbls := range tc.unmatchedLabels {
+		series = append(series, prompb.TimeSeries{
+			Labels:  toProtoLabels(lbls),
+			Samples: samples,
+		})
+	}
+	return series
+}
+
+func (tc *absentLabelSynthesis) Init(zt int64) {
+	tc.zeroTime = zt
+	tc.stateMachine.Init(zt)
+}
+
+func (tc *absentLabelSynthesis) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *absentLabelSynthesis) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	return tc.stateMachine.CheckAlerts(ts, alerts)
+}
+
+func (tc *absentLabelSynthesis) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	return tc.stateMachine.CheckRuleGroup(ts, rg, opts)
+}
+
+func (tc *absentLabelSynthesis) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	return tc.stateMachine.CheckMetrics(ts, samples, opts)
+}
+
+func (tc *absentLabelSynthesis) ExpectedAlerts() []ExpectedAlert {
+	return tc.stateMachine.ExpectedAlerts()
+}
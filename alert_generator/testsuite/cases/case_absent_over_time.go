@@ -0,0 +1,350 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// AbsentOverTime tests the following cases:
+// * Alert based on absent_over_time() that goes from pending->firing->inactive.
+// * A gap in the data that is shorter than the range of absent_over_time() does not make the alert active.
+// * The alert becomes active only after there has been no sample for the entire range, and gets resolved
+//   as soon as a sample appears again.
+// * The alert does not become active after the test ends, which is guarded by a control series that
+//   has samples for the entire test.
+func AbsentOverTime() TestCase {
+	groupName := "AbsentOverTime"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	controlLbls := labels.NewBuilder(lbls).Set("__name__", sourceTimeSeriesName+"_control").Labels()
+	tc := &absentOverTime{
+		groupName:     groupName,
+		alertName:     alertName,
+		metricLabels:  lbls,
+		controlLabels: controlLbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.window = 12 * tc.rwInterval
+	// Both the series end together, hence the main series is never absent for the entire range
+	// while the control series is present in the range.
+	tc.query = fmt.Sprintf("absent_over_time(%s[%s]) and on() present_over_time(%s[%s])",
+		lbls.String(), model.Duration(tc.window).String(), controlLbls.String(), model.Duration(tc.window).String())
+	tc.forDuration = model.Duration(6 * tc.rwInterval)
+	return tc
+}
+
+type absentOverTime struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	controlLabels             labels.Labels
+	rwInterval, groupInterval time.Duration
+	window                    time.Duration // Range of absent_over_time().
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *absentOverTime) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert based on absent_over_time() that goes from pending->firing->inactive. " +
+			"(2) A gap in the data that is shorter than the range of absent_over_time() does not make the alert active. " +
+			"(3) The alert becomes active only after there has been no sample for the entire range, and gets resolved as soon as a sample appears again. " +
+			"(4) The alert does not become active after the test ends, which is guarded by a control series that has samples for the entire test."
+}
+
+func (tc *absentOverTime) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The series has been absent for the whole window, value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *absentOverTime) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"1", "0x3", // 1m of data.
+		"0x6",  // 1m30s short gap, it will be removed below.
+		"0x6",  // 1m30s of data.
+		"0x24", // 6m long gap, it will be removed below.
+		"0x16", // 4m of data.
+	)
+	tc.totalSamples = len(samples)
+
+	// Remove the samples for the gaps.
+	var withGaps []prompb.Sample
+	withGaps = append(withGaps, samples[:4]...)
+	withGaps = append(withGaps, samples[10:16]...)
+	withGaps = append(withGaps, samples[40:]...)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: withGaps,
+		},
+		{
+			Labels:  toProtoLabels(tc.controlLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *absentOverTime) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *absentOverTime) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *absentOverTime) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *absentOverTime) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *absentOverTime) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// absentTime is the time relative to zeroTime after which the series is absent for the entire window.
+// The last sample before the long gap is the 16th sample.
+func (tc *absentOverTime) absentTime() time.Duration {
+	return 15*tc.rwInterval + tc.window
+}
+
+func (tc *absentOverTime) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.absentTime()/time.Millisecond))
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBePending {
+		expAlerts = append(expAlerts, []v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The series has been absent for the whole window, value is 1"),
+				State:       "pending",
+				Value:       "1",
+				ActiveAt:    &activeAt,
+			},
+		})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, []v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The series has been absent for the whole window, value is 1"),
+				State:       "firing",
+				Value:       "1",
+				ActiveAt:    &activeAt,
+			},
+		})
+	}
+
+	return expAlerts
+}
+
+func (tc *absentOverTime) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.absentTime()/time.Millisecond))
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The series has been absent for the whole window, value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBePending {
+		expRgs = append(expRgs, getRg("pending", []*v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The series has been absent for the whole window, value is 1"),
+				State:       "pending",
+				Value:       "1",
+				ActiveAt:    &activeAt,
+			},
+		}))
+	}
+	if canBeFiring {
+		expRgs = append(expRgs, getRg("firing", []*v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The series has been absent for the whole window, value is 1"),
+				State:       "firing",
+				Value:       "1",
+				ActiveAt:    &activeAt,
+			},
+		}))
+	}
+
+	return expRgs
+}
+
+func (tc *absentOverTime) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePending {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "pending", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+	if canBeFiring {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *absentOverTime) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	absent := tc.absentTime().Seconds()                                   // Goes into pending.
+	firing := (tc.absentTime() + time.Duration(tc.forDuration)).Seconds() // Goes into firing.
+	_40th := 40 * rwItvlSecFloat                                          // Resolved.
+	canBeInactive = between(0, absent+grpItvlSecFloat) ||
+		between(_40th-1, 240*rwItvlSecFloat)
+	canBePending = between(absent-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, _40th+grpItvlSecFloat)
+	return
+}
+
+func (tc *absentOverTime) ExpectedAlerts() []ExpectedAlert {
+	firing := int64((tc.absentTime() + time.Duration(tc.forDuration)) / time.Millisecond) // Firing.
+	_40th := 40 * int64(tc.rwInterval/time.Millisecond)                                   // Resolved.
+	_40thPlus15m := _40th + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < _40th; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + _40th),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _40th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The series has been absent for the whole window, value is 1"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := _40th; ts < _40thPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _40th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != _40th,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _40th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The series has been absent for the whole window, value is 1"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
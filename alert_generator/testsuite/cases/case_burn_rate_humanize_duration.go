@@ -0,0 +1,342 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// BurnRateHumanizeDuration tests the following cases:
+// * SLO burn-rate alert whose expr computes the projected time to exhaust the 30d error budget of a 99.9% SLO
+//   from the live error ratio, and that goes from pending->firing->inactive.
+// * The annotation renders the projected time via `$value | humanizeDuration`, and is compared exactly
+//   both via API and in the alerts sent.
+// * The rendered annotation changes with the value while the alert is firing, and the resends carry the new annotation.
+func BurnRateHumanizeDuration() TestCase {
+	groupName := "BurnRateHumanizeDuration"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &burnRateHumanizeDuration{
+		groupName: groupName,
+		alertName: alertName,
+		// The series is the error ratio. The burn rate is the error ratio divided by the error budget of 0.001,
+		// and the error budget of 30d is exhausted in 30d divided by the burn rate. The alert fires if that
+		// is less than 1d. The values of the series are chosen such that the result has no rounding errors.
+		query:         fmt.Sprintf("30 * 86400 / (%s / 0.001) < 86400", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(12 * tc.rwInterval)
+	return tc
+}
+
+type burnRateHumanizeDuration struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *burnRateHumanizeDuration) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) SLO burn-rate alert whose expr computes the projected time to exhaust the 30d error budget of a 99.9% SLO from the live error ratio, and that goes from pending->firing->inactive. " +
+			"(2) The annotation renders the projected time via `$value | humanizeDuration`, and is compared exactly both via API and in the alerts sent. " +
+			"(3) The rendered annotation changes with the value while the alert is firing, and the resends carry the new annotation."
+}
+
+// annotationTemplates are the annotations as written in the rule.
+func (tc *burnRateHumanizeDuration) annotationTemplates() map[string]string {
+	return map[string]string{
+		"summary":            "The error budget will be exhausted in {{ $value | humanizeDuration }} at the current burn rate",
+		"exhaustion_seconds": "{{ $value }}",
+	}
+}
+
+// expandedAnnotations are the annotations after the templates are expanded for the given value.
+func (tc *burnRateHumanizeDuration) expandedAnnotations(value string) labels.Labels {
+	human := map[string]string{
+		"41472": "11h 31m 12s",
+		"20736": "5h 45m 36s",
+	}[value]
+	return labels.FromStrings(
+		"summary", fmt.Sprintf("The error budget will be exhausted in %s at the current burn rate", human),
+		"exhaustion_seconds", value,
+	)
+}
+
+func (tc *burnRateHumanizeDuration) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: tc.annotationTemplates(),
+			},
+		},
+	}, nil
+}
+
+func (tc *burnRateHumanizeDuration) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"0.01", "0x11", // 3m of inactive. Exhausted in 3d.
+		"0.0625", "0x29", // 7m30s of active. Exhausted in 11h 31m 12s. Pending @3m and goes into firing @6m.
+		"0.125", "0x23", // 6m of firing with changed value. Exhausted in 5h 45m 36s.
+		"0.01", "0x19", // 5m of resolved.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *burnRateHumanizeDuration) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *burnRateHumanizeDuration) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *burnRateHumanizeDuration) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *burnRateHumanizeDuration) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *burnRateHumanizeDuration) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *burnRateHumanizeDuration) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+// possibleAlerts returns the possible alerts at the given time relative to zeroTime, where nil means inactive.
+func (tc *burnRateHumanizeDuration) possibleAlerts(relTs int64) (alerts []*v1.Alert) {
+	canBeInactive, canBePending, canBeFiring1, canBeFiring2 := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(12*tc.rwInterval/time.Millisecond))
+	alert := func(state, value string) *v1.Alert {
+		return &v1.Alert{
+			Labels:      tc.alertLabels(),
+			Annotations: tc.expandedAnnotations(value),
+			State:       state,
+			Value:       value,
+			ActiveAt:    &activeAt,
+		}
+	}
+
+	if canBeInactive {
+		alerts = append(alerts, nil)
+	}
+	if canBePending {
+		alerts = append(alerts, alert("pending", "41472"))
+	}
+	if canBeFiring1 {
+		alerts = append(alerts, alert("firing", "41472"))
+	}
+	if canBeFiring2 {
+		alerts = append(alerts, alert("firing", "20736"))
+	}
+	return alerts
+}
+
+func (tc *burnRateHumanizeDuration) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	for _, a := range tc.possibleAlerts(ts - tc.zeroTime) {
+		if a == nil {
+			expAlerts = append(expAlerts, []v1.Alert{})
+			continue
+		}
+		expAlerts = append(expAlerts, []v1.Alert{*a})
+	}
+	return expAlerts
+}
+
+func (tc *burnRateHumanizeDuration) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromMap(tc.annotationTemplates()),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	for _, a := range tc.possibleAlerts(ts - tc.zeroTime) {
+		if a == nil {
+			expRgs = append(expRgs, getRg("inactive", nil))
+			continue
+		}
+		expRgs = append(expRgs, getRg(a.State, []*v1.Alert{a}))
+	}
+	return expRgs
+}
+
+func (tc *burnRateHumanizeDuration) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	for _, a := range tc.possibleAlerts(ts - tc.zeroTime) {
+		if a == nil {
+			expSamples = append(expSamples, nil)
+			continue
+		}
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", a.State, "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *burnRateHumanizeDuration) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring1, canBeFiring2 bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_12th := 12 * rwItvlSecFloat // Goes into pending.
+	_24th := 24 * rwItvlSecFloat // Goes into firing.
+	_42nd := 42 * rwItvlSecFloat // Firing, but another value.
+	_66th := 66 * rwItvlSecFloat // Resolved.
+	canBeInactive = between(0, _12th+grpItvlSecFloat) ||
+		between(_66th-1, 240*rwItvlSecFloat)
+	canBePending = between(_12th-1, _24th+grpItvlSecFloat)
+	canBeFiring1 = between(_24th-1, _42nd+grpItvlSecFloat)
+	canBeFiring2 = between(_42nd-1, _66th+grpItvlSecFloat)
+	return
+}
+
+func (tc *burnRateHumanizeDuration) ExpectedAlerts() []ExpectedAlert {
+	_24th := 24 * int64(tc.rwInterval/time.Millisecond) // Firing.
+	_42nd := 42 * int64(tc.rwInterval/time.Millisecond) // Firing with value change.
+	_66th := 66 * int64(tc.rwInterval/time.Millisecond) // Resolved.
+	_66thPlus15m := _66th + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := _24th; ts < _42nd; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != _24th,
+			NextState:     timestamp.Time(tc.zeroTime + _42nd),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _66th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.expandedAnnotations("41472"),
+				StartsAt:    timestamp.Time(tc.zeroTime + _24th),
+			},
+		})
+	}
+	// Value change. The value changes half way between two resends, hence the next resend has the new annotation.
+	for ts := _42nd; ts < _66th; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        true,
+			NextState:     timestamp.Time(tc.zeroTime + _66th),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _66th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.expandedAnnotations("20736"),
+				StartsAt:    timestamp.Time(tc.zeroTime + _24th),
+			},
+		})
+	}
+
+	for ts := _66th; ts < _66thPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _66th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != _66th,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _66th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.expandedAnnotations("20736"),
+				StartsAt:    timestamp.Time(tc.zeroTime + _24th),
+			},
+		})
+	}
+
+	return exp
+}
@@ -0,0 +1,211 @@
+package cases
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// CardinalityChurn tests the following cases:
+// * A rule like `up{job="api"} == 0` whose result grows and shrinks as the instances come and go, where every
+//   instance gets its own alert with its own activeAt and 'for':
+//   - An instance that goes down and recovers goes from pending->firing->inactive.
+//   - An instance that appears already down gets a new alert that goes from pending->firing, and gets resolved
+//     when it is removed (marked stale) while still down.
+//   - An instance that is down for less than the 'for' goes from pending->inactive, and being removed later
+//     while up has no effect.
+//   - An instance that appears up and goes down in the same evaluation where another one is removed gets a new
+//     alert while the other gets resolved.
+func CardinalityChurn() TestCase {
+	groupName := "CardinalityChurn"
+	alertName := groupName + "_InstanceDown"
+	tc := &cardinalityChurn{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf(`%s{alertname="%s", job="api", rulegroup="%s"} == 0`, sourceTimeSeriesName, alertName, groupName),
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		forDuration:   model.Duration(30 * time.Second),
+		totalSamples:  108,
+		instances: []churnInstance{
+			{instance: "api-1", down: [][2]int{{12, 48}}},
+			{instance: "api-2", from: 24, removed: 60, down: [][2]int{{24, 60}}},
+			{instance: "api-3", removed: 48, down: [][2]int{{36, 40}}},
+			{instance: "api-4", from: 48, down: [][2]int{{60, 84}}},
+		},
+	}
+	tc.stateMachine = tc.newStateMachine()
+	return tc
+}
+
+// churnInstance is the series of an instance in CardinalityChurn, where the samples are the indexes of the
+// samples of the test case.
+type churnInstance struct {
+	instance string
+	from     int      // First sample of the series.
+	removed  int      // Sample where the series is marked stale and ends, 0 if never.
+	down     [][2]int // Ranges of the samples [first, last+1) where the instance is down, ended by a recovery or the removal.
+}
+
+// newStateMachine returns the expected states of the alerts of the instances, where every time an instance is
+// down it goes into pending at the first sample, into firing after the 'for' duration if still down, and
+// inactive at the sample where it recovers or is removed.
+func (tc *cardinalityChurn) newStateMachine() *StateMachine {
+	forDuration := time.Duration(tc.forDuration)
+	var alerts []AlertStateMachine
+	for _, inst := range tc.instances {
+		var transitions []Transition
+		for _, d := range inst.down {
+			active, inactive := time.Duration(d[0])*tc.rwInterval, time.Duration(d[1])*tc.rwInterval
+			transitions = append(transitions, Transition{From: AlertInactive, To: AlertPending, At: active, Value: "0"})
+			if active+forDuration < inactive {
+				transitions = append(transitions,
+					Transition{From: AlertPending, To: AlertFiring, At: active + forDuration},
+					Transition{From: AlertFiring, To: AlertInactive, At: inactive},
+				)
+			} else {
+				transitions = append(transitions, Transition{From: AlertPending, To: AlertInactive, At: inactive})
+			}
+		}
+		alerts = append(alerts, AlertStateMachine{
+			Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "instance", inst.instance, "job", "api", "rulegroup", tc.groupName),
+			Annotations: labels.FromStrings("description", fmt.Sprintf("%s of api is down", inst.instance)),
+			Transitions: transitions,
+		})
+	}
+	return &StateMachine{
+		GroupName:     tc.groupName,
+		GroupInterval: tc.groupInterval,
+		Rules: []RuleStateMachine{
+			{
+				Rule: v1.AlertingRule{
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(forDuration / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "{{$labels.instance}} of {{$labels.job}} is down"),
+					Health:      "ok",
+					Type:        "alerting",
+				},
+				Alerts: alerts,
+			},
+		},
+	}
+}
+
+type cardinalityChurn struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	instances                 []churnInstance
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+	stateMachine              *StateMachine
+
+	zeroTime int64
+}
+
+func (tc *cardinalityChurn) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) A rule like 'up{job=\"api\"} == 0' whose result grows and shrinks as the instances come and go, where every instance gets its own alert with its own activeAt and 'for'. " +
+			"(2) An instance that goes down and recovers goes from pending->firing->inactive. " +
+			"(3) An instance that appears already down gets a new alert that goes from pending->firing, and gets resolved when it is removed (marked stale) while still down. " +
+			"(4) An instance that is down for less than the 'for' goes from pending->inactive, and being removed later while up has no effect. " +
+			"(5) An instance that appears up and goes down in the same evaluation where another one is removed gets a new alert while the other gets resolved."
+}
+
+func (tc *cardinalityChurn) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert, expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "{{$labels.instance}} of {{$labels.job}} is down"},
+			},
+		},
+	}, nil
+}
+
+func (tc *cardinalityChurn) SamplesToRemoteWrite() []prompb.TimeSeries {
+	// 9m of samples, where the instances are up unless they are down as per churnInstance.down.
+	samples := sampleSlice(tc.rwInterval, "1", fmt.Sprintf("0x%d", tc.totalSamples-1))
+
+	var series []prompb.TimeSeries
+	for _, inst := range tc.instances {
+		end := len(samples)
+		if inst.removed > 0 {
+			end = inst.removed
+		}
+		var instSamples []prompb.Sample
+		for i := inst.from; i < end; i++ {
+			s := samples[i]
+			for _, d := range inst.down {
+				if i >= d[0] && i < d[1] {
+					s.Value = 0
+				}
+			}
+			instSamples = append(instSamples, s)
+		}
+		if inst.removed > 0 {
+			instSamples = append(instSamples, prompb.Sample{
+				Timestamp: samples[inst.removed].Timestamp,
+				Value:     math.Float64frombits(value.StaleNaN),
+			})
+		}
+		series = append(series, prompb.TimeSeries{
+			Labels: toProtoLabels(labels.NewBuilder(metricLabels(tc.groupName, tc.alertName)).
+				Set("job", "api").
+				Set("instance", inst.instance).
+				Labels()),
+			Samples: instSamples,
+		})
+	}
+	return series
+}
+
+func (tc *cardinalityChurn) Init(zt int64) {
+	tc.zeroTime = zt
+	tc.stateMachine.Init(zt)
+}
+
+func (tc *cardinalityChurn) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *cardinalityChurn) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	return tc.stateMachine.CheckAlerts(ts, alerts)
+}
+
+func (tc *cardinalityChurn) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	return tc.stateMachine.CheckRuleGroup(ts, rg, opts)
+}
+
+func (tc *cardinalityChurn) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	return tc.stateMachine.CheckMetrics(ts, samples, opts)
+}
+
+func (tc *cardinalityChurn) ExpectedAlerts() []ExpectedAlert {
+	return tc.stateMachine.ExpectedAlerts()
+}
@@ -0,0 +1,341 @@
+package cases
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// Changes tests the following cases:
+// * Alert based on changes() of a gauge over a window that goes from pending->firing->inactive, where the
+//   value of the alert is the number of times the value changed among the samples in the window.
+// * A few changes in the window that do not exceed the threshold do not make the alert active.
+// * The alert gets resolved as the old changes age out of the window after the gauge stops flapping.
+func Changes() TestCase {
+	groupName := "Changes"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &changes{
+		groupName:     groupName,
+		alertName:     alertName,
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		threshold:     4,
+	}
+	tc.rangeDuration = 24 * tc.rwInterval
+	tc.query = fmt.Sprintf("changes(%s[%s]) > %d", lbls.String(), model.Duration(tc.rangeDuration).String(), tc.threshold)
+	tc.forDuration = model.Duration(6 * tc.rwInterval)
+
+	// All comment times is assuming 15s interval.
+	// The gauge is 1 with a single blip to 2 from 3m to 5m, which is 2 changes. Then it flaps between 1 and 2
+	// every 1m from 7m30s to 19m30s, which is 12 changes, 1m apart. With the range of 6m, the window has more than
+	// 4 changes from the 5th change of the flapping at 12m30s until the 8th change at 15m30s is no more counted
+	// at 21m15s, which is when the sample before it leaves the window.
+	for i := 0; i < 150; i++ {
+		v := 1.0
+		switch {
+		case i >= 12 && i < 20:
+			v = 2
+		case i >= 30 && i < 78:
+			v = float64(1 + ((i-30)/4)%2)
+		}
+		tc.samples = append(tc.samples, prompb.Sample{
+			Timestamp: int64(time.Duration(i) * tc.rwInterval / time.Millisecond),
+			Value:     v,
+		})
+	}
+	return tc
+}
+
+type changes struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	rangeDuration             time.Duration
+	threshold                 int
+	forDuration               model.Duration
+	samples                   []prompb.Sample
+
+	zeroTime int64
+}
+
+const (
+	changesActiveIdx  = 50 // Index of the sample which brings the 5th change of the flapping in the window.
+	changesResolveIdx = 85 // Index of the sample after which the 8th change of the flapping is not counted in the window.
+)
+
+func (tc *changes) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert based on changes() of a gauge over a window that goes from pending->firing->inactive, where the value of the alert is the number of times the value changed among the samples in the window. " +
+			"(2) A few changes in the window that do not exceed the threshold do not make the alert active. " +
+			"(3) The alert gets resolved as the old changes age out of the window after the gauge stops flapping."
+}
+
+func (tc *changes) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is flapping"},
+			},
+		},
+	}, nil
+}
+
+func (tc *changes) SamplesToRemoteWrite() []prompb.TimeSeries {
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: tc.samples,
+		},
+	}
+}
+
+func (tc *changes) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *changes) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(len(tc.samples)) * tc.rwInterval))
+}
+
+func (tc *changes) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *changes) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *changes) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *changes) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *changes) alertAnnotations() labels.Labels {
+	return labels.FromStrings("description", "The value is flapping")
+}
+
+// countChanges returns the number of times the value changed among the given consecutive samples.
+func countChanges(samples []prompb.Sample) int {
+	n := 0
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Value != samples[i-1].Value {
+			n++
+		}
+	}
+	return n
+}
+
+// possibleValues returns the possible values above the threshold of the alert at ts, relative to zeroTime.
+// The last evaluation can be up to a group interval before ts, and the latest sample in the window might
+// not have been ingested at the time of the evaluation.
+func (tc *changes) possibleValues(relTs int64) []string {
+	rangeMs := int64(tc.rangeDuration / time.Millisecond)
+	minEvalTs := relTs - int64((tc.groupInterval+MaxRTT)/time.Millisecond)
+
+	// The window only changes when a sample enters or leaves it.
+	evalTimes := []int64{minEvalTs, relTs}
+	for _, s := range tc.samples {
+		for _, t := range []int64{s.Timestamp, s.Timestamp + 1, s.Timestamp + rangeMs, s.Timestamp + rangeMs + 1} {
+			if t > minEvalTs && t < relTs {
+				evalTimes = append(evalTimes, t)
+			}
+		}
+	}
+
+	var values []string
+	seen := make(map[string]bool)
+	for _, et := range evalTimes {
+		var window []prompb.Sample
+		for _, s := range tc.samples {
+			if s.Timestamp >= et-rangeMs && s.Timestamp <= et {
+				window = append(window, s)
+			}
+		}
+		windows := [][]prompb.Sample{window}
+		if len(window) > 1 {
+			windows = append(windows, window[:len(window)-1])
+		}
+		for _, w := range windows {
+			n := countChanges(w)
+			v := strconv.Itoa(n)
+			if n > tc.threshold && !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+func (tc *changes) possibleAlerts(ts int64) [][]v1.Alert {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(changesActiveIdx*tc.rwInterval/time.Millisecond))
+
+	var alerts []*v1.Alert
+	if canBeInactive {
+		alerts = append(alerts, nil)
+	}
+	for _, v := range tc.possibleValues(relTs) {
+		alerts = append(alerts, possibleSeriesAlerts(false, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(),
+			Annotations: tc.alertAnnotations(),
+			Value:       v,
+			ActiveAt:    &activeAt,
+		})...)
+	}
+	return alertCombinations([][]*v1.Alert{alerts}, nil)
+}
+
+func (tc *changes) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *changes) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: tc.alertAnnotations(),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *changes) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *changes) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	active := changesActiveIdx * rwItvlSecFloat                // Goes into pending.
+	firing := active + time.Duration(tc.forDuration).Seconds() // Goes into firing.
+	resolved := changesResolveIdx * rwItvlSecFloat             // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, float64(len(tc.samples))*rwItvlSecFloat)
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *changes) ExpectedAlerts() []ExpectedAlert {
+	firing := int64(changesActiveIdx*tc.rwInterval/time.Millisecond) + int64(time.Duration(tc.forDuration)/time.Millisecond)
+	resolved := int64(changesResolveIdx * tc.rwInterval / time.Millisecond)
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < resolved; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + resolved),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.alertAnnotations(),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == resolved {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != resolved,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.alertAnnotations(),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
@@ -0,0 +1,303 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// CommentedRuleGroup tests the following cases:
+// * A rule group with YAML comments around and within its rules, including a rule that is commented out,
+//   is loaded with only the rules that are not commented out.
+// * An alerting rule whose valid expression never matches stays inactive and does not interfere with the
+//   evaluation of the other alerting rule of the group, which goes into pending, firing and gets resolved.
+func CommentedRuleGroup() TestCase {
+	groupName := "CommentedRuleGroup"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &commentedRuleGroup{
+		groupName:     groupName,
+		alertName:     alertName,
+		noOpAlertName: groupName + "_NoOpAlert",
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		// The series is never negative.
+		noOpQuery:     fmt.Sprintf("%s < 0", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(30 * time.Second)
+	return tc
+}
+
+type commentedRuleGroup struct {
+	groupName                 string
+	alertName, noOpAlertName  string
+	query, noOpQuery          string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *commentedRuleGroup) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) A rule group with YAML comments around and within its rules, including a rule that is commented out, is loaded with only the rules that are not commented out. " +
+			"(2) An alerting rule that never matches stays inactive and does not interfere with the other alerting rule of the group, which goes into pending, firing and gets resolved."
+}
+
+func (tc *commentedRuleGroup) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert, noOpAlert yaml.Node
+	var expr, noOpExpr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := noOpAlert.Encode(tc.noOpAlertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := noOpExpr.Encode(tc.noOpQuery); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	alert.LineComment = "The active rule of the group."
+	expr.LineComment = "Above 10 for a while."
+	noOpAlert.LineComment = "A valid rule that never matches, the series is never negative."
+	noOpExpr.LineComment = "Never true."
+	// A rule that is commented out, which must not be loaded.
+	noOpExpr.FootComment = "- alert: " + tc.groupName + "_DisabledAlert\n  expr: vector(1)"
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+			{
+				Alert:       noOpAlert,
+				Expr:        noOpExpr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "baz", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "This should never fire"},
+			},
+		},
+	}, nil
+}
+
+func (tc *commentedRuleGroup) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 5s interval.
+		"3", "0x11", // 1m below the threshold.
+		"15", "0x35", // 3m above the threshold. Goes into pending at 1m and into firing at 1m30s.
+		"5", "0x11", // 1m below the threshold. Resolved at 4m.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *commentedRuleGroup) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *commentedRuleGroup) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *commentedRuleGroup) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *commentedRuleGroup) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *commentedRuleGroup) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// activeTime is the time relative to zeroTime when the alert becomes active, which is the first sample
+// above the threshold.
+func (tc *commentedRuleGroup) activeTime() time.Duration {
+	return 12 * tc.rwInterval
+}
+
+// firingTime is the time relative to zeroTime when the alert goes into firing.
+func (tc *commentedRuleGroup) firingTime() time.Duration {
+	return tc.activeTime() + time.Duration(tc.forDuration)
+}
+
+// resolvedTime is the time relative to zeroTime when the alert gets resolved, which is the first sample
+// back below the threshold.
+func (tc *commentedRuleGroup) resolvedTime() time.Duration {
+	return 48 * tc.rwInterval
+}
+
+func (tc *commentedRuleGroup) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *commentedRuleGroup) possibleAlerts(ts int64) [][]v1.Alert {
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(ts - tc.zeroTime)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+	return alertCombinations([][]*v1.Alert{
+		possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(),
+			Annotations: labels.FromStrings("description", "The value is 15"),
+			Value:       "15",
+			ActiveAt:    &activeAt,
+		}),
+	}, nil)
+}
+
+func (tc *commentedRuleGroup) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *commentedRuleGroup) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+				v1.AlertingRule{
+					State:       "inactive",
+					Name:        tc.noOpAlertName,
+					Query:       tc.noOpQuery,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "baz", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "This should never fire"),
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *commentedRuleGroup) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *commentedRuleGroup) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := tc.activeTime().Seconds()     // Goes into pending.
+	firing := tc.firingTime().Seconds()     // Goes into firing.
+	resolved := tc.resolvedTime().Seconds() // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, 2*resolved)
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *commentedRuleGroup) ExpectedAlerts() []ExpectedAlert {
+	firing := int64(tc.firingTime() / time.Millisecond)
+	resolved := int64(tc.resolvedTime() / time.Millisecond)
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < resolved; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + resolved),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The value is 15"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == resolved {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != resolved,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The value is 15"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
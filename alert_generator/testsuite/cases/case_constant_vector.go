@@ -0,0 +1,274 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// ConstantVector tests the following cases:
+// * Alert on a constant expression like `vector(1) > 0`, the "heartbeat" alert that is always firing to test
+//   the notification pipeline. There is a single alert with only the labels of the rule since the result of
+//   vector() has no labels, and it fires right away with a zero 'for' duration without ever being pending.
+// * The alert keeps firing and is resent for the whole time the expression holds.
+// Note: A constant expression would fire from when the rules are loaded, before the test starts. Hence it is
+// gated with `and on()` by a series that is 1 for the duration of the heartbeat, which does not add any labels.
+func ConstantVector() TestCase {
+	groupName := "ConstantVector"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &constantVector{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("vector(1) > 0 and on() (%s == 1)", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	return tc
+}
+
+type constantVector struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *constantVector) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert on a constant expression like 'vector(1) > 0', which has a single alert with only the labels of the rule and fires right away with a zero 'for' duration without ever being pending. " +
+			"(2) The alert keeps firing and is resent for the whole time the expression holds. " +
+			"The expression is gated by a series to fire only during the test."
+}
+
+func (tc *constantVector) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *constantVector) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"0", "0x3", // 1m of the gate closed (0 is @0 time).
+		"1", "0x39", // 10m of heartbeat. Goes into firing at 1m.
+		"0", "0x11", // 3m of the gate closed. Resolved.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *constantVector) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *constantVector) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *constantVector) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *constantVector) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *constantVector) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// activeTime is the time relative to zeroTime when the alert becomes active, which is the first sample
+// of the open gate.
+func (tc *constantVector) activeTime() time.Duration {
+	return 4 * tc.rwInterval
+}
+
+// firingTime is the time relative to zeroTime when the alert goes into firing.
+func (tc *constantVector) firingTime() time.Duration {
+	return tc.activeTime() + time.Duration(tc.forDuration)
+}
+
+// resolvedTime is the time relative to zeroTime when the alert gets resolved, which is the first sample
+// back at the threshold.
+func (tc *constantVector) resolvedTime() time.Duration {
+	return 44 * tc.rwInterval
+}
+
+func (tc *constantVector) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *constantVector) possibleAlerts(ts int64) [][]v1.Alert {
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(ts - tc.zeroTime)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+	return alertCombinations([][]*v1.Alert{
+		possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(),
+			Annotations: labels.FromStrings("description", "The value is 1"),
+			Value:       "1",
+			ActiveAt:    &activeAt,
+		}),
+	}, nil)
+}
+
+func (tc *constantVector) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *constantVector) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *constantVector) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *constantVector) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := tc.activeTime().Seconds()     // Becomes active.
+	firing := tc.firingTime().Seconds()     // Goes into firing, which is at the same time.
+	resolved := tc.resolvedTime().Seconds() // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, 2*resolved)
+	// The 'for' duration is zero, hence the alert goes into firing at the evaluation that makes it active.
+	canBePending = false
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *constantVector) ExpectedAlerts() []ExpectedAlert {
+	firing := int64(tc.firingTime() / time.Millisecond)
+	resolved := int64(tc.resolvedTime() / time.Millisecond)
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < resolved; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + resolved),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The value is 1"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == resolved {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != resolved,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The value is 1"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
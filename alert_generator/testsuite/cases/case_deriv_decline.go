@@ -0,0 +1,337 @@
+package cases
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// DerivDecline tests the following cases:
+// * Alert based on deriv() of a gauge that goes from pending->firing->inactive, where the value of the alert
+//   is the slope of the least-squares linear regression of the samples in the window.
+// * A gauge that is flat and then declines slower than the threshold does not alert, and the alert becomes
+//   active only once the decline steepens enough for the slope of the window to cross the threshold.
+func DerivDecline() TestCase {
+	groupName := "DerivDecline"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &derivDecline{
+		groupName:     groupName,
+		alertName:     alertName,
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		threshold:     -0.1,
+		activeIdx:     76,
+		resolveIdx:    125,
+	}
+	tc.rangeDuration = 12 * tc.rwInterval
+	tc.query = fmt.Sprintf("deriv(%s[%s]) < %s",
+		lbls.String(), model.Duration(tc.rangeDuration).String(), strconv.FormatFloat(tc.threshold, 'f', -1, 64))
+	tc.forDuration = model.Duration(12 * tc.rwInterval)
+
+	// All comment times is assuming 15s interval.
+	// The gauge is flat at 100 for 6m, then declines by 0.25 per sample (-0.05/s at 5s interval) for 12m,
+	// then by 1 per sample (-0.2/s) for 12m, and then is flat for 6m. Only the steep decline crosses the
+	// threshold, which with the windows of both 12 and 13 samples (the window includes its start) is from the
+	// 76th sample, when the window has 5 samples of the steep decline, until the 125th sample, when the window
+	// has 6 samples of the flat end.
+	v := 100.0
+	for i := 0; i < 144; i++ {
+		switch {
+		case i >= 24 && i < 72:
+			v -= 0.25
+		case i >= 72 && i < 120:
+			v--
+		}
+		tc.samples = append(tc.samples, prompb.Sample{
+			Timestamp: int64(time.Duration(i) * tc.rwInterval / time.Millisecond),
+			Value:     v,
+		})
+	}
+	return tc
+}
+
+type derivDecline struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	rangeDuration             time.Duration
+	threshold                 float64
+	forDuration               model.Duration
+	samples                   []prompb.Sample
+	activeIdx                 int // Index of the sample which brings the slope below the threshold.
+	resolveIdx                int // Index of the sample which brings the slope back above the threshold.
+
+	zeroTime int64
+}
+
+func (tc *derivDecline) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert based on deriv() of a gauge that goes from pending->firing->inactive, where the value of the alert is the slope of the least-squares linear regression of the samples in the window. " +
+			"(2) A gauge that is flat and then declines slower than the threshold does not alert, and the alert becomes active only once the decline steepens enough for the slope of the window to cross the threshold."
+}
+
+func (tc *derivDecline) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The gauge is declining too fast"},
+			},
+		},
+	}, nil
+}
+
+func (tc *derivDecline) SamplesToRemoteWrite() []prompb.TimeSeries {
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: tc.samples,
+		},
+	}
+}
+
+func (tc *derivDecline) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *derivDecline) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(len(tc.samples)) * tc.rwInterval))
+}
+
+func (tc *derivDecline) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *derivDecline) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *derivDecline) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *derivDecline) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *derivDecline) alertAnnotations() labels.Labels {
+	return labels.FromStrings("description", "The gauge is declining too fast")
+}
+
+// possibleValues returns the possible values below the threshold of the alert at ts, relative to zeroTime.
+// The last evaluation can be up to a group interval before ts, and the latest sample in the window might
+// not have been ingested at the time of the evaluation.
+func (tc *derivDecline) possibleValues(relTs int64) []string {
+	rangeMs := int64(tc.rangeDuration / time.Millisecond)
+	minEvalTs := relTs - int64((tc.groupInterval+MaxRTT)/time.Millisecond)
+
+	// The window only changes when a sample enters or leaves it.
+	evalTimes := []int64{minEvalTs, relTs}
+	for _, s := range tc.samples {
+		for _, t := range []int64{s.Timestamp, s.Timestamp + 1, s.Timestamp + rangeMs, s.Timestamp + rangeMs + 1} {
+			if t > minEvalTs && t < relTs {
+				evalTimes = append(evalTimes, t)
+			}
+		}
+	}
+
+	var values []string
+	seen := make(map[string]bool)
+	for _, et := range evalTimes {
+		var window []prompb.Sample
+		for _, s := range tc.samples {
+			if s.Timestamp >= et-rangeMs && s.Timestamp <= et {
+				window = append(window, s)
+			}
+		}
+		windows := [][]prompb.Sample{window}
+		if len(window) > 2 {
+			windows = append(windows, window[:len(window)-1])
+		}
+		for _, w := range windows {
+			if len(w) < 2 {
+				// deriv() needs at least 2 samples.
+				continue
+			}
+			d := linearRegressionSlope(w)
+			v := strconv.FormatFloat(d, 'f', -1, 64)
+			if d < tc.threshold && !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// possibleAlerts returns all the possible alerts, with any of the possible values.
+func (tc *derivDecline) possibleAlerts(ts int64) [][]v1.Alert {
+	relTs := ts - tc.zeroTime
+
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(time.Duration(tc.activeIdx)*tc.rwInterval/time.Millisecond))
+
+	var alerts []*v1.Alert
+	if canBeInactive {
+		alerts = append(alerts, nil)
+	}
+	for _, v := range tc.possibleValues(relTs) {
+		alerts = append(alerts, possibleSeriesAlerts(false, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(),
+			Annotations: tc.alertAnnotations(),
+			Value:       v,
+			ActiveAt:    &activeAt,
+		})...)
+	}
+
+	return alertCombinations([][]*v1.Alert{alerts}, nil)
+}
+
+func (tc *derivDecline) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *derivDecline) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The gauge is declining too fast"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *derivDecline) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *derivDecline) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	active := float64(tc.activeIdx) * rwItvlSecFloat           // Goes into pending.
+	firing := active + time.Duration(tc.forDuration).Seconds() // Goes into firing.
+	resolved := float64(tc.resolveIdx) * rwItvlSecFloat        // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, 240*rwItvlSecFloat)
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *derivDecline) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	firing := int64(tc.activeIdx)*int64(tc.rwInterval/time.Millisecond) + int64(time.Duration(tc.forDuration)/time.Millisecond)
+	resolved := int64(tc.resolveIdx) * int64(tc.rwInterval/time.Millisecond)
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+	for ts := firing; ts < resolved; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + resolved),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.alertAnnotations(),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == resolved {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != resolved,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.alertAnnotations(),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
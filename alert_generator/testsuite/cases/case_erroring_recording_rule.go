@@ -0,0 +1,478 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// ErroringRecordingRule tests the following cases:
+// * A recording rule whose labels override the label that distinguishes its input series starts erroring
+//   when a second input series appears, since it produces two series with the same labels.
+// * The recorded series is not marked stale when the recording rule errors, so the alerting rule that
+//   depends on it keeps firing until the recorded series is past the lookback, and then gets resolved.
+// * An independent alerting rule in the same group is unaffected by the erroring recording rule.
+func ErroringRecordingRule() TestCase {
+	groupName := "ErroringRecordingRule"
+	depAlertName := groupName + "_Dependent"
+	indAlertName := groupName + "_Independent"
+	recordName := groupName + ":value"
+	depLabels := metricLabels(groupName, depAlertName)
+	recorded := fmt.Sprintf(`%s{rulegroup="%s"}`, recordName, groupName)
+	return &erroringRecordingRule{
+		groupName:        groupName,
+		depAlertName:     depAlertName,
+		indAlertName:     indAlertName,
+		recordName:       recordName,
+		recordQuery:      depLabels.String(),
+		depQuery:         fmt.Sprintf("%s > 10", recorded),
+		indQuery:         fmt.Sprintf("%s > 10", metricLabels(groupName, indAlertName).String()),
+		recordedQuery:    fmt.Sprintf("%s > bool 0", recorded),
+		depMetricLabels:  depLabels,
+		indMetricLabels:  metricLabels(groupName, indAlertName),
+		rwInterval:       5 * time.Second,
+		groupInterval:    10 * time.Second,
+		forDuration:      model.Duration(30 * time.Second),
+		lookbackDelta:    DefaultLookbackDelta,
+		activeIdx:        4,
+		errorIdx:         30,
+		indResolveIdx:    100,
+		totalSamples:     112,
+		recordErrSnippet: "same labelset",
+	}
+}
+
+type erroringRecordingRule struct {
+	groupName                        string
+	depAlertName, indAlertName       string
+	recordName                       string
+	recordQuery, depQuery, indQuery  string
+	recordedQuery                    string // Query for the recorded series.
+	depMetricLabels, indMetricLabels labels.Labels
+	rwInterval, groupInterval        time.Duration
+	forDuration                      model.Duration
+	lookbackDelta                    time.Duration
+
+	// Indices of the samples.
+	activeIdx     int // Both the alerts become active.
+	errorIdx      int // The second input series of the recording rule appears.
+	indResolveIdx int // The independent alert gets resolved.
+	totalSamples  int
+
+	// Expected substring of the error of the recording rule.
+	recordErrSnippet string
+
+	zeroTime int64
+}
+
+func (tc *erroringRecordingRule) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) A recording rule whose labels override the label that distinguishes its input series starts erroring when a second input series appears. " +
+			"(2) The recorded series is not marked stale on the error, so the alert that depends on it keeps firing until the recorded series is past the lookback, and then gets resolved. " +
+			"(3) An independent alert in the same group is unaffected by the erroring recording rule."
+}
+
+func (tc *erroringRecordingRule) RuleGroup() (rulefmt.RuleGroup, error) {
+	var record, recordExpr yaml.Node
+	var depAlert, depExpr yaml.Node
+	var indAlert, indExpr yaml.Node
+	for _, e := range []struct {
+		n *yaml.Node
+		v string
+	}{
+		{&record, tc.recordName}, {&recordExpr, tc.recordQuery},
+		{&depAlert, tc.depAlertName}, {&depExpr, tc.depQuery},
+		{&indAlert, tc.indAlertName}, {&indExpr, tc.indQuery},
+	} {
+		if err := e.n.Encode(e.v); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				// The recording rule must come first so that the dependent alerting rule sees its output
+				// from the same evaluation.
+				Record: record,
+				Expr:   recordExpr,
+				Labels: map[string]string{"replica": "merged", "rulegroup": tc.groupName},
+			},
+			{
+				Alert:       depAlert,
+				Expr:        depExpr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+			{
+				Alert:       indAlert,
+				Expr:        indExpr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *erroringRecordingRule) SamplesToRemoteWrite() []prompb.TimeSeries {
+	// All comment times is assuming 15s interval.
+	depSamples := sampleSlice(tc.rwInterval,
+		"3", "0x3", // 1m (3 is @0 time).
+		"15", fmt.Sprintf("0x%d", tc.totalSamples-tc.activeIdx-1), // Till the end. Goes into pending at 1m.
+	)
+	// The second input series appears at 7m30s, which makes the recording rule error.
+	secondSamples := sampleSlice(tc.rwInterval, "15", fmt.Sprintf("0x%d", tc.totalSamples-tc.errorIdx-1))
+	offsetMs := int64(time.Duration(tc.errorIdx) * tc.rwInterval / time.Millisecond)
+	for i := range secondSamples {
+		secondSamples[i].Timestamp += offsetMs
+	}
+	indSamples := sampleSlice(tc.rwInterval,
+		"3", "0x3", // 1m.
+		"15", fmt.Sprintf("0x%d", tc.indResolveIdx-tc.activeIdx-1), // 24m of active. Goes into pending at 1m.
+		"5", fmt.Sprintf("0x%d", tc.totalSamples-tc.indResolveIdx-1), // Resolved at 25m.
+	)
+
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(labels.NewBuilder(tc.depMetricLabels).Set("replica", "a").Labels()),
+			Samples: depSamples,
+		},
+		{
+			Labels:  toProtoLabels(labels.NewBuilder(tc.depMetricLabels).Set("replica", "b").Labels()),
+			Samples: secondSamples,
+		},
+		{
+			Labels:  toProtoLabels(tc.indMetricLabels),
+			Samples: indSamples,
+		},
+	}
+}
+
+func (tc *erroringRecordingRule) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+// SetLookbackDelta implements LookbackDependent.
+func (tc *erroringRecordingRule) SetLookbackDelta(d time.Duration) {
+	tc.lookbackDelta = d
+}
+
+func (tc *erroringRecordingRule) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(tc.testDuration()))
+}
+
+// testDuration is the duration of the test, which lasts till the samples end or till the dependent alert
+// gets resolved with a long lookback delta. The input series of the recording rule stay for the lookback
+// after the samples end, hence it keeps erroring till the end of the test.
+func (tc *erroringRecordingRule) testDuration() time.Duration {
+	d := time.Duration(tc.totalSamples) * tc.rwInterval
+	if dr := tc.depResolvedTime() + 3*tc.groupInterval; dr > d {
+		d = dr
+	}
+	return d
+}
+
+func (tc *erroringRecordingRule) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *erroringRecordingRule) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *erroringRecordingRule) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *erroringRecordingRule) Queries() []string {
+	return []string{tc.recordedQuery}
+}
+
+func (tc *erroringRecordingRule) CheckQuery(ts int64, query string, samples []promql.Sample, opts CheckOptions) error {
+	if query != tc.recordedQuery {
+		return errors.Errorf("unexpected query %q", query)
+	}
+	expSamples := tc.expRecorded(ts)
+	return errors.Wrap(checkExpectedSamples(ts, expSamples, samples, opts), "recorded series")
+}
+
+// activeTime is the time relative to zeroTime when both the alerts become active.
+func (tc *erroringRecordingRule) activeTime() time.Duration {
+	return time.Duration(tc.activeIdx) * tc.rwInterval
+}
+
+// firingTime is the time relative to zeroTime when both the alerts go into firing.
+func (tc *erroringRecordingRule) firingTime() time.Duration {
+	return tc.activeTime() + time.Duration(tc.forDuration)
+}
+
+// errorTime is the time relative to zeroTime when the recording rule starts erroring.
+func (tc *erroringRecordingRule) errorTime() time.Duration {
+	return time.Duration(tc.errorIdx) * tc.rwInterval
+}
+
+// depResolvedTime is the earliest time relative to zeroTime when the dependent alert gets resolved. The last
+// recorded sample is from the last evaluation before errorTime(), which can be up to 1 group interval before it,
+// and the dependent alert is resolved once that sample is past the lookback.
+func (tc *erroringRecordingRule) depResolvedTime() time.Duration {
+	return tc.errorTime() - tc.groupInterval + tc.lookbackDelta
+}
+
+// indResolvedTime is the time relative to zeroTime when the independent alert gets resolved.
+func (tc *erroringRecordingRule) indResolvedTime() time.Duration {
+	return time.Duration(tc.indResolveIdx) * tc.rwInterval
+}
+
+func (tc *erroringRecordingRule) depAlertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.depAlertName, "foo", "bar", "replica", "merged", "rulegroup", tc.groupName)
+}
+
+func (tc *erroringRecordingRule) indAlertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.indAlertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *erroringRecordingRule) possibleAlerts(ts int64) [][]v1.Alert {
+	dep, ind := tc.allPossibleStates(ts - tc.zeroTime)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+	return alertCombinations([][]*v1.Alert{
+		possibleSeriesAlerts(dep.canBeInactive, dep.canBePending, dep.canBeFiring, v1.Alert{
+			Labels:      tc.depAlertLabels(),
+			Annotations: labels.FromStrings("description", "The value is 15"),
+			Value:       "15",
+			ActiveAt:    &activeAt,
+		}),
+		possibleSeriesAlerts(ind.canBeInactive, ind.canBePending, ind.canBeFiring, v1.Alert{
+			Labels:      tc.indAlertLabels(),
+			Annotations: labels.FromStrings("description", "The value is 15"),
+			Value:       "15",
+			ActiveAt:    &activeAt,
+		}),
+	}, nil)
+}
+
+func (tc *erroringRecordingRule) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *erroringRecordingRule) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getAlertingRule := func(alertName, query, state string, alerts []*v1.Alert) v1.AlertingRule {
+		return v1.AlertingRule{
+			State:       state,
+			Name:        alertName,
+			Query:       query,
+			Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+			Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+			Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+			Alerts:      alerts,
+			Health:      "ok",
+			Type:        "alerting",
+		}
+	}
+
+	var recordingRules []v1.RecordingRule
+	canBeOk, canBeErr := tc.possibleRecordingHealth(ts - tc.zeroTime)
+	if canBeOk {
+		recordingRules = append(recordingRules, v1.RecordingRule{
+			Name:   tc.recordName,
+			Query:  tc.recordQuery,
+			Labels: labels.FromStrings("replica", "merged", "rulegroup", tc.groupName),
+			Health: "ok",
+			Type:   "recording",
+		})
+	}
+	if canBeErr {
+		recordingRules = append(recordingRules, v1.RecordingRule{
+			Name:      tc.recordName,
+			Query:     tc.recordQuery,
+			Labels:    labels.FromStrings("replica", "merged", "rulegroup", tc.groupName),
+			Health:    "err",
+			LastError: tc.recordErrSnippet,
+			Type:      "recording",
+		})
+	}
+
+	for _, c := range tc.possibleAlerts(ts) {
+		// The alerts are split by the alertname into their rules.
+		depState, indState := "inactive", "inactive"
+		var depAlerts, indAlerts []*v1.Alert
+		for i := range c {
+			if c[i].Labels.Get("alertname") == tc.depAlertName {
+				depState = c[i].State
+				depAlerts = append(depAlerts, &c[i])
+				continue
+			}
+			indState = c[i].State
+			indAlerts = append(indAlerts, &c[i])
+		}
+		for _, rr := range recordingRules {
+			expRgs = append(expRgs, v1.RuleGroup{
+				Name:     tc.groupName,
+				Interval: float64(tc.groupInterval / time.Second),
+				Rules: []v1.Rule{
+					rr,
+					getAlertingRule(tc.depAlertName, tc.depQuery, depState, depAlerts),
+					getAlertingRule(tc.indAlertName, tc.indQuery, indState, indAlerts),
+				},
+			})
+		}
+	}
+	return expRgs
+}
+
+func (tc *erroringRecordingRule) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+func (tc *erroringRecordingRule) expRecorded(ts int64) (expSamples [][]promql.Sample) {
+	between := betweenFunc(ts - tc.zeroTime)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	resolved := tc.depResolvedTime().Seconds()
+	// The first sample can take up to 1 group interval to be remote written and 1 more to be recorded.
+	canBeAbsent := between(0, 2*grpItvlSecFloat) || between(resolved-1, tc.testDuration().Seconds())
+	canBePresent := between(0, resolved+2*grpItvlSecFloat)
+
+	if canBeAbsent {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePresent {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("alertname", tc.depAlertName, "replica", "merged", "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *erroringRecordingRule) possibleRecordingHealth(ts int64) (canBeOk, canBeErr bool) {
+	between := betweenFunc(ts)
+	errTime := tc.errorTime().Seconds()
+	canBeOk = between(0, errTime+float64(tc.groupInterval/time.Second))
+	canBeErr = between(errTime-1, tc.testDuration().Seconds())
+	return
+}
+
+type seriesStates struct {
+	canBeInactive, canBePending, canBeFiring bool
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *erroringRecordingRule) allPossibleStates(ts int64) (dep, ind seriesStates) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	// The dependent alert can also be an evaluation late since it sees the recorded series of the evaluation.
+	active := tc.activeTime().Seconds()           // Goes into pending.
+	firing := tc.firingTime().Seconds()           // Goes into firing.
+	depResolved := tc.depResolvedTime().Seconds() // The dependent alert is resolved.
+	indResolved := tc.indResolvedTime().Seconds() // The independent alert is resolved.
+	dep.canBeInactive = between(0, active+2*grpItvlSecFloat) ||
+		between(depResolved-1, tc.testDuration().Seconds())
+	dep.canBePending = between(active-1, firing+2*grpItvlSecFloat)
+	dep.canBeFiring = between(firing-1, depResolved+2*grpItvlSecFloat)
+
+	ind.canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(indResolved-1, tc.testDuration().Seconds())
+	ind.canBePending = between(active-1, firing+grpItvlSecFloat)
+	ind.canBeFiring = between(firing-1, indResolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *erroringRecordingRule) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	firing := int64(tc.firingTime() / time.Millisecond)
+	for _, a := range []struct {
+		lbls      labels.Labels
+		resolved  int64
+		tolerance time.Duration
+	}{
+		// The dependent alert sees the recorded series of the evaluation, which can make it an evaluation late.
+		{tc.depAlertLabels(), int64(tc.depResolvedTime() / time.Millisecond), 2 * tc.groupInterval},
+		{tc.indAlertLabels(), int64(tc.indResolvedTime() / time.Millisecond), tc.groupInterval},
+	} {
+		resolvedPlus15m := a.resolved + int64(15*time.Minute/time.Millisecond)
+		for ts := firing; ts < a.resolved; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: a.tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != firing,
+				NextState:     timestamp.Time(tc.zeroTime + a.resolved),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + a.resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      a.lbls,
+					Annotations: labels.FromStrings("description", "The value is 15"),
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+
+		for ts := a.resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+			tolerance := a.tolerance
+			if ts == a.resolved {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+				// based on this first resolved alert.
+				tolerance = a.tolerance + tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != a.resolved,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + a.resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      a.lbls,
+					Annotations: labels.FromStrings("description", "The value is 15"),
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+	}
+
+	return exp
+}
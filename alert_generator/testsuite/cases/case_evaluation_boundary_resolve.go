@@ -0,0 +1,275 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// EvaluationBoundaryResolve tests the following cases:
+// * The alert gets resolved at the first evaluation at or after the instant its condition stops holding,
+//   and the resolved alert is sent within a group interval of that instant with the EndsAt of that evaluation,
+//   including when the evaluation is exactly at that instant.
+// Note: The evaluation times of the alert generator are not known to the test suite, and a sample that ends the
+// condition can be ingested after the evaluation at its timestamp, which is why the other test cases allow the
+// resolved alert to be up to 2 group intervals late. Here the condition ends at a fixed time via time() without
+// any sample to ingest, maxSampleAge after the last sample, hence the resolved alert is expected without that slack.
+func EvaluationBoundaryResolve() TestCase {
+	groupName := "EvaluationBoundaryResolve"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &evaluationBoundaryResolve{
+		groupName:     groupName,
+		alertName:     alertName,
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		maxSampleAge:  10 * time.Second,
+	}
+	tc.query = fmt.Sprintf("%s > 10 unless time() - timestamp(%s) >= %d", lbls.String(), lbls.String(), int(tc.maxSampleAge.Seconds()))
+	tc.forDuration = model.Duration(30 * time.Second)
+	return tc
+}
+
+type evaluationBoundaryResolve struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	// maxSampleAge is the age of the last sample at which the condition stops holding. It must be more than
+	// rwInterval plus the delay of the ingestion so that the condition holds while the samples are written.
+	maxSampleAge time.Duration
+	totalSamples int
+
+	zeroTime int64
+}
+
+func (tc *evaluationBoundaryResolve) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) The alert gets resolved at the first evaluation at or after the instant its condition stops holding, which is a fixed time via time() that does not depend on the ingestion. " +
+			"(2) The resolved alert is sent within a group interval of that instant with the EndsAt of that evaluation, including when the evaluation is exactly at that instant."
+}
+
+func (tc *evaluationBoundaryResolve) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *evaluationBoundaryResolve) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"3", "0x3", // 1m (3 is @0 time).
+		"11", "0x23", // 6m above the threshold. Goes into pending at 1m and into firing at 1m30s.
+		// No more samples. Resolved when the last sample is maxSampleAge old.
+	)
+	// The test goes on for 2 resend delays after the last sample to check the resolution.
+	tc.totalSamples = len(samples) + 2*int(ResendDelay/tc.rwInterval)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *evaluationBoundaryResolve) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *evaluationBoundaryResolve) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *evaluationBoundaryResolve) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *evaluationBoundaryResolve) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *evaluationBoundaryResolve) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// activeTime is the time relative to zeroTime when the alert becomes active, which is the first sample
+// above the threshold.
+func (tc *evaluationBoundaryResolve) activeTime() time.Duration {
+	return 4 * tc.rwInterval
+}
+
+// firingTime is the time relative to zeroTime when the alert goes into firing.
+func (tc *evaluationBoundaryResolve) firingTime() time.Duration {
+	return tc.activeTime() + time.Duration(tc.forDuration)
+}
+
+// resolvedTime is the time relative to zeroTime when the condition stops holding, which is when the last
+// sample is maxSampleAge old.
+func (tc *evaluationBoundaryResolve) resolvedTime() time.Duration {
+	return 27*tc.rwInterval + tc.maxSampleAge
+}
+
+func (tc *evaluationBoundaryResolve) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *evaluationBoundaryResolve) possibleAlerts(ts int64) [][]v1.Alert {
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(ts - tc.zeroTime)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+	return alertCombinations([][]*v1.Alert{
+		possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(),
+			Annotations: labels.FromStrings("description", "The value is 11"),
+			Value:       "11",
+			ActiveAt:    &activeAt,
+		}),
+	}, nil)
+}
+
+func (tc *evaluationBoundaryResolve) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *evaluationBoundaryResolve) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *evaluationBoundaryResolve) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *evaluationBoundaryResolve) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := tc.activeTime().Seconds()     // Goes into pending.
+	firing := tc.firingTime().Seconds()     // Goes into firing.
+	resolved := tc.resolvedTime().Seconds() // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, 2*resolved)
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *evaluationBoundaryResolve) ExpectedAlerts() []ExpectedAlert {
+	firing := int64(tc.firingTime() / time.Millisecond)
+	resolved := int64(tc.resolvedTime() / time.Millisecond)
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < resolved; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + resolved),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			// Unlike the other test cases, the first resolved alert has no additional tolerance since the
+			// condition stops holding at resolved without waiting for any sample, hence the evaluation that
+			// resolves the alert is within 1 groupInterval of resolved.
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != resolved,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			// The EndsAt is exactly resolved when the evaluation is at that instant.
+			InclusiveBoundary: true,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
@@ -0,0 +1,273 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// ExactThreshold tests the following cases:
+// * Alert with the `> 10` condition does not become active while the value is exactly 10, including when
+//   the value reaches 10 in fractional steps, which catches `>=` used instead of `>`.
+// * The alert becomes active at the first sample above the threshold, and gets resolved at the first
+//   sample back at exactly the threshold.
+func ExactThreshold() TestCase {
+	groupName := "ExactThreshold"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &exactThreshold{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(30 * time.Second)
+	return tc
+}
+
+type exactThreshold struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *exactThreshold) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert with the '> 10' condition does not become active while the value is exactly 10, including when the value reaches 10 in fractional steps. " +
+			"(2) The alert becomes active at the first sample above the threshold, and gets resolved at the first sample back at exactly the threshold."
+}
+
+func (tc *exactThreshold) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *exactThreshold) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"3", "0x3", // 1m (3 is @0 time).
+		"9", "0.1x10", // 2m45s of going up to exactly 10 at 3m30s.
+		"0x23",       // 6m at exactly the threshold, which must not make the alert active.
+		"11", "0x23", // 6m above the threshold. Goes into pending at 9m30s and into firing at 10m.
+		"10", "0x11", // 3m back at exactly the threshold. Resolved.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *exactThreshold) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *exactThreshold) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *exactThreshold) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *exactThreshold) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *exactThreshold) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// activeTime is the time relative to zeroTime when the alert becomes active, which is the first sample
+// above the threshold.
+func (tc *exactThreshold) activeTime() time.Duration {
+	return 38 * tc.rwInterval
+}
+
+// firingTime is the time relative to zeroTime when the alert goes into firing.
+func (tc *exactThreshold) firingTime() time.Duration {
+	return tc.activeTime() + time.Duration(tc.forDuration)
+}
+
+// resolvedTime is the time relative to zeroTime when the alert gets resolved, which is the first sample
+// back at the threshold.
+func (tc *exactThreshold) resolvedTime() time.Duration {
+	return 62 * tc.rwInterval
+}
+
+func (tc *exactThreshold) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *exactThreshold) possibleAlerts(ts int64) [][]v1.Alert {
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(ts - tc.zeroTime)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+	return alertCombinations([][]*v1.Alert{
+		possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(),
+			Annotations: labels.FromStrings("description", "The value is 11"),
+			Value:       "11",
+			ActiveAt:    &activeAt,
+		}),
+	}, nil)
+}
+
+func (tc *exactThreshold) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *exactThreshold) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *exactThreshold) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *exactThreshold) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := tc.activeTime().Seconds()     // Goes into pending.
+	firing := tc.firingTime().Seconds()     // Goes into firing.
+	resolved := tc.resolvedTime().Seconds() // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, 2*resolved)
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *exactThreshold) ExpectedAlerts() []ExpectedAlert {
+	firing := int64(tc.firingTime() / time.Millisecond)
+	resolved := int64(tc.resolvedTime() / time.Millisecond)
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < resolved; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + resolved),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == resolved {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != resolved,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
@@ -0,0 +1,317 @@
+package cases
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// ForMixedUnits tests the following cases:
+// * Alert whose for duration is written with mixed units (1m30s) goes into firing after the total
+//   for duration has elapsed since it became active, and not before.
+// * Alert whose for duration has a day unit (1d2h30m) stays pending for the whole test and is
+//   reported with the total for duration in the rules API.
+func ForMixedUnits() TestCase {
+	groupName := "ForMixedUnits"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &forMixedUnits{
+		groupName:     groupName,
+		alertName:     alertName,
+		longAlertName: groupName + "_LongAlert",
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		forDuration:   mustParseDuration("1m30s"),
+		longFor:       mustParseDuration("1d2h30m"),
+	}
+	return tc
+}
+
+func mustParseDuration(s string) model.Duration {
+	d, err := model.ParseDuration(s)
+	if err != nil {
+		panic(fmt.Sprintf("invalid duration %s, err: %s", s, err.Error()))
+	}
+	return d
+}
+
+type forMixedUnits struct {
+	groupName                 string
+	alertName, longAlertName  string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration, longFor      model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *forMixedUnits) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert whose for duration is written with mixed units (1m30s) goes into firing after the total for duration has elapsed since it became active, and not before. " +
+			"(2) Alert whose for duration has a day unit (1d2h30m) stays pending for the whole test and is reported with the total for duration in the rules API."
+}
+
+func (tc *forMixedUnits) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert, longAlert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := longAlert.Encode(tc.longAlertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+			{
+				Alert:       longAlert,
+				Expr:        expr,
+				For:         tc.longFor,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *forMixedUnits) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"3", "0x3", // 1m (3 is @0 time).
+		"15", "0x35", // 9m of active. Goes into pending at 1m and into firing at 2m30s at the earliest.
+		"5", "0x11", // 3m of resolved.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *forMixedUnits) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *forMixedUnits) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *forMixedUnits) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *forMixedUnits) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *forMixedUnits) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// activeTime is the time relative to zeroTime when the alerts become active.
+func (tc *forMixedUnits) activeTime() time.Duration {
+	return 4 * tc.rwInterval
+}
+
+// firingTime is the earliest time relative to zeroTime when the alert with the mixed units for duration
+// can go into firing. It is computed from the parsed total for duration rounded up to the group interval.
+func (tc *forMixedUnits) firingTime() time.Duration {
+	evals := math.Ceil(float64(tc.forDuration) / float64(tc.groupInterval))
+	return tc.activeTime() + time.Duration(evals)*tc.groupInterval
+}
+
+// resolvedTime is the time relative to zeroTime when the alerts get resolved.
+func (tc *forMixedUnits) resolvedTime() time.Duration {
+	return 40 * tc.rwInterval
+}
+
+func (tc *forMixedUnits) alertLabels(alertName string) labels.Labels {
+	return labels.FromStrings("alertname", alertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *forMixedUnits) possibleAlerts(ts int64) [][]v1.Alert {
+	canBeInactive, canBePending, canBeFiring, longCanBePending := tc.allPossibleStates(ts - tc.zeroTime)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+	return alertCombinations([][]*v1.Alert{
+		possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(tc.alertName),
+			Annotations: labels.FromStrings("description", "The value is 15"),
+			Value:       "15",
+			ActiveAt:    &activeAt,
+		}),
+		possibleSeriesAlerts(canBeInactive, longCanBePending, false, v1.Alert{
+			Labels:      tc.alertLabels(tc.longAlertName),
+			Annotations: labels.FromStrings("description", "The value is 15"),
+			Value:       "15",
+			ActiveAt:    &activeAt,
+		}),
+	}, nil)
+}
+
+func (tc *forMixedUnits) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *forMixedUnits) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRule := func(alertName string, forDuration model.Duration, state string, alerts []*v1.Alert) v1.AlertingRule {
+		return v1.AlertingRule{
+			State:       state,
+			Name:        alertName,
+			Query:       tc.query,
+			Duration:    float64(time.Duration(forDuration) / time.Second),
+			Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+			Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+			Alerts:      alerts,
+			Health:      "ok",
+			Type:        "alerting",
+		}
+	}
+
+	for _, c := range tc.possibleAlerts(ts) {
+		// Both the rules have the same query, so the alerts are split by the alertname.
+		state, longState := "inactive", "inactive"
+		var alerts, longAlerts []*v1.Alert
+		for i := range c {
+			if c[i].Labels.Get("alertname") == tc.longAlertName {
+				longState = c[i].State
+				longAlerts = append(longAlerts, &c[i])
+				continue
+			}
+			state = c[i].State
+			alerts = append(alerts, &c[i])
+		}
+		expRgs = append(expRgs, v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				getRule(tc.alertName, tc.forDuration, state, alerts),
+				getRule(tc.longAlertName, tc.longFor, longState, longAlerts),
+			},
+		})
+	}
+	return expRgs
+}
+
+func (tc *forMixedUnits) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *forMixedUnits) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring, longCanBePending bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := tc.activeTime().Seconds()     // Goes into pending.
+	firing := tc.firingTime().Seconds()     // Goes into firing.
+	resolved := tc.resolvedTime().Seconds() // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, 2*resolved)
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	// The long for duration does not elapse within the test.
+	longCanBePending = between(active-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *forMixedUnits) ExpectedAlerts() []ExpectedAlert {
+	firing := int64(tc.firingTime() / time.Millisecond)
+	resolved := int64(tc.resolvedTime() / time.Millisecond)
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	// Only the alert with the mixed units for duration is sent, the long one never fires.
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < resolved; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + resolved),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(tc.alertName),
+				Annotations: labels.FromStrings("description", "The value is 15"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == resolved {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != resolved,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(tc.alertName),
+				Annotations: labels.FromStrings("description", "The value is 15"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
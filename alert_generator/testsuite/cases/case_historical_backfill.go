@@ -0,0 +1,337 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// HistoricalBackfill tests the following cases:
+// * Historical samples (with timestamps before the test starts) that are above the threshold for longer than
+//   the for duration until just before the start are remote written at the start of the test, and no alert
+//   is sent for that historical period.
+// * The rule is only evaluated forward from the start, and the alert goes from pending->firing->inactive
+//   based on the samples after the start.
+func HistoricalBackfill() TestCase {
+	groupName := "HistoricalBackfill"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &historicalBackfill{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(6 * tc.rwInterval)
+	return tc
+}
+
+type historicalBackfill struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *historicalBackfill) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Historical samples (with timestamps before the test starts) that are above the threshold for longer than the for duration until just before the start are remote written at the start of the test, and no alert is sent for that historical period. " +
+			"(2) The rule is only evaluated forward from the start, and the alert goes from pending->firing->inactive based on the samples after the start."
+}
+
+func (tc *historicalBackfill) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *historicalBackfill) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"1", "0x11", // 3m of inactive.
+		"11", "0x27", // Pending @3m, firing @4m30s.
+		"1", "0x19", // Resolved @10m until the end of test.
+	)
+	tc.totalSamples = len(samples)
+
+	// The historical samples are above the threshold for much longer than the for duration until
+	// 2 samples before the start, i.e. within the 5m lookback of the first evaluations. The last
+	// historical sample is below the threshold. Since the rule is only evaluated forward and the
+	// historical samples are written together at the start, the alert must not become active.
+	historical := sampleSlice(tc.rwInterval, "20", "0x46", "1")
+	offset := int64(time.Duration(len(historical)) * tc.rwInterval / time.Millisecond)
+	for i := range historical {
+		historical[i].Timestamp -= offset
+	}
+
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: append(historical, samples...),
+		},
+	}
+}
+
+func (tc *historicalBackfill) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *historicalBackfill) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *historicalBackfill) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *historicalBackfill) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *historicalBackfill) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// activeTime is the time relative to zeroTime when the alert becomes active.
+func (tc *historicalBackfill) activeTime() time.Duration {
+	return 12 * tc.rwInterval
+}
+
+func (tc *historicalBackfill) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBePending {
+		expAlerts = append(expAlerts, []v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				State:       "pending",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			},
+		})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, []v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				State:       "firing",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			},
+		})
+	}
+
+	return expAlerts
+}
+
+func (tc *historicalBackfill) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBePending {
+		expRgs = append(expRgs, getRg("pending", []*v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				State:       "pending",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			},
+		}))
+	}
+	if canBeFiring {
+		expRgs = append(expRgs, getRg("firing", []*v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				State:       "firing",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			},
+		}))
+	}
+
+	return expRgs
+}
+
+func (tc *historicalBackfill) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePending {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "pending", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+	if canBeFiring {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *historicalBackfill) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	active := tc.activeTime().Seconds()                                   // Goes into pending.
+	firing := (tc.activeTime() + time.Duration(tc.forDuration)).Seconds() // Goes into firing.
+	_40th := 40 * rwItvlSecFloat                                          // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(_40th-1, 240*rwItvlSecFloat)
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, _40th+grpItvlSecFloat)
+	return
+}
+
+func (tc *historicalBackfill) ExpectedAlerts() []ExpectedAlert {
+	firing := int64((tc.activeTime() + time.Duration(tc.forDuration)) / time.Millisecond) // Firing.
+	_40th := 40 * int64(tc.rwInterval/time.Millisecond)                                   // Resolved.
+	_40thPlus15m := _40th + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < _40th; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + _40th),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _40th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := _40th; ts < _40thPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _40th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != _40th,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _40th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
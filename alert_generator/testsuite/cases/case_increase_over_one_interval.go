@@ -0,0 +1,338 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// IncreaseOverOneInterval tests the following cases:
+// * Alert based on increase() whose range is exactly the group interval that goes from pending->firing->inactive.
+// * Every evaluation has only two samples of the counter in the range, and the increase is extrapolated
+//   to the entire range as per the two-sample formula: (v2-v1) * range / (t2-t1).
+// * The alert becomes active only when the counter has increased fast between the two samples in the range,
+//   and gets resolved as soon as it has increased slowly between them.
+func IncreaseOverOneInterval() TestCase {
+	groupName := "IncreaseOverOneInterval"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &increaseOverOneInterval{
+		groupName:     groupName,
+		alertName:     alertName,
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	// The counter increases by 1 every sample when slow and by 3 when fast. With two samples in the range,
+	// that is an increase of 2 and 6 respectively after extrapolation.
+	tc.query = fmt.Sprintf("increase(%s[%s]) > 4", lbls.String(), model.Duration(tc.groupInterval).String())
+	tc.forDuration = model.Duration(6 * tc.rwInterval)
+	return tc
+}
+
+type increaseOverOneInterval struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *increaseOverOneInterval) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert based on increase() whose range is exactly the group interval that goes from pending->firing->inactive. " +
+			"(2) Every evaluation has only two samples of the counter in the range, and the increase is extrapolated to the entire range. " +
+			"(3) The alert becomes active only when the counter has increased fast between the two samples in the range, and gets resolved as soon as it has increased slowly between them."
+}
+
+func (tc *increaseOverOneInterval) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": `The counter increased by {{ $value | printf "%.0f" }} in one interval`},
+			},
+		},
+	}, nil
+}
+
+func (tc *increaseOverOneInterval) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"0", "1x20", // 5m15s of slow counter.
+		"3x24", // 6m of fast counter.
+		"1x15", // 3m45s of slow counter.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+// WarmupDuration is the range of increase() so that the first evaluation has a full range of samples.
+// The counter does not increase during the warmup, hence it does not change the expectations.
+func (tc *increaseOverOneInterval) WarmupDuration() time.Duration {
+	return tc.groupInterval
+}
+
+func (tc *increaseOverOneInterval) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *increaseOverOneInterval) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *increaseOverOneInterval) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *increaseOverOneInterval) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *increaseOverOneInterval) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// activeTime is the time relative to zeroTime after which the counter has increased fast between the two samples
+// in the range, i.e. the 21st and 22nd samples. An evaluation exactly at the 22nd sample has 3 samples in the range,
+// giving an increase of 4 without extrapolation, hence the alert is active only after that.
+// The same applies when it gets resolved at the 46th sample.
+func (tc *increaseOverOneInterval) activeTime() time.Duration {
+	return 21 * tc.rwInterval
+}
+
+func (tc *increaseOverOneInterval) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBePending {
+		expAlerts = append(expAlerts, []v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The counter increased by 6 in one interval"),
+				State:       "pending",
+				Value:       "6",
+				ActiveAt:    &activeAt,
+			},
+		})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, []v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The counter increased by 6 in one interval"),
+				State:       "firing",
+				Value:       "6",
+				ActiveAt:    &activeAt,
+			},
+		})
+	}
+
+	return expAlerts
+}
+
+func (tc *increaseOverOneInterval) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", `The counter increased by {{ $value | printf "%.0f" }} in one interval`),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBePending {
+		expRgs = append(expRgs, getRg("pending", []*v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The counter increased by 6 in one interval"),
+				State:       "pending",
+				Value:       "6",
+				ActiveAt:    &activeAt,
+			},
+		}))
+	}
+	if canBeFiring {
+		expRgs = append(expRgs, getRg("firing", []*v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The counter increased by 6 in one interval"),
+				State:       "firing",
+				Value:       "6",
+				ActiveAt:    &activeAt,
+			},
+		}))
+	}
+
+	return expRgs
+}
+
+func (tc *increaseOverOneInterval) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePending {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "pending", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+	if canBeFiring {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *increaseOverOneInterval) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	active := tc.activeTime().Seconds()                                   // Goes into pending.
+	firing := (tc.activeTime() + time.Duration(tc.forDuration)).Seconds() // Goes into firing.
+	_45th := 45 * rwItvlSecFloat                                          // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(_45th-1, 240*rwItvlSecFloat)
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, _45th+grpItvlSecFloat)
+	return
+}
+
+func (tc *increaseOverOneInterval) ExpectedAlerts() []ExpectedAlert {
+	firing := int64((tc.activeTime() + time.Duration(tc.forDuration)) / time.Millisecond) // Firing.
+	_45th := 45 * int64(tc.rwInterval/time.Millisecond)                                   // Resolved.
+	_45thPlus15m := _45th + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < _45th; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + _45th),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _45th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The counter increased by 6 in one interval"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := _45th; ts < _45thPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _45th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != _45th,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _45th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The counter increased by 6 in one interval"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
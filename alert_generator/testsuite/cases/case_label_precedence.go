@@ -0,0 +1,312 @@
+package cases
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// LabelPrecedence tests the following cases:
+// * Alert that goes from pending->firing->inactive, where the labels of the alerts and the ALERTS series
+//   are the labels of the expr result merged with the labels of the rule.
+// * When both the expr result and the rule define a label, the value from the rule wins.
+// * When only one of the expr result or the rule defines a label, that value is used.
+func LabelPrecedence() TestCase {
+	groupName := "LabelPrecedence"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &labelPrecedence{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(12 * tc.rwInterval)
+	return tc
+}
+
+type labelPrecedence struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+// labelPrecedenceSeries describes the source series of an alert in labelPrecedence.
+type labelPrecedenceSeries struct {
+	sourceLabels labels.Labels // The labels of the series in addition to the metric labels.
+	alertLabels  labels.Labels // The labels of the alert in addition to alertname, foo and rulegroup.
+}
+
+func (tc *labelPrecedence) series() []labelPrecedenceSeries {
+	return []labelPrecedenceSeries{
+		// The severity from the rule overrides the one from the series.
+		{
+			sourceLabels: labels.FromStrings("series", "a", "severity", "page", "team", "db"),
+			alertLabels:  labels.FromStrings("series", "a", "severity", "warning", "team", "db"),
+		},
+		// The severity only comes from the rule and the team only from the series.
+		{
+			sourceLabels: labels.FromStrings("series", "b", "team", "web"),
+			alertLabels:  labels.FromStrings("series", "b", "severity", "warning", "team", "web"),
+		},
+		// Neither the severity nor the team comes from the series.
+		{
+			sourceLabels: labels.FromStrings("series", "c"),
+			alertLabels:  labels.FromStrings("series", "c", "severity", "warning"),
+		},
+	}
+}
+
+const (
+	labelPrecedenceActiveIdx  = 4  // Index of the sample which brings the series above the threshold.
+	labelPrecedenceResolveIdx = 32 // Index of the sample which brings the series below the threshold.
+)
+
+func (tc *labelPrecedence) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert that goes from pending->firing->inactive, where the labels of the alerts and the ALERTS series are the labels of the expr result merged with the labels of the rule. " +
+			"(2) When both the expr result and the rule define a label, the value from the rule wins. " +
+			"(3) When only one of the expr result or the rule defines a label, that value is used."
+}
+
+func (tc *labelPrecedence) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName, "severity": "warning"},
+				Annotations: map[string]string{"description": "Series {{$labels.series}} has the value {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *labelPrecedence) SamplesToRemoteWrite() []prompb.TimeSeries {
+	var res []prompb.TimeSeries
+	for _, s := range tc.series() {
+		series := append(tc.metricLabels.Copy(), s.sourceLabels...)
+		sort.Sort(series)
+		samples := sampleSlice(tc.rwInterval,
+			// All comment times is assuming 15s interval.
+			"3", "0x3", // 1m (3 is @0 time).
+			"15", "0x27", // 7m of active. Goes into pending at 1m and into firing at 4m.
+			"5", "0x19", // 5m of resolved.
+		)
+		tc.totalSamples = len(samples)
+		res = append(res, prompb.TimeSeries{
+			Labels:  toProtoLabels(series),
+			Samples: samples,
+		})
+	}
+	return res
+}
+
+func (tc *labelPrecedence) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *labelPrecedence) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *labelPrecedence) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *labelPrecedence) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *labelPrecedence) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *labelPrecedence) alertLabels(s labelPrecedenceSeries) labels.Labels {
+	lbls := append(labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName), s.alertLabels...)
+	sort.Sort(lbls)
+	return lbls
+}
+
+func (tc *labelPrecedence) alertAnnotations(s labelPrecedenceSeries) labels.Labels {
+	return labels.FromStrings("description", fmt.Sprintf("Series %s has the value 15", s.sourceLabels.Get("series")))
+}
+
+// possibleAlerts returns all the possible combinations of the alerts of all the series.
+// All the series have the same samples, hence their alerts are always in the same state.
+func (tc *labelPrecedence) possibleAlerts(ts int64) [][]v1.Alert {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + labelPrecedenceActiveIdx*int64(tc.rwInterval/time.Millisecond))
+
+	var perSeries [][]*v1.Alert
+	for _, s := range tc.series() {
+		perSeries = append(perSeries, possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(s),
+			Annotations: tc.alertAnnotations(s),
+			Value:       "15",
+			ActiveAt:    &activeAt,
+		}))
+	}
+
+	return alertCombinations(perSeries, func(c []*v1.Alert) bool {
+		for i := 1; i < len(c); i++ {
+			if (c[0] == nil) != (c[i] == nil) || (c[0] != nil && c[0].State != c[i].State) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (tc *labelPrecedence) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *labelPrecedence) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName, "severity", "warning"),
+					Annotations: labels.FromStrings("description", "Series {{$labels.series}} has the value {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *labelPrecedence) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *labelPrecedence) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	active := labelPrecedenceActiveIdx * rwItvlSecFloat        // Goes into pending.
+	firing := active + time.Duration(tc.forDuration).Seconds() // Goes into firing.
+	resolved := labelPrecedenceResolveIdx * rwItvlSecFloat     // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, 240*rwItvlSecFloat)
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *labelPrecedence) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	firing := labelPrecedenceActiveIdx*int64(tc.rwInterval/time.Millisecond) + int64(time.Duration(tc.forDuration)/time.Millisecond)
+	resolved := labelPrecedenceResolveIdx * int64(tc.rwInterval/time.Millisecond)
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+	for _, s := range tc.series() {
+		for ts := firing; ts < resolved; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != firing,
+				NextState:     timestamp.Time(tc.zeroTime + resolved),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(s),
+					Annotations: tc.alertAnnotations(s),
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+
+		for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+			tolerance := tc.groupInterval
+			if ts == resolved {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+				// based on this first resolved alert.
+				tolerance = 2 * tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != resolved,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(s),
+					Annotations: tc.alertAnnotations(s),
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+	}
+
+	return exp
+}
@@ -0,0 +1,169 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// LabelsAnnotationsSeparation tests the following cases:
+// * Alert with several rule labels and several annotations that goes from pending->firing->inactive, where the
+//   labels of the alert are exactly the series labels and the rule labels, and the annotations are exactly the
+//   rule annotations, in the API and as sent. An annotation promoted to a label, or a rule label demoted to an
+//   annotation, is reported as such.
+func LabelsAnnotationsSeparation() TestCase {
+	groupName := "LabelsAnnotationsSeparation"
+	alertName := groupName + "_Alert"
+	tc := &labelsAnnotationsSeparation{
+		groupName:     groupName,
+		alertName:     alertName,
+		metricLabels:  metricLabels(groupName, alertName),
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		forDuration:   model.Duration(30 * time.Second),
+		ruleLabels: map[string]string{
+			"foo":       "bar",
+			"rulegroup": groupName,
+			"severity":  "critical",
+			"team":      "observability",
+		},
+		ruleAnnotations: map[string]string{
+			"summary":     "The value is high",
+			"description": "The value is {{$value}}",
+			"runbook_url": "https://runbooks.example.com/" + groupName,
+		},
+	}
+	tc.query = fmt.Sprintf("%s > 10", tc.metricLabels.String())
+	tc.stateMachine = tc.newStateMachine()
+	return tc
+}
+
+// newStateMachine returns the expected states of the alert, which goes into pending at the 13th sample, into
+// firing after the 'for' duration, and gets resolved at the 37th sample.
+func (tc *labelsAnnotationsSeparation) newStateMachine() *StateMachine {
+	_13th := 12 * tc.rwInterval
+	_37th := 36 * tc.rwInterval
+	alertLabels := labels.NewBuilder(labels.FromMap(tc.ruleLabels)).Set("alertname", tc.alertName).Labels()
+	annotations := labels.FromMap(tc.ruleAnnotations)
+	return &StateMachine{
+		GroupName:     tc.groupName,
+		GroupInterval: tc.groupInterval,
+		Rules: []RuleStateMachine{
+			{
+				Rule: v1.AlertingRule{
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromMap(tc.ruleLabels),
+					Annotations: annotations,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+				Alerts: []AlertStateMachine{
+					{
+						Labels:      alertLabels,
+						Annotations: labels.NewBuilder(annotations).Set("description", "The value is 15").Labels(),
+						Transitions: []Transition{
+							{From: AlertInactive, To: AlertPending, At: _13th, Value: "15"},
+							{From: AlertPending, To: AlertFiring, At: _13th + time.Duration(tc.forDuration)},
+							{From: AlertFiring, To: AlertInactive, At: _37th},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+type labelsAnnotationsSeparation struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	ruleLabels                map[string]string
+	ruleAnnotations           map[string]string
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+	stateMachine              *StateMachine
+
+	zeroTime int64
+}
+
+func (tc *labelsAnnotationsSeparation) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert with several rule labels and several annotations that goes from pending->firing->inactive, where the labels of the alert are exactly the series labels and the rule labels, " +
+			"and the annotations are exactly the rule annotations, in the API and as sent."
+}
+
+func (tc *labelsAnnotationsSeparation) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      tc.ruleLabels,
+				Annotations: tc.ruleAnnotations,
+			},
+		},
+	}, nil
+}
+
+func (tc *labelsAnnotationsSeparation) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		"5", "0x11", // 1m of below the threshold.
+		"15", "0x23", // 2m of above the threshold.
+		"5", "0x23", // 2m of below the threshold.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *labelsAnnotationsSeparation) Init(zt int64) {
+	tc.zeroTime = zt
+	tc.stateMachine.Init(zt)
+}
+
+func (tc *labelsAnnotationsSeparation) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *labelsAnnotationsSeparation) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	return tc.stateMachine.CheckAlerts(ts, alerts)
+}
+
+func (tc *labelsAnnotationsSeparation) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	return tc.stateMachine.CheckRuleGroup(ts, rg, opts)
+}
+
+func (tc *labelsAnnotationsSeparation) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	return tc.stateMachine.CheckMetrics(ts, samples, opts)
+}
+
+func (tc *labelsAnnotationsSeparation) ExpectedAlerts() []ExpectedAlert {
+	return tc.stateMachine.ExpectedAlerts()
+}
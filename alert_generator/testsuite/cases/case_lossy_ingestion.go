@@ -0,0 +1,332 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// LossyIngestion tests the following cases:
+// * Alert that goes from pending->firing->inactive while the batches of its samples are randomly dropped
+//   or delayed by the test suite, if configured, within MaxIngestDropRate and MaxIngestDelay.
+// * The alert still reaches the correct state eventually, where the state changes are allowed
+//   to be late by the max delay and a few dropped samples.
+func LossyIngestion() TestCase {
+	groupName := "LossyIngestion"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &lossyIngestion{
+		groupName:    groupName,
+		alertName:    alertName,
+		query:        fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels: lbls,
+		// The samples are dense so that a few dropped samples do not shift the state changes by much.
+		rwInterval:    time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(60 * tc.rwInterval)
+	// A state change can be seen late by the max delay plus the max consecutive dropped batches.
+	tc.faultSlack = MaxIngestDelay + MaxIngestConsecutiveDrops*tc.rwInterval
+	return tc
+}
+
+type lossyIngestion struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+	faultSlack                time.Duration // Max delay in the state changes because of the ingestion faults.
+
+	zeroTime int64
+}
+
+func (tc *lossyIngestion) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert that goes from pending->firing->inactive while the batches of its samples are randomly dropped or delayed by the test suite, if configured. " +
+			"(2) The alert still reaches the correct state eventually, where the state changes are allowed to be late by the max delay and a few dropped samples."
+}
+
+func (tc *lossyIngestion) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *lossyIngestion) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		"1", "0x19", // 20s of inactive.
+		"11", "0x199", // Pending @20s, firing @1m20s.
+		"1", "0x79", // Resolved @3m40s until the end of test.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *lossyIngestion) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *lossyIngestion) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+// ToleratesIngestFaults implements IngestFaultTolerant.
+func (tc *lossyIngestion) ToleratesIngestFaults() {}
+
+func (tc *lossyIngestion) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval+tc.faultSlack)
+}
+
+func (tc *lossyIngestion) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroupWithTolerance(timestamp.Time(ts), expRgs, *rg, tc.groupInterval+tc.faultSlack, opts)
+}
+
+func (tc *lossyIngestion) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// activeTime is the time relative to zeroTime when the alert becomes active without any ingestion faults.
+func (tc *lossyIngestion) activeTime() time.Duration {
+	return 20 * tc.rwInterval
+}
+
+func (tc *lossyIngestion) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBePending {
+		expAlerts = append(expAlerts, []v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				State:       "pending",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			},
+		})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, []v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				State:       "firing",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			},
+		})
+	}
+
+	return expAlerts
+}
+
+func (tc *lossyIngestion) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBePending {
+		expRgs = append(expRgs, getRg("pending", []*v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				State:       "pending",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			},
+		}))
+	}
+	if canBeFiring {
+		expRgs = append(expRgs, getRg("firing", []*v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				State:       "firing",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			},
+		}))
+	}
+
+	return expRgs
+}
+
+func (tc *lossyIngestion) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePending {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "pending", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+	if canBeFiring {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *lossyIngestion) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat := float64(tc.rwInterval / time.Second)
+	tolerance := (tc.groupInterval + tc.faultSlack).Seconds()
+	active := tc.activeTime().Seconds()                                   // Goes into pending.
+	firing := (tc.activeTime() + time.Duration(tc.forDuration)).Seconds() // Goes into firing.
+	_220th := 220 * rwItvlSecFloat                                        // Resolved.
+	canBeInactive = between(0, active+tolerance) ||
+		between(_220th-1, 600*rwItvlSecFloat)
+	canBePending = between(active-1, firing+tolerance)
+	canBeFiring = between(firing-1, _220th+tolerance)
+	return
+}
+
+func (tc *lossyIngestion) ExpectedAlerts() []ExpectedAlert {
+	firing := int64((tc.activeTime() + time.Duration(tc.forDuration)) / time.Millisecond) // Firing.
+	_220th := 220 * int64(tc.rwInterval/time.Millisecond)                                 // Resolved.
+	_220thPlus15m := _220th + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < _220th; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval + tc.faultSlack,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + _220th),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _220th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := _220th; ts < _220thPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval + tc.faultSlack
+		if ts == _220th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2*tc.groupInterval + tc.faultSlack
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != _220th,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _220th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is 11"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
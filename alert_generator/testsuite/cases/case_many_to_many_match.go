@@ -0,0 +1,329 @@
+package cases
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// ManyToManyMatch tests the following cases:
+// * Alerting rule with a one-to-one comparison whose right hand side has two series for the same match group,
+//   which is a many-to-many match, is reported with the "err" health and the many-to-many error via API,
+//   and never becomes active even though the left hand side is above the threshold.
+// * Once the duplicate series on the right hand side ends with a stale marker, the match is one-to-one,
+//   and the rule recovers to the "ok" health with the alert going from pending->firing->inactive.
+// The stale marker ends the duplicate series at a known time irrespective of the lookback delta.
+func ManyToManyMatch() TestCase {
+	groupName := "ManyToManyMatch"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	lhsLabels := labels.NewBuilder(lbls).Set("instance", "a").Set("side", "lhs").Labels()
+	rhsLabels := labels.NewBuilder(lbls).Set("instance", "a").Set("side", "rhs").Labels()
+	rhsSelector := labels.NewBuilder(rhsLabels).Del("instance").Labels()
+	return &manyToManyMatch{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > on(instance) %s", lhsLabels.String(), rhsSelector.String()),
+		lhsLabels:     lhsLabels,
+		rhsLabels:     rhsLabels,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		forDuration:   model.Duration(30 * time.Second),
+		aboveIdx:      4,
+		fixIdx:        24,
+		resolveIdx:    72,
+		totalSamples:  84,
+		errSnippet:    "many-to-many matching not allowed",
+	}
+}
+
+type manyToManyMatch struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	lhsLabels, rhsLabels      labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+
+	// Indices of the samples.
+	aboveIdx     int // The left hand side goes above the threshold.
+	fixIdx       int // The stale marker of the duplicate series on the right hand side.
+	resolveIdx   int // The left hand side goes below the threshold.
+	totalSamples int
+
+	// Expected substring of the error of the alerting rule.
+	errSnippet string
+
+	zeroTime int64
+}
+
+func (tc *manyToManyMatch) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alerting rule with a one-to-one comparison whose right hand side has two series for the same match group is reported with the \"err\" health and the many-to-many error via API, and never becomes active even though the left hand side is above the threshold. " +
+			"(2) Once the duplicate series ends with a stale marker, the rule recovers to the \"ok\" health and the alert goes from pending->firing->inactive."
+}
+
+func (tc *manyToManyMatch) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *manyToManyMatch) SamplesToRemoteWrite() []prompb.TimeSeries {
+	// All comment times is assuming 15s interval.
+	lhsSamples := sampleSlice(tc.rwInterval,
+		"5", fmt.Sprintf("0x%d", tc.aboveIdx-1), // 1m below the threshold.
+		"15", fmt.Sprintf("0x%d", tc.resolveIdx-tc.aboveIdx-1), // Above the threshold till 18m, but erroring till 6m.
+		"5", fmt.Sprintf("0x%d", tc.totalSamples-tc.resolveIdx-1), // Resolved at 18m.
+	)
+	// The duplicate series exists from the start and is marked stale at 6m.
+	duplSamples := sampleSlice(tc.rwInterval, "10", fmt.Sprintf("0x%d", tc.fixIdx-1))
+	duplSamples = append(duplSamples, prompb.Sample{
+		Timestamp: int64(time.Duration(tc.fixIdx) * tc.rwInterval / time.Millisecond),
+		Value:     math.Float64frombits(value.StaleNaN),
+	})
+
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.lhsLabels),
+			Samples: lhsSamples,
+		},
+		{
+			Labels:  toProtoLabels(labels.NewBuilder(tc.rhsLabels).Set("replica", "1").Labels()),
+			Samples: sampleSlice(tc.rwInterval, "10", fmt.Sprintf("0x%d", tc.totalSamples-1)),
+		},
+		{
+			Labels:  toProtoLabels(labels.NewBuilder(tc.rhsLabels).Set("replica", "2").Labels()),
+			Samples: duplSamples,
+		},
+	}
+}
+
+func (tc *manyToManyMatch) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *manyToManyMatch) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *manyToManyMatch) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *manyToManyMatch) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *manyToManyMatch) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// fixTime is the time relative to zeroTime from when the match is one-to-one, which makes the alert active.
+func (tc *manyToManyMatch) fixTime() time.Duration {
+	return time.Duration(tc.fixIdx) * tc.rwInterval
+}
+
+// firingTime is the time relative to zeroTime when the alert goes into firing.
+func (tc *manyToManyMatch) firingTime() time.Duration {
+	return tc.fixTime() + time.Duration(tc.forDuration)
+}
+
+// resolvedTime is the time relative to zeroTime when the alert gets resolved.
+func (tc *manyToManyMatch) resolvedTime() time.Duration {
+	return time.Duration(tc.resolveIdx) * tc.rwInterval
+}
+
+func (tc *manyToManyMatch) alertLabels() labels.Labels {
+	// The one-to-one match on the instance only keeps the instance label of the left hand side.
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "instance", "a", "rulegroup", tc.groupName)
+}
+
+func (tc *manyToManyMatch) possibleAlerts(ts int64) [][]v1.Alert {
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(ts - tc.zeroTime)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.fixTime()/time.Millisecond))
+	return alertCombinations([][]*v1.Alert{
+		possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(),
+			Annotations: labels.FromStrings("description", "The value is 15"),
+			Value:       "15",
+			ActiveAt:    &activeAt,
+		}),
+	}, nil)
+}
+
+func (tc *manyToManyMatch) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *manyToManyMatch) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	canBeOk, canBeErr := tc.possibleHealth(ts - tc.zeroTime)
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	for _, rg := range alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg) {
+		if canBeOk {
+			expRgs = append(expRgs, rg)
+		}
+		ar := rg.Rules[0].(v1.AlertingRule)
+		if canBeErr && len(ar.Alerts) == 0 {
+			// The alert never becomes active while the rule errors.
+			ar.Health = "err"
+			ar.LastError = tc.errSnippet
+			rg.Rules = []v1.Rule{ar}
+			expRgs = append(expRgs, rg)
+		}
+	}
+	return expRgs
+}
+
+func (tc *manyToManyMatch) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *manyToManyMatch) possibleHealth(ts int64) (canBeOk, canBeErr bool) {
+	between := betweenFunc(ts)
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	fix := tc.fixTime().Seconds()
+	// The duplicate series can take up to 1 group interval to be remote written.
+	canBeOk = between(0, 2*grpItvlSecFloat) || between(fix-1, (time.Duration(tc.totalSamples)*tc.rwInterval).Seconds())
+	canBeErr = between(0, fix+grpItvlSecFloat)
+	return
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *manyToManyMatch) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := tc.fixTime().Seconds()        // Goes into pending.
+	firing := tc.firingTime().Seconds()     // Goes into firing.
+	resolved := tc.resolvedTime().Seconds() // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, (time.Duration(tc.totalSamples)*tc.rwInterval).Seconds())
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *manyToManyMatch) ExpectedAlerts() []ExpectedAlert {
+	firing := int64(tc.firingTime() / time.Millisecond)
+	resolved := int64(tc.resolvedTime() / time.Millisecond)
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < resolved; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + resolved),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The value is 15"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == resolved {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != resolved,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The value is 15"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
@@ -0,0 +1,287 @@
+package cases
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// MaxSamplesExceeded tests the following cases:
+// * Alert whose query is a subquery over many series, which loads all the samples of the series in its range into
+//   memory at once. When the alert generator is configured with a max samples of a query that is less than what
+//   the query loads, e.g. Prometheus run with --query.max-samples=500, the rule errors with the max samples error.
+// * The rule recovers once most of the series stop and their samples go out of the range of the subquery.
+// * The alert goes from pending->firing->inactive after the recovery, based on the series that remain.
+// With the default max samples, the rule never errors and only the alert is tested. The expectations on the health
+// of the rule are adjusted to the max samples via SetMaxSamples, which must be more than what the remaining series
+// load, about 150 samples.
+func MaxSamplesExceeded() TestCase {
+	groupName := "MaxSamplesExceeded"
+	alertName := groupName + "_Alert"
+	tc := &maxSamplesExceeded{
+		groupName:     groupName,
+		alertName:     alertName,
+		metricLabels:  metricLabels(groupName, alertName),
+		heavySeries:   37,
+		lightSeries:   3,
+		subqueryRange: 2 * time.Minute,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		forDuration:   model.Duration(time.Minute),
+		maxSamples:    DefaultMaxSamples,
+		stopIdx:       36,
+		resolveIdx:    96,
+		errSnippet:    "too many samples",
+	}
+	// The subquery has a step of the remote write interval so that it has a sample of every series at every step.
+	tc.query = fmt.Sprintf("sum(last_over_time(%s[%s:%s])) < 10",
+		tc.metricLabels.String(), model.Duration(tc.subqueryRange), model.Duration(tc.rwInterval))
+	tc.stateMachine = tc.newStateMachine()
+	return tc
+}
+
+// newStateMachine returns the expected states of the alert, which goes into pending once the samples of the
+// stopped series are out of the range of the subquery, into firing after the 'for' duration, and gets resolved
+// at the 97th sample where the value of the remaining series goes up.
+func (tc *maxSamplesExceeded) newStateMachine() *StateMachine {
+	// The last sample of the stopped series is a remote write interval before the stale marker.
+	pending := tc.stopTime() - tc.rwInterval + tc.subqueryRange
+	_97th := time.Duration(tc.resolveIdx) * tc.rwInterval
+	return &StateMachine{
+		GroupName:     tc.groupName,
+		GroupInterval: tc.groupInterval,
+		Rules: []RuleStateMachine{
+			{
+				Rule: v1.AlertingRule{
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+					Health:      "ok",
+					Type:        "alerting",
+				},
+				Alerts: []AlertStateMachine{
+					{
+						Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+						Annotations: labels.FromStrings("description", fmt.Sprintf("The value is %d", tc.lightSeries)),
+						Transitions: []Transition{
+							{From: AlertInactive, To: AlertPending, At: pending, Value: fmt.Sprintf("%d", tc.lightSeries)},
+							{From: AlertPending, To: AlertFiring, At: pending + time.Duration(tc.forDuration)},
+							{From: AlertFiring, To: AlertInactive, At: _97th},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+type maxSamplesExceeded struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	heavySeries               int // The series that stop at stopIdx.
+	lightSeries               int // The series that remain till the end, whose value goes up at resolveIdx.
+	subqueryRange             time.Duration
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	maxSamples                int64
+	stopIdx, resolveIdx       int
+	totalSamples              int
+	stateMachine              *StateMachine
+
+	// Expected substring of the error of the alerting rule.
+	errSnippet string
+
+	zeroTime int64
+}
+
+func (tc *maxSamplesExceeded) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert whose query is a subquery over many series errors with the max samples error when the alert generator is configured with a max samples of a query " +
+			"that is less than what the query loads, e.g. Prometheus run with --query.max-samples=500. " +
+			"(2) The rule recovers once most of the series stop and their samples go out of the range of the subquery. " +
+			"(3) The alert goes from pending->firing->inactive after the recovery, based on the series that remain."
+}
+
+func (tc *maxSamplesExceeded) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *maxSamplesExceeded) SamplesToRemoteWrite() []prompb.TimeSeries {
+	// All comment times is assuming 15s interval.
+	lightSamples := sampleSlice(tc.rwInterval,
+		"1", fmt.Sprintf("0x%d", tc.resolveIdx-1), // 24m of data.
+		"5", "0x23", // 6m of data. Resolved.
+	)
+	tc.totalSamples = len(lightSamples) + 12 // We want to wait for 3m more to see the resolved alerts.
+
+	// The heavy series are marked stale at the 37th sample.
+	var heavySamples []prompb.Sample
+	heavySamples = append(heavySamples, lightSamples[:tc.stopIdx]...)
+	heavySamples = append(heavySamples, prompb.Sample{
+		Timestamp: lightSamples[tc.stopIdx].Timestamp,
+		Value:     math.Float64frombits(value.StaleNaN),
+	})
+
+	var series []prompb.TimeSeries
+	for i := 0; i < tc.heavySeries; i++ {
+		series = append(series, prompb.TimeSeries{
+			Labels:  toProtoLabels(labels.NewBuilder(tc.metricLabels).Set("series", fmt.Sprintf("heavy-%d", i)).Labels()),
+			Samples: heavySamples,
+		})
+	}
+	for i := 0; i < tc.lightSeries; i++ {
+		series = append(series, prompb.TimeSeries{
+			Labels:  toProtoLabels(labels.NewBuilder(tc.metricLabels).Set("series", fmt.Sprintf("light-%d", i)).Labels()),
+			Samples: lightSamples,
+		})
+	}
+	return series
+}
+
+func (tc *maxSamplesExceeded) Init(zt int64) {
+	tc.zeroTime = zt
+	tc.stateMachine.Init(zt)
+}
+
+// SetMaxSamples implements MaxSamplesDependent.
+func (tc *maxSamplesExceeded) SetMaxSamples(n int64) {
+	tc.maxSamples = n
+}
+
+// ResourceProfile implements ResourceProfiled.
+func (tc *maxSamplesExceeded) ResourceProfile() Resources {
+	return Resources{
+		EvalComplexity: fmt.Sprintf("subquery over %d series that loads up to about %d samples at once",
+			tc.heavySeries+tc.lightSeries, (tc.heavySeries+tc.lightSeries)*int(tc.subqueryRange/tc.rwInterval)),
+	}
+}
+
+func (tc *maxSamplesExceeded) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *maxSamplesExceeded) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	return tc.stateMachine.CheckAlerts(ts, alerts)
+}
+
+func (tc *maxSamplesExceeded) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	return checkExpectedRuleGroup(timestamp.Time(ts), tc.expRuleGroups(ts), *rg, opts)
+}
+
+func (tc *maxSamplesExceeded) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	return tc.stateMachine.CheckMetrics(ts, samples, opts)
+}
+
+func (tc *maxSamplesExceeded) ExpectedAlerts() []ExpectedAlert {
+	return tc.stateMachine.ExpectedAlerts()
+}
+
+// stopTime is the time relative to zeroTime when the heavy series are marked stale.
+func (tc *maxSamplesExceeded) stopTime() time.Duration {
+	return time.Duration(tc.stopIdx) * tc.rwInterval
+}
+
+func (tc *maxSamplesExceeded) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	canBeOk, canBeErr := tc.possibleHealth(ts - tc.zeroTime)
+	for _, rg := range tc.stateMachine.ExpRuleGroups(ts) {
+		if canBeOk {
+			expRgs = append(expRgs, rg)
+		}
+		ar := rg.Rules[0].(v1.AlertingRule)
+		if canBeErr && len(ar.Alerts) == 0 {
+			// The alert never becomes active while the rule errors.
+			ar.Health = "err"
+			ar.LastError = tc.errSnippet
+			rg.Rules = []v1.Rule{ar}
+			expRgs = append(expRgs, rg)
+		}
+	}
+	return expRgs
+}
+
+// ts is relative time w.r.t. zeroTime. The last evaluation can be up to 1 group interval before ts, and the rule can
+// be in either health if the query loads more than the max samples at any of the possible times of the evaluation.
+func (tc *maxSamplesExceeded) possibleHealth(ts int64) (canBeOk, canBeErr bool) {
+	rel := time.Duration(ts) * time.Millisecond
+	for e := rel - tc.groupInterval - time.Second; e <= rel; e += time.Second {
+		minLoad, maxLoad := tc.loadedSamples(e)
+		canBeOk = canBeOk || minLoad <= tc.maxSamples
+		canBeErr = canBeErr || maxLoad > tc.maxSamples
+	}
+	return canBeOk, canBeErr
+}
+
+// loadedSamples returns the bounds of the number of samples that the query loads into memory at once when evaluated
+// at the time e relative to zeroTime. The subquery has a sample at every step in its range for every series that has
+// a sample at or before the step and is not stale, which is 1 more or 1 less depending on the alignment of the steps.
+// On top of that, last_over_time() loads the samples of 1 series at a time, and sum() the output of last_over_time().
+func (tc *maxSamplesExceeded) loadedSamples(e time.Duration) (minLoad, maxLoad int64) {
+	if e < 0 {
+		return 0, 0
+	}
+	inRange := func(until time.Duration) (min, max int64) {
+		d := e
+		if until < d {
+			d = until
+		}
+		if from := e - tc.subqueryRange; from > 0 {
+			d -= from
+		}
+		if d < 0 {
+			return 0, 0
+		}
+		steps := int64(d / tc.rwInterval)
+		if steps == 0 {
+			return 0, steps + 1
+		}
+		return steps - 1, steps + 1
+	}
+	heavyMin, heavyMax := inRange(tc.stopTime() - tc.rwInterval)
+	lightMin, lightMax := inRange(e)
+	minLoad = int64(tc.heavySeries)*heavyMin + int64(tc.lightSeries)*lightMin
+	maxLoad = int64(tc.heavySeries)*heavyMax + int64(tc.lightSeries)*lightMax +
+		int64(tc.subqueryRange/tc.rwInterval) + 1 + int64(tc.heavySeries+tc.lightSeries) + 1
+	return minLoad, maxLoad
+}
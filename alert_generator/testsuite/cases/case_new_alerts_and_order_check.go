@@ -155,7 +155,7 @@ func (tc *newAlertsAndOrderCheck) CheckAlerts(ts int64, alerts []v1.Alert) error
 	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
 }
 
-func (tc *newAlertsAndOrderCheck) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+func (tc *newAlertsAndOrderCheck) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
 	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
 		// We wait till 1 evaluation is done.
 		return nil
@@ -164,12 +164,12 @@ func (tc *newAlertsAndOrderCheck) CheckRuleGroup(ts int64, rg *v1.RuleGroup) err
 		return errors.New("no rule group found")
 	}
 	expRgs := tc.expRuleGroups(ts)
-	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
 }
 
-func (tc *newAlertsAndOrderCheck) CheckMetrics(ts int64, samples []promql.Sample) error {
+func (tc *newAlertsAndOrderCheck) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
 	expSamples := tc.expMetrics(ts)
-	return checkExpectedSamples(expSamples, samples)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
 }
 
 func (tc *newAlertsAndOrderCheck) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
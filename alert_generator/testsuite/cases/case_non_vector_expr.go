@@ -0,0 +1,138 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// NonVectorExpr tests the following cases:
+// * Alerting rule whose expr does not return an instant vector is reported with the "err" health and a
+//   non empty last error via API, and never becomes active even if the samples in the result are above the threshold.
+// Note: A scalar result cannot be used for this since Prometheus treats it as a single element without labels
+// (and a comparison of scalars without `bool`, like `scalar(sum(metric)) > 5`, does not even parse).
+// Hence a range vector result, which is neither a vector nor a scalar, is used.
+func NonVectorExpr() TestCase {
+	groupName := "NonVectorExpr"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &nonVectorExpr{
+		groupName:     groupName,
+		alertName:     alertName,
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.query = fmt.Sprintf("%s[%s]", lbls.String(), model.Duration(6*tc.rwInterval).String())
+	return tc
+}
+
+type nonVectorExpr struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *nonVectorExpr) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alerting rule whose expr does not return an instant vector is reported with the \"err\" health and a non empty last error via API, and never becomes active even if the samples in the result are above the threshold."
+}
+
+func (tc *nonVectorExpr) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *nonVectorExpr) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"11", "0x35", // 9m of samples in the result of the expr.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *nonVectorExpr) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *nonVectorExpr) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *nonVectorExpr) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	return checkExpectedAlerts([][]v1.Alert{{}}, alerts, tc.groupInterval)
+}
+
+func (tc *nonVectorExpr) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRg := v1.RuleGroup{
+		Name:     tc.groupName,
+		Interval: float64(tc.groupInterval / time.Second),
+		Rules: []v1.Rule{
+			v1.AlertingRule{
+				State:       "inactive",
+				Name:        tc.alertName,
+				Query:       tc.query,
+				Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+				Health:      "err",
+				// The error message is implementation specific, hence we only check that it is about the result type.
+				LastError: "vector",
+				Type:      "alerting",
+			},
+		},
+	}
+	return checkExpectedRuleGroup(timestamp.Time(ts), []v1.RuleGroup{expRg}, *rg, opts)
+}
+
+func (tc *nonVectorExpr) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	return checkExpectedSamples(ts, [][]promql.Sample{nil}, samples, opts)
+}
+
+func (tc *nonVectorExpr) ExpectedAlerts() []ExpectedAlert {
+	return nil
+}
@@ -90,6 +90,11 @@ func (tc *pendingAndFiringAndResolved) RuleGroup() (rulefmt.RuleGroup, error) {
 	}, nil
 }
 
+// Weight implements Weighted. The basic firing and resolving of alerts is the most important to get right.
+func (tc *pendingAndFiringAndResolved) Weight() float64 {
+	return 3
+}
+
 func (tc *pendingAndFiringAndResolved) SamplesToRemoteWrite() []prompb.TimeSeries {
 	samples := sampleSlice(tc.rwInterval,
 		// All comment times is assuming 15s interval.
@@ -130,7 +135,7 @@ func (tc *pendingAndFiringAndResolved) CheckAlerts(ts int64, alerts []v1.Alert)
 	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
 }
 
-func (tc *pendingAndFiringAndResolved) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+func (tc *pendingAndFiringAndResolved) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
 	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
 		// We wait till 1 evaluation is done.
 		return nil
@@ -139,12 +144,12 @@ func (tc *pendingAndFiringAndResolved) CheckRuleGroup(ts int64, rg *v1.RuleGroup
 		return errors.New("no rule group found")
 	}
 	expRgs := tc.expRuleGroups(ts)
-	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
 }
 
-func (tc *pendingAndFiringAndResolved) CheckMetrics(ts int64, samples []promql.Sample) error {
+func (tc *pendingAndFiringAndResolved) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
 	expSamples := tc.expMetrics(ts)
-	return checkExpectedSamples(expSamples, samples)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
 }
 
 func (tc *pendingAndFiringAndResolved) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
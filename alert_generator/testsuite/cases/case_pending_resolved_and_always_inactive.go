@@ -97,6 +97,11 @@ func (tc *pendingAndResolved) RuleGroup() (rulefmt.RuleGroup, error) {
 	}, nil
 }
 
+// Weight implements Weighted. Not sending the alerts that never fire is as important as sending the ones that do.
+func (tc *pendingAndResolved) Weight() float64 {
+	return 3
+}
+
 func (tc *pendingAndResolved) SamplesToRemoteWrite() []prompb.TimeSeries {
 	samples := sampleSlice(tc.rwInterval,
 		// All comment times is assuming 15s interval.
@@ -133,7 +138,7 @@ func (tc *pendingAndResolved) CheckAlerts(ts int64, alerts []v1.Alert) error {
 	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
 }
 
-func (tc *pendingAndResolved) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
+func (tc *pendingAndResolved) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
 	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
 		// We wait till 1 evaluation is done.
 		return nil
@@ -142,12 +147,12 @@ func (tc *pendingAndResolved) CheckRuleGroup(ts int64, rg *v1.RuleGroup) error {
 		return errors.New("no rule group found")
 	}
 	expRgs := tc.expRuleGroups(ts)
-	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
 }
 
-func (tc *pendingAndResolved) CheckMetrics(ts int64, samples []promql.Sample) error {
+func (tc *pendingAndResolved) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
 	expSamples := tc.expMetrics(ts)
-	return checkExpectedSamples(expSamples, samples)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
 }
 
 func (tc *pendingAndResolved) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
@@ -0,0 +1,172 @@
+package cases
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// PresentOverTime tests the following cases:
+// * Alert based on present_over_time() of a series that should not exist, with no 'for' duration, that goes
+//   from inactive->firing as soon as the series appears.
+// * A gap in the series that is shorter than the range of present_over_time() does not resolve the alert.
+// * The stale marker at the end of the series does not resolve the alert either, which is resolved only once
+//   the last sample is out of the range, i.e. the range after the last sample.
+func PresentOverTime() TestCase {
+	groupName := "PresentOverTime"
+	alertName := groupName + "_Alert"
+	tc := &presentOverTime{
+		groupName:     groupName,
+		alertName:     alertName,
+		metricLabels:  metricLabels(groupName, alertName),
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		window:        5 * time.Minute,
+		appearIdx:     12,
+		gapIdx:        24,
+		reappearIdx:   48,
+		staleIdx:      60,
+	}
+	tc.query = fmt.Sprintf("present_over_time(%s[%s])", tc.metricLabels.String(), model.Duration(tc.window).String())
+	tc.stateMachine = tc.newStateMachine()
+	return tc
+}
+
+// newStateMachine returns the expected states of the alert, which goes into firing at the 13th sample where the
+// series appears, and gets resolved the range after the last sample, which is the one before the stale marker.
+func (tc *presentOverTime) newStateMachine() *StateMachine {
+	_13th := time.Duration(tc.appearIdx) * tc.rwInterval
+	lastSample := time.Duration(tc.staleIdx-1) * tc.rwInterval
+	return &StateMachine{
+		GroupName:     tc.groupName,
+		GroupInterval: tc.groupInterval,
+		Rules: []RuleStateMachine{
+			{
+				Rule: v1.AlertingRule{
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The series is present with {{$value}}"),
+					Health:      "ok",
+					Type:        "alerting",
+				},
+				Alerts: []AlertStateMachine{
+					{
+						Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+						Annotations: labels.FromStrings("description", "The series is present with 1"),
+						Transitions: []Transition{
+							{From: AlertInactive, To: AlertFiring, At: _13th, Value: "1"},
+							{From: AlertFiring, To: AlertInactive, At: lastSample + tc.window},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+type presentOverTime struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	window                    time.Duration // Range of present_over_time().
+	totalSamples              int
+	stateMachine              *StateMachine
+
+	// Indices of the samples.
+	appearIdx   int // The series appears.
+	gapIdx      int // The series has no samples till reappearIdx.
+	reappearIdx int // The series has samples again.
+	staleIdx    int // The series is marked stale and has no samples after.
+
+	zeroTime int64
+}
+
+func (tc *presentOverTime) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert based on present_over_time() of a series that should not exist, with no 'for' duration, that goes from inactive->firing as soon as the series appears. " +
+			"(2) A gap in the series that is shorter than the range of present_over_time() does not resolve the alert. " +
+			"(3) The stale marker at the end of the series does not resolve the alert either, which is resolved only once the last sample is out of the range."
+}
+
+func (tc *presentOverTime) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The series is present with {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *presentOverTime) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		"3", fmt.Sprintf("0x%d", tc.staleIdx),
+	)
+	// We want to wait for the range after the stale marker and 1m more to see the resolved alerts.
+	tc.totalSamples = tc.staleIdx + int(tc.window/tc.rwInterval) + 12
+
+	var withGaps []prompb.Sample
+	withGaps = append(withGaps, samples[tc.appearIdx:tc.gapIdx]...)     // 1m of absence, then 1m of data.
+	withGaps = append(withGaps, samples[tc.reappearIdx:tc.staleIdx]...) // 2m of absence, then 1m of data.
+	withGaps = append(withGaps, prompb.Sample{
+		Timestamp: samples[tc.staleIdx].Timestamp,
+		Value:     math.Float64frombits(value.StaleNaN),
+	})
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: withGaps,
+		},
+	}
+}
+
+func (tc *presentOverTime) Init(zt int64) {
+	tc.zeroTime = zt
+	tc.stateMachine.Init(zt)
+}
+
+func (tc *presentOverTime) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *presentOverTime) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	return tc.stateMachine.CheckAlerts(ts, alerts)
+}
+
+func (tc *presentOverTime) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	return tc.stateMachine.CheckRuleGroup(ts, rg, opts)
+}
+
+func (tc *presentOverTime) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	return tc.stateMachine.CheckMetrics(ts, samples, opts)
+}
+
+func (tc *presentOverTime) ExpectedAlerts() []ExpectedAlert {
+	return tc.stateMachine.ExpectedAlerts()
+}
@@ -0,0 +1,377 @@
+package cases
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// QuantileOverTime tests the following cases:
+// * Alert based on quantile_over_time() of a gauge that goes from pending->firing->inactive, where the
+//   value of the alert is the quantile interpolated between the two closest ranks of the samples in the window.
+// * A single spike in the window does not make the quantile cross the threshold.
+// * A window with a single sample gives that sample as the quantile, hence the alert for that series
+//   is active for exactly the range of the window after the sample.
+func QuantileOverTime() TestCase {
+	groupName := "QuantileOverTime"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &quantileOverTime{
+		groupName:     groupName,
+		alertName:     alertName,
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		quantile:      0.9,
+		threshold:     10,
+	}
+	tc.rangeDuration = 24 * tc.rwInterval
+	tc.query = fmt.Sprintf("quantile_over_time(%s, %s[%s]) > %s",
+		strconv.FormatFloat(tc.quantile, 'f', -1, 64), lbls.String(), model.Duration(tc.rangeDuration).String(),
+		strconv.FormatFloat(tc.threshold, 'f', -1, 64))
+	tc.forDuration = model.Duration(12 * tc.rwInterval)
+
+	// All comment times is assuming 15s interval.
+	// The dense series is below the threshold for 12m with a single spike at 2m30s, then above the threshold
+	// for 12m, and then below the threshold for 8m45s. Since the values below the threshold are at most 9 and
+	// the values above the threshold are at least 20, the quantile of the window is above the threshold only
+	// when at least 3 samples in the window are above the threshold, which is the case from the 50th sample
+	// until the 93rd sample leaves the window at the 117th sample.
+	normal := []float64{3, 7, 1, 9, 5, 2, 8, 4, 6}
+	high := []float64{20, 35, 25, 40, 30, 22, 38, 27}
+	for i := 0; i < 131; i++ {
+		v := normal[i%len(normal)]
+		switch {
+		case i == 10:
+			v = 50
+		case i >= 48 && i < 96:
+			v = high[(i-48)%len(high)]
+		}
+		tc.denseSamples = append(tc.denseSamples, prompb.Sample{
+			Timestamp: int64(time.Duration(i) * tc.rwInterval / time.Millisecond),
+			Value:     v,
+		})
+	}
+	return tc
+}
+
+type quantileOverTime struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	rangeDuration             time.Duration
+	quantile, threshold       float64
+	forDuration               model.Duration
+	denseSamples              []prompb.Sample
+
+	zeroTime int64
+}
+
+// quantileSeries describes the source series of an alert in quantileOverTime.
+type quantileSeries struct {
+	name       string
+	activeIdx  int // Index of the sample which brings the quantile above the threshold.
+	resolveIdx int // Index of the sample when the quantile goes below the threshold or the window is empty.
+}
+
+func (tc *quantileOverTime) series() []quantileSeries {
+	return []quantileSeries{
+		{name: "dense", activeIdx: 50, resolveIdx: 117},
+		// Only has a single sample at the 20th sample, which stays in the window for 24 samples.
+		{name: "sparse", activeIdx: 20, resolveIdx: 44},
+	}
+}
+
+func (tc *quantileOverTime) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert based on quantile_over_time() of a gauge that goes from pending->firing->inactive, where the value of the alert is the quantile interpolated between the two closest ranks of the samples in the window. " +
+			"(2) A single spike in the window does not make the quantile cross the threshold. " +
+			"(3) A window with a single sample gives that sample as the quantile, hence the alert for that series is active for exactly the range of the window after the sample."
+}
+
+func (tc *quantileOverTime) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The 90th percentile of the {{$labels.series}} series is above the threshold"},
+			},
+		},
+	}, nil
+}
+
+func (tc *quantileOverTime) seriesLabels(s quantileSeries) labels.Labels {
+	lbls := append(tc.metricLabels.Copy(), labels.Label{Name: "series", Value: s.name})
+	sort.Sort(lbls)
+	return lbls
+}
+
+func (tc *quantileOverTime) SamplesToRemoteWrite() []prompb.TimeSeries {
+	s := tc.series()
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.seriesLabels(s[0])),
+			Samples: tc.denseSamples,
+		},
+		{
+			Labels: toProtoLabels(tc.seriesLabels(s[1])),
+			Samples: []prompb.Sample{
+				{Timestamp: int64(time.Duration(s[1].activeIdx) * tc.rwInterval / time.Millisecond), Value: 50},
+			},
+		},
+	}
+}
+
+func (tc *quantileOverTime) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *quantileOverTime) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(len(tc.denseSamples)) * tc.rwInterval))
+}
+
+func (tc *quantileOverTime) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *quantileOverTime) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *quantileOverTime) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *quantileOverTime) alertLabels(s quantileSeries) labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName, "series", s.name)
+}
+
+func (tc *quantileOverTime) alertAnnotations(s quantileSeries) labels.Labels {
+	return labels.FromStrings("description", fmt.Sprintf("The 90th percentile of the %s series is above the threshold", s.name))
+}
+
+// possibleDenseValues returns the possible values above the threshold of the alert of the dense series at ts,
+// relative to zeroTime. The last evaluation can be up to a group interval before ts, and the latest sample
+// in the window might not have been ingested at the time of the evaluation.
+func (tc *quantileOverTime) possibleDenseValues(relTs int64) []string {
+	rangeMs := int64(tc.rangeDuration / time.Millisecond)
+	minEvalTs := relTs - int64((tc.groupInterval+MaxRTT)/time.Millisecond)
+
+	// The window only changes when a sample enters or leaves it.
+	evalTimes := []int64{minEvalTs, relTs}
+	for _, s := range tc.denseSamples {
+		for _, t := range []int64{s.Timestamp, s.Timestamp + 1, s.Timestamp + rangeMs, s.Timestamp + rangeMs + 1} {
+			if t > minEvalTs && t < relTs {
+				evalTimes = append(evalTimes, t)
+			}
+		}
+	}
+
+	var values []string
+	seen := make(map[string]bool)
+	for _, et := range evalTimes {
+		var window []float64
+		for _, s := range tc.denseSamples {
+			if s.Timestamp >= et-rangeMs && s.Timestamp <= et {
+				window = append(window, s.Value)
+			}
+		}
+		windows := [][]float64{window}
+		if len(window) > 1 {
+			windows = append(windows, window[:len(window)-1])
+		}
+		for _, w := range windows {
+			if len(w) == 0 {
+				continue
+			}
+			q := quantile(tc.quantile, w)
+			v := strconv.FormatFloat(q, 'f', -1, 64)
+			if q > tc.threshold && !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// possibleAlerts returns all the possible combinations of the alerts of both the series.
+func (tc *quantileOverTime) possibleAlerts(ts int64) [][]v1.Alert {
+	relTs := ts - tc.zeroTime
+
+	var perSeries [][]*v1.Alert
+	for _, s := range tc.series() {
+		canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs, s)
+		values := []string{"50"}
+		if s.name == "dense" {
+			values = tc.possibleDenseValues(relTs)
+		}
+		activeAt := timestamp.Time(tc.zeroTime + int64(time.Duration(s.activeIdx)*tc.rwInterval/time.Millisecond))
+
+		var alerts []*v1.Alert
+		if canBeInactive {
+			alerts = append(alerts, nil)
+		}
+		for _, v := range values {
+			alerts = append(alerts, possibleSeriesAlerts(false, canBePending, canBeFiring, v1.Alert{
+				Labels:      tc.alertLabels(s),
+				Annotations: tc.alertAnnotations(s),
+				Value:       v,
+				ActiveAt:    &activeAt,
+			})...)
+		}
+		perSeries = append(perSeries, alerts)
+	}
+
+	return alertCombinations(perSeries, nil)
+}
+
+func (tc *quantileOverTime) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *quantileOverTime) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The 90th percentile of the {{$labels.series}} series is above the threshold"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *quantileOverTime) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *quantileOverTime) allPossibleStates(ts int64, s quantileSeries) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	active := float64(s.activeIdx) * rwItvlSecFloat            // Goes into pending.
+	firing := active + time.Duration(tc.forDuration).Seconds() // Goes into firing.
+	resolved := float64(s.resolveIdx) * rwItvlSecFloat         // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, 240*rwItvlSecFloat)
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *quantileOverTime) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for _, s := range tc.series() {
+		firing := int64(s.activeIdx)*int64(tc.rwInterval/time.Millisecond) + int64(time.Duration(tc.forDuration)/time.Millisecond)
+		resolved := int64(s.resolveIdx) * int64(tc.rwInterval/time.Millisecond)
+		resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+		for ts := firing; ts < resolved; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != firing,
+				NextState:     timestamp.Time(tc.zeroTime + resolved),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(s),
+					Annotations: tc.alertAnnotations(s),
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+
+		for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+			tolerance := tc.groupInterval
+			if ts == resolved {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+				// based on this first resolved alert.
+				tolerance = 2 * tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != resolved,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(s),
+					Annotations: tc.alertAnnotations(s),
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+	}
+
+	return exp
+}
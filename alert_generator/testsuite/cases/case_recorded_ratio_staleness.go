@@ -0,0 +1,429 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// RecordedRatioStaleness tests the following cases:
+// * A recording rule produces an availability ratio from the source series, and two alerting rules in the
+//   same group alert on the recorded ratio: one on its value being below the target, and one via absent().
+// * When the source series goes stale after the lookback, the recording rule stops producing and the recorded
+//   ratio goes stale immediately. The alert on the value gets resolved since there is no data, while the
+//   absent() alert becomes active, both in the same evaluation, hence they are never active together.
+// * The absent() alert gets resolved once there has been no ratio for 5m, which is guarded by present_over_time()
+//   to not alert on a ratio that never existed.
+// The rules that depend on a recording rule are put in the same group since the order of the evaluation
+// of different groups is not defined.
+func RecordedRatioStaleness() TestCase {
+	groupName := "RecordedRatioStaleness"
+	belowAlertName := groupName + "_BelowTarget"
+	absentAlertName := groupName + "_Absent"
+	recordName := groupName + ":availability:ratio"
+	lbls := metricLabels(groupName, belowAlertName)
+	ratio := fmt.Sprintf(`%s{rulegroup="%s"}`, recordName, groupName)
+	return &recordedRatioStaleness{
+		groupName:       groupName,
+		belowAlertName:  belowAlertName,
+		absentAlertName: absentAlertName,
+		recordName:      recordName,
+		recordQuery:     fmt.Sprintf("avg by (rulegroup) (%s)", lbls.String()),
+		belowQuery:      fmt.Sprintf("%s < 0.9", ratio),
+		absentQuery:     fmt.Sprintf("absent(%s) and on() present_over_time(%s[5m])", ratio, ratio),
+		ratio:           ratio,
+		metricLabels:    lbls,
+		rwInterval:      5 * time.Second,
+		groupInterval:   10 * time.Second,
+		forDuration:     model.Duration(30 * time.Second),
+		lookbackDelta:   DefaultLookbackDelta,
+		activeIdx:       4,
+		lastIdx:         15,
+	}
+}
+
+type recordedRatioStaleness struct {
+	groupName                       string
+	belowAlertName, absentAlertName string
+	recordName                      string
+	recordQuery                     string
+	belowQuery, absentQuery         string
+	ratio                           string // Query for the recorded ratio.
+	metricLabels                    labels.Labels
+	rwInterval, groupInterval       time.Duration
+	forDuration                     model.Duration
+	lookbackDelta                   time.Duration
+
+	// Indices of the samples.
+	activeIdx int // The ratio goes below the target.
+	lastIdx   int // The last sample of the source series.
+
+	zeroTime int64
+}
+
+func (tc *recordedRatioStaleness) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) A recording rule produces a ratio and two alerting rules in the same group alert on it, one on its value being below the target and one via absent(). " +
+			"(2) When the source series goes stale after the lookback, the recorded ratio goes stale immediately, which resolves the alert on the value and makes the absent() alert active in the same evaluation. " +
+			"(3) The absent() alert gets resolved once there has been no ratio for 5m."
+}
+
+func (tc *recordedRatioStaleness) RuleGroup() (rulefmt.RuleGroup, error) {
+	var record, recordExpr yaml.Node
+	var belowAlert, belowExpr yaml.Node
+	var absentAlert, absentExpr yaml.Node
+	for _, e := range []struct {
+		n *yaml.Node
+		v string
+	}{
+		{&record, tc.recordName}, {&recordExpr, tc.recordQuery},
+		{&belowAlert, tc.belowAlertName}, {&belowExpr, tc.belowQuery},
+		{&absentAlert, tc.absentAlertName}, {&absentExpr, tc.absentQuery},
+	} {
+		if err := e.n.Encode(e.v); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				// The recording rule must come first so that the alerting rules see its output
+				// from the same evaluation.
+				Record: record,
+				Expr:   recordExpr,
+				Labels: map[string]string{"rulegroup": tc.groupName},
+			},
+			{
+				Alert:       belowAlert,
+				Expr:        belowExpr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The availability ratio is {{$value}}"},
+			},
+			{
+				Alert:       absentAlert,
+				Expr:        absentExpr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The availability ratio is not recorded, value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *recordedRatioStaleness) SamplesToRemoteWrite() []prompb.TimeSeries {
+	return []prompb.TimeSeries{
+		{
+			Labels: toProtoLabels(tc.metricLabels),
+			Samples: sampleSlice(tc.rwInterval,
+				// All comment times is assuming 15s interval.
+				"1", fmt.Sprintf("0x%d", tc.activeIdx-1), // 1m (1 is @0 time).
+				// 3m below the target, after which the source series goes stale after the lookback.
+				"0.8", fmt.Sprintf("0x%d", tc.lastIdx-tc.activeIdx),
+			),
+		},
+	}
+}
+
+func (tc *recordedRatioStaleness) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+// SetLookbackDelta implements LookbackDependent.
+func (tc *recordedRatioStaleness) SetLookbackDelta(d time.Duration) {
+	tc.lookbackDelta = d
+}
+
+func (tc *recordedRatioStaleness) TestUntil() int64 {
+	// The samples end much before the absent() alert gets resolved.
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(tc.testDuration()))
+}
+
+// testDuration is the duration of the test, which is 150 samples with the default lookback delta.
+func (tc *recordedRatioStaleness) testDuration() time.Duration {
+	return tc.absentResolvedTime() + 15*tc.rwInterval
+}
+
+func (tc *recordedRatioStaleness) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *recordedRatioStaleness) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *recordedRatioStaleness) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *recordedRatioStaleness) Queries() []string {
+	return []string{tc.ratio}
+}
+
+func (tc *recordedRatioStaleness) CheckQuery(ts int64, query string, samples []promql.Sample, opts CheckOptions) error {
+	if query != tc.ratio {
+		return errors.Errorf("unexpected query %q", query)
+	}
+	expSamples := tc.expRatio(ts)
+	return errors.Wrap(checkExpectedSamples(ts, expSamples, samples, opts), "recorded ratio")
+}
+
+// activeTime is the time relative to zeroTime when the ratio goes below the target.
+func (tc *recordedRatioStaleness) activeTime() time.Duration {
+	return time.Duration(tc.activeIdx) * tc.rwInterval
+}
+
+// staleTime is the time relative to zeroTime after which the source series, and hence the recorded ratio, is stale.
+// The alert on the value is resolved and the absent() alert becomes active at this time.
+func (tc *recordedRatioStaleness) staleTime() time.Duration {
+	return time.Duration(tc.lastIdx)*tc.rwInterval + tc.lookbackDelta
+}
+
+// absentResolvedTime is the time relative to zeroTime when the absent() alert gets resolved.
+func (tc *recordedRatioStaleness) absentResolvedTime() time.Duration {
+	return tc.staleTime() + 5*time.Minute
+}
+
+func (tc *recordedRatioStaleness) belowAlertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.belowAlertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *recordedRatioStaleness) absentAlertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.absentAlertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *recordedRatioStaleness) possibleAlerts(ts int64) [][]v1.Alert {
+	below, absent := tc.allPossibleStates(ts - tc.zeroTime)
+	belowActiveAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+	absentActiveAt := timestamp.Time(tc.zeroTime + int64(tc.staleTime()/time.Millisecond))
+	return alertCombinations([][]*v1.Alert{
+		possibleSeriesAlerts(below.canBeInactive, below.canBePending, below.canBeFiring, v1.Alert{
+			Labels:      tc.belowAlertLabels(),
+			Annotations: labels.FromStrings("description", "The availability ratio is 0.8"),
+			Value:       "0.8",
+			ActiveAt:    &belowActiveAt,
+		}),
+		possibleSeriesAlerts(absent.canBeInactive, absent.canBePending, absent.canBeFiring, v1.Alert{
+			Labels:      tc.absentAlertLabels(),
+			Annotations: labels.FromStrings("description", "The availability ratio is not recorded, value is 1"),
+			Value:       "1",
+			ActiveAt:    &absentActiveAt,
+		}),
+	}, func(c []*v1.Alert) bool {
+		// The alert on the value is resolved in the same evaluation that the absent() alert becomes active,
+		// and it is evaluated first, hence both can be inactive in between but never active together.
+		return c[0] == nil || c[1] == nil
+	})
+}
+
+func (tc *recordedRatioStaleness) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *recordedRatioStaleness) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getAlertingRule := func(alertName, query, description, state string, alerts []*v1.Alert) v1.AlertingRule {
+		return v1.AlertingRule{
+			State:       state,
+			Name:        alertName,
+			Query:       query,
+			Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+			Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+			Annotations: labels.FromStrings("description", description),
+			Alerts:      alerts,
+			Health:      "ok",
+			Type:        "alerting",
+		}
+	}
+
+	for _, c := range tc.possibleAlerts(ts) {
+		// The alerts are split by the alertname into their rules.
+		belowState, absentState := "inactive", "inactive"
+		var belowAlerts, absentAlerts []*v1.Alert
+		for i := range c {
+			if c[i].Labels.Get("alertname") == tc.belowAlertName {
+				belowState = c[i].State
+				belowAlerts = append(belowAlerts, &c[i])
+				continue
+			}
+			absentState = c[i].State
+			absentAlerts = append(absentAlerts, &c[i])
+		}
+		expRgs = append(expRgs, v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.RecordingRule{
+					Name:   tc.recordName,
+					Query:  tc.recordQuery,
+					Labels: labels.FromStrings("rulegroup", tc.groupName),
+					Health: "ok",
+					Type:   "recording",
+				},
+				getAlertingRule(tc.belowAlertName, tc.belowQuery, "The availability ratio is {{$value}}", belowState, belowAlerts),
+				getAlertingRule(tc.absentAlertName, tc.absentQuery, "The availability ratio is not recorded, value is {{$value}}", absentState, absentAlerts),
+			},
+		})
+	}
+	return expRgs
+}
+
+func (tc *recordedRatioStaleness) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+func (tc *recordedRatioStaleness) expRatio(ts int64) (expSamples [][]promql.Sample) {
+	between := betweenFunc(ts - tc.zeroTime)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := tc.activeTime().Seconds()
+	stale := tc.staleTime().Seconds()
+	// The first sample can take up to 1 group interval to be remote written and 1 more to be recorded.
+	canBeAbsent := between(0, 2*grpItvlSecFloat) || between(stale-1, tc.testDuration().Seconds())
+	canBeOne := between(0, active+2*grpItvlSecFloat)
+	canBeBelow := between(active-1, stale+grpItvlSecFloat)
+
+	if canBeAbsent {
+		expSamples = append(expSamples, nil)
+	}
+	for _, v := range []struct {
+		ok bool
+		v  float64
+	}{{canBeOne, 1}, {canBeBelow, 0.8}} {
+		if !v.ok {
+			continue
+		}
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: v.v},
+				Metric: labels.FromStrings("__name__", tc.recordName, "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *recordedRatioStaleness) allPossibleStates(ts int64) (below, absent seriesStates) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	forSec := time.Duration(tc.forDuration).Seconds()
+	// The alert on the value can also be an evaluation late since it sees the recorded ratio of the evaluation.
+	active := tc.activeTime().Seconds()                 // The alert on the value goes into pending.
+	stale := tc.staleTime().Seconds()                   // The alert on the value is resolved, the absent() alert goes into pending.
+	absentResolved := tc.absentResolvedTime().Seconds() // The absent() alert is resolved.
+	below.canBeInactive = between(0, active+2*grpItvlSecFloat) ||
+		between(stale-1, tc.testDuration().Seconds())
+	below.canBePending = between(active-1, active+forSec+2*grpItvlSecFloat)
+	below.canBeFiring = between(active+forSec-1, stale+grpItvlSecFloat)
+
+	absent.canBeInactive = between(0, stale+grpItvlSecFloat) ||
+		between(absentResolved-1, tc.testDuration().Seconds())
+	absent.canBePending = between(stale-1, stale+forSec+grpItvlSecFloat)
+	absent.canBeFiring = between(stale+forSec-1, absentResolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *recordedRatioStaleness) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	forDurationMs := int64(time.Duration(tc.forDuration) / time.Millisecond)
+	staleMs := int64(tc.staleTime() / time.Millisecond)
+	for _, a := range []struct {
+		lbls        labels.Labels
+		description string
+		firing      int64
+		resolved    int64
+		tolerance   time.Duration
+	}{
+		// The alert on the value sees the recorded ratio of the evaluation, which can make it an evaluation late.
+		{
+			tc.belowAlertLabels(), "The availability ratio is 0.8",
+			int64(tc.activeTime()/time.Millisecond) + forDurationMs, staleMs, 2 * tc.groupInterval,
+		},
+		{
+			tc.absentAlertLabels(), "The availability ratio is not recorded, value is 1",
+			staleMs + forDurationMs, int64(tc.absentResolvedTime() / time.Millisecond), tc.groupInterval,
+		},
+	} {
+		resolvedPlus15m := a.resolved + int64(15*time.Minute/time.Millisecond)
+		for ts := a.firing; ts < a.resolved; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: a.tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != a.firing,
+				NextState:     timestamp.Time(tc.zeroTime + a.resolved),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + a.resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      a.lbls,
+					Annotations: labels.FromStrings("description", a.description),
+					StartsAt:    timestamp.Time(tc.zeroTime + a.firing),
+				},
+			})
+		}
+
+		for ts := a.resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+			tolerance := a.tolerance
+			if ts == a.resolved {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+				// based on this first resolved alert.
+				tolerance = a.tolerance + tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != a.resolved,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + a.resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      a.lbls,
+					Annotations: labels.FromStrings("description", a.description),
+					StartsAt:    timestamp.Time(tc.zeroTime + a.firing),
+				},
+			})
+		}
+	}
+
+	return exp
+}
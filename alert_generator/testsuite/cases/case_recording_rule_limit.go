@@ -0,0 +1,405 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// RecordingRuleLimit tests the following cases:
+// * The limit of a rule group applies to the recording rules. A recording rule whose aggregation produces
+//   more series than the limit errors, and none of its series are recorded.
+// * The recording rule recovers once its aggregation produces as many series as the limit, and its series
+//   are recorded from then on.
+// * An alerting rule on the recorded series, which is within the limit, fires once the series are recorded.
+// Note: The recording rule does not write the staleness markers when it errors, hence going over the limit
+// after the series have been recorded would leave them visible for the lookback. So the recording rule
+// goes over the limit only before it has recorded any series.
+func RecordingRuleLimit() TestCase {
+	groupName := "RecordingRuleLimit"
+	alertName := groupName + "_Alert"
+	recordName := groupName + ":value"
+	lbls := metricLabels(groupName, alertName)
+	recorded := fmt.Sprintf(`%s{rulegroup="%s"}`, recordName, groupName)
+	return &recordingRuleLimit{
+		groupName:     groupName,
+		alertName:     alertName,
+		recordName:    recordName,
+		recordQuery:   fmt.Sprintf("sum by (instance) (%s > 0)", lbls.String()),
+		alertQuery:    fmt.Sprintf("count(%s) > 1", recorded),
+		recordedQuery: fmt.Sprintf("%s > bool 0", recorded),
+		metricLabels:  lbls,
+		limit:         2,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		forDuration:   model.Duration(30 * time.Second),
+		overLimitIdx:  4,
+		recoverIdx:    24,
+		resolveIdx:    64,
+		totalSamples:  76,
+	}
+}
+
+type recordingRuleLimit struct {
+	groupName                 string
+	alertName                 string
+	recordName                string
+	recordQuery, alertQuery   string
+	recordedQuery             string // Query for the recorded series.
+	metricLabels              labels.Labels
+	limit                     int
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+
+	// Indices of the samples.
+	overLimitIdx int // The three input series are above 0, which is over the limit.
+	recoverIdx   int // One of the input series drops to 0, which brings the recording rule within the limit.
+	resolveIdx   int // All the input series drop to 0, which resolves the alert.
+	totalSamples int
+
+	zeroTime int64
+}
+
+func (tc *recordingRuleLimit) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) The limit of a rule group applies to the recording rules, and a recording rule whose aggregation produces more series than the limit errors without recording any series. " +
+			"(2) The recording rule recovers once its aggregation produces as many series as the limit, and its series are recorded from then on. " +
+			"(3) An alert on the recorded series fires once the series are recorded."
+}
+
+func (tc *recordingRuleLimit) RuleGroup() (rulefmt.RuleGroup, error) {
+	var record, recordExpr yaml.Node
+	var alert, alertExpr yaml.Node
+	for _, e := range []struct {
+		n *yaml.Node
+		v string
+	}{
+		{&record, tc.recordName}, {&recordExpr, tc.recordQuery},
+		{&alert, tc.alertName}, {&alertExpr, tc.alertQuery},
+	} {
+		if err := e.n.Encode(e.v); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Limit:    tc.limit,
+		Rules: []rulefmt.RuleNode{
+			{
+				// The recording rule must come first so that the alerting rule sees its output
+				// from the same evaluation.
+				Record: record,
+				Expr:   recordExpr,
+				Labels: map[string]string{"rulegroup": tc.groupName},
+			},
+			{
+				Alert:       alert,
+				Expr:        alertExpr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The count is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *recordingRuleLimit) SamplesToRemoteWrite() []prompb.TimeSeries {
+	// All comment times is assuming 15s interval.
+	withinLimit := sampleSlice(tc.rwInterval,
+		"0", "0x3", // 1m of no series recorded (0 is @0 time).
+		"15", fmt.Sprintf("0x%d", tc.resolveIdx-tc.overLimitIdx-1), // 15m. Goes over the limit at 1m and back within it at 6m.
+		"0", fmt.Sprintf("0x%d", tc.totalSamples-tc.resolveIdx-1), // 3m of no series recorded. Resolved at 16m.
+	)
+	overLimit := sampleSlice(tc.rwInterval,
+		"0", "0x3", // 1m.
+		"15", fmt.Sprintf("0x%d", tc.recoverIdx-tc.overLimitIdx-1), // 5m of the third series, which is over the limit.
+		"0", fmt.Sprintf("0x%d", tc.totalSamples-tc.recoverIdx-1), // Not recorded till the end.
+	)
+
+	var series []prompb.TimeSeries
+	for _, inst := range []string{"a", "b"} {
+		series = append(series, prompb.TimeSeries{
+			Labels:  toProtoLabels(labels.NewBuilder(tc.metricLabels).Set("instance", inst).Labels()),
+			Samples: withinLimit,
+		})
+	}
+	return append(series, prompb.TimeSeries{
+		Labels:  toProtoLabels(labels.NewBuilder(tc.metricLabels).Set("instance", "c").Labels()),
+		Samples: overLimit,
+	})
+}
+
+func (tc *recordingRuleLimit) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *recordingRuleLimit) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *recordingRuleLimit) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *recordingRuleLimit) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *recordingRuleLimit) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *recordingRuleLimit) Queries() []string {
+	return []string{tc.recordedQuery}
+}
+
+func (tc *recordingRuleLimit) CheckQuery(ts int64, query string, samples []promql.Sample, opts CheckOptions) error {
+	if query != tc.recordedQuery {
+		return errors.Errorf("unexpected query %q", query)
+	}
+	expSamples := tc.expRecorded(ts)
+	return errors.Wrap(checkExpectedSamples(ts, expSamples, samples, opts), "recorded series")
+}
+
+// overLimitTime is the time relative to zeroTime when the recording rule goes over the limit.
+func (tc *recordingRuleLimit) overLimitTime() time.Duration {
+	return time.Duration(tc.overLimitIdx) * tc.rwInterval
+}
+
+// activeTime is the time relative to zeroTime when the recording rule is back within the limit, which makes
+// the alert active since the series are recorded.
+func (tc *recordingRuleLimit) activeTime() time.Duration {
+	return time.Duration(tc.recoverIdx) * tc.rwInterval
+}
+
+// firingTime is the time relative to zeroTime when the alert goes into firing.
+func (tc *recordingRuleLimit) firingTime() time.Duration {
+	return tc.activeTime() + time.Duration(tc.forDuration)
+}
+
+// resolvedTime is the time relative to zeroTime when the alert gets resolved, since the recording rule
+// does not produce any series and marks the recorded series stale.
+func (tc *recordingRuleLimit) resolvedTime() time.Duration {
+	return time.Duration(tc.resolveIdx) * tc.rwInterval
+}
+
+func (tc *recordingRuleLimit) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *recordingRuleLimit) possibleAlerts(ts int64) [][]v1.Alert {
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(ts - tc.zeroTime)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+	return alertCombinations([][]*v1.Alert{
+		possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(),
+			Annotations: labels.FromStrings("description", "The count is 2"),
+			Value:       "2",
+			ActiveAt:    &activeAt,
+		}),
+	}, nil)
+}
+
+func (tc *recordingRuleLimit) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *recordingRuleLimit) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	var recordingRules []v1.RecordingRule
+	canBeOk, canBeErr := tc.possibleRecordingHealth(ts - tc.zeroTime)
+	if canBeOk {
+		recordingRules = append(recordingRules, v1.RecordingRule{
+			Name:   tc.recordName,
+			Query:  tc.recordQuery,
+			Labels: labels.FromStrings("rulegroup", tc.groupName),
+			Health: "ok",
+			Type:   "recording",
+		})
+	}
+	if canBeErr {
+		recordingRules = append(recordingRules, v1.RecordingRule{
+			Name:      tc.recordName,
+			Query:     tc.recordQuery,
+			Labels:    labels.FromStrings("rulegroup", tc.groupName),
+			Health:    "err",
+			LastError: fmt.Sprintf("exceeded limit of %d with 3 series", tc.limit),
+			Type:      "recording",
+		})
+	}
+
+	for _, c := range tc.possibleAlerts(ts) {
+		state := "inactive"
+		var alerts []*v1.Alert
+		for i := range c {
+			state = c[i].State
+			alerts = append(alerts, &c[i])
+		}
+		for _, rr := range recordingRules {
+			expRgs = append(expRgs, v1.RuleGroup{
+				Name:     tc.groupName,
+				Interval: float64(tc.groupInterval / time.Second),
+				Rules: []v1.Rule{
+					rr,
+					v1.AlertingRule{
+						State:       state,
+						Name:        tc.alertName,
+						Query:       tc.alertQuery,
+						Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+						Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+						Annotations: labels.FromStrings("description", "The count is {{$value}}"),
+						Alerts:      alerts,
+						Health:      "ok",
+						Type:        "alerting",
+					},
+				},
+			})
+		}
+	}
+	return expRgs
+}
+
+func (tc *recordingRuleLimit) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// expRecorded is absent while the recording rule is over the limit, and has a series per input series within
+// the limit once it is back within the limit.
+func (tc *recordingRuleLimit) expRecorded(ts int64) (expSamples [][]promql.Sample) {
+	between := betweenFunc(ts - tc.zeroTime)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	recovered := tc.activeTime().Seconds()
+	resolved := tc.resolvedTime().Seconds()
+	// The samples can take up to 1 group interval to be remote written and 1 more to be recorded.
+	canBeAbsent := between(0, recovered+2*grpItvlSecFloat) ||
+		between(resolved-1, float64(tc.totalSamples)*tc.rwInterval.Seconds())
+	canBePresent := between(recovered-1, resolved+2*grpItvlSecFloat)
+
+	if canBeAbsent {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePresent {
+		var samples []promql.Sample
+		for _, inst := range []string{"a", "b"} {
+			samples = append(samples, promql.Sample{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("instance", inst, "rulegroup", tc.groupName),
+			})
+		}
+		expSamples = append(expSamples, samples)
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *recordingRuleLimit) possibleRecordingHealth(ts int64) (canBeOk, canBeErr bool) {
+	between := betweenFunc(ts)
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	overLimit := tc.overLimitTime().Seconds()
+	recovered := tc.activeTime().Seconds()
+	canBeOk = between(0, overLimit+grpItvlSecFloat) ||
+		between(recovered-1, float64(tc.totalSamples)*tc.rwInterval.Seconds())
+	canBeErr = between(overLimit-1, recovered+grpItvlSecFloat)
+	return
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *recordingRuleLimit) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := tc.activeTime().Seconds()     // Goes into pending.
+	firing := tc.firingTime().Seconds()     // Goes into firing.
+	resolved := tc.resolvedTime().Seconds() // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, float64(tc.totalSamples)*tc.rwInterval.Seconds())
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *recordingRuleLimit) ExpectedAlerts() []ExpectedAlert {
+	firing := int64(tc.firingTime() / time.Millisecond)
+	resolved := int64(tc.resolvedTime() / time.Millisecond)
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < resolved; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + resolved),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The count is 2"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == resolved {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != resolved,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The count is 2"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
@@ -0,0 +1,400 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// RecordingRuleStaleness tests the following cases:
+// * A recording rule produces a heartbeat series from the source series, and an alerting rule in the same
+//   group alerts on the heartbeat via absent() (a dead man's switch) that goes from pending->firing->inactive.
+// * When the source series goes stale after the lookback, the recording rule stops producing and the
+//   heartbeat series goes stale immediately, which makes the alert active in the same evaluation.
+// * The alert gets resolved once there has been no heartbeat for 5m, which is guarded by present_over_time()
+//   to not alert on a heartbeat that never existed.
+func RecordingRuleStaleness() TestCase {
+	groupName := "RecordingRuleStaleness"
+	alertName := groupName + "_Alert"
+	recordName := groupName + ":heartbeat"
+	lbls := metricLabels(groupName, alertName)
+	heartbeat := fmt.Sprintf(`%s{rulegroup="%s"}`, recordName, groupName)
+	return &recordingRuleStaleness{
+		groupName:     groupName,
+		alertName:     alertName,
+		recordName:    recordName,
+		recordQuery:   fmt.Sprintf("sum by (rulegroup) (%s)", lbls.String()),
+		alertQuery:    fmt.Sprintf("absent(%s) and on() present_over_time(%s[5m])", heartbeat, heartbeat),
+		heartbeat:     heartbeat,
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		forDuration:   model.Duration(30 * time.Second),
+		lookbackDelta: DefaultLookbackDelta,
+	}
+}
+
+type recordingRuleStaleness struct {
+	groupName                 string
+	alertName                 string
+	recordName                string
+	recordQuery               string
+	alertQuery                string
+	heartbeat                 string // Query for the heartbeat series.
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	lookbackDelta             time.Duration
+
+	zeroTime int64
+}
+
+func (tc *recordingRuleStaleness) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) A recording rule produces a heartbeat series and an alerting rule in the same group alerts via absent() on it, going from pending->firing->inactive. " +
+			"(2) When the source series goes stale after the lookback, the heartbeat series goes stale immediately and the alert becomes active in the same evaluation. " +
+			"(3) The alert gets resolved once there has been no heartbeat for 5m."
+}
+
+func (tc *recordingRuleStaleness) RuleGroup() (rulefmt.RuleGroup, error) {
+	var record, recordExpr yaml.Node
+	var alert, alertExpr yaml.Node
+	if err := record.Encode(tc.recordName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := recordExpr.Encode(tc.recordQuery); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := alertExpr.Encode(tc.alertQuery); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				// The recording rule must come first so that the alerting rule sees its output
+				// from the same evaluation.
+				Record: record,
+				Expr:   recordExpr,
+				Labels: map[string]string{"rulegroup": tc.groupName},
+			},
+			{
+				Alert:       alert,
+				Expr:        alertExpr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The heartbeat recording has stopped, value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *recordingRuleStaleness) SamplesToRemoteWrite() []prompb.TimeSeries {
+	return []prompb.TimeSeries{
+		{
+			Labels: toProtoLabels(tc.metricLabels),
+			Samples: sampleSlice(tc.rwInterval,
+				// All comment times is assuming 15s interval.
+				"1", "0x15", // 4m of data, after which the source series goes stale after the lookback.
+			),
+		},
+	}
+}
+
+func (tc *recordingRuleStaleness) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+// SetLookbackDelta implements LookbackDependent.
+func (tc *recordingRuleStaleness) SetLookbackDelta(d time.Duration) {
+	tc.lookbackDelta = d
+}
+
+func (tc *recordingRuleStaleness) TestUntil() int64 {
+	// The samples end much before the alert gets resolved.
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(tc.testDuration()))
+}
+
+// testDuration is the duration of the test, which is 150 samples with the default lookback delta.
+func (tc *recordingRuleStaleness) testDuration() time.Duration {
+	return tc.staleTime() + 5*time.Minute + 15*tc.rwInterval
+}
+
+func (tc *recordingRuleStaleness) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *recordingRuleStaleness) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *recordingRuleStaleness) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *recordingRuleStaleness) Queries() []string {
+	return []string{tc.heartbeat}
+}
+
+func (tc *recordingRuleStaleness) CheckQuery(ts int64, query string, samples []promql.Sample, opts CheckOptions) error {
+	if query != tc.heartbeat {
+		return errors.Errorf("unexpected query %q", query)
+	}
+	expSamples := tc.expHeartbeat(ts)
+	return errors.Wrap(checkExpectedSamples(ts, expSamples, samples, opts), "heartbeat")
+}
+
+// staleTime is the time relative to zeroTime after which the source series, and hence the heartbeat, is stale.
+// The last sample is the 16th sample.
+func (tc *recordingRuleStaleness) staleTime() time.Duration {
+	return 15*tc.rwInterval + tc.lookbackDelta
+}
+
+func (tc *recordingRuleStaleness) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.staleTime()/time.Millisecond))
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBePending {
+		expAlerts = append(expAlerts, []v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The heartbeat recording has stopped, value is 1"),
+				State:       "pending",
+				Value:       "1",
+				ActiveAt:    &activeAt,
+			},
+		})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, []v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The heartbeat recording has stopped, value is 1"),
+				State:       "firing",
+				Value:       "1",
+				ActiveAt:    &activeAt,
+			},
+		})
+	}
+
+	return expAlerts
+}
+
+func (tc *recordingRuleStaleness) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.staleTime()/time.Millisecond))
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.RecordingRule{
+					Name:   tc.recordName,
+					Query:  tc.recordQuery,
+					Labels: labels.FromStrings("rulegroup", tc.groupName),
+					Health: "ok",
+					Type:   "recording",
+				},
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.alertQuery,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The heartbeat recording has stopped, value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBePending {
+		expRgs = append(expRgs, getRg("pending", []*v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The heartbeat recording has stopped, value is 1"),
+				State:       "pending",
+				Value:       "1",
+				ActiveAt:    &activeAt,
+			},
+		}))
+	}
+	if canBeFiring {
+		expRgs = append(expRgs, getRg("firing", []*v1.Alert{
+			{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The heartbeat recording has stopped, value is 1"),
+				State:       "firing",
+				Value:       "1",
+				ActiveAt:    &activeAt,
+			},
+		}))
+	}
+
+	return expRgs
+}
+
+func (tc *recordingRuleStaleness) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePending {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "pending", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+	if canBeFiring {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+func (tc *recordingRuleStaleness) expHeartbeat(ts int64) (expSamples [][]promql.Sample) {
+	between := betweenFunc(ts - tc.zeroTime)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	stale := tc.staleTime().Seconds()
+	// The first sample can take up to 1 group interval to be remote written and 1 more to be recorded.
+	canBeAbsent := between(0, 2*grpItvlSecFloat) || between(stale-1, tc.testDuration().Seconds())
+	canBePresent := between(0, stale+grpItvlSecFloat)
+
+	if canBeAbsent {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePresent {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", tc.recordName, "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *recordingRuleStaleness) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	stale := tc.staleTime().Seconds()                                    // Goes into pending.
+	firing := (tc.staleTime() + time.Duration(tc.forDuration)).Seconds() // Goes into firing.
+	resolved := (tc.staleTime() + 5*time.Minute).Seconds()               // Resolved.
+	canBeInactive = between(0, stale+grpItvlSecFloat) ||
+		between(resolved-1, tc.testDuration().Seconds())
+	canBePending = between(stale-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *recordingRuleStaleness) ExpectedAlerts() []ExpectedAlert {
+	firing := int64((tc.staleTime() + time.Duration(tc.forDuration)) / time.Millisecond) // Firing.
+	resolved := int64((tc.staleTime() + 5*time.Minute) / time.Millisecond)               // Resolved.
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < resolved; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + resolved),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The heartbeat recording has stopped, value is 1"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == resolved {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != resolved,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The heartbeat recording has stopped, value is 1"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
@@ -0,0 +1,291 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// RefiringAfterDip tests the following cases:
+// * Alert that goes pending->firing->inactive->pending->firing, where the value of a firing alert drops below the
+//   threshold for a moment and comes back right away. The alert gets resolved at the first evaluation that does
+//   not see it, and the alert that comes back is a new alert. It starts over from pending with a fresh ActiveAt,
+//   needs the whole 'for' duration again and fires with a new StartsAt, i.e. the alert does not go back to firing
+//   nor stay firing.
+// * The resolved alert of the first firing is sent once and not resent after the alert becomes active again.
+// The state machine of the alert is:
+//   inactive --(value > 10)--> pending --('for' passes)--> firing --(value <= 10)--> inactive (resolved)
+//   inactive (resolved) --(value > 10)--> pending (new ActiveAt) --('for' passes)--> firing (new StartsAt)
+func RefiringAfterDip() TestCase {
+	groupName := "RefiringAfterDip"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &refiringAfterDip{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(6 * tc.rwInterval)
+	return tc
+}
+
+type refiringAfterDip struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+// refiringAfterDipEpisode is a period in which the alert is active in refiringAfterDip. The times are relative
+// to zeroTime.
+type refiringAfterDipEpisode struct {
+	activeTime, resolvedTime time.Duration
+}
+
+// episodes are the two active periods of the alert, before and after the dip.
+func (tc *refiringAfterDip) episodes() []refiringAfterDipEpisode {
+	return []refiringAfterDipEpisode{
+		{activeTime: 4 * tc.rwInterval, resolvedTime: 24 * tc.rwInterval},
+		{activeTime: 27 * tc.rwInterval, resolvedTime: 50 * tc.rwInterval},
+	}
+}
+
+func (tc *refiringAfterDip) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert that goes pending->firing->inactive->pending->firing, where the value of a firing alert drops below the threshold for a moment and comes back right away. " +
+			"The alert gets resolved, and the alert that comes back starts over from pending with a fresh ActiveAt and fires again after the whole 'for' duration with a new StartsAt. " +
+			"(2) The resolved alert of the first firing is sent once and not resent after the alert becomes active again."
+}
+
+func (tc *refiringAfterDip) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *refiringAfterDip) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		"3", "0x3", // 20s (3 is @0 time).
+		"15", "0x19", // 1m40s of active. Goes into pending at 20s and into firing at 50s.
+		// 15s below the threshold, which is longer than the group interval so that an evaluation sees it.
+		// Resolved at 2m.
+		"9", "0x2",
+		"15", "0x22", // 1m55s of active. Goes into pending again at 2m15s and into firing again at 2m45s.
+		"5", "0x11", // 1m of resolved.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *refiringAfterDip) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *refiringAfterDip) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *refiringAfterDip) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *refiringAfterDip) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *refiringAfterDip) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *refiringAfterDip) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *refiringAfterDip) possibleAlerts(ts int64) [][]v1.Alert {
+	// The episodes are treated like series of the same alert, which cannot be active together.
+	var perEpisode [][]*v1.Alert
+	for _, e := range tc.episodes() {
+		canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(ts-tc.zeroTime, e)
+		activeAt := timestamp.Time(tc.zeroTime + int64(e.activeTime/time.Millisecond))
+		perEpisode = append(perEpisode, possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(),
+			Annotations: labels.FromStrings("description", "The value is 15"),
+			Value:       "15",
+			ActiveAt:    &activeAt,
+		}))
+	}
+	return alertCombinations(perEpisode, func(c []*v1.Alert) bool {
+		return c[0] == nil || c[1] == nil
+	})
+}
+
+func (tc *refiringAfterDip) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *refiringAfterDip) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *refiringAfterDip) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *refiringAfterDip) allPossibleStates(ts int64, e refiringAfterDipEpisode) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := e.activeTime.Seconds()                                   // Goes into pending.
+	firing := (e.activeTime + time.Duration(tc.forDuration)).Seconds() // Goes into firing.
+	resolved := e.resolvedTime.Seconds()                               // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, float64(tc.totalSamples)*tc.rwInterval.Seconds())
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *refiringAfterDip) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	annotations := labels.FromStrings("description", "The value is 15")
+	episodes := tc.episodes()
+	for i, e := range episodes {
+		firing := int64((e.activeTime + time.Duration(tc.forDuration)) / time.Millisecond)
+		resolved := int64(e.resolvedTime / time.Millisecond)
+		// The resolved alert is resent until the alert becomes active again, which replaces it.
+		resolvedEnd := resolved + int64(15*time.Minute/time.Millisecond)
+		if i+1 < len(episodes) {
+			resolvedEnd = int64(episodes[i+1].activeTime / time.Millisecond)
+		}
+
+		for ts := firing; ts < resolved; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != firing,
+				NextState:     timestamp.Time(tc.zeroTime + resolved),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(),
+					Annotations: annotations,
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+
+		for ts := resolved; ts < resolvedEnd; ts += resendDelayMs {
+			tolerance := tc.groupInterval
+			if ts == resolved {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+				// based on this first resolved alert.
+				tolerance = 2 * tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != resolved,
+				NextState:     timestamp.Time(tc.zeroTime + resolvedEnd),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(),
+					Annotations: annotations,
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+	}
+
+	return exp
+}
@@ -0,0 +1,220 @@
+package cases
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// RoundedValue tests the following cases:
+// * Alert based on round() of a gauge that goes from pending->firing->inactive, where the raw value crosses
+//   the threshold only after rounding, and the value of the alert is the rounded value.
+// * round() rounds the ties up, and a raw value just below the tie does not cross the threshold.
+// * round() with a to_nearest argument rounds to the nearest multiple of it, e.g. 9.75 to 10 with 0.5.
+// The expected states are derived from the samples by rounding them the same way.
+func RoundedValue() TestCase {
+	groupName := "RoundedValue"
+	tc := &roundedValue{
+		groupName:     groupName,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		forDuration:   model.Duration(30 * time.Second),
+	}
+	tc.rules = []roundedRule{
+		{
+			// 9.4 rounds to 9, the tie 9.5 to 10, and 9.49 to 9.
+			alertName: groupName + "_Nearest",
+			toNearest: 1,
+			threshold: 10,
+			values:    []string{"9.4", "0x11", "9.5", "0x23", "9.49", "0x23"},
+		},
+		{
+			// 9.7 rounds to 9.5, the tie 9.75 to 10, and 9.74 to 9.5.
+			alertName: groupName + "_ToNearest",
+			toNearest: 0.5,
+			threshold: 10,
+			values:    []string{"9.7", "0x11", "9.75", "0x23", "9.74", "0x23"},
+		},
+	}
+	for i := range tc.rules {
+		r := &tc.rules[i]
+		r.metricLabels = metricLabels(groupName, r.alertName)
+		if r.toNearest == 1 {
+			r.query = fmt.Sprintf("round(%s) >= %s", r.metricLabels.String(), formatValue(r.threshold))
+		} else {
+			r.query = fmt.Sprintf("round(%s, %s) >= %s", r.metricLabels.String(), formatValue(r.toNearest), formatValue(r.threshold))
+		}
+	}
+	tc.stateMachine = tc.newStateMachine()
+	return tc
+}
+
+// roundedRule is an alerting rule on round() of its own series.
+type roundedRule struct {
+	alertName    string
+	query        string
+	metricLabels labels.Labels
+	toNearest    float64
+	threshold    float64
+	values       []string // Values of the series in the notation of sampleSlice.
+}
+
+// promRound rounds the value to the nearest multiple of toNearest with the ties rounded up, like round() of PromQL.
+func promRound(v, toNearest float64) float64 {
+	toNearestInverse := 1.0 / toNearest
+	return math.Floor(v*toNearestInverse+0.5) / toNearestInverse
+}
+
+// transitions returns the transitions of the alert of the rule, which is active at the samples whose rounded
+// value crosses the threshold.
+func (r roundedRule) transitions(rwInterval time.Duration, forDuration time.Duration) []Transition {
+	var ts []Transition
+	samples := sampleSlice(rwInterval, r.values...)
+	for i := 0; i < len(samples); {
+		v := promRound(samples[i].Value, r.toNearest)
+		if v < r.threshold {
+			i++
+			continue
+		}
+		j := i
+		for j < len(samples) && promRound(samples[j].Value, r.toNearest) >= r.threshold {
+			j++
+		}
+		active, inactive := time.Duration(i)*rwInterval, time.Duration(j)*rwInterval
+		ts = append(ts, Transition{From: AlertInactive, To: AlertPending, At: active, Value: formatValue(v)})
+		state := AlertPending
+		if active+forDuration < inactive {
+			ts = append(ts, Transition{From: AlertPending, To: AlertFiring, At: active + forDuration})
+			state = AlertFiring
+		}
+		ts = append(ts, Transition{From: state, To: AlertInactive, At: inactive})
+		i = j
+	}
+	return ts
+}
+
+// newStateMachine returns the expected states of the alerts, which both go into pending at the 13th sample, into
+// firing after the 'for' duration, and get resolved at the 37th sample.
+func (tc *roundedValue) newStateMachine() *StateMachine {
+	sm := &StateMachine{
+		GroupName:     tc.groupName,
+		GroupInterval: tc.groupInterval,
+	}
+	for _, r := range tc.rules {
+		var annotation string
+		transitions := r.transitions(tc.rwInterval, time.Duration(tc.forDuration))
+		if len(transitions) > 0 {
+			annotation = "The rounded value is " + transitions[0].Value
+		}
+		sm.Rules = append(sm.Rules, RuleStateMachine{
+			Rule: v1.AlertingRule{
+				Name:        r.alertName,
+				Query:       r.query,
+				Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+				Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+				Annotations: labels.FromStrings("description", "The rounded value is {{$value}}"),
+				Health:      "ok",
+				Type:        "alerting",
+			},
+			Alerts: []AlertStateMachine{
+				{
+					Labels:      labels.FromStrings("alertname", r.alertName, "foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", annotation),
+					Transitions: transitions,
+				},
+			},
+		})
+	}
+	return sm
+}
+
+type roundedValue struct {
+	groupName                 string
+	rules                     []roundedRule
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+	stateMachine              *StateMachine
+
+	zeroTime int64
+}
+
+func (tc *roundedValue) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert based on round() of a gauge that goes from pending->firing->inactive, where the raw value crosses the threshold only after rounding, and the value of the alert is the rounded value. " +
+			"(2) round() rounds the ties up, and a raw value just below the tie does not cross the threshold. " +
+			"(3) round() with a to_nearest argument rounds to the nearest multiple of it."
+}
+
+func (tc *roundedValue) RuleGroup() (rulefmt.RuleGroup, error) {
+	rg := rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+	}
+	for _, r := range tc.rules {
+		var alert, expr yaml.Node
+		if err := alert.Encode(r.alertName); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+		if err := expr.Encode(r.query); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+		rg.Rules = append(rg.Rules, rulefmt.RuleNode{
+			Alert:       alert,
+			Expr:        expr,
+			For:         tc.forDuration,
+			Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+			Annotations: map[string]string{"description": "The rounded value is {{$value}}"},
+		})
+	}
+	return rg, nil
+}
+
+func (tc *roundedValue) SamplesToRemoteWrite() []prompb.TimeSeries {
+	var series []prompb.TimeSeries
+	for _, r := range tc.rules {
+		samples := sampleSlice(tc.rwInterval, r.values...)
+		if len(samples)+12 > tc.totalSamples {
+			tc.totalSamples = len(samples) + 12 // We want to wait for 1m more to see the resolved alerts.
+		}
+		series = append(series, prompb.TimeSeries{
+			Labels:  toProtoLabels(r.metricLabels),
+			Samples: samples,
+		})
+	}
+	return series
+}
+
+func (tc *roundedValue) Init(zt int64) {
+	tc.zeroTime = zt
+	tc.stateMachine.Init(zt)
+}
+
+func (tc *roundedValue) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *roundedValue) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	return tc.stateMachine.CheckAlerts(ts, alerts)
+}
+
+func (tc *roundedValue) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	return tc.stateMachine.CheckRuleGroup(ts, rg, opts)
+}
+
+func (tc *roundedValue) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	return tc.stateMachine.CheckMetrics(ts, samples, opts)
+}
+
+func (tc *roundedValue) ExpectedAlerts() []ExpectedAlert {
+	return tc.stateMachine.ExpectedAlerts()
+}
@@ -0,0 +1,166 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// SentinelValue tests the following cases:
+// * Alert with the compound condition `metric >= 0 and metric < 5` on a gauge that uses the sentinel -1 for
+//   "unknown", which goes from pending->firing->inactive, where the alert is resolved as soon as the gauge drops
+//   to the sentinel, even though the sentinel is below the threshold.
+// * The alert goes from pending->firing->inactive again once the gauge is back below the threshold, and the
+//   sentinel never makes the alert active on its own.
+func SentinelValue() TestCase {
+	groupName := "SentinelValue"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &sentinelValue{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s >= 0 and %s < 5", lbls.String(), lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+		forDuration:   model.Duration(30 * time.Second),
+	}
+	tc.stateMachine = tc.newStateMachine()
+	return tc
+}
+
+// newStateMachine returns the expected states of the alert, which goes into pending at the 13th and the 49th
+// samples, into firing after the 'for' duration, and gets resolved at the 37th and the 73rd samples where the
+// sentinel appears.
+func (tc *sentinelValue) newStateMachine() *StateMachine {
+	_13th := 12 * tc.rwInterval
+	_37th := 36 * tc.rwInterval
+	_49th := 48 * tc.rwInterval
+	_73rd := 72 * tc.rwInterval
+	forDuration := time.Duration(tc.forDuration)
+	return &StateMachine{
+		GroupName:     tc.groupName,
+		GroupInterval: tc.groupInterval,
+		Rules: []RuleStateMachine{
+			{
+				Rule: v1.AlertingRule{
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(forDuration / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The known value is {{$value}}"),
+					Health:      "ok",
+					Type:        "alerting",
+				},
+				Alerts: []AlertStateMachine{
+					{
+						Labels:      labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName),
+						Annotations: labels.FromStrings("description", "The known value is 2"),
+						Transitions: []Transition{
+							{From: AlertInactive, To: AlertPending, At: _13th, Value: "2"},
+							{From: AlertPending, To: AlertFiring, At: _13th + forDuration},
+							{From: AlertFiring, To: AlertInactive, At: _37th},
+							{From: AlertInactive, To: AlertPending, At: _49th, Value: "2"},
+							{From: AlertPending, To: AlertFiring, At: _49th + forDuration},
+							{From: AlertFiring, To: AlertInactive, At: _73rd},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+type sentinelValue struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+	stateMachine              *StateMachine
+
+	zeroTime int64
+}
+
+func (tc *sentinelValue) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Alert with the compound condition 'metric >= 0 and metric < 5' on a gauge that uses the sentinel -1 for unknown, which goes from pending->firing->inactive, " +
+			"where the alert is resolved as soon as the gauge drops to the sentinel, even though the sentinel is below the threshold. " +
+			"(2) The alert goes from pending->firing->inactive again once the gauge is back below the threshold, and the sentinel never makes the alert active on its own."
+}
+
+func (tc *sentinelValue) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The known value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *sentinelValue) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		"10", "0x11", // 1m of above the threshold.
+		"2", "0x23", // 2m of below the threshold. Goes into pending at 1m and into firing at 1m30s.
+		"-1", "0x11", // 1m of the sentinel. Gets resolved at 3m.
+		"2", "0x23", // 2m of below the threshold. Goes into pending at 4m and into firing at 4m30s.
+		"-1", "0x23", // 2m of the sentinel. Gets resolved at 6m.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *sentinelValue) Init(zt int64) {
+	tc.zeroTime = zt
+	tc.stateMachine.Init(zt)
+}
+
+func (tc *sentinelValue) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *sentinelValue) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	return tc.stateMachine.CheckAlerts(ts, alerts)
+}
+
+func (tc *sentinelValue) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	return tc.stateMachine.CheckRuleGroup(ts, rg, opts)
+}
+
+func (tc *sentinelValue) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	return tc.stateMachine.CheckMetrics(ts, samples, opts)
+}
+
+func (tc *sentinelValue) ExpectedAlerts() []ExpectedAlert {
+	return tc.stateMachine.ExpectedAlerts()
+}
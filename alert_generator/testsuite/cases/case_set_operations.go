@@ -0,0 +1,345 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// SetOperations tests the following cases:
+// * A rule with the 'and' and 'unless' set operators, where the series of the left hand side are
+//   matched with the series of the operands by their labels ignoring the operand label.
+// * The series of the left hand side without a matching 'and' series never alert.
+// * The alerts get resolved while the left hand side stays above the threshold, one because
+//   its 'unless' series starts matching and the other because its 'and' series stops matching.
+func SetOperations() TestCase {
+	groupName := "SetOperations"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	operand := func(name string) labels.Labels {
+		return labels.NewBuilder(lbls).Set("operand", name).Labels()
+	}
+	tc := &setOperations{
+		groupName: groupName,
+		alertName: alertName,
+		query: fmt.Sprintf("%s > 10 and ignoring(operand) %s > 0 unless ignoring(operand) %s > 0",
+			operand("value").String(), operand("and").String(), operand("unless").String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(12 * tc.rwInterval)
+	return tc
+}
+
+type setOperations struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+// setOperationsSeries describes the source series of an instance in setOperations. The left hand side
+// is above the threshold from the 4th sample till the end.
+type setOperationsSeries struct {
+	name string // The instance label.
+	// The samples of the 'and' and 'unless' operands, which are absent if empty.
+	and, unless []string
+	// Index of the sample which resolves the alert. 0 if the instance never alerts.
+	resolveIdx int
+}
+
+func (tc *setOperations) series() []setOperationsSeries {
+	return []setOperationsSeries{
+		// Resolved when the 'unless' series starts matching.
+		{name: "x", and: []string{"1", "0x55"}, unless: []string{"0", "0x27", "1", "0x27"}, resolveIdx: 28},
+		// No 'and' series to match.
+		{name: "y", unless: []string{"0", "0x55"}},
+		// Resolved when the 'and' series stops matching. The 'unless' series never matches.
+		{name: "z", and: []string{"1", "0x39", "0", "0x15"}, unless: []string{"0", "0x55"}, resolveIdx: 40},
+	}
+}
+
+// alertingSeries returns the series of the instances that alert.
+func (tc *setOperations) alertingSeries() []setOperationsSeries {
+	var res []setOperationsSeries
+	for _, s := range tc.series() {
+		if s.resolveIdx > 0 {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func (tc *setOperations) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) A rule with the 'and' and 'unless' set operators, where the series of the left hand side are matched with the series of the operands by their labels ignoring the operand label. " +
+			"(2) The series of the left hand side without a matching 'and' series never alert. " +
+			"(3) The alerts get resolved while the left hand side stays above the threshold, one because its 'unless' series starts matching and the other because its 'and' series stops matching."
+}
+
+func (tc *setOperations) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:  alert,
+				Expr:   expr,
+				For:    tc.forDuration,
+				Labels: map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{
+					"description": "Instance {{$labels.instance}} is firing",
+					"summary":     "The value is {{$value}}",
+				},
+			},
+		},
+	}, nil
+}
+
+func (tc *setOperations) SamplesToRemoteWrite() []prompb.TimeSeries {
+	var res []prompb.TimeSeries
+	add := func(instance, operand string, samples []prompb.Sample) {
+		if len(samples) > tc.totalSamples {
+			tc.totalSamples = len(samples)
+		}
+		res = append(res, prompb.TimeSeries{
+			Labels:  toProtoLabels(labels.NewBuilder(tc.metricLabels).Set("instance", instance).Set("operand", operand).Labels()),
+			Samples: samples,
+		})
+	}
+	for _, s := range tc.series() {
+		// All comment times is assuming 15s interval.
+		add(s.name, "value", sampleSlice(tc.rwInterval,
+			"1", "0x3", // 1m of inactive.
+			"15", "0x51", // Pending @1m and goes into firing @4m if the operands match.
+		))
+		if len(s.and) > 0 {
+			add(s.name, "and", sampleSlice(tc.rwInterval, s.and...))
+		}
+		if len(s.unless) > 0 {
+			add(s.name, "unless", sampleSlice(tc.rwInterval, s.unless...))
+		}
+	}
+	return res
+}
+
+func (tc *setOperations) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *setOperations) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *setOperations) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *setOperations) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *setOperations) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *setOperations) alertLabels(s setOperationsSeries) labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "instance", s.name, "operand", "value", "rulegroup", tc.groupName)
+}
+
+func (tc *setOperations) alertAnnotations(s setOperationsSeries) labels.Labels {
+	return labels.FromStrings("description", fmt.Sprintf("Instance %s is firing", s.name), "summary", "The value is 15")
+}
+
+// possibleAlerts returns all the possible combinations of the alerts of all the alerting series.
+// An empty state means that the alert for the series can be absent.
+// Since all the series become active together, their alerts are always in the same state
+// until they get resolved in the order of the series.
+func (tc *setOperations) possibleAlerts(ts int64) [][]v1.Alert {
+	relTs := ts - tc.zeroTime
+	activeAt := timestamp.Time(tc.zeroTime + int64(4*tc.rwInterval/time.Millisecond))
+	_16th := int64(16 * tc.rwInterval / time.Millisecond)
+
+	var perSeries [][]*v1.Alert
+	for _, s := range tc.alertingSeries() {
+		canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs, s)
+		perSeries = append(perSeries, possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(s),
+			Annotations: tc.alertAnnotations(s),
+			Value:       "15",
+			ActiveAt:    &activeAt,
+		}))
+	}
+
+	// stage tells how far the alert of a series has progressed in its
+	// inactive->pending->firing->inactive cycle. nil is the inactive state.
+	stage := func(a *v1.Alert) int {
+		switch {
+		case a == nil && relTs < _16th:
+			return 0
+		case a == nil:
+			return 3
+		case a.State == "pending":
+			return 1
+		}
+		return 2
+	}
+	return alertCombinations(perSeries, func(c []*v1.Alert) bool {
+		for i := 1; i < len(c); i++ {
+			prev, curr := stage(c[i-1]), stage(c[i])
+			// The previous series can only be ahead of this series by getting resolved first.
+			if prev != curr && (prev != 3 || curr != 2) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (tc *setOperations) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *setOperations) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "Instance {{$labels.instance}} is firing", "summary", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *setOperations) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *setOperations) allPossibleStates(ts int64, s setOperationsSeries) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_4th := 4 * rwItvlSecFloat                         // Goes into pending.
+	_16th := 16 * rwItvlSecFloat                       // Goes into firing.
+	resolved := float64(s.resolveIdx) * rwItvlSecFloat // Resolved.
+	canBeInactive = between(0, _4th+grpItvlSecFloat) ||
+		between(resolved-1, 240*rwItvlSecFloat)
+	canBePending = between(_4th-1, _16th+grpItvlSecFloat)
+	canBeFiring = between(_16th-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *setOperations) ExpectedAlerts() []ExpectedAlert {
+	_16th := 16 * int64(tc.rwInterval/time.Millisecond) // Firing.
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for _, s := range tc.alertingSeries() {
+		resolved := int64(s.resolveIdx) * int64(tc.rwInterval/time.Millisecond)
+		resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+		for ts := _16th; ts < resolved; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != _16th,
+				NextState:     timestamp.Time(tc.zeroTime + resolved),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(s),
+					Annotations: tc.alertAnnotations(s),
+					StartsAt:    timestamp.Time(tc.zeroTime + _16th),
+				},
+			})
+		}
+
+		for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+			tolerance := tc.groupInterval
+			if ts == resolved {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+				// based on this first resolved alert.
+				tolerance = 2 * tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != resolved,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(s),
+					Annotations: tc.alertAnnotations(s),
+					StartsAt:    timestamp.Time(tc.zeroTime + _16th),
+				},
+			})
+		}
+	}
+
+	return exp
+}
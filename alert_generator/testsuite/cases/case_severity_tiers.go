@@ -0,0 +1,181 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// SeverityTiers tests the following cases:
+// * Two alerting rules in the same group with the same expression and annotations, that only differ by their
+//   'for' duration and a severity label, like "warning after 5m, critical after 15m" (scaled down here). Each goes
+//   from pending->firing->inactive at its own 'for' boundary, with the same activeAt. The alert names differ only
+//   because an alert name cannot repeat within a group of the test suite.
+// * When the condition lasts longer than the shorter 'for' but not the longer one, only the warning fires and
+//   the critical goes from pending->inactive.
+func SeverityTiers() TestCase {
+	groupName := "SeverityTiers"
+	lbls := metricLabels(groupName, groupName+"_Alert")
+	tc := &severityTiers{
+		groupName:    groupName,
+		query:        fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels: lbls,
+		tiers: []severityTier{
+			{alertName: groupName + "_Warning", severity: "warning", forDuration: model.Duration(30 * time.Second)},
+			{alertName: groupName + "_Critical", severity: "critical", forDuration: model.Duration(90 * time.Second)},
+		},
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.stateMachine = tc.newStateMachine()
+	return tc
+}
+
+// severityTier is a rule of SeverityTiers.
+type severityTier struct {
+	alertName   string
+	severity    string
+	forDuration model.Duration
+}
+
+// newStateMachine returns the expected states of the alerts of the tiers. The condition holds from the 13th sample
+// until the 49th sample, and from the 61st sample until the 73rd sample, which is shorter than the 'for' of the
+// critical tier.
+func (tc *severityTiers) newStateMachine() *StateMachine {
+	episodes := [][2]time.Duration{
+		{12 * tc.rwInterval, 48 * tc.rwInterval},
+		{60 * tc.rwInterval, 72 * tc.rwInterval},
+	}
+	sm := &StateMachine{
+		GroupName:     tc.groupName,
+		GroupInterval: tc.groupInterval,
+	}
+	for _, tier := range tc.tiers {
+		forDuration := time.Duration(tier.forDuration)
+		var transitions []Transition
+		for _, e := range episodes {
+			active, inactive := e[0], e[1]
+			transitions = append(transitions, Transition{From: AlertInactive, To: AlertPending, At: active, Value: "15"})
+			if active+forDuration < inactive {
+				transitions = append(transitions,
+					Transition{From: AlertPending, To: AlertFiring, At: active + forDuration},
+					Transition{From: AlertFiring, To: AlertInactive, At: inactive},
+				)
+			} else {
+				transitions = append(transitions, Transition{From: AlertPending, To: AlertInactive, At: inactive})
+			}
+		}
+		sm.Rules = append(sm.Rules, RuleStateMachine{
+			Rule: v1.AlertingRule{
+				Name:        tier.alertName,
+				Query:       tc.query,
+				Duration:    float64(forDuration / time.Second),
+				Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName, "severity", tier.severity),
+				Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+				Health:      "ok",
+				Type:        "alerting",
+			},
+			Alerts: []AlertStateMachine{
+				{
+					Labels:      labels.FromStrings("alertname", tier.alertName, "foo", "bar", "rulegroup", tc.groupName, "severity", tier.severity),
+					Annotations: labels.FromStrings("description", "The value is 15"),
+					Transitions: transitions,
+				},
+			},
+		})
+	}
+	return sm
+}
+
+type severityTiers struct {
+	groupName                 string
+	query                     string
+	metricLabels              labels.Labels
+	tiers                     []severityTier
+	rwInterval, groupInterval time.Duration
+	totalSamples              int
+	stateMachine              *StateMachine
+
+	zeroTime int64
+}
+
+func (tc *severityTiers) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Two alerting rules in the same group with the same expression and annotations, that only differ by their 'for' duration and a severity label. " +
+			"Each goes from pending->firing->inactive at its own 'for' boundary, with the same activeAt. " +
+			"(2) When the condition lasts longer than the shorter 'for' but not the longer one, only the warning fires and the critical goes from pending->inactive."
+}
+
+func (tc *severityTiers) RuleGroup() (rulefmt.RuleGroup, error) {
+	rg := rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+	}
+	for _, tier := range tc.tiers {
+		var alert, expr yaml.Node
+		if err := alert.Encode(tier.alertName); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+		if err := expr.Encode(tc.query); err != nil {
+			return rulefmt.RuleGroup{}, err
+		}
+		rg.Rules = append(rg.Rules, rulefmt.RuleNode{
+			Alert:       alert,
+			Expr:        expr,
+			For:         tier.forDuration,
+			Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName, "severity": tier.severity},
+			Annotations: map[string]string{"description": "The value is {{$value}}"},
+		})
+	}
+	return rg, nil
+}
+
+func (tc *severityTiers) SamplesToRemoteWrite() []prompb.TimeSeries {
+	samples := sampleSlice(tc.rwInterval,
+		"5", "0x11", // 1m of below the threshold.
+		"15", "0x35", // 3m of above the threshold. Both tiers fire.
+		"5", "0x11", // 1m of below the threshold. Both get resolved.
+		"15", "0x11", // 1m of above the threshold. Only the warning fires.
+		"5", "0x23", // 2m of below the threshold.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.metricLabels),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *severityTiers) Init(zt int64) {
+	tc.zeroTime = zt
+	tc.stateMachine.Init(zt)
+}
+
+func (tc *severityTiers) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *severityTiers) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	return tc.stateMachine.CheckAlerts(ts, alerts)
+}
+
+func (tc *severityTiers) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	return tc.stateMachine.CheckRuleGroup(ts, rg, opts)
+}
+
+func (tc *severityTiers) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	return tc.stateMachine.CheckMetrics(ts, samples, opts)
+}
+
+func (tc *severityTiers) ExpectedAlerts() []ExpectedAlert {
+	return tc.stateMachine.ExpectedAlerts()
+}
@@ -0,0 +1,317 @@
+package cases
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// StaggeredResolve tests the following cases:
+// * A rule that fires for multiple series where the series cross the threshold together
+//   but drop below the threshold at different times.
+// * Each alert resolves independently, i.e. the first alert gets resolved while the
+//   second alert keeps firing, with its own ResolvedTime/EndsAt.
+func StaggeredResolve() TestCase {
+	groupName := "StaggeredResolve"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &staggeredResolve{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(12 * tc.rwInterval)
+	return tc
+}
+
+type staggeredResolve struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+// staggeredSeries describes the source series of an alert in staggeredResolve.
+type staggeredSeries struct {
+	name       string
+	value      string // Value of the sample when it is active.
+	resolveIdx int    // Index of the sample which resolves the alert.
+}
+
+func (tc *staggeredResolve) series() []staggeredSeries {
+	return []staggeredSeries{
+		{name: "one", value: "11", resolveIdx: 28},
+		{name: "two", value: "12", resolveIdx: 40},
+	}
+}
+
+func (tc *staggeredResolve) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) A rule that fires for multiple series where the series cross the threshold together but drop below the threshold at different times. " +
+			"(2) Each alert resolves independently, i.e. the first alert gets resolved while the second alert keeps firing, with its own ResolvedTime/EndsAt."
+}
+
+func (tc *staggeredResolve) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:  alert,
+				Expr:   expr,
+				For:    tc.forDuration,
+				Labels: map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{
+					"description": "Series {{$labels.series}} is firing",
+					"summary":     "The value is {{$value}}",
+				},
+			},
+		},
+	}, nil
+}
+
+func (tc *staggeredResolve) SamplesToRemoteWrite() []prompb.TimeSeries {
+	var res []prompb.TimeSeries
+	for _, s := range tc.series() {
+		series := append(tc.metricLabels.Copy(), labels.Label{Name: "series", Value: s.name})
+		sort.Sort(series)
+		samples := sampleSlice(tc.rwInterval,
+			// All comment times is assuming 15s interval.
+			"1", "0x3", // 1m of inactive.
+			s.value, fmt.Sprintf("0x%d", s.resolveIdx-5), // Pending @1m and goes into firing @4m.
+			"9", fmt.Sprintf("0x%d", 55-s.resolveIdx), // Resolved until the end of test.
+		)
+		if len(samples) > tc.totalSamples {
+			tc.totalSamples = len(samples)
+		}
+		res = append(res, prompb.TimeSeries{
+			Labels:  toProtoLabels(series),
+			Samples: samples,
+		})
+	}
+	return res
+}
+
+func (tc *staggeredResolve) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *staggeredResolve) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *staggeredResolve) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *staggeredResolve) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *staggeredResolve) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *staggeredResolve) alertLabels(s staggeredSeries) labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName, "series", s.name)
+}
+
+func (tc *staggeredResolve) alertAnnotations(s staggeredSeries) labels.Labels {
+	return labels.FromStrings("description", fmt.Sprintf("Series %s is firing", s.name), "summary", "The value is "+s.value)
+}
+
+// possibleAlerts returns all the possible combinations of the alerts of all the series.
+// An empty state means that the alert for the series can be absent.
+// Since all the series become active together, their alerts are always in the same state
+// until they get resolved in the order of the series.
+func (tc *staggeredResolve) possibleAlerts(ts int64) [][]v1.Alert {
+	relTs := ts - tc.zeroTime
+	activeAt := timestamp.Time(tc.zeroTime + int64(4*tc.rwInterval/time.Millisecond))
+	_16th := int64(16 * tc.rwInterval / time.Millisecond)
+
+	var perSeries [][]*v1.Alert
+	for _, s := range tc.series() {
+		canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs, s)
+		perSeries = append(perSeries, possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(s),
+			Annotations: tc.alertAnnotations(s),
+			Value:       s.value,
+			ActiveAt:    &activeAt,
+		}))
+	}
+
+	// stage tells how far the alert of a series has progressed in its
+	// inactive->pending->firing->inactive cycle. nil is the inactive state.
+	stage := func(a *v1.Alert) int {
+		switch {
+		case a == nil && relTs < _16th:
+			return 0
+		case a == nil:
+			return 3
+		case a.State == "pending":
+			return 1
+		}
+		return 2
+	}
+	return alertCombinations(perSeries, func(c []*v1.Alert) bool {
+		for i := 1; i < len(c); i++ {
+			prev, curr := stage(c[i-1]), stage(c[i])
+			// The previous series can only be ahead of this series by getting resolved first.
+			if prev != curr && (prev != 3 || curr != 2) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (tc *staggeredResolve) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *staggeredResolve) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "Series {{$labels.series}} is firing", "summary", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *staggeredResolve) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *staggeredResolve) allPossibleStates(ts int64, s staggeredSeries) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_4th := 4 * rwItvlSecFloat                         // Goes into pending.
+	_16th := 16 * rwItvlSecFloat                       // Goes into firing.
+	resolved := float64(s.resolveIdx) * rwItvlSecFloat // Resolved.
+	canBeInactive = between(0, _4th+grpItvlSecFloat) ||
+		between(resolved-1, 240*rwItvlSecFloat)
+	canBePending = between(_4th-1, _16th+grpItvlSecFloat)
+	canBeFiring = between(_16th-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *staggeredResolve) ExpectedAlerts() []ExpectedAlert {
+	_16th := 16 * int64(tc.rwInterval/time.Millisecond) // Firing.
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for _, s := range tc.series() {
+		resolved := int64(s.resolveIdx) * int64(tc.rwInterval/time.Millisecond)
+		resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+		for ts := _16th; ts < resolved; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != _16th,
+				NextState:     timestamp.Time(tc.zeroTime + resolved),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(s),
+					Annotations: tc.alertAnnotations(s),
+					StartsAt:    timestamp.Time(tc.zeroTime + _16th),
+				},
+			})
+		}
+
+		for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+			tolerance := tc.groupInterval
+			if ts == resolved {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+				// based on this first resolved alert.
+				tolerance = 2 * tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != resolved,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(s),
+					Annotations: tc.alertAnnotations(s),
+					StartsAt:    timestamp.Time(tc.zeroTime + _16th),
+				},
+			})
+		}
+	}
+
+	return exp
+}
@@ -0,0 +1,301 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateControlFlow tests the following cases:
+// * The annotations of the alert use the `with` and `range` blocks of the templates over the results of the
+//   `query` function, enumerating the instances that are down in the order of `sortByLabel`, and rendering
+//   the `else` branch of `with` for a query without results. The rendered annotations are compared exactly.
+// * The alert on the count of the instances that are down becomes active while 2 of the 3 instances are down,
+//   and gets resolved when they are back up.
+func TemplateControlFlow() TestCase {
+	groupName := "TemplateControlFlow"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &templateControlFlow{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("count(%s == 0) > 1", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(30 * time.Second)
+	return tc
+}
+
+type templateControlFlow struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *templateControlFlow) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) The annotations use the 'with' and 'range' blocks of the templates over the results of the 'query' function to enumerate the instances that are down, " +
+			"including the 'else' branch of 'with'. (2) The alert becomes active while 2 of the 3 instances are down, and gets resolved when they are back up."
+}
+
+func (tc *templateControlFlow) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: tc.ruleAnnotations(),
+			},
+		},
+	}, nil
+}
+
+// ruleAnnotations returns the templates of the annotations of the alerting rule.
+func (tc *templateControlFlow) ruleAnnotations() map[string]string {
+	down := fmt.Sprintf("%s == 0", tc.metricLabels.String())
+	return map[string]string{
+		"instances": fmt.Sprintf("{{ range query `%s` | sortByLabel \"instance\" }}{{ .Labels.instance }}={{ .Value }};{{ end }}", down),
+		"summary":   fmt.Sprintf("{{ with query `count(%s)` }}{{ . | first | value }} of 3 down{{ else }}none down{{ end }}", down),
+		"above_one": fmt.Sprintf("{{ with query `%s > 1` }}{{ range . }}{{ .Labels.instance }}{{ end }}{{ else }}none above 1{{ end }}", tc.metricLabels.String()),
+	}
+}
+
+// annotations returns the annotations of the alert as rendered while the instances a and c are down.
+func (tc *templateControlFlow) annotations() labels.Labels {
+	return labels.FromStrings(
+		"instances", "a=0;c=0;",
+		"summary", "2 of 3 down",
+		"above_one", "none above 1",
+	)
+}
+
+func (tc *templateControlFlow) SamplesToRemoteWrite() []prompb.TimeSeries {
+	up := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 5s interval.
+		"1", "0x58", // 5m up.
+	)
+	flapping := sampleSlice(tc.rwInterval,
+		"1", "0x11", // 1m up.
+		"0", "0x35", // 3m down. Goes into pending at 1m and into firing at 1m30s.
+		"1", "0x11", // 1m up. Resolved at 4m.
+	)
+	tc.totalSamples = len(up)
+	series := func(instance string, samples []prompb.Sample) prompb.TimeSeries {
+		lbls := labels.NewBuilder(tc.metricLabels).Set("instance", instance).Labels()
+		return prompb.TimeSeries{
+			Labels:  toProtoLabels(lbls),
+			Samples: samples,
+		}
+	}
+	// The instances are written out of their order in the annotations.
+	return []prompb.TimeSeries{
+		series("c", flapping),
+		series("b", up),
+		series("a", flapping),
+	}
+}
+
+func (tc *templateControlFlow) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *templateControlFlow) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *templateControlFlow) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *templateControlFlow) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *templateControlFlow) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// activeTime is the time relative to zeroTime when the alert becomes active, which is the first sample
+// of the instances down.
+func (tc *templateControlFlow) activeTime() time.Duration {
+	return 12 * tc.rwInterval
+}
+
+// firingTime is the time relative to zeroTime when the alert goes into firing.
+func (tc *templateControlFlow) firingTime() time.Duration {
+	return tc.activeTime() + time.Duration(tc.forDuration)
+}
+
+// resolvedTime is the time relative to zeroTime when the alert gets resolved, which is the first sample
+// of the instances back up.
+func (tc *templateControlFlow) resolvedTime() time.Duration {
+	return 48 * tc.rwInterval
+}
+
+func (tc *templateControlFlow) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName)
+}
+
+func (tc *templateControlFlow) possibleAlerts(ts int64) [][]v1.Alert {
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(ts - tc.zeroTime)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+	return alertCombinations([][]*v1.Alert{
+		possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(),
+			Annotations: tc.annotations(),
+			Value:       "2",
+			ActiveAt:    &activeAt,
+		}),
+	}, nil)
+}
+
+func (tc *templateControlFlow) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *templateControlFlow) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromMap(tc.ruleAnnotations()),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *templateControlFlow) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *templateControlFlow) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := tc.activeTime().Seconds()     // Goes into pending.
+	firing := tc.firingTime().Seconds()     // Goes into firing.
+	resolved := tc.resolvedTime().Seconds() // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, 2*resolved)
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *templateControlFlow) ExpectedAlerts() []ExpectedAlert {
+	firing := int64(tc.firingTime() / time.Millisecond)
+	resolved := int64(tc.resolvedTime() / time.Millisecond)
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < resolved; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + resolved),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.annotations(),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == resolved {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != resolved,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.annotations(),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
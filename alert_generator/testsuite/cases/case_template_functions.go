@@ -0,0 +1,356 @@
+package cases
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateFunctions tests the following cases:
+// * Expansion of annotations that use the newer template functions (parseDuration, stripPort, args,
+//   humanizeDuration, humanizePercentage, humanizeTimestamp) with deterministic inputs.
+// * The rendered annotations are compared exactly, both via API and in the alerts sent.
+// Note: toTime and stripDomain are not part of the template functions of the Prometheus version
+// that this test suite validates the rules against, hence they are not covered here.
+func TemplateFunctions() TestCase {
+	groupName := "TemplateFunctions"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &templateFunctions{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		instance:      "host.example.com:9100",
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(12 * tc.rwInterval)
+	return tc
+}
+
+type templateFunctions struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	instance                  string
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *templateFunctions) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) Expansion of annotations that use the newer template functions (parseDuration, stripPort, args, humanizeDuration, humanizePercentage, humanizeTimestamp) with deterministic inputs. " +
+			"(2) The rendered annotations are compared exactly, both via API and in the alerts sent."
+}
+
+// annotationTemplates are the annotations as written in the rule.
+func (tc *templateFunctions) annotationTemplates() map[string]string {
+	return map[string]string{
+		"duration":         `{{ "1h30m" | parseDuration }}`,
+		"duration_human":   `{{ "90s" | parseDuration | humanizeDuration }}`,
+		"host":             `{{ $labels.instance | stripPort }}`,
+		"host_no_port":     `{{ stripPort "example.com" }}`,
+		"args":             `{{ with args "foo" 5 }}{{ .arg0 }}-{{ .arg1 }}{{ end }}`,
+		"value_percentage": `{{ $value | humanizePercentage }}`,
+		"timestamp":        `{{ 1435065584.128 | humanizeTimestamp }}`,
+	}
+}
+
+// expandedAnnotations are the annotations after the templates are expanded.
+func (tc *templateFunctions) expandedAnnotations() labels.Labels {
+	return labels.FromStrings(
+		"duration", "5400",
+		"duration_human", "1m 30s",
+		"host", "host.example.com",
+		"host_no_port", "example.com",
+		"args", "foo-5",
+		"value_percentage", "1100%",
+		"timestamp", "2015-06-23 13:19:44.128 +0000 UTC",
+	)
+}
+
+func (tc *templateFunctions) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: tc.annotationTemplates(),
+			},
+		},
+	}, nil
+}
+
+func (tc *templateFunctions) SamplesToRemoteWrite() []prompb.TimeSeries {
+	series := append(tc.metricLabels.Copy(), labels.Label{Name: "instance", Value: tc.instance})
+	sort.Sort(series)
+	samples := sampleSlice(tc.rwInterval,
+		// All comment times is assuming 15s interval.
+		"1", "0x3", // 1m of inactive.
+		"11", "0x23", // 6m of active. Pending @1m and goes into firing @4m.
+		"9", "0x15", // 4m of resolved.
+	)
+	tc.totalSamples = len(samples)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(series),
+			Samples: samples,
+		},
+	}
+}
+
+func (tc *templateFunctions) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *templateFunctions) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *templateFunctions) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *templateFunctions) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *templateFunctions) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *templateFunctions) alertLabels() labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "instance", tc.instance, "rulegroup", tc.groupName)
+}
+
+func (tc *templateFunctions) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(4*tc.rwInterval/time.Millisecond))
+
+	if canBeInactive {
+		expAlerts = append(expAlerts, []v1.Alert{})
+	}
+	if canBePending {
+		expAlerts = append(expAlerts, []v1.Alert{
+			{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.expandedAnnotations(),
+				State:       "pending",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			},
+		})
+	}
+	if canBeFiring {
+		expAlerts = append(expAlerts, []v1.Alert{
+			{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.expandedAnnotations(),
+				State:       "firing",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			},
+		})
+	}
+
+	return expAlerts
+}
+
+func (tc *templateFunctions) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+	activeAt := timestamp.Time(tc.zeroTime + int64(4*tc.rwInterval/time.Millisecond))
+
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromMap(tc.annotationTemplates()),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	if canBeInactive {
+		expRgs = append(expRgs, getRg("inactive", nil))
+	}
+	if canBePending {
+		expRgs = append(expRgs, getRg("pending", []*v1.Alert{
+			{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.expandedAnnotations(),
+				State:       "pending",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			},
+		}))
+	}
+	if canBeFiring {
+		expRgs = append(expRgs, getRg("firing", []*v1.Alert{
+			{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.expandedAnnotations(),
+				State:       "firing",
+				Value:       "11",
+				ActiveAt:    &activeAt,
+			},
+		}))
+	}
+
+	return expRgs
+}
+
+func (tc *templateFunctions) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	relTs := ts - tc.zeroTime
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs)
+
+	if canBeInactive {
+		expSamples = append(expSamples, nil)
+	}
+	if canBePending {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "pending", "alertname", tc.alertName, "foo", "bar", "instance", tc.instance, "rulegroup", tc.groupName),
+			},
+		})
+	}
+	if canBeFiring {
+		expSamples = append(expSamples, []promql.Sample{
+			{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "alertname", tc.alertName, "foo", "bar", "instance", tc.instance, "rulegroup", tc.groupName),
+			},
+		})
+	}
+
+	return expSamples
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *templateFunctions) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	_4th := 4 * rwItvlSecFloat   // Goes into pending.
+	_16th := 16 * rwItvlSecFloat // Goes into firing.
+	_28th := 28 * rwItvlSecFloat // Resolved.
+	canBeInactive = between(0, _4th+grpItvlSecFloat) ||
+		between(_28th-1, 240*rwItvlSecFloat)
+	canBePending = between(_4th-1, _16th+grpItvlSecFloat)
+	canBeFiring = between(_16th-1, _28th+grpItvlSecFloat)
+	return
+}
+
+func (tc *templateFunctions) ExpectedAlerts() []ExpectedAlert {
+	_16th := 16 * int64(tc.rwInterval/time.Millisecond) // Firing.
+	_28th := 28 * int64(tc.rwInterval/time.Millisecond) // Resolved.
+	_28thPlus15m := _28th + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := _16th; ts < _28th; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != _16th,
+			NextState:     timestamp.Time(tc.zeroTime + _28th),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _28th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.expandedAnnotations(),
+				StartsAt:    timestamp.Time(tc.zeroTime + _16th),
+			},
+		})
+	}
+
+	for ts := _28th; ts < _28thPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == _28th {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != _28th,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + _28th),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: tc.expandedAnnotations(),
+				StartsAt:    timestamp.Time(tc.zeroTime + _16th),
+			},
+		})
+	}
+
+	return exp
+}
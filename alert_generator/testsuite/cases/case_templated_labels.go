@@ -0,0 +1,303 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplatedLabels tests the following cases:
+// * The label values of an alerting rule are templates expanded like the annotations, with $labels of
+//   the expr result, and the alerts and the ALERTS series carry the expanded values.
+// * Since the labels identify an alert, a label templated with $value changes the identity of the alert
+//   when the value crosses the boundary of the template. The alert with the old labels gets resolved and
+//   the alert with the new labels starts over from pending, even though the expr result never stopped.
+func TemplatedLabels() TestCase {
+	groupName := "TemplatedLabels"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &templatedLabels{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(6 * tc.rwInterval)
+	return tc
+}
+
+type templatedLabels struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+// templatedLabelsAlert describes an alert in templatedLabels. The times are relative to zeroTime.
+type templatedLabelsAlert struct {
+	instance, severity, value string
+	activeTime, resolvedTime  time.Duration
+}
+
+func (tc *templatedLabels) alerts() []templatedLabelsAlert {
+	active := 4 * tc.rwInterval
+	escalated := 40 * tc.rwInterval // The value of instance b goes above 20.
+	resolved := 70 * tc.rwInterval
+	return []templatedLabelsAlert{
+		{instance: "a", severity: "warning", value: "15", activeTime: active, resolvedTime: resolved},
+		{instance: "b", severity: "warning", value: "15", activeTime: active, resolvedTime: escalated},
+		{instance: "b", severity: "critical", value: "25", activeTime: escalated, resolvedTime: resolved},
+	}
+}
+
+func (tc *templatedLabels) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) The label values of an alerting rule are templates expanded with $labels of the expr result, and the alerts and the ALERTS series carry the expanded values. " +
+			"(2) A label templated with $value changes the identity of the alert when the value crosses the boundary of the template, which resolves the alert with the old labels and starts the alert with the new labels from pending."
+}
+
+func (tc *templatedLabels) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert: alert,
+				Expr:  expr,
+				For:   tc.forDuration,
+				Labels: map[string]string{
+					"rulegroup":      tc.groupName,
+					"instance_group": "group-{{ $labels.instance }}",
+					"severity":       "{{ if gt $value 20.0 }}critical{{ else }}warning{{ end }}",
+				},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *templatedLabels) SamplesToRemoteWrite() []prompb.TimeSeries {
+	// All comment times is assuming 15s interval.
+	a := sampleSlice(tc.rwInterval,
+		"3", "0x3", // 1m (3 is @0 time).
+		"15", "0x65", // 16m30s of active. Goes into pending at 1m and into firing at 2m30s.
+		"5", "0x11", // 3m of resolved.
+	)
+	b := sampleSlice(tc.rwInterval,
+		"3", "0x3", // 1m (3 is @0 time).
+		"15", "0x35", // 9m of active as warning. Goes into pending at 1m and into firing at 2m30s.
+		"25", "0x29", // 7m30s of active as critical. The warning is resolved and the critical goes into pending at 10m.
+		"5", "0x11", // 3m of resolved.
+	)
+	tc.totalSamples = len(a)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(labels.NewBuilder(tc.metricLabels).Set("instance", "a").Labels()),
+			Samples: a,
+		},
+		{
+			Labels:  toProtoLabels(labels.NewBuilder(tc.metricLabels).Set("instance", "b").Labels()),
+			Samples: b,
+		},
+	}
+}
+
+func (tc *templatedLabels) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *templatedLabels) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *templatedLabels) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *templatedLabels) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *templatedLabels) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// alertLabels are the labels of the alert with the templates of the rule labels expanded.
+func (tc *templatedLabels) alertLabels(a templatedLabelsAlert) labels.Labels {
+	return labels.FromStrings(
+		"alertname", tc.alertName,
+		"instance", a.instance,
+		"instance_group", "group-"+a.instance,
+		"rulegroup", tc.groupName,
+		"severity", a.severity,
+	)
+}
+
+func (tc *templatedLabels) possibleAlerts(ts int64) [][]v1.Alert {
+	var perSeries [][]*v1.Alert
+	for _, a := range tc.alerts() {
+		canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(ts-tc.zeroTime, a)
+		activeAt := timestamp.Time(tc.zeroTime + int64(a.activeTime/time.Millisecond))
+		perSeries = append(perSeries, possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(a),
+			Annotations: labels.FromStrings("description", "The value is "+a.value),
+			Value:       a.value,
+			ActiveAt:    &activeAt,
+		}))
+	}
+	return alertCombinations(perSeries, nil)
+}
+
+func (tc *templatedLabels) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *templatedLabels) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:    state,
+					Name:     tc.alertName,
+					Query:    tc.query,
+					Duration: float64(time.Duration(tc.forDuration) / time.Second),
+					// The rules API has the labels of the rule as they are, without expanding the templates.
+					Labels: labels.FromStrings(
+						"rulegroup", tc.groupName,
+						"instance_group", "group-{{ $labels.instance }}",
+						"severity", "{{ if gt $value 20.0 }}critical{{ else }}warning{{ end }}",
+					),
+					Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *templatedLabels) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *templatedLabels) allPossibleStates(ts int64, a templatedLabelsAlert) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := a.activeTime.Seconds()                                   // Goes into pending.
+	firing := (a.activeTime + time.Duration(tc.forDuration)).Seconds() // Goes into firing.
+	resolved := a.resolvedTime.Seconds()                               // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, float64(tc.totalSamples)*tc.rwInterval.Seconds())
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *templatedLabels) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for _, a := range tc.alerts() {
+		firing := int64((a.activeTime + time.Duration(tc.forDuration)) / time.Millisecond)
+		resolved := int64(a.resolvedTime / time.Millisecond)
+		resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+		annotations := labels.FromStrings("description", "The value is "+a.value)
+
+		for ts := firing; ts < resolved; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != firing,
+				NextState:     timestamp.Time(tc.zeroTime + resolved),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(a),
+					Annotations: annotations,
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+
+		for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+			tolerance := tc.groupInterval
+			if ts == resolved {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+				// based on this first resolved alert.
+				tolerance = 2 * tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != resolved,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(a),
+					Annotations: annotations,
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+	}
+
+	return exp
+}
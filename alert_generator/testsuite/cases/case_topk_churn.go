@@ -0,0 +1,333 @@
+package cases
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// TopKChurn tests the following cases:
+// * A rule with topk() where the set of series in the result changes over time while all the
+//   series stay above the threshold.
+// * A series leaving the top k gets its alert resolved while the series entering the top k
+//   in the same evaluation gets a new alert that goes from pending->firing on its own.
+// * A series that stays in the top k keeps firing throughout the churn.
+func TopKChurn() TestCase {
+	groupName := "TopKChurn"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &topKChurn{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("topk(2, %s) > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(12 * tc.rwInterval)
+	return tc
+}
+
+type topKChurn struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+// topKPhases is the index of the first sample of each phase of the samples in topKChurn.
+// The series are below the threshold in the first and last phase.
+var topKPhases = []int{0, 4, 28, 52}
+
+const topKTotalSamples = 64
+
+// topKSeries describes the source series of an alert in topKChurn.
+type topKSeries struct {
+	name       string
+	values     []string // Value of the samples in each phase of topKPhases.
+	value      string   // Value of the sample when it is in the top k.
+	activeIdx  int      // Index of the sample which brings the series into the top k.
+	resolveIdx int      // Index of the sample which takes the series out of the top k.
+}
+
+func (tc *topKChurn) series() []topKSeries {
+	return []topKSeries{
+		// Stays in the top k.
+		{name: "one", values: []string{"1", "30", "30", "1"}, value: "30", activeIdx: 4, resolveIdx: 52},
+		// Leaves the top k in the 2nd phase.
+		{name: "two", values: []string{"2", "20", "14", "2"}, value: "20", activeIdx: 4, resolveIdx: 28},
+		// Enters the top k in the 2nd phase.
+		{name: "three", values: []string{"3", "15", "25", "3"}, value: "25", activeIdx: 28, resolveIdx: 52},
+	}
+}
+
+func (tc *topKChurn) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) A rule with topk() where the set of series in the result changes over time while all the series stay above the threshold. " +
+			"(2) A series leaving the top k gets its alert resolved while the series entering the top k in the same evaluation gets a new alert that goes from pending->firing on its own. " +
+			"(3) A series that stays in the top k keeps firing throughout the churn."
+}
+
+func (tc *topKChurn) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:  alert,
+				Expr:   expr,
+				For:    tc.forDuration,
+				Labels: map[string]string{"foo": "bar", "rulegroup": tc.groupName},
+				Annotations: map[string]string{
+					"description": "Series {{$labels.series}} is in the top 2",
+					"summary":     "The value is {{$value}}",
+				},
+			},
+		},
+	}, nil
+}
+
+func (tc *topKChurn) SamplesToRemoteWrite() []prompb.TimeSeries {
+	var res []prompb.TimeSeries
+	for _, s := range tc.series() {
+		series := append(tc.metricLabels.Copy(), labels.Label{Name: "series", Value: s.name})
+		sort.Sort(series)
+		// All comment times is assuming 15s interval.
+		// 1m of inactive, 6m of first top k, 6m of second top k, 3m of inactive.
+		var values []string
+		for i, v := range s.values {
+			end := topKTotalSamples
+			if i+1 < len(topKPhases) {
+				end = topKPhases[i+1]
+			}
+			values = append(values, v, fmt.Sprintf("0x%d", end-topKPhases[i]-1))
+		}
+		samples := sampleSlice(tc.rwInterval, values...)
+		tc.totalSamples = len(samples)
+		res = append(res, prompb.TimeSeries{
+			Labels:  toProtoLabels(series),
+			Samples: samples,
+		})
+	}
+	return res
+}
+
+func (tc *topKChurn) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *topKChurn) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *topKChurn) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *topKChurn) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *topKChurn) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *topKChurn) alertLabels(s topKSeries) labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "foo", "bar", "rulegroup", tc.groupName, "series", s.name)
+}
+
+func (tc *topKChurn) alertAnnotations(s topKSeries) labels.Labels {
+	return labels.FromStrings("description", fmt.Sprintf("Series %s is in the top 2", s.name), "summary", "The value is "+s.value)
+}
+
+// possibleAlerts returns all the possible combinations of the alerts of all the series.
+// An empty state means that the alert for the series can be absent.
+// The alerts present at any time are of the series in the top k as per the samples of a single
+// phase, and the series that entered the top k together are always in the same state.
+func (tc *topKChurn) possibleAlerts(ts int64) [][]v1.Alert {
+	relTs := ts - tc.zeroTime
+
+	series := tc.series()
+	var perSeries [][]*v1.Alert
+	for _, s := range series {
+		activeAt := timestamp.Time(tc.zeroTime + int64(s.activeIdx)*int64(tc.rwInterval/time.Millisecond))
+		canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(relTs, s)
+		perSeries = append(perSeries, possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(s),
+			Annotations: tc.alertAnnotations(s),
+			Value:       s.value,
+			ActiveAt:    &activeAt,
+		}))
+	}
+
+	return alertCombinations(perSeries, func(c []*v1.Alert) bool {
+		for i := range c {
+			for j := i + 1; j < len(c); j++ {
+				if c[i] != nil && c[j] != nil && series[i].activeIdx == series[j].activeIdx && c[i].State != c[j].State {
+					return false
+				}
+			}
+		}
+		for _, phaseStart := range topKPhases {
+			matches := true
+			for i, s := range series {
+				inTopK := s.activeIdx <= phaseStart && phaseStart < s.resolveIdx
+				if inTopK != (c[i] != nil) {
+					matches = false
+					break
+				}
+			}
+			if matches {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (tc *topKChurn) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *topKChurn) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("foo", "bar", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "Series {{$labels.series}} is in the top 2", "summary", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *topKChurn) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *topKChurn) allPossibleStates(ts int64, s topKSeries) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	rwItvlSecFloat, grpItvlSecFloat := float64(tc.rwInterval/time.Second), float64(tc.groupInterval/time.Second)
+	active := float64(s.activeIdx) * rwItvlSecFloat            // Goes into pending.
+	firing := active + time.Duration(tc.forDuration).Seconds() // Goes into firing.
+	resolved := float64(s.resolveIdx) * rwItvlSecFloat         // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, 240*rwItvlSecFloat)
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *topKChurn) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for _, s := range tc.series() {
+		firing := int64(s.activeIdx)*int64(tc.rwInterval/time.Millisecond) + int64(time.Duration(tc.forDuration)/time.Millisecond)
+		resolved := int64(s.resolveIdx) * int64(tc.rwInterval/time.Millisecond)
+		resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+		for ts := firing; ts < resolved; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != firing,
+				NextState:     timestamp.Time(tc.zeroTime + resolved),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(s),
+					Annotations: tc.alertAnnotations(s),
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+
+		for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+			tolerance := tc.groupInterval
+			if ts == resolved {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+				// based on this first resolved alert.
+				tolerance = 2 * tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != resolved,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(s),
+					Annotations: tc.alertAnnotations(s),
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+	}
+
+	return exp
+}
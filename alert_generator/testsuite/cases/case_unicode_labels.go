@@ -0,0 +1,291 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// UnicodeLabels tests the following cases:
+// * Label values that are the same text in different unicode forms, i.e. "é" as a single code point (NFC),
+//   as "e" and a combining accent (NFD) and in full width letters that NFKC folds, make distinct series and
+//   hence distinct alerts. The alerts, their annotations and the ALERTS series carry the exact bytes of the
+//   label values without any normalization.
+// Note: Prometheus treats the label values as opaque byte strings, so an alert generator that normalizes them
+// merges the alerts or changes their labels.
+func UnicodeLabels() TestCase {
+	groupName := "UnicodeLabels"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &unicodeLabels{
+		groupName:     groupName,
+		alertName:     alertName,
+		query:         fmt.Sprintf("%s > 10", lbls.String()),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(6 * tc.rwInterval)
+	return tc
+}
+
+type unicodeLabels struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+// unicodeLabelsAlert describes an alert in unicodeLabels. The times are relative to zeroTime.
+type unicodeLabelsAlert struct {
+	city, value              string
+	activeTime, resolvedTime time.Duration
+}
+
+// The city label values of the series, which are all "Café" when normalized.
+const (
+	cityNFC       = "Caf\u00e9"                // "é" as U+00E9.
+	cityNFD       = "Cafe\u0301"               // "e" followed by the combining acute accent U+0301.
+	cityFullWidth = "\uff23\uff41\uff46\u00e9" // Full width "Caf" followed by U+00E9, which NFKC folds to cityNFC.
+)
+
+func (tc *unicodeLabels) alerts() []unicodeLabelsAlert {
+	active := 4 * tc.rwInterval
+	resolved := 40 * tc.rwInterval
+	// The values differ so that the alerts cannot be mistaken for each other.
+	return []unicodeLabelsAlert{
+		{city: cityNFC, value: "15", activeTime: active, resolvedTime: resolved},
+		{city: cityNFD, value: "16", activeTime: active, resolvedTime: resolved},
+		{city: cityFullWidth, value: "17", activeTime: active, resolvedTime: resolved},
+	}
+}
+
+func (tc *unicodeLabels) Describe() (title string, description string) {
+	return tc.groupName,
+		"Label values that are the same text in different unicode forms (NFC, NFD and full width letters that NFKC folds) make distinct alerts. " +
+			"The alerts, their annotations and the ALERTS series carry the exact bytes of the label values without any normalization."
+}
+
+func (tc *unicodeLabels) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value of {{ $labels.city }} is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *unicodeLabels) SamplesToRemoteWrite() []prompb.TimeSeries {
+	var series []prompb.TimeSeries
+	for _, a := range tc.alerts() {
+		// All comment times is assuming 15s interval.
+		samples := sampleSlice(tc.rwInterval,
+			"3", "0x3", // 1m (3 is @0 time).
+			a.value, "0x35", // 9m of active. Goes into pending at 1m and into firing at 2m30s.
+			"5", "0x11", // 3m of resolved.
+		)
+		tc.totalSamples = len(samples)
+		series = append(series, prompb.TimeSeries{
+			Labels:  toProtoLabels(labels.NewBuilder(tc.metricLabels).Set("city", a.city).Labels()),
+			Samples: samples,
+		})
+	}
+	return series
+}
+
+func (tc *unicodeLabels) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *unicodeLabels) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *unicodeLabels) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *unicodeLabels) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *unicodeLabels) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+func (tc *unicodeLabels) alertLabels(a unicodeLabelsAlert) labels.Labels {
+	return labels.FromStrings("alertname", tc.alertName, "city", a.city, "rulegroup", tc.groupName)
+}
+
+func (tc *unicodeLabels) annotations(a unicodeLabelsAlert) labels.Labels {
+	return labels.FromStrings("description", "The value of "+a.city+" is "+a.value)
+}
+
+func (tc *unicodeLabels) possibleAlerts(ts int64) [][]v1.Alert {
+	var perSeries [][]*v1.Alert
+	for _, a := range tc.alerts() {
+		canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(ts-tc.zeroTime, a)
+		activeAt := timestamp.Time(tc.zeroTime + int64(a.activeTime/time.Millisecond))
+		perSeries = append(perSeries, possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(a),
+			Annotations: tc.annotations(a),
+			Value:       a.value,
+			ActiveAt:    &activeAt,
+		}))
+	}
+	return alertCombinations(perSeries, nil)
+}
+
+func (tc *unicodeLabels) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *unicodeLabels) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The value of {{ $labels.city }} is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *unicodeLabels) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *unicodeLabels) allPossibleStates(ts int64, a unicodeLabelsAlert) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := a.activeTime.Seconds()                                   // Goes into pending.
+	firing := (a.activeTime + time.Duration(tc.forDuration)).Seconds() // Goes into firing.
+	resolved := a.resolvedTime.Seconds()                               // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, float64(tc.totalSamples)*tc.rwInterval.Seconds())
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *unicodeLabels) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for _, a := range tc.alerts() {
+		firing := int64((a.activeTime + time.Duration(tc.forDuration)) / time.Millisecond)
+		resolved := int64(a.resolvedTime / time.Millisecond)
+		resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+		annotations := tc.annotations(a)
+
+		for ts := firing; ts < resolved; ts += resendDelayMs {
+			addAlert(ExpectedAlert{
+				TimeTolerance: tc.groupInterval,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      false,
+				Resend:        ts != firing,
+				NextState:     timestamp.Time(tc.zeroTime + resolved),
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(a),
+					Annotations: annotations,
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+
+		for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+			tolerance := tc.groupInterval
+			if ts == resolved {
+				// Since the alert state is reset, the alert sent time for resolved alert can be upto
+				// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+				// account for this delay plus the usual tolerance.
+				// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+				// based on this first resolved alert.
+				tolerance = 2 * tc.groupInterval
+			}
+			addAlert(ExpectedAlert{
+				TimeTolerance: tolerance,
+				Ts:            timestamp.Time(tc.zeroTime + ts),
+				Resolved:      true,
+				Resend:        ts != resolved,
+				ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+				EndsAtDelta:   endsAtDelta,
+				Alert: &notifier.Alert{
+					Labels:      tc.alertLabels(a),
+					Annotations: annotations,
+					StartsAt:    timestamp.Time(tc.zeroTime + firing),
+				},
+			})
+		}
+	}
+
+	return exp
+}
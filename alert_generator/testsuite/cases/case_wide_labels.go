@@ -0,0 +1,313 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// WideLabels tests the following cases:
+// * The series have many labels, including label names that sort before and after the usual ones, and the rule
+//   selects them on a subset of the labels. The alerts and the ALERTS series carry all the labels of the series
+//   except the ones aggregated away, intact.
+// * A series that does not match all the matchers of the rule never makes an alert, even though it shares all
+//   the other labels with the matching series.
+func WideLabels() TestCase {
+	groupName := "WideLabels"
+	alertName := groupName + "_Alert"
+	lbls := metricLabels(groupName, alertName)
+	tc := &wideLabels{
+		groupName: groupName,
+		alertName: alertName,
+		query: fmt.Sprintf(`max without (instance_id) (%s{alertname=%q, env="prod", region=~"eu-.+", rulegroup=%q}) > 10`,
+			sourceTimeSeriesName, alertName, groupName),
+		metricLabels:  lbls,
+		rwInterval:    5 * time.Second,
+		groupInterval: 10 * time.Second,
+	}
+	tc.forDuration = model.Duration(30 * time.Second)
+	return tc
+}
+
+type wideLabels struct {
+	groupName                 string
+	alertName                 string
+	query                     string
+	metricLabels              labels.Labels
+	rwInterval, groupInterval time.Duration
+	forDuration               model.Duration
+	totalSamples              int
+
+	zeroTime int64
+}
+
+func (tc *wideLabels) Describe() (title string, description string) {
+	return tc.groupName,
+		"(1) The series have many labels and the rule selects them on a subset of the labels. The alerts and the ALERTS series carry all the labels of the series except the ones aggregated away, intact. " +
+			"(2) A series that does not match all the matchers of the rule never makes an alert, even though it shares all the other labels with the matching series."
+}
+
+// seriesLabels returns the labels of a series with the given env and instance_id. The label names that start
+// with an upper case letter or an underscore sort before all the others.
+func (tc *wideLabels) seriesLabels(env, instanceID string) labels.Labels {
+	return labels.NewBuilder(tc.metricLabels).
+		Set("AZ", "eu-west-1a").
+		Set("_shard", "7").
+		Set("cluster", "eu-1").
+		Set("container", "api").
+		Set("env", env).
+		Set("instance_id", instanceID).
+		Set("job", "api-server").
+		Set("namespace", "payments").
+		Set("node", "node-42").
+		Set("pod", "api-7d9f8b6c5-x2x4z").
+		Set("region", "eu-west-1").
+		Set("service", "checkout").
+		Set("team", "core").
+		Set("version", "v1.2.3").
+		Set("zone", "z1").
+		Labels()
+}
+
+func (tc *wideLabels) RuleGroup() (rulefmt.RuleGroup, error) {
+	var alert yaml.Node
+	var expr yaml.Node
+	if err := alert.Encode(tc.alertName); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	if err := expr.Encode(tc.query); err != nil {
+		return rulefmt.RuleGroup{}, err
+	}
+	return rulefmt.RuleGroup{
+		Name:     tc.groupName,
+		Interval: model.Duration(tc.groupInterval),
+		Rules: []rulefmt.RuleNode{
+			{
+				Alert:       alert,
+				Expr:        expr,
+				For:         tc.forDuration,
+				Labels:      map[string]string{"severity": "page", "rulegroup": tc.groupName},
+				Annotations: map[string]string{"description": "The value is {{$value}}"},
+			},
+		},
+	}, nil
+}
+
+func (tc *wideLabels) SamplesToRemoteWrite() []prompb.TimeSeries {
+	// All comment times is assuming 15s interval.
+	prod1 := sampleSlice(tc.rwInterval,
+		"3", "0x3", // 1m (3 is @0 time).
+		"15", "0x35", // 9m of active. Goes into pending at 1m and into firing at 2m30s.
+		"5", "0x11", // 3m of resolved.
+	)
+	prod2 := sampleSlice(tc.rwInterval,
+		"3", "0x3", // 1m (3 is @0 time).
+		"12", "0x35", // 9m above the threshold, but lower than the other series, so max() takes the other one.
+		"5", "0x11", // 3m of resolved.
+	)
+	// Shares all the labels with the prod series except env, so it does not match the rule and never alerts.
+	staging := sampleSlice(tc.rwInterval, "15", "0x51")
+	tc.totalSamples = len(prod1)
+	return []prompb.TimeSeries{
+		{
+			Labels:  toProtoLabels(tc.seriesLabels("prod", "i-1")),
+			Samples: prod1,
+		},
+		{
+			Labels:  toProtoLabels(tc.seriesLabels("prod", "i-2")),
+			Samples: prod2,
+		},
+		{
+			Labels:  toProtoLabels(tc.seriesLabels("staging", "i-1")),
+			Samples: staging,
+		},
+	}
+}
+
+func (tc *wideLabels) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *wideLabels) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(time.Duration(tc.totalSamples) * tc.rwInterval))
+}
+
+func (tc *wideLabels) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	expAlerts := tc.expAlerts(ts, alerts)
+	return checkExpectedAlerts(expAlerts, alerts, tc.groupInterval)
+}
+
+func (tc *wideLabels) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	expRgs := tc.expRuleGroups(ts)
+	return checkExpectedRuleGroup(timestamp.Time(ts), expRgs, *rg, opts)
+}
+
+func (tc *wideLabels) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	expSamples := tc.expMetrics(ts)
+	return checkExpectedSamples(ts, expSamples, samples, opts)
+}
+
+// activeTime is the time relative to zeroTime when the alert becomes active.
+func (tc *wideLabels) activeTime() time.Duration {
+	return 4 * tc.rwInterval
+}
+
+// firingTime is the time relative to zeroTime when the alert goes into firing.
+func (tc *wideLabels) firingTime() time.Duration {
+	return tc.activeTime() + time.Duration(tc.forDuration)
+}
+
+// resolvedTime is the time relative to zeroTime when the alert gets resolved.
+func (tc *wideLabels) resolvedTime() time.Duration {
+	return 40 * tc.rwInterval
+}
+
+// alertLabels are all the labels of the matching series except the metric name and instance_id, which are
+// aggregated away, with the labels of the rule.
+func (tc *wideLabels) alertLabels() labels.Labels {
+	return labels.NewBuilder(tc.seriesLabels("prod", "i-1")).
+		Del(labels.MetricName, "instance_id").
+		Set("severity", "page").
+		Labels()
+}
+
+func (tc *wideLabels) possibleAlerts(ts int64) [][]v1.Alert {
+	canBeInactive, canBePending, canBeFiring := tc.allPossibleStates(ts - tc.zeroTime)
+	activeAt := timestamp.Time(tc.zeroTime + int64(tc.activeTime()/time.Millisecond))
+	return alertCombinations([][]*v1.Alert{
+		possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring, v1.Alert{
+			Labels:      tc.alertLabels(),
+			Annotations: labels.FromStrings("description", "The value is 15"),
+			Value:       "15",
+			ActiveAt:    &activeAt,
+		}),
+	}, nil)
+}
+
+func (tc *wideLabels) expAlerts(ts int64, alerts []v1.Alert) (expAlerts [][]v1.Alert) {
+	return tc.possibleAlerts(ts)
+}
+
+func (tc *wideLabels) expRuleGroups(ts int64) (expRgs []v1.RuleGroup) {
+	getRg := func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{
+			Name:     tc.groupName,
+			Interval: float64(tc.groupInterval / time.Second),
+			Rules: []v1.Rule{
+				v1.AlertingRule{
+					State:       state,
+					Name:        tc.alertName,
+					Query:       tc.query,
+					Duration:    float64(time.Duration(tc.forDuration) / time.Second),
+					Labels:      labels.FromStrings("severity", "page", "rulegroup", tc.groupName),
+					Annotations: labels.FromStrings("description", "The value is {{$value}}"),
+					Alerts:      alerts,
+					Health:      "ok",
+					Type:        "alerting",
+				},
+			},
+		}
+	}
+
+	return alertCombinationsRuleGroups(tc.possibleAlerts(ts), getRg)
+}
+
+func (tc *wideLabels) expMetrics(ts int64) (expSamples [][]promql.Sample) {
+	return alertCombinationsSamples(ts, tc.possibleAlerts(ts))
+}
+
+// ts is relative time w.r.t. zeroTime.
+func (tc *wideLabels) allPossibleStates(ts int64) (canBeInactive, canBePending, canBeFiring bool) {
+	between := betweenFunc(ts)
+
+	grpItvlSecFloat := float64(tc.groupInterval / time.Second)
+	active := tc.activeTime().Seconds()     // Goes into pending.
+	firing := tc.firingTime().Seconds()     // Goes into firing.
+	resolved := tc.resolvedTime().Seconds() // Resolved.
+	canBeInactive = between(0, active+grpItvlSecFloat) ||
+		between(resolved-1, float64(tc.totalSamples)*tc.rwInterval.Seconds())
+	canBePending = between(active-1, firing+grpItvlSecFloat)
+	canBeFiring = between(firing-1, resolved+grpItvlSecFloat)
+	return
+}
+
+func (tc *wideLabels) ExpectedAlerts() []ExpectedAlert {
+	firing := int64(tc.firingTime() / time.Millisecond)
+	resolved := int64(tc.resolvedTime() / time.Millisecond)
+	resolvedPlus15m := resolved + int64(15*time.Minute/time.Millisecond)
+
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*tc.groupInterval {
+		endsAtDelta = 4 * tc.groupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+
+	resendDelayMs := int64(ResendDelay / time.Millisecond)
+	for ts := firing; ts < resolved; ts += resendDelayMs {
+		addAlert(ExpectedAlert{
+			TimeTolerance: tc.groupInterval,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      false,
+			Resend:        ts != firing,
+			NextState:     timestamp.Time(tc.zeroTime + resolved),
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The value is 15"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	for ts := resolved; ts < resolvedPlus15m; ts += resendDelayMs {
+		tolerance := tc.groupInterval
+		if ts == resolved {
+			// Since the alert state is reset, the alert sent time for resolved alert can be upto
+			// 1 groupInterval late compared to actual time when it gets resolved. So we need to
+			// account for this delay plus the usual tolerance.
+			// We don't change tolerance for other resolved alerts because their Ts will be adjusted
+			// based on this first resolved alert.
+			tolerance = 2 * tc.groupInterval
+		}
+		addAlert(ExpectedAlert{
+			TimeTolerance: tolerance,
+			Ts:            timestamp.Time(tc.zeroTime + ts),
+			Resolved:      true,
+			Resend:        ts != resolved,
+			ResolvedTime:  timestamp.Time(tc.zeroTime + resolved),
+			EndsAtDelta:   endsAtDelta,
+			Alert: &notifier.Alert{
+				Labels:      tc.alertLabels(),
+				Annotations: labels.FromStrings("description", "The value is 15"),
+				StartsAt:    timestamp.Time(tc.zeroTime + firing),
+			},
+		})
+	}
+
+	return exp
+}
@@ -47,12 +47,21 @@ type ExpectedAlert struct {
 	// It is usually 4*resendDelay or 4*groupInterval, whichever is higher.
 	EndsAtDelta time.Duration
 
+	// InclusiveBoundary allows the StartsAt and EndsAt of the alert to be exactly at the expected time, which happens
+	// only when the state changes at a fixed time that an evaluation can land exactly on, unlike with the
+	// ingestion of a sample.
+	InclusiveBoundary bool
+
 	// This is the expected alert.
 	Alert *notifier.Alert
 }
 
 // Matches tells if the given alert satisfies the expected alert description.
 func (ea *ExpectedAlert) Matches(now time.Time, a notifier.Alert) (err error) {
+	if diff := separationDiff(ea.Alert.Labels, ea.Alert.Annotations, a.Labels, a.Annotations); diff != "" {
+		return fmt.Errorf("labels and annotations are not separated (%s), expected labels: %s, annotations: %s, got labels: %s, annotations: %s",
+			diff, ea.Alert.Labels.String(), ea.Alert.Annotations.String(), a.Labels.String(), a.Annotations.String())
+	}
 	if labels.Compare(ea.Alert.Labels, a.Labels) != 0 {
 		return fmt.Errorf("labels mismatch, expected: %s, got: %s", ea.Alert.Labels.String(), a.Labels.String())
 	}
@@ -106,6 +115,9 @@ func (ea *ExpectedAlert) Matches(now time.Time, a notifier.Alert) (err error) {
 }
 
 func (ea *ExpectedAlert) matchesWithinTolerance(exp, act time.Time) bool {
+	if ea.InclusiveBoundary && act.Equal(exp) {
+		return true
+	}
 	return act.After(exp) && act.Before(exp.Add(ea.TimeTolerance))
 }
 
@@ -15,6 +15,43 @@ const (
 	// MaxRTT is the max request time for alert-generator sending the alert or making GET requests to the API.
 	// TODO: make it 5s for final use.
 	MaxRTT = 2 * time.Second
+
+	// MaxIngestDropRate is the max rate at which the test suite can drop the batches of samples
+	// of the IngestFaultTolerant test cases.
+	MaxIngestDropRate = 0.2
+	// MaxIngestDelay is the max delay that the test suite can add to the batches of samples
+	// of the IngestFaultTolerant test cases.
+	MaxIngestDelay = 5 * time.Second
+	// MaxIngestConsecutiveDrops is the max number of consecutive batches of samples of the
+	// IngestFaultTolerant test cases that the test suite can drop.
+	MaxIngestConsecutiveDrops = 5
+
+	// MaxBackfill is how old the historical samples of a test case can be w.r.t. the start of the test,
+	// so that they are not out of bounds for the TSDB of the alert generator.
+	// This includes the samples added for the Warmup.
+	MaxBackfill = time.Hour
+
+	// DefaultWeight is the weight of a TestCase in the compliance score if it does not implement Weighted.
+	DefaultWeight = 1.0
+
+	// DefaultLookbackDelta is the lookback delta of the queries of the alert generator assumed by the
+	// test cases, which is the default of Prometheus. See LookbackDependent.
+	DefaultLookbackDelta = 5 * time.Minute
+
+	// DefaultMaxSamples is the max number of samples that a query of the alert generator can load into memory
+	// assumed by the test cases, which is the default of Prometheus. See MaxSamplesDependent.
+	DefaultMaxSamples = 50000000
+
+	// DefaultExternalURL is the external URL of the alert generator assumed by the test cases,
+	// e.g. Prometheus run with --web.external-url=http://localhost:9090. See ExternalURLDependent.
+	DefaultExternalURL = "http://localhost:9090"
+
+	// DefaultSampleEpsilon is the default CheckOptions.SampleEpsilon.
+	DefaultSampleEpsilon = 1e-9
+
+	// DefaultStepInterval is the default CheckOptions.StepInterval, which is the default scrape interval of the Prometheus
+	// configuration examples.
+	DefaultStepInterval = 15 * time.Second
 )
 
 // TestCase defines a single test case for the alert generator.
@@ -36,6 +73,8 @@ type TestCase interface {
 	// which is the time when the test suite would start the test.
 	// The test suite is responsible for translating these 0 based
 	// timestamp to the relevant timestamps for the current time.
+	// Negative timestamps are allowed for the historical samples (i.e. backfill), which are
+	// remote-written together right away when the test starts. They must be within MaxBackfill of 0.
 	//
 	// The samples must be delivered to the remote storage after the timestamp specified on the samples
 	// and must be delivered within 10 seconds of that timestamp.
@@ -57,14 +96,124 @@ type TestCase interface {
 	// CheckRuleGroup returns nil if the rule group provided is as expected at the given timestamp.
 	// Returns an error otherwise describing what is the problem.
 	// This must be checked with a min interval of the rule group's interval from RuleGroup().
-	CheckRuleGroup(ts int64, rg *v1.RuleGroup) error
+	// opts are the options of the test suite for the check.
+	CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error
 
 	// CheckMetrics returns nil if at give timestamp the metrics contain the expected metrics.
 	// Returns an error otherwise describing what is the problem.
 	// This must be checked with a min interval of the rule group's interval from RuleGroup().
-	CheckMetrics(ts int64, metrics []promql.Sample) error
+	// opts are the options of the test suite for the check.
+	CheckMetrics(ts int64, metrics []promql.Sample, opts CheckOptions) error
 
 	// ExpectedAlerts returns all the expected alerts that must be received for this test case.
 	// This must be called only after Init().
 	ExpectedAlerts() []ExpectedAlert
 }
+
+// QueryChecker can be optionally implemented by a TestCase to check the result of additional
+// PromQL queries, for example the series produced by the recording rules of the group.
+type QueryChecker interface {
+	// Queries returns the instant queries to run. Only the resulting series having
+	// the `rulegroup="<groupName>"` label are passed to CheckQuery().
+	Queries() []string
+
+	// CheckQuery returns nil if the result of the query at the given timestamp is as expected.
+	// Returns an error otherwise describing what is the problem.
+	// This is checked at the same interval as CheckMetrics(), with the same opts.
+	CheckQuery(ts int64, query string, samples []promql.Sample, opts CheckOptions) error
+}
+
+// IngestFaultTolerant can be optionally implemented by a TestCase whose expectations hold even if its
+// batches of samples are dropped or delayed by the test suite on purpose, within MaxIngestDropRate,
+// MaxIngestConsecutiveDrops and MaxIngestDelay. Only the samples of such test cases are subject to the ingestion faults.
+type IngestFaultTolerant interface {
+	// ToleratesIngestFaults is only a marker and does nothing.
+	ToleratesIngestFaults()
+}
+
+// Warmup can be optionally implemented by a TestCase whose range vector selectors need the samples before
+// the 0 time to give the correct result from the first evaluation, e.g. rate() and increase().
+// When the test suite is run with the warmup enabled, the first sample of every series is repeated
+// backwards at the interval of the series for WarmupDuration(), and these samples are remote-written
+// together with the historical samples when the test starts. The expectations must hold with and without it.
+type Warmup interface {
+	// WarmupDuration returns how long before the first sample of the series the samples are needed.
+	// It must be positive and within MaxBackfill.
+	WarmupDuration() time.Duration
+}
+
+// Weighted can be optionally implemented by a TestCase to count more or less than DefaultWeight in the
+// compliance score, e.g. the basic firing and resolving of alerts counts more than a niche function.
+type Weighted interface {
+	// Weight returns the weight of the test case in the compliance score. It must not be negative.
+	Weight() float64
+}
+
+// NotificationsUnchecked can be optionally implemented by a TestCase whose alerts sent to the test suite
+// and present in the Alertmanager are not checked, e.g. the user provided rules from PromtoolTestCases
+// whose notifications are not known in advance. The alerts of such test cases are not reported as unexpected.
+type NotificationsUnchecked interface {
+	// IgnoresNotifications is only a marker and does nothing.
+	IgnoresNotifications()
+}
+
+// Fixture can be optionally implemented by a TestCase whose samples and expectations come from an externally
+// provided fixture instead of being built into the test suite, e.g. the user provided rules from PromtoolTestCases.
+// Only such test cases can be replayed at a speed other than the real time (see TestSuiteOptions.ReplaySpeed).
+type Fixture interface {
+	// IsFixture is only a marker and does nothing.
+	IsFixture()
+}
+
+// LookbackDependent can be optionally implemented by a TestCase whose expectations depend on the lookback delta
+// of the alert generator, e.g. when an alert changes state once its series goes out of the lookback.
+// The expectations assume DefaultLookbackDelta unless SetLookbackDelta() is called, which happens before Init().
+type LookbackDependent interface {
+	// SetLookbackDelta sets the lookback delta that the alert generator is configured with.
+	SetLookbackDelta(d time.Duration)
+}
+
+// MaxSamplesDependent can be optionally implemented by a TestCase whose expectations depend on the max number of
+// samples that a query of the alert generator can load into memory, e.g. when a rule errors once its query loads more.
+// The expectations assume DefaultMaxSamples unless SetMaxSamples() is called, which happens before Init().
+type MaxSamplesDependent interface {
+	// SetMaxSamples sets the max samples of a query that the alert generator is configured with.
+	SetMaxSamples(n int64)
+}
+
+// ExternalURLDependent can be optionally implemented by a TestCase whose expectations depend on the external URL
+// that the alert generator is configured with, e.g. an annotation that links to the alert generator via externalURL.
+// The expectations assume DefaultExternalURL unless SetExternalURL() is called, which happens before Init().
+type ExternalURLDependent interface {
+	// SetExternalURL sets the external URL that the alert generator is configured with.
+	SetExternalURL(u string)
+}
+
+// ScheduledIngestion can be optionally implemented by a TestCase whose samples are not remote written at their
+// timestamps, e.g. a burst of samples after a pause in the ingestion. The test suite then remote writes the
+// batches of samples at their scheduled time instead of every sample at its timestamp.
+// SamplesToRemoteWrite() must still return all the samples, which are the samples of the batches, since the
+// expectations of the test case are based on it. See ValidateSchedule().
+// It cannot be combined with Warmup, and the batches are not subject to the ingestion faults.
+type ScheduledIngestion interface {
+	// ScheduledSamples returns the batches of samples in the order of their SendAt.
+	// This is called after SamplesToRemoteWrite().
+	ScheduledSamples() []TimedBatch
+}
+
+// Cleaner can be optionally implemented by a TestCase that leaves more state behind in the alert generator than
+// its series, to return the alert generator to a clean baseline after the test when the test suite is run with the
+// cleanup enabled. The test cases that do not implement it get their series marked stale. See CleanupSeries().
+type Cleaner interface {
+	// Cleanup returns the series to remote write after the test. ts is the time of the cleanup in milliseconds,
+	// which is after all the samples of the test case.
+	Cleanup(ts int64) []prompb.TimeSeries
+}
+
+// TimedBatch is a batch of samples remote written together. See ScheduledIngestion.
+type TimedBatch struct {
+	// SendAt is the time to remote write the batch relative to the 0 time, which cannot be before
+	// the timestamps of its samples. The timestamps of the samples are 0 based like in SamplesToRemoteWrite().
+	SendAt time.Duration
+	Series []prompb.TimeSeries
+}
@@ -0,0 +1,127 @@
+package cases
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"gopkg.in/yaml.v3"
+)
+
+// PromtoolFixture returns a unit test file of `promtool test rules` with the given series as its input_series,
+// to replay real samples, e.g. captured from a live Prometheus via a range query, with PromtoolTestCases.
+// The sample at start is the first value of the input series, and every following value is an interval later,
+// i.e. the timestamps are relative to the zero time of the test. The samples must be at the steps of the interval
+// from start, and a step without a sample is written as omitted. The rule_files and the alert_rule_test are left
+// empty for the user to fill in with the rules to test and the alerts expected from the samples.
+func PromtoolFixture(series []promql.Series, start int64, interval time.Duration) ([]byte, error) {
+	if interval <= 0 {
+		return nil, errors.New("the interval of the fixture must be positive")
+	}
+	intervalMs := int64(interval / time.Millisecond)
+
+	test := promtoolTestGroup{Interval: model.Duration(interval)}
+	for _, s := range series {
+		var (
+			vals []float64
+			set  []bool
+		)
+		for _, p := range s.Points {
+			if p.T < start || (p.T-start)%intervalMs != 0 {
+				return nil, fmt.Errorf("sample of %s at %d is not at a step of %s from %d", s.Metric, p.T, interval, start)
+			}
+			i := int((p.T - start) / intervalMs)
+			for len(vals) <= i {
+				vals = append(vals, 0)
+				set = append(set, false)
+			}
+			vals[i], set[i] = p.V, true
+		}
+		if len(vals) == 0 {
+			continue
+		}
+		test.InputSeries = append(test.InputSeries, promtoolSeries{
+			Series: metricString(s.Metric),
+			Values: expandingNotation(vals, set),
+		})
+	}
+	sort.Slice(test.InputSeries, func(i, j int) bool {
+		return test.InputSeries[i].Series < test.InputSeries[j].Series
+	})
+
+	return yaml.Marshal(promtoolTestFile{
+		RuleFiles:          []string{},
+		EvaluationInterval: model.Duration(interval),
+		Tests:              []promtoolTestGroup{test},
+	})
+}
+
+// metricString returns the series in the notation of the input series, i.e. the metric name followed by the other labels.
+func metricString(lbls labels.Labels) string {
+	m := make(model.Metric)
+	for k, v := range lbls.Map() {
+		m[model.LabelName(k)] = model.LabelValue(v)
+	}
+	return m.String()
+}
+
+// expandingNotation returns the values in the expanding notation of the input series, where the values not set are
+// omitted with '_'. A run of at least 3 finite values that are the same, or that grow by the same increment, is written
+// as 'axn' or 'a+bxn', which gives back exactly the same values when expanded.
+func expandingNotation(vals []float64, set []bool) string {
+	var items []string
+	for i := 0; i < len(vals); {
+		if !set[i] {
+			j := i
+			for j < len(vals) && !set[j] {
+				j++
+			}
+			if j-i == 1 {
+				items = append(items, "_")
+			} else {
+				items = append(items, fmt.Sprintf("_x%d", j-i))
+			}
+			i = j
+			continue
+		}
+
+		// Find the longest run from i that expands back exactly, where the value is added the increment
+		// every step like the parser of the input series does.
+		j := i + 1
+		if j < len(vals) && set[j] && !math.IsNaN(vals[j]-vals[i]) && !math.IsInf(vals[j]-vals[i], 0) {
+			delta := vals[j] - vals[i]
+			next := vals[i] + delta
+			for j < len(vals) && set[j] && next == vals[j] {
+				j++
+				next += delta
+			}
+			if j-i >= 3 {
+				switch {
+				case delta == 0:
+					items = append(items, fmt.Sprintf("%sx%d", formatValue(vals[i]), j-i-1))
+				case delta > 0:
+					items = append(items, fmt.Sprintf("%s+%sx%d", formatValue(vals[i]), formatValue(delta), j-i-1))
+				default:
+					items = append(items, fmt.Sprintf("%s-%sx%d", formatValue(vals[i]), formatValue(-delta), j-i-1))
+				}
+				i = j
+				continue
+			}
+		}
+		items = append(items, formatValue(vals[i]))
+		i++
+	}
+	return strings.Join(items, " ")
+}
+
+// formatValue returns the shortest representation of the value that parses back to the same value.
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
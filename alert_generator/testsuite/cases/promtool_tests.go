@@ -0,0 +1,296 @@
+package cases
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// promtoolTestFile is the unit test file of `promtool test rules`. Only the fields used here are parsed.
+type promtoolTestFile struct {
+	RuleFiles          []string            `yaml:"rule_files"`
+	EvaluationInterval model.Duration      `yaml:"evaluation_interval,omitempty"`
+	Tests              []promtoolTestGroup `yaml:"tests"`
+}
+
+type promtoolTestGroup struct {
+	Interval        model.Duration      `yaml:"interval"`
+	InputSeries     []promtoolSeries    `yaml:"input_series"`
+	AlertRuleTests  []promtoolAlertTest `yaml:"alert_rule_test,omitempty"`
+	PromqlExprTests []yaml.Node         `yaml:"promql_expr_test,omitempty"`
+}
+
+type promtoolSeries struct {
+	Series string `yaml:"series"`
+	Values string `yaml:"values"`
+}
+
+type promtoolAlertTest struct {
+	EvalTime  model.Duration  `yaml:"eval_time"`
+	Alertname string          `yaml:"alertname"`
+	ExpAlerts []promtoolAlert `yaml:"exp_alerts"`
+}
+
+type promtoolAlert struct {
+	ExpLabels      map[string]string `yaml:"exp_labels"`
+	ExpAnnotations map[string]string `yaml:"exp_annotations"`
+}
+
+// PromtoolTestCases returns a test case per rule group of the rules used by the given unit test file
+// of `promtool test rules`, to test user provided rules with the alert generator instead of promtool.
+// The input series are remote-written as per the test, and the firing alerts declared for an eval_time
+// are checked via the API between one and two group intervals after the eval_time, since the alert
+// generator does not evaluate at the same times as promtool. Hence the declared alerts must hold for
+// two group intervals after the eval_time. The pending alerts are ignored like promtool does.
+//
+// The `rulegroup` label is added to all the rules, and the group interval defaults to the evaluation_interval
+// of the test file instead of the global evaluation interval of the alert generator. The rules must be
+// loaded into the alert generator via the rules file given by rule_config_builder with the same test file.
+//
+// Since the input series of different tests would be mixed in the same database, only one test is allowed
+// in the file. promql_expr_test is not supported. The alerts sent by the alert generator are not checked.
+func PromtoolTestCases(testFile string) ([]TestCase, error) {
+	b, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		return nil, err
+	}
+	var tf promtoolTestFile
+	if err := yaml.Unmarshal(b, &tf); err != nil {
+		return nil, errors.Wrap(err, "unmarshal promtool test file")
+	}
+	if len(tf.Tests) != 1 {
+		return nil, fmt.Errorf("exactly one test is supported in the promtool test file, got %d", len(tf.Tests))
+	}
+	test := tf.Tests[0]
+	if len(test.PromqlExprTests) > 0 {
+		return nil, errors.New("promql_expr_test is not supported in the promtool test file")
+	}
+	if tf.EvaluationInterval == 0 {
+		tf.EvaluationInterval = model.Duration(time.Minute)
+	}
+	if test.Interval == 0 {
+		test.Interval = tf.EvaluationInterval
+	}
+
+	samples, lastSampleTs, err := promtoolSamples(test)
+	if err != nil {
+		return nil, err
+	}
+
+	var rgs []rulefmt.RuleGroup
+	for _, pattern := range tf.RuleFiles {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(testFile), pattern)
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no rule files found for %q", pattern)
+		}
+		for _, f := range files {
+			fileRgs, errs := rulefmt.ParseFile(f)
+			if len(errs) > 0 {
+				return nil, errors.Wrapf(errs[0], "parse rule file %q", f)
+			}
+			rgs = append(rgs, fileRgs.Groups...)
+		}
+	}
+
+	var (
+		cs          []TestCase
+		alertGroups = make(map[string]*promtoolRuleGroup) // Alert name -> the test case of its group.
+	)
+	for i, rg := range rgs {
+		if rg.Interval == 0 {
+			rg.Interval = tf.EvaluationInterval
+		}
+		for j := range rg.Rules {
+			lbls := make(map[string]string, len(rg.Rules[j].Labels)+1)
+			for k, v := range rg.Rules[j].Labels {
+				lbls[k] = v
+			}
+			lbls["rulegroup"] = rg.Name
+			rg.Rules[j].Labels = lbls
+		}
+
+		tc := &promtoolRuleGroup{
+			ruleGroup:     rg,
+			groupInterval: time.Duration(rg.Interval),
+		}
+		if i == 0 {
+			// The input series are shared by all the groups, hence written only once.
+			tc.samples = samples
+		}
+		for _, r := range rg.Rules {
+			if r.Alert.Value != "" {
+				alertGroups[r.Alert.Value] = tc
+			}
+		}
+		cs = append(cs, tc)
+	}
+
+	var lastEvalTime time.Duration
+	for _, at := range test.AlertRuleTests {
+		tc, ok := alertGroups[at.Alertname]
+		if !ok {
+			return nil, fmt.Errorf("no alerting rule found for the alert %q in the promtool test file", at.Alertname)
+		}
+		tc.alertTests = append(tc.alertTests, at)
+		if time.Duration(at.EvalTime) > lastEvalTime {
+			lastEvalTime = time.Duration(at.EvalTime)
+		}
+	}
+
+	// All the groups run until the last sample and the checks of the last eval_time are over.
+	for _, c := range cs {
+		tc := c.(*promtoolRuleGroup)
+		tc.testFor = time.Duration(lastSampleTs) * time.Millisecond
+		if until := lastEvalTime + 2*tc.groupInterval; until > tc.testFor {
+			tc.testFor = until
+		}
+	}
+	return cs, nil
+}
+
+// promtoolSamples returns the samples of the input series of the test and the timestamp of the last sample.
+func promtoolSamples(test promtoolTestGroup) ([]prompb.TimeSeries, int64, error) {
+	var (
+		res          []prompb.TimeSeries
+		lastSampleTs int64
+	)
+	intervalMs := int64(time.Duration(test.Interval) / time.Millisecond)
+	for _, is := range test.InputSeries {
+		lbls, vals, err := parser.ParseSeriesDesc(is.Series + " " + is.Values)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "parse input series %q", is.Series)
+		}
+		ts := prompb.TimeSeries{Labels: toProtoLabels(lbls)}
+		for i, v := range vals {
+			if v.Omitted {
+				continue
+			}
+			ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: int64(i) * intervalMs, Value: v.Value})
+			if int64(i)*intervalMs > lastSampleTs {
+				lastSampleTs = int64(i) * intervalMs
+			}
+		}
+		res = append(res, ts)
+	}
+	return res, lastSampleTs, nil
+}
+
+// promtoolRuleGroup is a test case for a user provided rule group from PromtoolTestCases.
+type promtoolRuleGroup struct {
+	ruleGroup     rulefmt.RuleGroup
+	groupInterval time.Duration
+	samples       []prompb.TimeSeries
+	alertTests    []promtoolAlertTest
+	testFor       time.Duration
+
+	zeroTime int64
+}
+
+func (tc *promtoolRuleGroup) Describe() (title string, description string) {
+	return tc.ruleGroup.Name, fmt.Sprintf("(1) User provided rule group with %d rules, where the firing alerts are checked at %d eval_time(s) of the promtool test.",
+		len(tc.ruleGroup.Rules), len(tc.alertTests))
+}
+
+func (tc *promtoolRuleGroup) RuleGroup() (rulefmt.RuleGroup, error) {
+	return tc.ruleGroup, nil
+}
+
+func (tc *promtoolRuleGroup) SamplesToRemoteWrite() []prompb.TimeSeries {
+	return tc.samples
+}
+
+func (tc *promtoolRuleGroup) Init(zt int64) {
+	tc.zeroTime = zt
+}
+
+func (tc *promtoolRuleGroup) TestUntil() int64 {
+	return timestamp.FromTime(timestamp.Time(tc.zeroTime).Add(tc.testFor))
+}
+
+// IgnoresNotifications implements NotificationsUnchecked.
+func (tc *promtoolRuleGroup) IgnoresNotifications() {}
+
+// IsFixture implements Fixture.
+func (tc *promtoolRuleGroup) IsFixture() {}
+
+func (tc *promtoolRuleGroup) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	relTs := time.Duration(ts-tc.zeroTime) * time.Millisecond
+	for _, at := range tc.alertTests {
+		evalTime := time.Duration(at.EvalTime)
+		if relTs < evalTime+tc.groupInterval || relTs >= evalTime+2*tc.groupInterval {
+			continue
+		}
+
+		var exp, act []string
+		for _, a := range at.ExpAlerts {
+			lbls := labels.FromMap(a.ExpLabels)
+			lbls = labels.NewBuilder(lbls).Set("alertname", at.Alertname).Set("rulegroup", tc.ruleGroup.Name).Labels()
+			exp = append(exp, lbls.String()+" "+labels.FromMap(a.ExpAnnotations).String())
+		}
+		for _, a := range alerts {
+			if a.State != "firing" || a.Labels.Get("alertname") != at.Alertname {
+				continue
+			}
+			act = append(act, a.Labels.String()+" "+a.Annotations.String())
+		}
+		sort.Strings(exp)
+		sort.Strings(act)
+		if strings.Join(exp, "\n") != strings.Join(act, "\n") {
+			return fmt.Errorf("firing alerts mismatch for %q at eval_time %s, expected labels and annotations: %v, got: %v",
+				at.Alertname, at.EvalTime, exp, act)
+		}
+	}
+	return nil
+}
+
+func (tc *promtoolRuleGroup) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-tc.zeroTime < int64(tc.groupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	for _, r := range rg.Rules {
+		switch rule := r.(type) {
+		case v1.AlertingRule:
+			if rule.Health != "ok" {
+				return fmt.Errorf("alerting rule %q has the health %q with the error %q", rule.Name, rule.Health, rule.LastError)
+			}
+		case v1.RecordingRule:
+			if rule.Health != "ok" {
+				return fmt.Errorf("recording rule %q has the health %q with the error %q", rule.Name, rule.Health, rule.LastError)
+			}
+		}
+	}
+	return nil
+}
+
+func (tc *promtoolRuleGroup) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	// The ALERTS series are not declared in a promtool test.
+	return nil
+}
+
+func (tc *promtoolRuleGroup) ExpectedAlerts() []ExpectedAlert {
+	return nil
+}
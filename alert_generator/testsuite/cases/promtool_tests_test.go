@@ -0,0 +1,177 @@
+package cases
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPromtoolTestCases(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "rules.yaml"), []byte(`
+groups:
+- name: example
+  rules:
+  - alert: HighValue
+    expr: metric > 10
+    for: 1m
+    labels:
+      severity: page
+    annotations:
+      summary: "Value of {{ $labels.instance }} is high"
+`), 0o644))
+	testFile := filepath.Join(dir, "test.yaml")
+	require.NoError(t, ioutil.WriteFile(testFile, []byte(`
+rule_files:
+- rules.yaml
+evaluation_interval: 30s
+tests:
+- interval: 30s
+  input_series:
+  - series: 'metric{instance="a"}'
+    values: '5 _ 15x5'
+  alert_rule_test:
+  - eval_time: 2m
+    alertname: HighValue
+    exp_alerts:
+    - exp_labels:
+        severity: page
+        instance: a
+      exp_annotations:
+        summary: "Value of a is high"
+`), 0o644))
+
+	cs, err := PromtoolTestCases(testFile)
+	require.NoError(t, err)
+	require.Len(t, cs, 1)
+	c := cs[0]
+
+	rg, err := c.RuleGroup()
+	require.NoError(t, err)
+	require.Equal(t, "example", rg.Name)
+	require.Equal(t, 30*time.Second, time.Duration(rg.Interval))
+	require.Equal(t, map[string]string{"severity": "page", "rulegroup": "example"}, rg.Rules[0].Labels)
+
+	samples := c.SamplesToRemoteWrite()
+	require.Len(t, samples, 1)
+	require.Equal(t, []prompb.Sample{
+		{Timestamp: 0, Value: 5},
+		{Timestamp: 60000, Value: 15},
+		{Timestamp: 90000, Value: 15},
+		{Timestamp: 120000, Value: 15},
+		{Timestamp: 150000, Value: 15},
+		{Timestamp: 180000, Value: 15},
+		{Timestamp: 210000, Value: 15},
+	}, samples[0].Samples)
+
+	zeroTime := int64(100000)
+	c.Init(zeroTime)
+	// The last sample is at 3m30s, after the checks of the eval_time are over at 3m.
+	require.Equal(t, zeroTime+210000, c.TestUntil())
+
+	firing := v1.Alert{
+		Labels:      labels.FromStrings("alertname", "HighValue", "instance", "a", "rulegroup", "example", "severity", "page"),
+		Annotations: labels.FromStrings("summary", "Value of a is high"),
+		State:       "firing",
+	}
+	pending := firing
+	pending.State = "pending"
+
+	// Not checked outside of the eval_time.
+	require.NoError(t, c.CheckAlerts(zeroTime+60000, nil))
+	require.NoError(t, c.CheckAlerts(zeroTime+180000, nil))
+
+	// Checked from a group interval after the eval_time.
+	require.NoError(t, c.CheckAlerts(zeroTime+150000, []v1.Alert{firing}))
+	require.Error(t, c.CheckAlerts(zeroTime+150000, []v1.Alert{pending}))
+	require.Error(t, c.CheckAlerts(zeroTime+150000, nil))
+	modified := firing
+	modified.Annotations = labels.FromStrings("summary", "Value of b is high")
+	require.Error(t, c.CheckAlerts(zeroTime+150000, []v1.Alert{modified}))
+}
+
+func TestPromtoolTestCasesErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"two_tests.yaml":     "tests:\n- interval: 1m\n- interval: 1m\n",
+		"expr_test.yaml":     "tests:\n- promql_expr_test:\n  - expr: up\n    eval_time: 1m\n",
+		"no_rules.yaml":      "rule_files:\n- missing.yaml\ntests:\n- interval: 1m\n",
+		"unknown_alert.yaml": "tests:\n- alert_rule_test:\n  - eval_time: 1m\n    alertname: Unknown\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			testFile := filepath.Join(dir, name)
+			require.NoError(t, ioutil.WriteFile(testFile, []byte(content), 0o644))
+			_, err := PromtoolTestCases(testFile)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestExpandingNotation(t *testing.T) {
+	for _, c := range []struct {
+		vals []float64
+		set  []bool
+		exp  string
+	}{
+		{vals: []float64{5, 5, 5, 5}, set: []bool{true, true, true, true}, exp: "5x3"},
+		{vals: []float64{1, 2, 3, 4, 9}, set: []bool{true, true, true, true, true}, exp: "1+1x3 9"},
+		{vals: []float64{10, 8, 6, 0, 0}, set: []bool{true, true, true, false, false}, exp: "10-2x2 _x2"},
+		{vals: []float64{1, 2, 0, 7}, set: []bool{true, true, false, true}, exp: "1 2 _ 7"},
+		// The increments of 0.1 do not add up exactly to the values.
+		{vals: []float64{0.1, 0.2, 0.3, 0.4}, set: []bool{true, true, true, true}, exp: "0.1 0.2 0.3 0.4"},
+		{vals: []float64{math.NaN(), math.NaN(), math.NaN()}, set: []bool{true, true, true}, exp: "NaN NaN NaN"},
+	} {
+		require.Equal(t, c.exp, expandingNotation(c.vals, c.set))
+	}
+}
+
+func TestPromtoolFixture(t *testing.T) {
+	start := int64(1000000)
+	series := []promql.Series{
+		{
+			Metric: labels.FromStrings("__name__", "http_requests_total", "job", "api"),
+			Points: []promql.Point{{T: start, V: 100}, {T: start + 15000, V: 110}, {T: start + 30000, V: 120}, {T: start + 60000, V: 0.5}},
+		},
+		{
+			Metric: labels.FromStrings("job", "api"),
+			Points: []promql.Point{{T: start + 30000, V: 1e6}},
+		},
+	}
+	b, err := PromtoolFixture(series, start, 15*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, `rule_files: []
+evaluation_interval: 15s
+tests:
+    - interval: 15s
+      input_series:
+        - series: http_requests_total{job="api"}
+          values: 100+10x2 _ 0.5
+        - series: '{job="api"}'
+          values: _x2 1e+06
+`, string(b))
+
+	// The fixture is replayed with the same samples relative to the zero time.
+	var tf promtoolTestFile
+	require.NoError(t, yaml.Unmarshal(b, &tf))
+	samples, _, err := promtoolSamples(tf.Tests[0])
+	require.NoError(t, err)
+	require.Equal(t, []prompb.Sample{
+		{Timestamp: 0, Value: 100},
+		{Timestamp: 15000, Value: 110},
+		{Timestamp: 30000, Value: 120},
+		{Timestamp: 60000, Value: 0.5},
+	}, samples[0].Samples)
+	require.Equal(t, []prompb.Sample{{Timestamp: 30000, Value: 1e6}}, samples[1].Samples)
+
+	_, err = PromtoolFixture(series, start+1, 15*time.Second)
+	require.Error(t, err)
+}
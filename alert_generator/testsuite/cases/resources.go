@@ -0,0 +1,138 @@
+package cases
+
+import (
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+)
+
+// Resources is the load that a TestCase puts on the alert generator, to size the alert generator before the test.
+// It is only informational.
+type Resources struct {
+	// Series is the number of distinct series remote written.
+	Series int
+	// Samples is the number of samples remote written, including the stale markers.
+	Samples int
+	// PeakFiringAlerts is the max number of alerts firing at the same time.
+	PeakFiringAlerts int
+	// EvalComplexity is a free form description of what makes the evaluation of the rules expensive,
+	// e.g. a subquery over many series. Empty if there is nothing notable.
+	EvalComplexity string
+}
+
+// ResourceProfiled can be optionally implemented by a TestCase to declare its Resources, e.g. for the high cardinality
+// test cases. The declared resources are only used for what cannot be derived from the test case by CaseResources,
+// e.g. the peak alerts of a test case whose ExpectedAlerts are not known in advance, and the EvalComplexity.
+type ResourceProfiled interface {
+	// ResourceProfile returns the declared resources of the test case.
+	ResourceProfile() Resources
+}
+
+// CaseResources returns the resources of the test case, where the series and the samples are derived from
+// SamplesToRemoteWrite() and the peak firing alerts from ExpectedAlerts(), falling back to the declared ones
+// (see ResourceProfiled). The test case is initialised with the given zero time.
+func CaseResources(tc TestCase, zeroTime int64) Resources {
+	r, _ := caseResources(tc, zeroTime)
+	return r
+}
+
+// TotalResources returns the sum of the resources of the test cases, where the peak firing alerts is of all
+// the test cases starting together at the given zero time. The EvalComplexity is not set.
+func TotalResources(cs []TestCase, zeroTime int64) Resources {
+	var (
+		total     Resources
+		intervals []firingInterval
+		declared  int // Sum of the declared peak alerts of the test cases without the expected alerts.
+	)
+	for _, tc := range cs {
+		r, itvls := caseResources(tc, zeroTime)
+		total.Series += r.Series
+		total.Samples += r.Samples
+		if len(itvls) == 0 {
+			declared += r.PeakFiringAlerts
+		}
+		intervals = append(intervals, itvls...)
+	}
+	total.PeakFiringAlerts = peakFiring(intervals) + declared
+	return total
+}
+
+// firingInterval is when an alert is firing, from start until end.
+type firingInterval struct {
+	start, end time.Time
+}
+
+func caseResources(tc TestCase, zeroTime int64) (Resources, []firingInterval) {
+	var declared Resources
+	if rp, ok := tc.(ResourceProfiled); ok {
+		declared = rp.ResourceProfile()
+	}
+
+	r := Resources{EvalComplexity: declared.EvalComplexity}
+	seen := make(map[string]bool)
+	for _, s := range tc.SamplesToRemoteWrite() {
+		seen[fromProtoLabels(s.Labels).String()] = true
+		r.Samples += len(s.Samples)
+	}
+	r.Series = len(seen)
+	if r.Series == 0 {
+		r.Series, r.Samples = declared.Series, declared.Samples
+	}
+
+	tc.Init(zeroTime)
+	intervals := firingIntervals(tc.ExpectedAlerts(), timestamp.Time(tc.TestUntil()))
+	r.PeakFiringAlerts = peakFiring(intervals)
+	if len(intervals) == 0 {
+		r.PeakFiringAlerts = declared.PeakFiringAlerts
+	}
+	return r, intervals
+}
+
+// firingIntervals returns when the expected alerts are firing, where an alert that is never resolved is firing till the
+// end of the test. An alert is identified by its labels and StartsAt, hence it can fire more than once.
+func firingIntervals(expAlerts []ExpectedAlert, testUntil time.Time) []firingInterval {
+	byAlert := make(map[string]firingInterval)
+	for _, ea := range expAlerts {
+		if ea.Alert == nil {
+			continue
+		}
+		itvl := firingInterval{start: ea.Alert.StartsAt, end: ea.ResolvedTime}
+		if !itvl.end.After(itvl.start) {
+			itvl.end = testUntil
+		}
+		byAlert[ea.Alert.Labels.String()+"@"+itvl.start.String()] = itvl
+	}
+	intervals := make([]firingInterval, 0, len(byAlert))
+	for _, itvl := range byAlert {
+		intervals = append(intervals, itvl)
+	}
+	return intervals
+}
+
+// peakFiring returns the max number of the intervals that overlap, where an alert is not firing anymore at its end.
+func peakFiring(intervals []firingInterval) int {
+	type event struct {
+		t     time.Time
+		delta int
+	}
+	events := make([]event, 0, 2*len(intervals))
+	for _, itvl := range intervals {
+		events = append(events, event{itvl.start, 1}, event{itvl.end, -1})
+	}
+	// At the same time, the ends come before the starts.
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].t.Equal(events[j].t) {
+			return events[i].t.Before(events[j].t)
+		}
+		return events[i].delta < events[j].delta
+	})
+	peak, cur := 0, 0
+	for _, e := range events {
+		cur += e.delta
+		if cur > peak {
+			peak = cur
+		}
+	}
+	return peak
+}
@@ -0,0 +1,67 @@
+package cases
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeakFiring(t *testing.T) {
+	zt := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return zt.Add(time.Duration(m) * time.Minute) }
+	expAlert := func(name string, startsAt, resolved int) ExpectedAlert {
+		return ExpectedAlert{
+			Ts:           at(startsAt),
+			ResolvedTime: at(resolved),
+			Alert:        &notifier.Alert{Labels: labels.FromStrings("alertname", name), StartsAt: at(startsAt)},
+		}
+	}
+	exp := []ExpectedAlert{
+		expAlert("a", 1, 5),
+		expAlert("a", 1, 5), // Resend.
+		expAlert("b", 2, 6),
+		// Fires again when the first one is resolved.
+		expAlert("a", 5, 7),
+		expAlert("c", 4, 0),
+		{Alert: nil},
+	}
+	// c is never resolved, hence it fires till the end.
+	intervals := firingIntervals(exp, at(10))
+	require.Len(t, intervals, 4)
+	require.Equal(t, 3, peakFiring(intervals))
+	require.Equal(t, 0, peakFiring(nil))
+}
+
+// undeclaredAlertsCase is a test case whose expected alerts are not known in advance, with its declared resources.
+type undeclaredAlertsCase struct {
+	TestCase
+}
+
+func (undeclaredAlertsCase) ExpectedAlerts() []ExpectedAlert { return nil }
+
+func (undeclaredAlertsCase) ResourceProfile() Resources {
+	return Resources{Series: 100, PeakFiringAlerts: 7, EvalComplexity: "many series"}
+}
+
+func TestCaseResources(t *testing.T) {
+	zeroTime := timestamp.FromTime(time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC))
+
+	r := CaseResources(MaxSamplesExceeded(), zeroTime)
+	require.Equal(t, 40, r.Series)
+	// 120 samples of the light series and 36 samples and a stale marker of the heavy series.
+	require.Equal(t, 3*120+37*37, r.Samples)
+	require.Equal(t, 1, r.PeakFiringAlerts)
+	require.Contains(t, r.EvalComplexity, "subquery")
+
+	// The series are derived and the peak firing alerts are declared.
+	r = CaseResources(undeclaredAlertsCase{LabelJoin()}, zeroTime)
+	require.Equal(t, Resources{Series: 3, Samples: 156, PeakFiringAlerts: 7, EvalComplexity: "many series"}, r)
+
+	// The alerts of the same test cases fire at the same time, plus the declared ones.
+	total := TotalResources([]TestCase{LabelJoin(), undeclaredAlertsCase{LabelJoin()}, LabelJoin()}, zeroTime)
+	require.Equal(t, Resources{Series: 3 * 3, Samples: 3 * 156, PeakFiringAlerts: 2*3 + 7}, total)
+}
@@ -0,0 +1,327 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/promql"
+	v1 "github.com/prometheus/prometheus/web/api/v1"
+)
+
+// AlertState is the state of an alert in a StateMachine.
+type AlertState string
+
+const (
+	AlertInactive AlertState = "inactive"
+	AlertPending  AlertState = "pending"
+	AlertFiring   AlertState = "firing"
+)
+
+// Transition is a change of the state of an alert at a time relative to the zero time of the test case,
+// which is the time of the first sample that causes the change.
+type Transition struct {
+	From, To AlertState
+	At       time.Duration
+	// Value is the value of the alert from this transition. It is inherited from the previous transition if empty
+	// when going from pending to firing, and unused when going to inactive.
+	Value string
+}
+
+// AlertStateMachine is the expected states of a single alert of an alerting rule over the test case.
+type AlertStateMachine struct {
+	// Labels and Annotations are of the alert as sent, i.e. with the alertname and the rendered annotations,
+	// which must be the same for all the transitions.
+	Labels, Annotations labels.Labels
+	// Transitions are in the order of their time. The alert starts inactive and must end inactive.
+	Transitions []Transition
+}
+
+// RuleStateMachine is an alerting rule of the rule group with the state machines of its alerts.
+type RuleStateMachine struct {
+	// Rule is the alerting rule as in GET /api/v1/rules, whose State and Alerts are derived from the alerts.
+	Rule   v1.AlertingRule
+	Alerts []AlertStateMachine
+}
+
+// StateMachine is the expected states of the alerts of all the alerting rules of a rule group, from which the
+// expectations of a TestCase on the alerts and rules APIs, the ALERTS series and the alerts received are derived.
+// Its methods have the same signature as the ones of TestCase so that a test case can delegate to them.
+//
+// An alert is expected in a state from a second before the time of the transition into it (a sample at an evaluation)
+// until a group interval after the time of the transition out of it (the next evaluation after the sample), and
+// all the combinations of the states of the alerts that are possible at a time are accepted. The state of a rule
+// is the highest state of its alerts.
+type StateMachine struct {
+	GroupName     string
+	GroupInterval time.Duration
+	Rules         []RuleStateMachine
+	// Valid, if not nil, gets an alert per alert of every rule in their order (nil if inactive) and tells if
+	// the alerts can be in that combination of states at the same time, e.g. when they change state together.
+	Valid func(c []*v1.Alert) bool
+
+	zeroTime int64
+}
+
+// Validate checks that the transitions of every alert are in order and between the states that the alerts can
+// go from and to, starting and ending inactive.
+func (sm *StateMachine) Validate() error {
+	for _, r := range sm.Rules {
+		for _, a := range r.Alerts {
+			prev := Transition{To: AlertInactive}
+			for i, t := range a.Transitions {
+				if t.From != prev.To {
+					return fmt.Errorf("alert %s: transition %d is from %s, but the alert is %s", a.Labels, i, t.From, prev.To)
+				}
+				if i > 0 && t.At <= prev.At {
+					return fmt.Errorf("alert %s: transition %d at %s is not after the previous one at %s", a.Labels, i, t.At, prev.At)
+				}
+				switch {
+				case t.From == AlertInactive && (t.To == AlertPending || t.To == AlertFiring):
+				case t.From == AlertPending && (t.To == AlertFiring || t.To == AlertInactive):
+				case t.From == AlertFiring && t.To == AlertInactive:
+				default:
+					return fmt.Errorf("alert %s: transition %d from %s to %s is not possible", a.Labels, i, t.From, t.To)
+				}
+				prev = t
+			}
+			if prev.To != AlertInactive {
+				return fmt.Errorf("alert %s: must end inactive, ends %s", a.Labels, prev.To)
+			}
+		}
+	}
+	return nil
+}
+
+// Init sets the zero time of the test case. See TestCase.Init().
+func (sm *StateMachine) Init(zt int64) {
+	sm.zeroTime = zt
+}
+
+// possibleAlerts returns the possible alerts at the time relative to the zero time, where nil means inactive.
+func (a AlertStateMachine) possibleAlerts(zeroTime int64, rel, groupInterval time.Duration) []*v1.Alert {
+	var alerts []*v1.Alert
+	inactive := false
+	state, start, value := AlertInactive, -time.Second, ""
+	var activeAt time.Time
+	addIfPossible := func(end time.Duration, endless bool) {
+		if rel <= start-time.Second || (!endless && rel > end+groupInterval) {
+			return
+		}
+		if state == AlertInactive {
+			if !inactive {
+				inactive = true
+				alerts = append(alerts, nil)
+			}
+			return
+		}
+		at := activeAt
+		alerts = append(alerts, &v1.Alert{
+			Labels:      a.Labels,
+			Annotations: a.Annotations,
+			State:       string(state),
+			Value:       value,
+			ActiveAt:    &at,
+		})
+	}
+	for _, t := range a.Transitions {
+		addIfPossible(t.At, false)
+		if t.From == AlertInactive {
+			activeAt = timestamp.Time(zeroTime).Add(t.At)
+		}
+		if t.Value != "" || t.To == AlertInactive {
+			value = t.Value
+		}
+		state, start = t.To, t.At
+	}
+	addIfPossible(0, true)
+	return alerts
+}
+
+// combinations returns the combinations of the possible alerts at ts, with an alert per alert of every rule
+// in their order, where nil means inactive.
+func (sm *StateMachine) combinations(ts int64) [][]*v1.Alert {
+	rel := time.Duration(ts-sm.zeroTime) * time.Millisecond
+	choices := [][]*v1.Alert{{}}
+	for _, r := range sm.Rules {
+		for _, a := range r.Alerts {
+			var newChoices [][]*v1.Alert
+			possible := a.possibleAlerts(sm.zeroTime, rel, sm.GroupInterval)
+			for _, c := range choices {
+				for _, pa := range possible {
+					newChoices = append(newChoices, append(append([]*v1.Alert{}, c...), pa))
+				}
+			}
+			choices = newChoices
+		}
+	}
+	if sm.Valid == nil {
+		return choices
+	}
+	var valid [][]*v1.Alert
+	for _, c := range choices {
+		if sm.Valid(c) {
+			valid = append(valid, c)
+		}
+	}
+	return valid
+}
+
+// ExpAlerts returns the possible alerts of GET /api/v1/alerts at ts.
+func (sm *StateMachine) ExpAlerts(ts int64) [][]v1.Alert {
+	var expAlerts [][]v1.Alert
+	for _, c := range sm.combinations(ts) {
+		alerts := []v1.Alert{}
+		for _, a := range c {
+			if a != nil {
+				alerts = append(alerts, *a)
+			}
+		}
+		expAlerts = append(expAlerts, alerts)
+	}
+	return expAlerts
+}
+
+// ExpRuleGroups returns the possible rule groups of GET /api/v1/rules at ts.
+func (sm *StateMachine) ExpRuleGroups(ts int64) []v1.RuleGroup {
+	var expRgs []v1.RuleGroup
+	for _, c := range sm.combinations(ts) {
+		rg := v1.RuleGroup{
+			Name:     sm.GroupName,
+			Interval: float64(sm.GroupInterval / time.Second),
+		}
+		i := 0
+		for _, r := range sm.Rules {
+			rule := r.Rule
+			rule.State = string(AlertInactive)
+			rule.Alerts = nil
+			for range r.Alerts {
+				a := c[i]
+				i++
+				if a == nil {
+					continue
+				}
+				if a.State == string(AlertFiring) || rule.State == string(AlertInactive) {
+					rule.State = a.State
+				}
+				rule.Alerts = append(rule.Alerts, a)
+			}
+			rg.Rules = append(rg.Rules, rule)
+		}
+		expRgs = append(expRgs, rg)
+	}
+	return expRgs
+}
+
+// ExpMetrics returns the possible ALERTS samples at ts.
+func (sm *StateMachine) ExpMetrics(ts int64) [][]promql.Sample {
+	return alertCombinationsSamples(ts, sm.ExpAlerts(ts))
+}
+
+// CheckAlerts implements TestCase.CheckAlerts.
+func (sm *StateMachine) CheckAlerts(ts int64, alerts []v1.Alert) error {
+	return checkExpectedAlerts(sm.ExpAlerts(ts), alerts, sm.GroupInterval)
+}
+
+// CheckRuleGroup implements TestCase.CheckRuleGroup.
+func (sm *StateMachine) CheckRuleGroup(ts int64, rg *v1.RuleGroup, opts CheckOptions) error {
+	if ts-sm.zeroTime < int64(sm.GroupInterval/time.Millisecond) {
+		// We wait till 1 evaluation is done.
+		return nil
+	}
+	if rg == nil {
+		return errors.New("no rule group found")
+	}
+	return checkExpectedRuleGroup(timestamp.Time(ts), sm.ExpRuleGroups(ts), *rg, opts)
+}
+
+// CheckMetrics implements TestCase.CheckMetrics.
+func (sm *StateMachine) CheckMetrics(ts int64, samples []promql.Sample, opts CheckOptions) error {
+	return checkExpectedSamples(ts, sm.ExpMetrics(ts), samples, opts)
+}
+
+// ExpectedAlerts implements TestCase.ExpectedAlerts. Every time an alert goes into firing, it is sent at that
+// time and resent after every ResendDelay until it goes inactive, when it is sent resolved for 15m or until
+// it becomes active again, whichever is earlier.
+func (sm *StateMachine) ExpectedAlerts() []ExpectedAlert {
+	var exp []ExpectedAlert
+	endsAtDelta := 4 * ResendDelay
+	if endsAtDelta < 4*sm.GroupInterval {
+		endsAtDelta = 4 * sm.GroupInterval
+	}
+
+	orderingID := 0
+	addAlert := func(ea ExpectedAlert) {
+		orderingID++
+		ea.OrderingID = orderingID
+		exp = append(exp, ea)
+	}
+	at := func(d time.Duration) time.Time {
+		return timestamp.Time(sm.zeroTime).Add(d)
+	}
+
+	for _, r := range sm.Rules {
+		for _, a := range r.Alerts {
+			for i, t := range a.Transitions {
+				if t.To != AlertFiring {
+					continue
+				}
+				// Validate() makes sure that the alert goes inactive next, and the transitions after that
+				// are from inactive.
+				firing, resolved := t.At, a.Transitions[i+1].At
+				var nextActive time.Duration
+				if i+2 < len(a.Transitions) {
+					nextActive = a.Transitions[i+2].At
+				}
+				alert := func() *notifier.Alert {
+					return &notifier.Alert{
+						Labels:      a.Labels,
+						Annotations: a.Annotations,
+						StartsAt:    at(firing),
+					}
+				}
+
+				for ts := firing; ts < resolved; ts += ResendDelay {
+					addAlert(ExpectedAlert{
+						TimeTolerance: sm.GroupInterval,
+						Ts:            at(ts),
+						Resolved:      false,
+						Resend:        ts != firing,
+						NextState:     at(resolved),
+						ResolvedTime:  at(resolved),
+						EndsAtDelta:   endsAtDelta,
+						Alert:         alert(),
+					})
+				}
+
+				// The resolved alert is not sent anymore once the alert is active again.
+				for ts := resolved; ts < resolved+15*time.Minute && (nextActive == 0 || ts < nextActive); ts += ResendDelay {
+					tolerance := sm.GroupInterval
+					if ts == resolved {
+						// Since the alert state is reset, the alert sent time for resolved alert can be upto
+						// 1 groupInterval late compared to actual time when it gets resolved.
+						tolerance = 2 * sm.GroupInterval
+					}
+					ea := ExpectedAlert{
+						TimeTolerance: tolerance,
+						Ts:            at(ts),
+						Resolved:      true,
+						Resend:        ts != resolved,
+						ResolvedTime:  at(resolved),
+						EndsAtDelta:   endsAtDelta,
+						Alert:         alert(),
+					}
+					if nextActive != 0 {
+						ea.NextState = at(nextActive)
+					}
+					addAlert(ea)
+				}
+			}
+		}
+	}
+
+	return exp
+}
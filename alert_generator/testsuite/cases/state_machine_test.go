@@ -0,0 +1,135 @@
+package cases
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func testStateMachine(transitions ...Transition) *StateMachine {
+	return &StateMachine{
+		GroupName:     "Test",
+		GroupInterval: 10 * time.Second,
+		Rules: []RuleStateMachine{{
+			Alerts: []AlertStateMachine{{
+				Labels:      labels.FromStrings("alertname", "Test"),
+				Transitions: transitions,
+			}},
+		}},
+	}
+}
+
+func TestStateMachineValidate(t *testing.T) {
+	cases := map[string]struct {
+		transitions []Transition
+		err         string
+	}{
+		"valid": {
+			transitions: []Transition{
+				{From: AlertInactive, To: AlertPending, At: time.Minute, Value: "1"},
+				{From: AlertPending, To: AlertFiring, At: 2 * time.Minute},
+				{From: AlertFiring, To: AlertInactive, At: 3 * time.Minute},
+			},
+		},
+		"wrong from": {
+			transitions: []Transition{
+				{From: AlertPending, To: AlertFiring, At: time.Minute},
+			},
+			err: "transition 0 is from pending, but the alert is inactive",
+		},
+		"out of order": {
+			transitions: []Transition{
+				{From: AlertInactive, To: AlertFiring, At: time.Minute},
+				{From: AlertFiring, To: AlertInactive, At: time.Minute},
+			},
+			err: "is not after the previous one",
+		},
+		"impossible transition": {
+			transitions: []Transition{
+				{From: AlertInactive, To: AlertFiring, At: time.Minute},
+				{From: AlertFiring, To: AlertPending, At: 2 * time.Minute},
+			},
+			err: "from firing to pending is not possible",
+		},
+		"ends active": {
+			transitions: []Transition{
+				{From: AlertInactive, To: AlertFiring, At: time.Minute},
+			},
+			err: "must end inactive, ends firing",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := testStateMachine(c.transitions...).Validate()
+			if c.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.err)
+		})
+	}
+}
+
+func TestStateMachineExpAlerts(t *testing.T) {
+	zeroTime := timestamp.FromTime(time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC))
+	sm := testStateMachine(
+		Transition{From: AlertInactive, To: AlertPending, At: time.Minute, Value: "1"},
+		Transition{From: AlertPending, To: AlertFiring, At: 2 * time.Minute},
+		Transition{From: AlertFiring, To: AlertInactive, At: 3 * time.Minute},
+	)
+	require.NoError(t, sm.Validate())
+	sm.Init(zeroTime)
+
+	// states returns the possible states of the alert at the time relative to the zero time.
+	states := func(rel time.Duration) []string {
+		var s []string
+		for _, alerts := range sm.ExpAlerts(zeroTime + int64(rel/time.Millisecond)) {
+			if len(alerts) == 0 {
+				s = append(s, string(AlertInactive))
+				continue
+			}
+			require.Len(t, alerts, 1)
+			require.Equal(t, "1", alerts[0].Value)
+			s = append(s, alerts[0].State)
+		}
+		return s
+	}
+
+	require.Equal(t, []string{"inactive"}, states(0))
+	require.Equal(t, []string{"inactive"}, states(time.Minute-time.Second))
+	require.Equal(t, []string{"inactive", "pending"}, states(time.Minute))
+	require.Equal(t, []string{"inactive", "pending"}, states(time.Minute+10*time.Second))
+	require.Equal(t, []string{"pending"}, states(time.Minute+11*time.Second))
+	require.Equal(t, []string{"pending", "firing"}, states(2*time.Minute))
+	require.Equal(t, []string{"firing"}, states(2*time.Minute+30*time.Second))
+	require.Equal(t, []string{"firing", "inactive"}, states(3*time.Minute+10*time.Second))
+	require.Equal(t, []string{"inactive"}, states(3*time.Minute+11*time.Second))
+}
+
+func TestStateMachineExpectedAlerts(t *testing.T) {
+	zeroTime := timestamp.FromTime(time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC))
+	sm := testStateMachine(
+		Transition{From: AlertInactive, To: AlertFiring, At: time.Minute, Value: "1"},
+		Transition{From: AlertFiring, To: AlertInactive, At: 4 * time.Minute},
+		Transition{From: AlertInactive, To: AlertFiring, At: 10 * time.Minute, Value: "2"},
+		Transition{From: AlertFiring, To: AlertInactive, At: 11 * time.Minute},
+	)
+	require.NoError(t, sm.Validate())
+	sm.Init(zeroTime)
+
+	var firing, resolved int
+	for _, ea := range sm.ExpectedAlerts() {
+		if ea.Resolved {
+			resolved++
+		} else {
+			firing++
+		}
+	}
+	// 3 firing then 6 resolved until firing again, and 1 firing then 15 resolved.
+	require.Equal(t, 4, firing)
+	require.Equal(t, 21, resolved)
+}
@@ -2,6 +2,7 @@ package cases
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -10,6 +11,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/promql/parser"
@@ -28,6 +30,14 @@ func metricLabels(groupName, alertName string) labels.Labels {
 	)
 }
 
+func fromProtoLabels(pls []prompb.Label) labels.Labels {
+	lbls := make(labels.Labels, 0, len(pls))
+	for _, l := range pls {
+		lbls = append(lbls, labels.Label{Name: l.Name, Value: l.Value})
+	}
+	return lbls
+}
+
 func toProtoLabels(lbls labels.Labels) []prompb.Label {
 	res := make([]prompb.Label, 0, len(lbls))
 	for _, l := range lbls {
@@ -46,7 +56,8 @@ func toProtoLabels(lbls labels.Labels) []prompb.Label {
 //   * "V" is the absolute value of the sample in float.
 //   * "AxB" A is the value increment per sample and B is the number of samples.
 //     The initial value starts at 0 if this notation is the first value.
-//     A is a float, B is an integer.
+//     A is a float, B is an integer. The Nth value is computed as the initial value + N*A instead of
+//     adding A N times, so that the values are exact where possible, e.g. "9", "0.1x10" ends at exactly 10.
 // Example:
 //   Input values : [ "1x1",  "0x3",      "5x3",   "9", "8",   "-2x2" ]
 //   Output values: [   1,   1, 1, 1,   6, 11, 16,  9,   8,     6, 4 ]
@@ -67,8 +78,9 @@ func sampleSlice(interval time.Duration, values ...string) []prompb.Sample {
 				panic(fmt.Sprintf("invalid values notation %s, err: %s", v, err.Error()))
 			}
 
+			base := val
 			for i := 0; i < b; i++ {
-				val += a
+				val = base + a*float64(i+1)
 				samples = append(samples, prompb.Sample{
 					Timestamp: timestamp.FromTime(ts),
 					Value:     val,
@@ -94,6 +106,52 @@ func sampleSlice(interval time.Duration, values ...string) []prompb.Sample {
 	return samples
 }
 
+// WithWarmupSamples returns a copy of the given samples of the test case with the warmup samples added
+// before the first sample of every series if the test case implements Warmup. Otherwise the samples are
+// returned as is. A series with less than 2 samples does not get any warmup since its interval is not known.
+func WithWarmupSamples(tc TestCase, series []prompb.TimeSeries) []prompb.TimeSeries {
+	w, ok := tc.(Warmup)
+	if !ok {
+		return series
+	}
+	warmupMs := int64(w.WarmupDuration() / time.Millisecond)
+
+	res := make([]prompb.TimeSeries, 0, len(series))
+	for _, ts := range series {
+		if len(ts.Samples) < 2 || ts.Samples[1].Timestamp <= ts.Samples[0].Timestamp {
+			res = append(res, ts)
+			continue
+		}
+		first := ts.Samples[0]
+		step := ts.Samples[1].Timestamp - first.Timestamp
+		var samples []prompb.Sample
+		for t := first.Timestamp - (warmupMs/step)*step; t < first.Timestamp; t += step {
+			samples = append(samples, prompb.Sample{Timestamp: t, Value: first.Value})
+		}
+		samples = append(samples, ts.Samples...)
+		res = append(res, prompb.TimeSeries{Labels: ts.Labels, Samples: samples})
+	}
+	return res
+}
+
+// CleanupSeries returns the series to remote write after the test to return the alert generator to a clean baseline,
+// which is Cleanup() if the test case implements Cleaner. Otherwise it is a stale marker at the given time in milliseconds
+// for every series from SamplesToRemoteWrite(), so that the alerts on them are resolved at the next evaluation instead of
+// after the lookback delta, and do not leak into the next run against the same alert generator.
+func CleanupSeries(tc TestCase, ts int64) []prompb.TimeSeries {
+	if c, ok := tc.(Cleaner); ok {
+		return c.Cleanup(ts)
+	}
+	var res []prompb.TimeSeries
+	for _, s := range tc.SamplesToRemoteWrite() {
+		res = append(res, prompb.TimeSeries{
+			Labels:  s.Labels,
+			Samples: []prompb.Sample{{Timestamp: ts, Value: math.Float64frombits(value.StaleNaN)}},
+		})
+	}
+	return res
+}
+
 // betweenFunc returns a function that returns true if
 // ts belongs to (start, end].
 func betweenFunc(ts int64) func(start, end float64) bool {
@@ -104,6 +162,90 @@ func betweenFunc(ts int64) func(start, end float64) bool {
 	}
 }
 
+// possibleSeriesAlerts returns the possible alerts of a single series for the given possible states,
+// where nil means that the alert is inactive. The state of the given alert is overwritten.
+func possibleSeriesAlerts(canBeInactive, canBePending, canBeFiring bool, alert v1.Alert) []*v1.Alert {
+	var alerts []*v1.Alert
+	if canBeInactive {
+		alerts = append(alerts, nil)
+	}
+	for _, state := range []string{"pending", "firing"} {
+		if (state == "pending" && !canBePending) || (state == "firing" && !canBeFiring) {
+			continue
+		}
+		a := alert
+		a.State = state
+		alerts = append(alerts, &a)
+	}
+	return alerts
+}
+
+// alertCombinations returns the combinations of the possible alerts of multiple series of a rule,
+// where perSeries[i] are the possible alerts of the ith series as given by possibleSeriesAlerts.
+// The valid function, if not nil, gets one alert per series in the same order (nil if inactive)
+// and tells if the series can be in that combination of states at the same time.
+func alertCombinations(perSeries [][]*v1.Alert, valid func(c []*v1.Alert) bool) [][]v1.Alert {
+	choices := [][]*v1.Alert{{}}
+	for _, alerts := range perSeries {
+		var newChoices [][]*v1.Alert
+		for _, c := range choices {
+			for _, a := range alerts {
+				newChoices = append(newChoices, append(append([]*v1.Alert{}, c...), a))
+			}
+		}
+		choices = newChoices
+	}
+
+	var combinations [][]v1.Alert
+	for _, c := range choices {
+		if valid != nil && !valid(c) {
+			continue
+		}
+		combination := []v1.Alert{}
+		for _, a := range c {
+			if a != nil {
+				combination = append(combination, *a)
+			}
+		}
+		combinations = append(combinations, combination)
+	}
+	return combinations
+}
+
+// alertCombinationsRuleGroups returns the expected rule groups for the given combinations of alerts
+// from alertCombinations. getRg gives the rule group for the rule state and its alerts.
+func alertCombinationsRuleGroups(combinations [][]v1.Alert, getRg func(state string, alerts []*v1.Alert) v1.RuleGroup) (expRgs []v1.RuleGroup) {
+	for _, c := range combinations {
+		// The rule state is the state of the alert with the highest state.
+		state := "inactive"
+		var alerts []*v1.Alert
+		for i := range c {
+			if c[i].State == "firing" || state == "inactive" {
+				state = c[i].State
+			}
+			alerts = append(alerts, &c[i])
+		}
+		expRgs = append(expRgs, getRg(state, alerts))
+	}
+	return expRgs
+}
+
+// alertCombinationsSamples returns the expected ALERTS samples at ts for the given combinations of
+// alerts from alertCombinations.
+func alertCombinationsSamples(ts int64, combinations [][]v1.Alert) (expSamples [][]promql.Sample) {
+	for _, c := range combinations {
+		var samples []promql.Sample
+		for _, a := range c {
+			samples = append(samples, promql.Sample{
+				Point:  promql.Point{T: ts / 1000, V: 1},
+				Metric: labels.NewBuilder(a.Labels).Set("__name__", "ALERTS").Set("alertstate", a.State).Labels(),
+			})
+		}
+		expSamples = append(expSamples, samples)
+	}
+	return expSamples
+}
+
 // checkExpectedAlerts checks the actual alerts with all possible combinations of expected alerts
 // provided. It returns an error if none of them match.
 //
@@ -160,10 +302,15 @@ func areAlertsEqual(exp, act []v1.Alert, interval time.Duration) error {
 			return errors.Errorf("error when parsing the value - alert: %v, error: %s", a, err.Error())
 		}
 
-		ok := labels.Compare(e.Labels, a.Labels) == 0 &&
-			labels.Compare(e.Annotations, a.Annotations) == 0 &&
+		if diff := separationDiff(e.Labels, e.Annotations, a.Labels, a.Annotations); diff != "" {
+			return errors.Errorf("alerts mismatch in the separation of labels and annotations (%s) - expected: %v, actual: %v", diff, e, a)
+		}
+		if labels.Compare(e.Labels, a.Labels) != 0 {
+			return errors.Errorf("alerts mismatch in labels (%s) - expected: %v, actual: %v", labelsDiff(e.Labels, a.Labels), e, a)
+		}
+		ok := labels.Compare(e.Annotations, a.Annotations) == 0 &&
 			e.State == a.State &&
-			ev == av
+			floatEquals(ev, av)
 
 		if !ok {
 			return errors.Errorf("alerts mismatch - expected: %v, actual: %v", e, a)
@@ -191,30 +338,221 @@ func areAlertsEqual(exp, act []v1.Alert, interval time.Duration) error {
 	return nil
 }
 
+// labelsDiff describes the labels that are missing, unexpected or have a different value in the actual labels,
+// so that a single wrong label stands out in a wide label set.
+func labelsDiff(exp, act labels.Labels) string {
+	var diffs []string
+	expMap, actMap := exp.Map(), act.Map()
+	for _, l := range exp {
+		v, ok := actMap[l.Name]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("missing %s=%q", l.Name, l.Value))
+		case v != l.Value:
+			diffs = append(diffs, fmt.Sprintf("%s=%q instead of %q", l.Name, v, l.Value))
+		}
+	}
+	for _, l := range act {
+		if _, ok := expMap[l.Name]; !ok {
+			diffs = append(diffs, fmt.Sprintf("unexpected %s=%q", l.Name, l.Value))
+		}
+	}
+	return strings.Join(diffs, ", ")
+}
+
+// separationDiff describes the annotations that appeared in the actual labels and the labels that appeared in
+// the actual annotations instead, i.e. the ones that the alert generator promoted or demoted, so that such a
+// failure is not reported as just some unexpected label. Empty if the labels and the annotations are separated
+// as expected, even if they differ otherwise.
+func separationDiff(expLabels, expAnnotations, actLabels, actAnnotations labels.Labels) string {
+	var diffs []string
+	appeared := func(kind string, exp, expOther, act, actOther labels.Labels, other string) {
+		for _, l := range exp {
+			if expOther.Get(l.Name) != "" || actOther.Get(l.Name) == "" {
+				continue
+			}
+			if act.Get(l.Name) != "" {
+				diffs = append(diffs, fmt.Sprintf("%s %q appeared in %s", kind, l.Name, other))
+			} else {
+				diffs = append(diffs, fmt.Sprintf("%s %q appeared in %s instead of %ss", kind, l.Name, other, kind))
+			}
+		}
+	}
+	appeared("annotation", expAnnotations, expLabels, actAnnotations, actLabels, "labels")
+	appeared("label", expLabels, expAnnotations, actLabels, actAnnotations, "annotations")
+	return strings.Join(diffs, ", ")
+}
+
+// CheckOptions are the options of the test suite that the checks of the test cases depend on, which the test suite
+// passes to every check. The zero value is the defaults.
+type CheckOptions struct {
+	// SampleEpsilon is the relative tolerance of the comparison of the values of the samples in CheckMetrics()
+	// and CheckQuery(). DefaultSampleEpsilon is used if 0.
+	SampleEpsilon float64
+	// StrictRuleGroup makes CheckRuleGroup() also verify the fields of the rule groups and the rules that are not
+	// expected by the test cases, for the alert generators that must be compatible with the API of Prometheus
+	// field for field. In addition to the usual checks:
+	// * The file of the group must be set.
+	// * The evaluationTime of the group and of every rule must be between 0 and the group interval, and their
+	//   lastEvaluation must be set.
+	// * The alerts of every alerting rule must be the expected alerts of that rule and not of another rule in the
+	//   group, their activeAt must not be after the lastEvaluation of the rule, and their value must be formatted
+	//   like Prometheus does, e.g. "1.5e+01".
+	// The fields unknown to the test suite are still ignored, and the lastError still only needs to contain the
+	// expected error, since the error messages are implementation specific.
+	StrictRuleGroup bool
+	// StepAlignment is how the alert generator aligns the instant of the instant queries, which the timestamps of
+	// the expected samples in CheckMetrics() and CheckQuery() are aligned to. QueryStepAlignmentNone is used if empty.
+	StepAlignment QueryStepAlignment
+	// StepInterval is the step that the instant is aligned to with QueryStepAlignmentInterval.
+	// DefaultStepInterval is used if 0.
+	StepInterval time.Duration
+}
+
+func (o CheckOptions) sampleEpsilon() float64 {
+	if o.SampleEpsilon > 0 {
+		return o.SampleEpsilon
+	}
+	return DefaultSampleEpsilon
+}
+
+func (o CheckOptions) stepAlignment() QueryStepAlignment {
+	if o.StepAlignment != "" {
+		return o.StepAlignment
+	}
+	return QueryStepAlignmentNone
+}
+
+// SampleTimestamp returns the timestamp in seconds of the samples of an instant query at ts in milliseconds,
+// with the instant aligned according to StepAlignment.
+func (o CheckOptions) SampleTimestamp(ts int64) int64 {
+	switch o.stepAlignment() {
+	case QueryStepAlignmentSecond:
+		return (ts + 500) / 1000
+	case QueryStepAlignmentInterval:
+		itvl := int64(DefaultStepInterval / time.Millisecond)
+		if o.StepInterval > 0 {
+			itvl = int64(o.StepInterval / time.Millisecond)
+		}
+		return ts / itvl * itvl / 1000
+	}
+	return ts / 1000
+}
+
+// floatEquals tells if the values are equal within DefaultSampleEpsilon, see floatEqualsWithin.
+func floatEquals(a, b float64) bool {
+	return floatEqualsWithin(a, b, DefaultSampleEpsilon)
+}
+
+// floatEqualsWithin tells if the values are equal within epsilon relative to the larger one, which allows the
+// rounding errors of the float arithmetic in PromQL, e.g. the extrapolation in increase() can give 5.999999999999998
+// for 6, and the results of rate() can differ in the last bits because of the order of summation.
+func floatEqualsWithin(a, b, epsilon float64) bool {
+	if a == b {
+		return true
+	}
+	if math.IsInf(a, 0) || math.IsInf(b, 0) {
+		return false
+	}
+	return math.Abs(a-b) <= epsilon*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// QueryStepAlignment is how the alert generator aligns the instant at which an instant query is evaluated, which is
+// the timestamp of the samples in the result, e.g. the ALERTS samples checked by CheckMetrics().
+type QueryStepAlignment string
+
+const (
+	// QueryStepAlignmentNone evaluates at the requested instant like Prometheus. The timestamp of the samples is
+	// that instant truncated to the second. It is the default.
+	QueryStepAlignmentNone QueryStepAlignment = "none"
+	// QueryStepAlignmentSecond rounds the requested instant to the nearest second.
+	QueryStepAlignmentSecond QueryStepAlignment = "second"
+	// QueryStepAlignmentInterval aligns the requested instant down to a multiple of CheckOptions.StepInterval since the epoch,
+	// like the alert generators that only evaluate at the boundaries of their scrape interval.
+	QueryStepAlignmentInterval QueryStepAlignment = "interval"
+)
+
+// quantile returns the q-quantile of the values the same way as quantile_over_time() in Prometheus,
+// i.e. by interpolating linearly between the two closest ranks. The values must not be empty.
+func quantile(q float64, values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	n := float64(len(sorted))
+	rank := q * (n - 1)
+	lowerIndex := math.Max(0, math.Floor(rank))
+	upperIndex := math.Min(n-1, lowerIndex+1)
+	weight := rank - math.Floor(rank)
+	return sorted[int(lowerIndex)]*(1-weight) + sorted[int(upperIndex)]*weight
+}
+
+// linearRegressionSlope returns the slope per second of the least-squares linear regression of the samples,
+// which is deriv() of the samples in PromQL. It needs at least 2 samples. Like PromQL, the timestamps are
+// taken relative to the first sample and the sums are compensated, so that the result is as close as possible.
+func linearRegressionSlope(samples []prompb.Sample) float64 {
+	var (
+		n           float64
+		sumX, cX    float64
+		sumY, cY    float64
+		sumXY, cXY  float64
+		sumX2, cX2  float64
+		constY      = true
+		kahanSumInc = func(inc, sum, c float64) (float64, float64) {
+			t := sum + inc
+			if math.Abs(sum) >= math.Abs(inc) {
+				c += (sum - t) + inc
+			} else {
+				c += (inc - t) + sum
+			}
+			return t, c
+		}
+	)
+	for i, s := range samples {
+		if i > 0 && s.Value != samples[0].Value {
+			constY = false
+		}
+		n++
+		x := float64(s.Timestamp-samples[0].Timestamp) / 1e3
+		sumX, cX = kahanSumInc(x, sumX, cX)
+		sumY, cY = kahanSumInc(s.Value, sumY, cY)
+		sumXY, cXY = kahanSumInc(x*s.Value, sumXY, cXY)
+		sumX2, cX2 = kahanSumInc(x*x, sumX2, cX2)
+	}
+	if constY {
+		return 0
+	}
+	sumX += cX
+	sumY += cY
+	sumXY += cXY
+	sumX2 += cX2
+	return (sumXY - sumX*sumY/n) / (sumX2 - sumX*sumX/n)
+}
+
 // checkExpectedRuleGroup checks the actual rule group with all possible combinations of expected alerts
 // provided and the rule group fields. It returns an error if none of them match.
 // This runs the same logic as checkExpectedAlerts for checking the alerts of the rule group.
-func checkExpectedRuleGroup(now time.Time, expRgs []v1.RuleGroup, actRg v1.RuleGroup) error {
+func checkExpectedRuleGroup(now time.Time, expRgs []v1.RuleGroup, actRg v1.RuleGroup, opts CheckOptions) error {
+	return checkExpectedRuleGroupWithTolerance(now, expRgs, actRg, 0, opts)
+}
+
+// checkExpectedRuleGroupWithTolerance is checkExpectedRuleGroup where the ActiveAt of the alerts can be
+// up to activeAtTolerance after the expected ActiveAt. If 0, the group interval is used as the tolerance.
+func checkExpectedRuleGroupWithTolerance(now time.Time, expRgs []v1.RuleGroup, actRg v1.RuleGroup, activeAtTolerance time.Duration, opts CheckOptions) error {
 	var actAlerts []v1.Alert
-	var actRules []v1.AlertingRule
+	var actRules []v1.Rule
 	for _, r := range actRg.Rules {
-		ar, ok := r.(v1.AlertingRule)
-		if !ok {
-			return fmt.Errorf("found a rule that is not an alerting rule")
-		}
-		actRules = append(actRules, ar)
-		for _, a := range ar.Alerts {
-			actAlerts = append(actAlerts, *a)
+		switch rule := r.(type) {
+		case v1.AlertingRule:
+			for _, a := range rule.Alerts {
+				actAlerts = append(actAlerts, *a)
+			}
+		case v1.RecordingRule:
+		default:
+			return fmt.Errorf("found a rule that is neither an alerting nor a recording rule")
 		}
+		actRules = append(actRules, r)
 	}
 
-	sort.Slice(actRules, func(i, j int) bool {
-		l, r := actRules[i], actRules[j]
-		if l.Name == r.Name {
-			return labels.Compare(l.Labels, r.Labels) <= 0
-		}
-		return l.Name < r.Name
-	})
+	sortRules(actRules)
 
 	var firstErr error
 	markErr := func(err error) {
@@ -249,7 +587,22 @@ func checkExpectedRuleGroup(now time.Time, expRgs []v1.RuleGroup, actRg v1.RuleG
 			continue
 		}
 
-		err := areRulesEqual(now, itvl, rg.Rules, actRules, actAlerts)
+		if opts.StrictRuleGroup {
+			if actRg.File == "" {
+				markErr(fmt.Errorf("strict rule group: no file of the group"))
+				continue
+			}
+			if err := checkStrictEvaluation("group", itvl, actRg.EvaluationTime, actRg.LastEvaluation); err != nil {
+				markErr(err)
+				continue
+			}
+		}
+
+		tolerance := activeAtTolerance
+		if tolerance == 0 {
+			tolerance = itvl
+		}
+		err := areRulesEqual(now, itvl, tolerance, rg.Rules, actRules, actAlerts, opts.StrictRuleGroup)
 		if err == nil {
 			// This rule group matched.
 			return nil
@@ -260,30 +613,65 @@ func checkExpectedRuleGroup(now time.Time, expRgs []v1.RuleGroup, actRg v1.RuleG
 	return errors.Wrap(firstErr, "error in rules")
 }
 
-func areRulesEqual(now time.Time, itvl time.Duration, exp []v1.Rule, actRules []v1.AlertingRule, actAlerts []v1.Alert) error {
+// ruleNameAndLabels returns the name and labels of a v1.AlertingRule or v1.RecordingRule.
+func ruleNameAndLabels(r v1.Rule) (string, labels.Labels) {
+	switch rule := r.(type) {
+	case v1.AlertingRule:
+		return rule.Name, rule.Labels
+	case v1.RecordingRule:
+		return rule.Name, rule.Labels
+	}
+	return "", nil
+}
+
+func sortRules(rules []v1.Rule) {
+	sort.Slice(rules, func(i, j int) bool {
+		ln, ll := ruleNameAndLabels(rules[i])
+		rn, rl := ruleNameAndLabels(rules[j])
+		if ln == rn {
+			return labels.Compare(ll, rl) <= 0
+		}
+		return ln < rn
+	})
+}
+
+// areRulesEqual tells whether the actual rules match the expected ones, with the strict checks of
+// CheckOptions.StrictRuleGroup if strict.
+func areRulesEqual(now time.Time, itvl, activeAtTolerance time.Duration, exp []v1.Rule, actRules []v1.Rule, actAlerts []v1.Alert, strict bool) error {
 	var expAlerts []v1.Alert
-	var expRules []v1.AlertingRule
+	var expRules []v1.Rule
 	for _, r := range exp {
-		ar, ok := r.(v1.AlertingRule)
-		if !ok {
-			panic("expected rules can only be alerting rules")
-		}
-		expRules = append(expRules, ar)
-		for _, a := range ar.Alerts {
-			expAlerts = append(expAlerts, *a)
+		switch rule := r.(type) {
+		case v1.AlertingRule:
+			for _, a := range rule.Alerts {
+				expAlerts = append(expAlerts, *a)
+			}
+		case v1.RecordingRule:
+		default:
+			panic("expected rules can only be alerting or recording rules")
 		}
+		expRules = append(expRules, r)
 	}
 
-	sort.Slice(expRules, func(i, j int) bool {
-		l, r := expRules[i], expRules[j]
-		if l.Name == r.Name {
-			return labels.Compare(l.Labels, r.Labels) <= 0
-		}
-		return l.Name < r.Name
-	})
+	sortRules(expRules)
 
 	for i := range expRules {
-		e, a := expRules[i], actRules[i]
+		if e, ok := expRules[i].(v1.RecordingRule); ok {
+			a, ok := actRules[i].(v1.RecordingRule)
+			if !ok {
+				return fmt.Errorf("rules do not match, expected a recording rule %q, \n\t\tgot: %#v", e.Name, actRules[i])
+			}
+			if err := areRecordingRulesEqual(now, itvl, e, a, strict); err != nil {
+				return err
+			}
+			continue
+		}
+
+		e := expRules[i].(v1.AlertingRule)
+		a, ok := actRules[i].(v1.AlertingRule)
+		if !ok {
+			return fmt.Errorf("rules do not match, expected an alerting rule %q, \n\t\tgot: %#v", e.Name, actRules[i])
+		}
 		mismatch := ""
 		eq, err := parser.ParseExpr(e.Query)
 		if err != nil {
@@ -310,7 +698,7 @@ func areRulesEqual(now time.Time, itvl time.Duration, exp []v1.Rule, actRules []
 			mismatch = "Health"
 		case e.Type != a.Type:
 			mismatch = "Type"
-		case e.LastError != a.LastError:
+		case !lastErrorMatches(e.LastError, a.LastError):
 			mismatch = "LastError"
 		}
 
@@ -323,18 +711,116 @@ func areRulesEqual(now time.Time, itvl time.Duration, exp []v1.Rule, actRules []
 			return fmt.Errorf("expected evaluation for %q rule after %s, but the last evaluation was on %s", a.Name,
 				cutOff.Format(time.RFC3339Nano), a.LastEvaluation.UTC().Format(time.RFC3339Nano))
 		}
+
+		if strict {
+			if err := checkStrictAlertingRule(itvl, activeAtTolerance, e, a); err != nil {
+				return err
+			}
+		}
 	}
 
-	return checkExpectedAlerts([][]v1.Alert{expAlerts}, actAlerts, itvl)
+	return checkExpectedAlerts([][]v1.Alert{expAlerts}, actAlerts, activeAtTolerance)
 }
 
-// checkExpectedSamples checks the actual samples with all possible combinations of expected samples
-// provided. It returns an error if none of them match.
+// checkStrictEvaluation checks the evaluationTime and the lastEvaluation of a group or a rule for
+// CheckOptions.StrictRuleGroup.
+func checkStrictEvaluation(of string, itvl time.Duration, evaluationTime float64, lastEvaluation time.Time) error {
+	if math.IsNaN(evaluationTime) || evaluationTime < 0 || evaluationTime > itvl.Seconds() {
+		return fmt.Errorf("strict rule group: evaluation time of the %s must be between 0 and the interval %s, got: %gs", of, itvl, evaluationTime)
+	}
+	if lastEvaluation.IsZero() {
+		return fmt.Errorf("strict rule group: no last evaluation of the %s", of)
+	}
+	return nil
+}
+
+// checkStrictAlertingRule checks the fields of an alerting rule that match the expected rule otherwise
+// for CheckOptions.StrictRuleGroup.
+func checkStrictAlertingRule(itvl, activeAtTolerance time.Duration, e, a v1.AlertingRule) error {
+	if err := checkStrictEvaluation(fmt.Sprintf("rule %q", a.Name), itvl, a.EvaluationTime, a.LastEvaluation); err != nil {
+		return err
+	}
+	var expAlerts, actAlerts []v1.Alert
+	for _, al := range e.Alerts {
+		expAlerts = append(expAlerts, *al)
+	}
+	for _, al := range a.Alerts {
+		actAlerts = append(actAlerts, *al)
+		if al.ActiveAt != nil && al.ActiveAt.After(a.LastEvaluation) {
+			return fmt.Errorf("strict rule group: alert %s of the rule %q is active at %s, after the last evaluation of the rule on %s", al.Labels, a.Name,
+				al.ActiveAt.UTC().Format(time.RFC3339Nano), a.LastEvaluation.UTC().Format(time.RFC3339Nano))
+		}
+		if v, err := strconv.ParseFloat(al.Value, 64); err == nil && al.Value != strconv.FormatFloat(v, 'e', -1, 64) {
+			return fmt.Errorf("strict rule group: value of the alert %s of the rule %q must be formatted as %q, got: %q", al.Labels, a.Name,
+				strconv.FormatFloat(v, 'e', -1, 64), al.Value)
+		}
+	}
+	if err := areAlertsEqual(expAlerts, actAlerts, activeAtTolerance); err != nil {
+		return errors.Wrapf(err, "strict rule group: alerts of the rule %q", a.Name)
+	}
+	return nil
+}
+
+// lastErrorMatches tells if the actual last error of a rule matches the expected one. Since the error
+// messages are implementation specific, the expected error only needs to be a substring of the actual error.
+// An empty expected error means that there must not be any error.
+func lastErrorMatches(exp, act string) bool {
+	if exp == "" {
+		return act == ""
+	}
+	return strings.Contains(act, exp)
+}
+
+func areRecordingRulesEqual(now time.Time, itvl time.Duration, e, a v1.RecordingRule, strict bool) error {
+	mismatch := ""
+	eq, err := parser.ParseExpr(e.Query)
+	if err != nil {
+		panic("expecting query is not parsing: " + err.Error())
+	}
+	aq, err := parser.ParseExpr(a.Query)
+	if err != nil {
+		return fmt.Errorf("error in parsing query: " + err.Error())
+	}
+	switch {
+	case e.Name != a.Name:
+		mismatch = "Name"
+	case eq.String() != aq.String():
+		mismatch = "Query"
+	case labels.Compare(e.Labels, a.Labels) != 0:
+		mismatch = "Labels"
+	case e.Health != a.Health:
+		mismatch = "Health"
+	case e.Type != a.Type:
+		mismatch = "Type"
+	case !lastErrorMatches(e.LastError, a.LastError):
+		mismatch = "LastError"
+	}
+
+	if mismatch != "" {
+		return fmt.Errorf("recording rules do not match, mismatch in %q, \n\t\texpected(ignoring LastEvaluation): %#v, \n\t\tgot: %#v", mismatch, e, a)
+	}
+
+	cutOff := now.Add(-MaxRTT).Add(-itvl)
+	if a.LastEvaluation.Before(cutOff) {
+		return fmt.Errorf("expected evaluation for %q rule after %s, but the last evaluation was on %s", a.Name,
+			cutOff.Format(time.RFC3339Nano), a.LastEvaluation.UTC().Format(time.RFC3339Nano))
+	}
+
+	if strict {
+		return checkStrictEvaluation(fmt.Sprintf("rule %q", a.Name), itvl, a.EvaluationTime, a.LastEvaluation)
+	}
+	return nil
+}
+
+// checkExpectedSamples checks the actual samples of an instant query at ts with all possible combinations of
+// expected samples provided. It returns an error if none of them match. The expected samples are at ts truncated
+// to the second, and their timestamp is aligned according to CheckOptions.StepAlignment.
 // TODO: write unit tests for this.
-func checkExpectedSamples(expSamples [][]promql.Sample, act []promql.Sample) error {
+func checkExpectedSamples(ts int64, expSamples [][]promql.Sample, act []promql.Sample, opts CheckOptions) error {
 	var errs []error
+	shift := opts.SampleTimestamp(ts) - ts/1000
 	for _, exp := range expSamples {
-		err := areSamplesEqual(exp, act)
+		err := areSamplesEqual(shiftSamples(exp, shift), act, opts)
 		if err == nil {
 			// We only need one of the expected slice to match.
 			return nil
@@ -355,8 +841,23 @@ func checkExpectedSamples(expSamples [][]promql.Sample, act []promql.Sample) err
 	return errors.New(errMsg)
 }
 
-// areSamplesEqual tells whether both the expected and actual samples match.
-func areSamplesEqual(exp, act []promql.Sample) error {
+// shiftSamples returns a copy of the samples with their timestamp shifted by shift, or the samples as they are
+// if shift is 0.
+func shiftSamples(samples []promql.Sample, shift int64) []promql.Sample {
+	if shift == 0 {
+		return samples
+	}
+	res := make([]promql.Sample, len(samples))
+	for i, s := range samples {
+		s.T += shift
+		res[i] = s
+	}
+	return res
+}
+
+// areSamplesEqual tells whether both the expected and actual samples match, with the values within
+// CheckOptions.SampleEpsilon.
+func areSamplesEqual(exp, act []promql.Sample, opts CheckOptions) error {
 	if len(exp) != len(act) {
 		return errors.Errorf("different number of metrics - expected(%d): %v, actual(%d): %v", len(exp), exp, len(act), act)
 	}
@@ -370,9 +871,12 @@ func areSamplesEqual(exp, act []promql.Sample) error {
 
 	for i := range exp {
 		e, a := exp[i], act[i]
-		ok := labels.Compare(e.Metric, a.Metric) == 0 &&
-			e.T == a.T && e.V == a.V
-		if !ok {
+		sameSeries := labels.Compare(e.Metric, a.Metric) == 0 && floatEqualsWithin(e.V, a.V, opts.sampleEpsilon())
+		if sameSeries && e.T != a.T {
+			// Only off by the alignment of the instant of the query, e.g. by a step.
+			return errors.Errorf("metrics mismatch in the timestamp, check how the alert generator aligns the instant of the query (assumed %q) - expected: %v, actual: %v", opts.stepAlignment(), e, a)
+		}
+		if !sameSeries {
 			return errors.Errorf("metrics mismatch - expected: %v, actual: %v", e, a)
 		}
 	}
@@ -1,11 +1,15 @@
 package cases
 
 import (
+	"math"
 	"testing"
 	"time"
 
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/web/api/v1"
 	"github.com/stretchr/testify/require"
 )
 
@@ -26,4 +30,280 @@ func TestSampleSlice(t *testing.T) {
 	}
 
 	require.Equal(t, exp, act)
+
+	// The values are not accumulated, which would make the last value 9.999999999999996.
+	act = sampleSlice(15*time.Second, "9", "0.1x10")
+	require.Len(t, act, 11)
+	require.Equal(t, 10.0, act[10].Value)
+
+	// Negative absolute values and increments.
+	act = sampleSlice(15*time.Second, "-5", "-1x4", "-15", "0x2")
+	require.Equal(t, []float64{-5, -6, -7, -8, -9, -15, -15, -15}, sampleValues(act))
+}
+
+func sampleValues(samples []prompb.Sample) []float64 {
+	vals := make([]float64, 0, len(samples))
+	for _, s := range samples {
+		vals = append(vals, s.Value)
+	}
+	return vals
+}
+
+func TestFloatEquals(t *testing.T) {
+	require.True(t, floatEquals(6, 6))
+	require.True(t, floatEquals(6, 5.999999999999998))
+	require.True(t, floatEquals(6.000000000000002, 6))
+	require.False(t, floatEquals(6, 6.001))
+	require.False(t, floatEquals(0, 1e-12))
+	require.False(t, floatEquals(math.Inf(1), 1))
+}
+
+func TestAreSamplesEqualEpsilon(t *testing.T) {
+	lbls := labels.FromStrings("__name__", "rate")
+	exp := []promql.Sample{{Point: promql.Point{T: 1000, V: 0.1 + 0.2}, Metric: lbls}}
+	act := []promql.Sample{{Point: promql.Point{T: 1000, V: 0.3}, Metric: lbls}}
+	require.NoError(t, areSamplesEqual(exp, act, CheckOptions{}))
+
+	act[0].V = 0.31
+	require.Error(t, areSamplesEqual(exp, act, CheckOptions{}))
+	require.NoError(t, areSamplesEqual(exp, act, CheckOptions{SampleEpsilon: 0.1}))
+}
+
+func TestSampleTimestamp(t *testing.T) {
+	ts := int64(1641808794700) // 2022-01-10T09:59:54.700Z
+
+	require.Equal(t, int64(1641808794), CheckOptions{}.SampleTimestamp(ts))
+	require.Equal(t, int64(1641808794), CheckOptions{StepAlignment: QueryStepAlignmentNone}.SampleTimestamp(ts))
+	second := CheckOptions{StepAlignment: QueryStepAlignmentSecond}
+	require.Equal(t, int64(1641808795), second.SampleTimestamp(ts))
+	require.Equal(t, int64(1641808794), second.SampleTimestamp(ts-300))
+	require.Equal(t, int64(1641808785), CheckOptions{StepAlignment: QueryStepAlignmentInterval}.SampleTimestamp(ts))
+	interval := CheckOptions{StepAlignment: QueryStepAlignmentInterval, StepInterval: 10 * time.Second}
+	require.Equal(t, int64(1641808790), interval.SampleTimestamp(ts))
+
+	// The expected samples are aligned by the check.
+	lbls := labels.FromStrings("__name__", "ALERTS")
+	exp := [][]promql.Sample{{{Point: promql.Point{T: ts / 1000, V: 1}, Metric: lbls}}}
+	act := []promql.Sample{{Point: promql.Point{T: 1641808790, V: 1}, Metric: lbls}}
+	require.NoError(t, checkExpectedSamples(ts, exp, act, interval))
+	require.Equal(t, ts/1000, exp[0][0].T)
+
+	// Off by the alignment only.
+	act[0].T = 1641808794
+	require.EqualError(t, checkExpectedSamples(ts, exp, act, interval), `error in metrics: metrics mismatch in the timestamp, check how the alert generator aligns the instant of the query (assumed "interval") - expected: {__name__="ALERTS"} => 1 @[1641808790], actual: {__name__="ALERTS"} => 1 @[1641808794]`)
+	require.NoError(t, checkExpectedSamples(ts, exp, act, CheckOptions{}))
+	act[0].V = 2
+	require.EqualError(t, checkExpectedSamples(ts, exp, act, interval), `error in metrics: metrics mismatch - expected: {__name__="ALERTS"} => 1 @[1641808790], actual: {__name__="ALERTS"} => 2 @[1641808794]`)
+}
+
+func TestQuantile(t *testing.T) {
+	require.Equal(t, 50.0, quantile(0.9, []float64{50}))
+	require.Equal(t, 2.5, quantile(0.5, []float64{4, 1, 3, 2}))
+	require.True(t, floatEquals(13.1, quantile(0.9, []float64{5, 50, 1, 9, 3, 7, 2, 8, 4, 6})))
+	require.Equal(t, 1.0, quantile(0, []float64{3, 1, 2}))
+	require.Equal(t, 3.0, quantile(1, []float64{3, 1, 2}))
+}
+
+func TestLinearRegressionSlope(t *testing.T) {
+	require.Equal(t, 0.0, linearRegressionSlope([]prompb.Sample{{Timestamp: 0, Value: 3}, {Timestamp: 5000, Value: 3}}))
+	require.True(t, floatEquals(-0.2, linearRegressionSlope([]prompb.Sample{
+		{Timestamp: 10000, Value: 10}, {Timestamp: 15000, Value: 9}, {Timestamp: 20000, Value: 8},
+	})))
+	// The least-squares fit of (0, 0), (1, 1), (2, 0), (3, 3).
+	require.True(t, floatEquals(0.8, linearRegressionSlope([]prompb.Sample{
+		{Timestamp: 0, Value: 0}, {Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 0}, {Timestamp: 3000, Value: 3},
+	})))
+}
+
+func TestAlertCombinations(t *testing.T) {
+	alert := func(name string) v1.Alert {
+		return v1.Alert{Labels: labels.FromStrings("series", name)}
+	}
+	perSeries := [][]*v1.Alert{
+		possibleSeriesAlerts(true, false, true, alert("a")),
+		possibleSeriesAlerts(false, true, true, alert("b")),
+	}
+	require.Len(t, perSeries[0], 2)
+	require.Nil(t, perSeries[0][0])
+	require.Equal(t, "firing", perSeries[0][1].State)
+	require.Equal(t, "pending", perSeries[1][0].State)
+	require.Equal(t, "firing", perSeries[1][1].State)
+
+	all := alertCombinations(perSeries, nil)
+	require.Len(t, all, 4)
+	require.Len(t, all[0], 1, "inactive alert must be absent")
+
+	// Only the combinations where both are in the same state.
+	same := alertCombinations(perSeries, func(c []*v1.Alert) bool {
+		return c[0] != nil && c[0].State == c[1].State
+	})
+	require.Len(t, same, 1)
+	require.Equal(t, "firing", same[0][0].State)
+	require.Equal(t, "firing", same[0][1].State)
+
+	rgs := alertCombinationsRuleGroups(all, func(state string, alerts []*v1.Alert) v1.RuleGroup {
+		return v1.RuleGroup{Name: state}
+	})
+	require.Equal(t, []string{"pending", "firing", "firing", "firing"}, []string{rgs[0].Name, rgs[1].Name, rgs[2].Name, rgs[3].Name})
+
+	samples := alertCombinationsSamples(10000, same)
+	require.Len(t, samples, 1)
+	require.Equal(t, labels.FromStrings("__name__", "ALERTS", "alertstate", "firing", "series", "a"), samples[0][0].Metric)
+}
+
+func TestLastErrorMatches(t *testing.T) {
+	require.True(t, lastErrorMatches("", ""))
+	require.False(t, lastErrorMatches("", "some error"))
+	require.True(t, lastErrorMatches("vector", "rule result is not a vector or scalar"))
+	require.False(t, lastErrorMatches("vector", ""))
+	require.False(t, lastErrorMatches("vector", "some error"))
+}
+
+func TestLabelsDiff(t *testing.T) {
+	exp := WideLabels().(*wideLabels).alertLabels()
+	require.Equal(t, "", labelsDiff(exp, exp))
+
+	act := labels.NewBuilder(exp).Del("zone").Set("pod", "api-7d9f8b6c5").Set("instance_id", "i-1").Labels()
+	require.Equal(t, `pod="api-7d9f8b6c5" instead of "api-7d9f8b6c5-x2x4z", missing zone="z1", unexpected instance_id="i-1"`, labelsDiff(exp, act))
+
+	err := areAlertsEqual([]v1.Alert{{Labels: exp, Value: "15"}}, []v1.Alert{{Labels: act, Value: "15"}}, time.Second)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "alerts mismatch in labels (pod=")
+}
+
+func TestAreAlertsEqualUnicodeForms(t *testing.T) {
+	activeAt := time.Unix(0, 0)
+	alert := func(city string) []v1.Alert {
+		return []v1.Alert{{Labels: labels.FromStrings("city", city), Value: "15", ActiveAt: &activeAt}}
+	}
+	require.NoError(t, areAlertsEqual(alert(cityNFD), alert(cityNFD), time.Second))
+	// The label values are compared as bytes, without any normalization.
+	for _, city := range []string{cityNFD, cityFullWidth} {
+		err := areAlertsEqual(alert(cityNFC), alert(city), time.Second)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "alerts mismatch in labels")
+	}
+}
+
+func TestSeparationDiff(t *testing.T) {
+	activeAt := time.Unix(0, 0)
+	lbls := labels.FromStrings("alertname", "a", "severity", "critical")
+	anns := labels.FromStrings("description", "The value is 15", "summary", "High")
+	require.Equal(t, "", separationDiff(lbls, anns, lbls, anns))
+	// A wrong value is not about the separation.
+	require.Equal(t, "", separationDiff(lbls, anns, labels.FromStrings("alertname", "a", "severity", "warning"), anns))
+
+	promoted := labels.NewBuilder(lbls).Set("description", "The value is 15").Labels()
+	require.Equal(t, `annotation "description" appeared in labels`, separationDiff(lbls, anns, promoted, anns))
+	require.Equal(t, `annotation "description" appeared in labels instead of annotations`,
+		separationDiff(lbls, anns, promoted, labels.FromStrings("summary", "High")))
+
+	demoted := labels.NewBuilder(anns).Set("severity", "critical").Labels()
+	require.Equal(t, `label "severity" appeared in annotations instead of labels`,
+		separationDiff(lbls, anns, labels.FromStrings("alertname", "a"), demoted))
+
+	err := areAlertsEqual(
+		[]v1.Alert{{Labels: lbls, Annotations: anns, Value: "15", ActiveAt: &activeAt}},
+		[]v1.Alert{{Labels: promoted, Annotations: anns, Value: "15", ActiveAt: &activeAt}},
+		time.Second,
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `alerts mismatch in the separation of labels and annotations (annotation "description" appeared in labels)`)
+}
+
+func TestCheckExpectedRuleGroupStrict(t *testing.T) {
+	now := time.Unix(1000, 0).UTC()
+	activeAt := now.Add(-2 * time.Second)
+	alertingRule := func(name, value string, evaluationTime float64, lastEvaluation time.Time, alerts ...string) v1.AlertingRule {
+		r := v1.AlertingRule{
+			State:          "firing",
+			Name:           name,
+			Query:          "up > 10",
+			Labels:         labels.Labels{},
+			Annotations:    labels.Labels{},
+			Alerts:         []*v1.Alert{},
+			Health:         "ok",
+			EvaluationTime: evaluationTime,
+			LastEvaluation: lastEvaluation,
+			Type:           "alerting",
+		}
+		for _, a := range alerts {
+			r.Alerts = append(r.Alerts, &v1.Alert{
+				Labels:      labels.FromStrings("alertname", a),
+				Annotations: labels.Labels{},
+				State:       "firing",
+				ActiveAt:    &activeAt,
+				Value:       value,
+			})
+		}
+		return r
+	}
+	ruleGroup := func(file string, rules ...v1.Rule) v1.RuleGroup {
+		return v1.RuleGroup{Name: "Test", File: file, Rules: rules, Interval: 10, EvaluationTime: 0.001, LastEvaluation: now}
+	}
+	exp := []v1.RuleGroup{ruleGroup("",
+		alertingRule("A", "15", 0, time.Time{}, "A"),
+		alertingRule("B", "15", 0, time.Time{}, "B"),
+	)}
+
+	cases := map[string]struct {
+		act v1.RuleGroup
+		err string
+	}{
+		"ok": {
+			act: ruleGroup("rules.yaml",
+				alertingRule("A", "1.5e+01", 0.001, now, "A"),
+				alertingRule("B", "1.5e+01", 0.001, now, "B"),
+			),
+		},
+		"no file": {
+			act: ruleGroup("",
+				alertingRule("A", "1.5e+01", 0.001, now, "A"),
+				alertingRule("B", "1.5e+01", 0.001, now, "B"),
+			),
+			err: "strict rule group: no file of the group",
+		},
+		"evaluation time above the interval": {
+			act: ruleGroup("rules.yaml",
+				alertingRule("A", "1.5e+01", 11, now, "A"),
+				alertingRule("B", "1.5e+01", 0.001, now, "B"),
+			),
+			err: `strict rule group: evaluation time of the rule "A" must be between 0 and the interval 10s, got: 11s`,
+		},
+		"value not formatted like Prometheus": {
+			act: ruleGroup("rules.yaml",
+				alertingRule("A", "15", 0.001, now, "A"),
+				alertingRule("B", "1.5e+01", 0.001, now, "B"),
+			),
+			err: `strict rule group: value of the alert {alertname="A"} of the rule "A" must be formatted as "1.5e+01", got: "15"`,
+		},
+		"active after the last evaluation": {
+			act: ruleGroup("rules.yaml",
+				alertingRule("A", "1.5e+01", 0.001, now.Add(-5*time.Second), "A"),
+				alertingRule("B", "1.5e+01", 0.001, now, "B"),
+			),
+			err: `strict rule group: alert {alertname="A"} of the rule "A" is active at`,
+		},
+		"alerts of another rule": {
+			act: ruleGroup("rules.yaml",
+				alertingRule("A", "1.5e+01", 0.001, now, "A", "B"),
+				alertingRule("B", "1.5e+01", 0.001, now),
+			),
+			err: `strict rule group: alerts of the rule "A": different number of alerts`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Everything but the strict checks match.
+			require.NoError(t, checkExpectedRuleGroup(now, exp, c.act, CheckOptions{}))
+
+			err := checkExpectedRuleGroup(now, exp, c.act, CheckOptions{StrictRuleGroup: true})
+			if c.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.err)
+		})
+	}
 }
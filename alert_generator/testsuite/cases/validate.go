@@ -0,0 +1,204 @@
+package cases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// ValidateExpectedAlerts checks that the schedule of ExpectedAlerts() of the test case is internally
+// coherent. It does not need any alert generator and is meant to catch mistakes while writing a test case.
+// It calls SamplesToRemoteWrite() and Init() on the test case with the given zero time.
+//
+// The following is checked (the alerts that can be ignored as per CanBeIgnored() are only checked for 1-3):
+//   0. The samples to remote write, with the warmup if the test case implements Warmup, are valid as per ValidateSamples(),
+//      and so is the schedule of the samples as per ValidateSchedule() if the test case implements ScheduledIngestion.
+//   1. OrderingIDs are strictly increasing.
+//   2. TimeTolerance and EndsAtDelta are positive.
+//   3. The alert has the `rulegroup` label with the group name of the test case.
+//   4. For the same labels, a resolved alert comes only after a firing alert, and its Ts is not before its ResolvedTime.
+//   5. For the same labels, only the first alert after a state change is not a resend and the rest are resends.
+//   6. Firing alerts are within [zeroTime, TestUntil] and before their ResolvedTime. Resolved alerts are resolved
+//      before TestUntil and are not sent for more than 15m after being resolved. Only an alert that is still firing
+//      at TestUntil can have its resends and the resolved alerts after TestUntil, e.g. when its series goes stale
+//      after the last sample.
+func ValidateExpectedAlerts(tc TestCase, zeroTime int64) error {
+	groupName, _ := tc.Describe()
+	if w, ok := tc.(Warmup); ok && w.WarmupDuration() <= 0 {
+		return fmt.Errorf("non positive WarmupDuration %s", w.WarmupDuration())
+	}
+	samples := tc.SamplesToRemoteWrite()
+	if err := ValidateSamples(WithWarmupSamples(tc, samples)); err != nil {
+		return err
+	}
+	if err := ValidateSchedule(tc, samples); err != nil {
+		return err
+	}
+	tc.Init(zeroTime)
+
+	zt := timestamp.Time(zeroTime)
+	testUntil := timestamp.Time(tc.TestUntil())
+
+	// Labels string -> last alert with the labels.
+	lastAlerts := make(map[string]ExpectedAlert)
+	seenIDs := make(map[string]bool)
+	expAlerts := tc.ExpectedAlerts()
+	for i, ea := range expAlerts {
+		if ea.Alert == nil {
+			return fmt.Errorf("expected alert %d: no alert found", i)
+		}
+		id := ea.Alert.Labels.String()
+		wrapErr := func(err error) error {
+			return errors.Wrapf(err, "expected alert %d (ordering ID %d, labels %s)", i, ea.OrderingID, id)
+		}
+
+		if i > 0 && ea.OrderingID <= expAlerts[i-1].OrderingID {
+			return wrapErr(errors.New("ordering IDs are not strictly increasing"))
+		}
+		if ea.TimeTolerance <= 0 {
+			return wrapErr(fmt.Errorf("non positive TimeTolerance %s", ea.TimeTolerance))
+		}
+		if ea.EndsAtDelta <= 0 {
+			return wrapErr(fmt.Errorf("non positive EndsAtDelta %s", ea.EndsAtDelta))
+		}
+		if gn := ea.Alert.Labels.Get("rulegroup"); gn != groupName {
+			return wrapErr(fmt.Errorf("expected the rulegroup label to be %q, got %q", groupName, gn))
+		}
+
+		if ea.CanBeIgnored() {
+			// This alert may or may not come, hence does not take part in the schedule.
+			seenIDs[id] = true
+			continue
+		}
+
+		last, seen := lastAlerts[id]
+		if ea.Resolved {
+			if !seen && !seenIDs[id] {
+				return wrapErr(errors.New("resolved alert without a firing alert before it"))
+			}
+			if ea.Ts.Before(ea.ResolvedTime) {
+				return wrapErr(fmt.Errorf("resolved alert expected at %s, before it is resolved at %s",
+					ea.Ts.Format(time.RFC3339Nano), ea.ResolvedTime.Format(time.RFC3339Nano)))
+			}
+			if ea.ResolvedTime.After(testUntil) && !(seen && last.ResolvedTime.Equal(ea.ResolvedTime)) {
+				return wrapErr(fmt.Errorf("alert resolved at %s, after the test ends at %s",
+					ea.ResolvedTime.Format(time.RFC3339Nano), testUntil.Format(time.RFC3339Nano)))
+			}
+			if ea.Ts.Sub(ea.ResolvedTime) > 15*time.Minute {
+				return wrapErr(fmt.Errorf("resolved alert expected at %s, more than 15m after it was resolved at %s",
+					ea.Ts.Format(time.RFC3339Nano), ea.ResolvedTime.Format(time.RFC3339Nano)))
+			}
+		} else {
+			firingAtEnd := ea.ResolvedTime.After(testUntil) && !ea.Alert.StartsAt.After(testUntil)
+			if ea.Ts.Before(zt) || (ea.Ts.After(testUntil) && !firingAtEnd) {
+				return wrapErr(fmt.Errorf("firing alert expected at %s, outside the test range [%s, %s]",
+					ea.Ts.Format(time.RFC3339Nano), zt.Format(time.RFC3339Nano), testUntil.Format(time.RFC3339Nano)))
+			}
+			if !ea.ResolvedTime.Equal(time.Time{}) && !ea.Ts.Before(ea.ResolvedTime) {
+				return wrapErr(fmt.Errorf("firing alert expected at %s, not before it is resolved at %s",
+					ea.Ts.Format(time.RFC3339Nano), ea.ResolvedTime.Format(time.RFC3339Nano)))
+			}
+			if ea.Alert.StartsAt.After(ea.Ts) {
+				return wrapErr(fmt.Errorf("firing alert expected at %s, before its StartsAt %s",
+					ea.Ts.Format(time.RFC3339Nano), ea.Alert.StartsAt.Format(time.RFC3339Nano)))
+			}
+		}
+
+		if seen && !ea.Ts.After(last.Ts) {
+			return wrapErr(fmt.Errorf("alert expected at %s, not after the previous alert with same labels at %s",
+				ea.Ts.Format(time.RFC3339Nano), last.Ts.Format(time.RFC3339Nano)))
+		}
+
+		// A resend is an alert in the same state as the last alert, and for the same firing episode.
+		expResend := seen && last.Resolved == ea.Resolved && last.Alert.StartsAt.Equal(ea.Alert.StartsAt)
+		if ea.Resend != expResend {
+			return wrapErr(fmt.Errorf("expected Resend to be %t, got %t", expResend, ea.Resend))
+		}
+
+		lastAlerts[id] = ea
+		seenIDs[id] = true
+	}
+
+	return nil
+}
+
+// ValidateSamples checks that the 0 based timestamps of the samples given by SamplesToRemoteWrite()
+// of a test case are not older than MaxBackfill.
+func ValidateSamples(series []prompb.TimeSeries) error {
+	minTs := -int64(MaxBackfill / time.Millisecond)
+	for _, ts := range series {
+		for _, s := range ts.Samples {
+			if s.Timestamp < minTs {
+				return fmt.Errorf("sample of the series %s at %s is older than the max backfill of %s",
+					fromProtoLabels(ts.Labels).String(), time.Duration(s.Timestamp)*time.Millisecond, MaxBackfill)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateSchedule checks the batches given by ScheduledSamples() of a test case that implements ScheduledIngestion
+// against the samples given by SamplesToRemoteWrite(). It does nothing for the other test cases.
+// The following is checked:
+//   1. The test case does not implement Warmup.
+//   2. The batches are in the order of their SendAt, which is not negative.
+//   3. No sample is sent before its timestamp.
+//   4. The samples of a series are sent in the order of their timestamps, so that none is out of order.
+//   5. The batches have all the samples given by SamplesToRemoteWrite() and no other sample.
+func ValidateSchedule(tc TestCase, series []prompb.TimeSeries) error {
+	sc, ok := tc.(ScheduledIngestion)
+	if !ok {
+		return nil
+	}
+	if _, ok := tc.(Warmup); ok {
+		return errors.New("scheduled ingestion cannot be combined with warmup")
+	}
+
+	// Labels string -> timestamp -> value.
+	expSamples := make(map[string]map[int64]float64, len(series))
+	for _, ts := range series {
+		id := fromProtoLabels(ts.Labels).String()
+		if expSamples[id] == nil {
+			expSamples[id] = make(map[int64]float64, len(ts.Samples))
+		}
+		for _, s := range ts.Samples {
+			expSamples[id][s.Timestamp] = s.Value
+		}
+	}
+
+	// Labels string -> timestamp of the last sample sent.
+	lastSent := make(map[string]int64)
+	for i, b := range sc.ScheduledSamples() {
+		if b.SendAt < 0 {
+			return fmt.Errorf("batch %d: negative SendAt %s", i, b.SendAt)
+		}
+		sendAtMs := int64(b.SendAt / time.Millisecond)
+		for _, ts := range b.Series {
+			id := fromProtoLabels(ts.Labels).String()
+			for _, s := range ts.Samples {
+				t := time.Duration(s.Timestamp) * time.Millisecond
+				if s.Timestamp > sendAtMs {
+					return fmt.Errorf("batch %d: sample of the series %s at %s is sent before its timestamp at %s", i, id, t, b.SendAt)
+				}
+				if last, ok := lastSent[id]; ok && s.Timestamp <= last {
+					return fmt.Errorf("batch %d: sample of the series %s at %s is out of order", i, id, t)
+				}
+				lastSent[id] = s.Timestamp
+				v, ok := expSamples[id][s.Timestamp]
+				if !ok || v != s.Value {
+					return fmt.Errorf("batch %d: sample of the series %s at %s is not in the samples to remote write", i, id, t)
+				}
+				delete(expSamples[id], s.Timestamp)
+			}
+		}
+	}
+	for id, samples := range expSamples {
+		for t := range samples {
+			return fmt.Errorf("sample of the series %s at %s is not in any batch", id, time.Duration(t)*time.Millisecond)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package cases
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateExpectedAlertsOfAllCases(t *testing.T) {
+	zeroTime := timestamp.FromTime(time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC))
+	for _, tc := range AllCases {
+		groupName, _ := tc.Describe()
+		t.Run(groupName, func(t *testing.T) {
+			require.NoError(t, ValidateExpectedAlerts(tc, zeroTime))
+		})
+	}
+}
+
+// mutatedCase is a test case with its ExpectedAlerts() modified.
+type mutatedCase struct {
+	TestCase
+	mutate func(exp []ExpectedAlert) []ExpectedAlert
+}
+
+func (tc mutatedCase) ExpectedAlerts() []ExpectedAlert {
+	return tc.mutate(tc.TestCase.ExpectedAlerts())
+}
+
+func TestValidateExpectedAlertsErrors(t *testing.T) {
+	zeroTime := timestamp.FromTime(time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC))
+
+	firstResolved := func(exp []ExpectedAlert) int {
+		for i, ea := range exp {
+			if ea.Resolved {
+				return i
+			}
+		}
+		return -1
+	}
+
+	cases := []struct {
+		name   string
+		mutate func(exp []ExpectedAlert) []ExpectedAlert
+		expErr string
+	}{
+		{
+			name: "non increasing ordering ID",
+			mutate: func(exp []ExpectedAlert) []ExpectedAlert {
+				exp[1].OrderingID = exp[0].OrderingID
+				return exp
+			},
+			expErr: "ordering IDs are not strictly increasing",
+		},
+		{
+			name: "resolved before firing",
+			mutate: func(exp []ExpectedAlert) []ExpectedAlert {
+				idx := firstResolved(exp)
+				newExp := append([]ExpectedAlert{exp[idx]}, exp[:idx]...)
+				newExp = append(newExp, exp[idx+1:]...)
+				for i := range newExp {
+					newExp[i].OrderingID = i + 1
+				}
+				return newExp
+			},
+			expErr: "resolved alert without a firing alert before it",
+		},
+		{
+			name: "wrong resend",
+			mutate: func(exp []ExpectedAlert) []ExpectedAlert {
+				exp[1].Resend = !exp[1].Resend
+				return exp
+			},
+			expErr: "expected Resend to be true, got false",
+		},
+		{
+			name: "first alert marked as resend",
+			mutate: func(exp []ExpectedAlert) []ExpectedAlert {
+				exp[0].Resend = true
+				return exp
+			},
+			expErr: "expected Resend to be false, got true",
+		},
+		{
+			name: "firing before the test starts",
+			mutate: func(exp []ExpectedAlert) []ExpectedAlert {
+				exp[0].Ts = timestamp.Time(zeroTime).Add(-time.Minute)
+				return exp
+			},
+			expErr: "outside the test range",
+		},
+		{
+			name: "firing after the test ends",
+			mutate: func(exp []ExpectedAlert) []ExpectedAlert {
+				// Without the next state, it cannot be ignored.
+				idx := firstResolved(exp) - 1
+				exp[idx].Ts = exp[idx].Ts.Add(24 * time.Hour)
+				exp[idx].NextState, exp[idx].ResolvedTime = time.Time{}, time.Time{}
+				return exp
+			},
+			expErr: "outside the test range",
+		},
+		{
+			name: "resolved after the test ends",
+			mutate: func(exp []ExpectedAlert) []ExpectedAlert {
+				idx := len(exp) - 1
+				exp[idx].Ts = exp[idx].Ts.Add(24 * time.Hour)
+				exp[idx].ResolvedTime = exp[idx].ResolvedTime.Add(24 * time.Hour)
+				return exp
+			},
+			expErr: "after the test ends",
+		},
+		{
+			name: "resolved after the test ends without firing at the end",
+			mutate: func(exp []ExpectedAlert) []ExpectedAlert {
+				idx := firstResolved(exp)
+				for i := idx; i < len(exp); i++ {
+					exp[i].Ts = exp[i].Ts.Add(24 * time.Hour)
+					exp[i].ResolvedTime = exp[i].ResolvedTime.Add(24 * time.Hour)
+				}
+				return exp
+			},
+			expErr: "after the test ends",
+		},
+		{
+			// Like the resolved alerts overlapping with the next firing episode in ZeroFor_SmallFor.
+			name: "duplicate Ts",
+			mutate: func(exp []ExpectedAlert) []ExpectedAlert {
+				idx := firstResolved(exp) + 1
+				dup := exp[idx]
+				dup.OrderingID = exp[len(exp)-1].OrderingID + 1
+				return append(exp, dup)
+			},
+			expErr: "not after the previous alert with same labels",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc := mutatedCase{TestCase: PendingAndFiringAndResolved(), mutate: c.mutate}
+			err := ValidateExpectedAlerts(tc, zeroTime)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.expErr)
+		})
+	}
+}
+
+func TestValidateSamples(t *testing.T) {
+	series := func(ts ...int64) []prompb.TimeSeries {
+		s := prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: "a"}}}
+		for _, t := range ts {
+			s.Samples = append(s.Samples, prompb.Sample{Timestamp: t, Value: 1})
+		}
+		return []prompb.TimeSeries{s}
+	}
+
+	maxBackfillMs := int64(MaxBackfill / time.Millisecond)
+	require.NoError(t, ValidateSamples(series(0, 1000)))
+	require.NoError(t, ValidateSamples(series(-maxBackfillMs, 0)))
+	err := ValidateSamples(series(-maxBackfillMs-1, 0))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "older than the max backfill")
+}
+
+// warmupCase is a test case with the given WarmupDuration().
+type warmupCase struct {
+	TestCase
+	warmup time.Duration
+}
+
+func (tc warmupCase) WarmupDuration() time.Duration {
+	return tc.warmup
+}
+
+func TestWithWarmupSamples(t *testing.T) {
+	series := []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "a"}},
+			Samples: []prompb.Sample{{Timestamp: 0, Value: 3}, {Timestamp: 5000, Value: 4}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "b"}},
+			Samples: []prompb.Sample{{Timestamp: 0, Value: 1}},
+		},
+	}
+
+	// No warmup if the test case does not implement Warmup.
+	require.Equal(t, series, WithWarmupSamples(PendingAndFiringAndResolved(), series))
+
+	act := WithWarmupSamples(warmupCase{TestCase: PendingAndFiringAndResolved(), warmup: 12 * time.Second}, series)
+	require.Equal(t, []prompb.Sample{
+		{Timestamp: -10000, Value: 3}, {Timestamp: -5000, Value: 3}, {Timestamp: 0, Value: 3}, {Timestamp: 5000, Value: 4},
+	}, act[0].Samples)
+	// The interval of a series with a single sample is not known.
+	require.Equal(t, series[1], act[1])
+	// The original samples are not modified.
+	require.Len(t, series[0].Samples, 2)
+
+	require.NoError(t, ValidateExpectedAlerts(warmupCase{TestCase: PendingAndFiringAndResolved(), warmup: MaxBackfill}, 0))
+	err := ValidateExpectedAlerts(warmupCase{TestCase: PendingAndFiringAndResolved(), warmup: MaxBackfill + time.Minute}, 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "older than the max backfill")
+	err = ValidateExpectedAlerts(warmupCase{TestCase: PendingAndFiringAndResolved(), warmup: 0}, 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "non positive WarmupDuration")
+}
+
+// scheduledCase is a test case with the given ScheduledSamples().
+type scheduledCase struct {
+	TestCase
+	batches []TimedBatch
+}
+
+func (tc scheduledCase) ScheduledSamples() []TimedBatch {
+	return tc.batches
+}
+
+type scheduledWarmupCase struct {
+	scheduledCase
+}
+
+func (tc scheduledWarmupCase) WarmupDuration() time.Duration {
+	return time.Minute
+}
+
+func TestValidateSchedule(t *testing.T) {
+	series := func(name string, ts ...int64) prompb.TimeSeries {
+		s := prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: name}}}
+		for _, t := range ts {
+			s.Samples = append(s.Samples, prompb.Sample{Timestamp: t, Value: 1})
+		}
+		return s
+	}
+	samples := []prompb.TimeSeries{series("a", 0, 5000, 10000), series("b", 0)}
+
+	// Nothing to validate if the test case does not implement ScheduledIngestion.
+	require.NoError(t, ValidateSchedule(PendingAndFiringAndResolved(), samples))
+
+	for _, c := range []struct {
+		batches []TimedBatch
+		err     string
+	}{
+		{
+			// A pause after the first sample and then a burst of the rest.
+			batches: []TimedBatch{
+				{SendAt: 0, Series: []prompb.TimeSeries{series("a", 0), series("b", 0)}},
+				{SendAt: 12 * time.Second, Series: []prompb.TimeSeries{series("a", 5000, 10000)}},
+			},
+		},
+		{
+			batches: []TimedBatch{
+				{SendAt: 0, Series: []prompb.TimeSeries{series("a", 0, 5000, 10000), series("b", 0)}},
+			},
+			err: "batch 0: sample of the series {__name__=\"a\"} at 5s is sent before its timestamp at 0s",
+		},
+		{
+			batches: []TimedBatch{
+				{SendAt: 10 * time.Second, Series: []prompb.TimeSeries{series("a", 0, 10000), series("b", 0)}},
+				{SendAt: 10 * time.Second, Series: []prompb.TimeSeries{series("a", 5000)}},
+			},
+			err: "batch 1: sample of the series {__name__=\"a\"} at 5s is out of order",
+		},
+		{
+			batches: []TimedBatch{
+				{SendAt: 10 * time.Second, Series: []prompb.TimeSeries{series("a", 0, 5000, 10000)}},
+			},
+			err: "sample of the series {__name__=\"b\"} at 0s is not in any batch",
+		},
+		{
+			batches: []TimedBatch{
+				{SendAt: 10 * time.Second, Series: []prompb.TimeSeries{series("a", 0, 5000, 10000), series("b", 0), series("c", 0)}},
+			},
+			err: "batch 0: sample of the series {__name__=\"c\"} at 0s is not in the samples to remote write",
+		},
+		{
+			batches: []TimedBatch{{SendAt: -time.Second}},
+			err:     "batch 0: negative SendAt -1s",
+		},
+	} {
+		err := ValidateSchedule(scheduledCase{TestCase: PendingAndFiringAndResolved(), batches: c.batches}, samples)
+		if c.err == "" {
+			require.NoError(t, err)
+			continue
+		}
+		require.EqualError(t, err, c.err)
+	}
+
+	err := ValidateSchedule(scheduledWarmupCase{scheduledCase{TestCase: PendingAndFiringAndResolved()}}, samples)
+	require.EqualError(t, err, "scheduled ingestion cannot be combined with warmup")
+}
+
+// cleanerCase is a test case with the given Cleanup().
+type cleanerCase struct {
+	TestCase
+	series []prompb.TimeSeries
+}
+
+func (tc cleanerCase) Cleanup(int64) []prompb.TimeSeries {
+	return tc.series
+}
+
+func TestCleanupSeries(t *testing.T) {
+	tc := StaggeredResolve()
+	written := tc.SamplesToRemoteWrite()
+	act := CleanupSeries(tc, 123000)
+	require.Len(t, act, len(written))
+	for i, s := range act {
+		require.Equal(t, written[i].Labels, s.Labels)
+		require.Len(t, s.Samples, 1)
+		require.Equal(t, int64(123000), s.Samples[0].Timestamp)
+		require.True(t, value.IsStaleNaN(s.Samples[0].Value))
+	}
+
+	series := []prompb.TimeSeries{{Labels: []prompb.Label{{Name: "__name__", Value: "a"}}}}
+	require.Equal(t, series, CleanupSeries(cleanerCase{TestCase: tc, series: series}, 123000))
+}
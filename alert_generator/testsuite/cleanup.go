@@ -0,0 +1,97 @@
+package testsuite
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+const (
+	// cleanupTimeout is how long the cleanup waits for the alerts of the test cases to be gone from the alert generator.
+	cleanupTimeout = 2 * time.Minute
+	// cleanupPollInterval is how often the cleanup checks the alerts API while waiting.
+	cleanupPollInterval = 5 * time.Second
+)
+
+// Cleanup returns the alert generator to a clean baseline after the test, so that the series and the alerts of this
+// run do not leak into a subsequent run against the same alert generator, e.g. with another seed for the shuffle.
+// It remote writes the series from cases.CleanupSeries() of every test case, which marks their series stale by default,
+// makes a POST request to TestSuiteOptions.CleanupURL if set, and then waits up to cleanupTimeout for the alerts of the
+// test cases to be gone from the alerts API. An error is returned if any of it fails or the alerts are still there.
+// It must be called after Wait() and does not change the result of the test.
+func (ts *TestSuite) Cleanup() error {
+	now := timestamp.FromTime(ts.clock.Now())
+	groups := make(map[string]bool, len(ts.opts.Cases))
+	var series []prompb.TimeSeries
+	for _, c := range ts.opts.Cases {
+		gn, _ := c.Describe()
+		groups[gn] = true
+		series = append(series, cases.CleanupSeries(c, now)...)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	if len(series) > 0 {
+		level.Info(ts.logger).Log("msg", "Remote writing the cleanup series", "series", len(series))
+		req, err := buildWriteRequest(series, nil)
+		if err != nil {
+			return errors.Wrap(err, "build the cleanup write request")
+		}
+		if _, err := ts.remoteWriter.store(ctx, req); err != nil {
+			return errors.Wrap(err, "remote write the cleanup series")
+		}
+	}
+	if ts.opts.CleanupURL != "" {
+		level.Info(ts.logger).Log("msg", "Resetting the alert generator", "url", ts.opts.CleanupURL)
+		if _, _, err := ts.client.Do(ctx, http.MethodPost, ts.opts.CleanupURL, nil, nil); err != nil {
+			return errors.Wrap(err, "reset the alert generator")
+		}
+	}
+
+	level.Info(ts.logger).Log("msg", "Waiting for the alerts of the test cases to be gone", "timeout", cleanupTimeout)
+	for {
+		remaining, err := ts.groupsWithAlerts(groups)
+		if err == nil && len(remaining) == 0 {
+			level.Info(ts.logger).Log("msg", "Cleanup done")
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return errors.Wrap(err, "get the alerts after the cleanup")
+			}
+			return errors.Errorf("alerts still present after the cleanup for the rule groups: %s", strings.Join(remaining, ", "))
+		case <-time.After(cleanupPollInterval):
+		}
+	}
+}
+
+// groupsWithAlerts returns the sorted names of the given rule groups that have any alert in the alerts API.
+func (ts *TestSuite) groupsWithAlerts(groups map[string]bool) ([]string, error) {
+	b, err := ts.client.Get(ts.alertsAPIURL)
+	if err != nil {
+		return nil, err
+	}
+	alerts, err := parseAndGroupAlertsCompat(b, ts.opts.APICompat)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for gn, as := range alerts {
+		if groups[gn] && len(as) > 0 {
+			res = append(res, gn)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
@@ -0,0 +1,89 @@
+package testsuite
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestCleanup(t *testing.T) {
+	var (
+		mtx          sync.Mutex
+		written      []prompb.TimeSeries
+		reset        bool
+		resetFailure bool
+	)
+	// The alert of the test case is there until the alert generator is reset.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		switch r.URL.Path {
+		case "/api/v1/write":
+			req, err := decodeWriteRequest(r)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			written = append(written, req.Timeseries...)
+			w.WriteHeader(http.StatusNoContent)
+		case "/-/reset":
+			if r.Method != http.MethodPost || resetFailure {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			reset = true
+		case "/api/v1/alerts":
+			if reset {
+				_, _ = w.Write([]byte(`{"status":"success","data":{"alerts":[]}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":{"alerts":[{"labels":{"alertname":"A","rulegroup":"PendingAndFiringAndResolved"},"state":"firing","value":"1"}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := cases.PendingAndFiringAndResolved()
+	ts, err := NewTestSuite(TestSuiteOptions{
+		Logger:          log.NewNopLogger(),
+		Cases:           []cases.TestCase{c},
+		RemoteWriteURL:  srv.URL + "/api/v1/write",
+		BaseAPIURL:      srv.URL,
+		PromQLBaseURL:   srv.URL,
+		AlertServerPort: "8080",
+		CleanupURL:      srv.URL + "/-/reset",
+	})
+	require.NoError(t, err)
+
+	mtx.Lock()
+	resetFailure = true
+	mtx.Unlock()
+	err = ts.Cleanup()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "reset the alert generator")
+
+	mtx.Lock()
+	resetFailure = false
+	written = nil
+	mtx.Unlock()
+	require.NoError(t, ts.Cleanup())
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.True(t, reset)
+	require.Len(t, written, len(c.SamplesToRemoteWrite()))
+	for _, s := range written {
+		require.Len(t, s.Samples, 1)
+		require.True(t, value.IsStaleNaN(s.Samples[0].Value), "expected a stale marker, got %v", math.Float64bits(s.Samples[0].Value))
+	}
+}
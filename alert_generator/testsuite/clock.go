@@ -0,0 +1,84 @@
+package testsuite
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time to the test suite, which is the time of the checks of the APIs and the time
+// at which the alerts are received from the alert generator. The test cases do not need it since they are
+// given the zero time and the time of every check.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the wall clock, which is the default Clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// FrozenClock is a Clock that only moves when it is told to, to test the logic of the test suite that depends
+// on the current time deterministically, e.g. the matching of the alerts received by the alert receiving server
+// with the expected alerts of a test case. It is safe for concurrent use.
+type FrozenClock struct {
+	mtx sync.Mutex
+	t   time.Time
+}
+
+// NewFrozenClock returns a FrozenClock stopped at the given time.
+func NewFrozenClock(t time.Time) *FrozenClock {
+	return &FrozenClock{t: t}
+}
+
+func (c *FrozenClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.t
+}
+
+// Set moves the clock to the given time, which can be before the current time of the clock.
+func (c *FrozenClock) Set(t time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.t = t
+}
+
+// Advance moves the clock forward by the given duration.
+func (c *FrozenClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// scaledClock is a Clock that runs at the given speed relative to the base clock once it is started, which is
+// the clock of the alert generator when the fixtures are replayed at TestSuiteOptions.ReplaySpeed. It is the
+// same as the base clock before it is started. It is safe for concurrent use.
+type scaledClock struct {
+	base  Clock
+	speed float64
+
+	mtx    sync.Mutex
+	origin time.Time // Zero till started.
+}
+
+func newScaledClock(base Clock, speed float64) *scaledClock {
+	return &scaledClock{base: base, speed: speed}
+}
+
+// start makes the clock run at its speed from the given time of the base clock.
+func (c *scaledClock) start(origin time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.origin = origin
+}
+
+func (c *scaledClock) Now() time.Time {
+	now := c.base.Now()
+	c.mtx.Lock()
+	origin := c.origin
+	c.mtx.Unlock()
+	if origin.IsZero() {
+		return now
+	}
+	return origin.Add(time.Duration(float64(now.Sub(origin)) * c.speed))
+}
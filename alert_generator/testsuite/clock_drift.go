@@ -0,0 +1,172 @@
+package testsuite
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/prometheus/model/timestamp"
+	v1 "github.com/prometheus/prometheus/web/api/v1"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// clockDriftInterval is the interval at which the clock drift watchdog measures the drift.
+const clockDriftInterval = 30 * time.Second
+
+// ClockDrift is a measurement of the drift of the clock of the alert generator from the clock of the test suite,
+// as reported in Score.ClockDrift.
+type ClockDrift struct {
+	Time time.Time `json:"time"`
+	// Drift is positive if the clock of the alert generator is behind the clock of the test suite.
+	Drift float64 `json:"drift_seconds"`
+}
+
+// measureClockDrift returns the drift of the clock of the alert generator from now, the time of the test suite
+// right after the rule groups were fetched. The last evaluation of a group is expected to be at most its interval
+// and a request before now, and how much it is outside of that is the drift of the group, which also includes how
+// much the evaluation is late. Hence the drift is the one of the group with the smallest drift, since all the groups
+// are evaluated with the same clock. False if no group has been evaluated yet.
+func measureClockDrift(now time.Time, groups map[string]*v1.RuleGroup) (time.Duration, bool) {
+	var (
+		drift time.Duration
+		found bool
+	)
+	for _, rg := range groups {
+		if rg == nil || rg.LastEvaluation.IsZero() {
+			continue
+		}
+		lag := now.Sub(rg.LastEvaluation)
+		maxLag := time.Duration(rg.Interval*float64(time.Second)) + cases.MaxRTT
+		var d time.Duration
+		switch {
+		case lag < 0:
+			d = lag
+		case lag > maxLag:
+			d = lag - maxLag
+		}
+		if !found || absDuration(d) < absDuration(drift) {
+			drift, found = d, true
+		}
+	}
+	return drift, found
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// clockDrifts is the timeline of the clock drift measured by the watchdog. It is safe for concurrent use.
+type clockDrifts struct {
+	mtx      sync.Mutex
+	timeline []ClockDrift
+}
+
+func (cd *clockDrifts) add(t time.Time, d time.Duration) {
+	cd.mtx.Lock()
+	defer cd.mtx.Unlock()
+	cd.timeline = append(cd.timeline, ClockDrift{Time: t.UTC(), Drift: d.Seconds()})
+}
+
+func (cd *clockDrifts) all() []ClockDrift {
+	cd.mtx.Lock()
+	defer cd.mtx.Unlock()
+	return append([]ClockDrift(nil), cd.timeline...)
+}
+
+// maxDrift returns the drift with the largest magnitude between from and until, if it is more than the threshold
+// in either direction.
+func maxDrift(timeline []ClockDrift, from, until time.Time, threshold time.Duration) (ClockDrift, bool) {
+	var (
+		largest ClockDrift
+		found   bool
+	)
+	for _, d := range timeline {
+		if d.Time.Before(from) || d.Time.After(until) || math.Abs(d.Drift) <= threshold.Seconds() {
+			continue
+		}
+		if !found || math.Abs(d.Drift) > math.Abs(largest.Drift) {
+			largest, found = d, true
+		}
+	}
+	return largest, found
+}
+
+// clockDriftLoop is the watchdog that measures the drift of the clock of the alert generator from the clock of
+// the test suite from the last evaluation of the rule groups, till the test is over.
+func (ts *TestSuite) clockDriftLoop() {
+	defer ts.wg.Done()
+
+	for !ts.isOver() {
+		select {
+		case <-ts.stopc:
+			return
+		case <-time.After(ts.realDuration(clockDriftInterval)):
+		}
+		b, err := ts.client.Get(ts.rulesAPIURL)
+		now := ts.clock.Now()
+		if err != nil {
+			level.Error(ts.logger).Log("msg", "Error in fetching the rules for the clock drift", "url", ts.rulesAPIURL, "err", err)
+			continue
+		}
+		groups, err := parseAndGroupRulesCompat(b, ts.opts.APICompat)
+		if err != nil {
+			level.Error(ts.logger).Log("msg", "Error in parsing the rules for the clock drift", "url", ts.rulesAPIURL, "err", err)
+			continue
+		}
+		drift, ok := measureClockDrift(now, groups)
+		if !ok {
+			continue
+		}
+		ts.clockDrifts.add(now, drift)
+		if absDuration(drift) > ts.opts.ClockDriftThreshold {
+			level.Warn(ts.logger).Log("msg", "The clock of the alert generator drifted from the clock of the test suite", "drift", drift, "threshold", ts.opts.ClockDriftThreshold)
+		}
+	}
+}
+
+// caseClockDrifts returns the drift with the largest magnitude above the threshold by the group name of the test
+// cases that were running when it was measured.
+func (ts *TestSuite) caseClockDrifts() map[string]ClockDrift {
+	if ts.clockDrifts == nil {
+		return nil
+	}
+	timeline := ts.clockDrifts.all()
+	drifts := make(map[string]ClockDrift)
+	for _, c := range ts.opts.Cases {
+		gn, _ := c.Describe()
+		start, ok := ts.caseStartTimes[gn]
+		if !ok {
+			continue
+		}
+		if d, ok := maxDrift(timeline, timestamp.Time(start), timestamp.Time(c.TestUntil()), ts.opts.ClockDriftThreshold); ok {
+			drifts[gn] = d
+		}
+	}
+	return drifts
+}
+
+// describeClockDrift describes the test cases whose timing failures may be due to the clock drift.
+func describeClockDrift(drifts map[string]ClockDrift, threshold time.Duration) string {
+	if len(drifts) == 0 {
+		return ""
+	}
+	groupNames := make([]string, 0, len(drifts))
+	for gn := range drifts {
+		groupNames = append(groupNames, gn)
+	}
+	sort.Strings(groupNames)
+	describe := fmt.Sprintf("Warning: The clock of the alert generator drifted more than %s from the clock of the test suite while these rule groups were running, "+
+		"their timing failures may be due to the clock and not the alert generator:\n", threshold)
+	for _, gn := range groupNames {
+		d := drifts[gn]
+		describe += fmt.Sprintf("\t%s: drift of %.3fs at %s\n", gn, d.Drift, d.Time.Format(time.RFC3339))
+	}
+	return describe
+}
@@ -0,0 +1,55 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/prometheus/web/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasureClockDrift(t *testing.T) {
+	now := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	group := func(interval float64, lastEval time.Duration) *v1.RuleGroup {
+		return &v1.RuleGroup{Interval: interval, LastEvaluation: now.Add(-lastEval)}
+	}
+
+	_, ok := measureClockDrift(now, map[string]*v1.RuleGroup{"A": {Interval: 10}, "B": nil})
+	require.False(t, ok, "no group evaluated yet")
+
+	// Within the interval and a request.
+	d, ok := measureClockDrift(now, map[string]*v1.RuleGroup{"A": group(10, 11*time.Second)})
+	require.True(t, ok)
+	require.Equal(t, time.Duration(0), d)
+
+	// The alert generator is ahead, and the smallest drift of the groups wins.
+	d, _ = measureClockDrift(now, map[string]*v1.RuleGroup{"A": group(10, -5*time.Second), "B": group(60, -3*time.Second)})
+	require.Equal(t, -3*time.Second, d)
+
+	// The alert generator is behind, where a group evaluated late does not count more.
+	d, _ = measureClockDrift(now, map[string]*v1.RuleGroup{"A": group(10, 20*time.Second), "B": group(10, 40*time.Second)})
+	require.Equal(t, 8*time.Second, d)
+}
+
+func TestCaseClockDrifts(t *testing.T) {
+	zt := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	timeline := []ClockDrift{
+		{Time: zt.Add(time.Minute), Drift: 1},
+		{Time: zt.Add(2 * time.Minute), Drift: -4},
+		{Time: zt.Add(3 * time.Minute), Drift: 3},
+		{Time: zt.Add(20 * time.Minute), Drift: 10},
+	}
+	d, ok := maxDrift(timeline, zt, zt.Add(10*time.Minute), 2*time.Second)
+	require.True(t, ok)
+	require.Equal(t, timeline[1], d)
+
+	_, ok = maxDrift(timeline, zt, zt.Add(90*time.Second), 2*time.Second)
+	require.False(t, ok, "below the threshold")
+	_, ok = maxDrift(timeline, zt.Add(30*time.Minute), zt.Add(40*time.Minute), 2*time.Second)
+	require.False(t, ok, "not running")
+
+	describe := describeClockDrift(map[string]ClockDrift{"B": timeline[3], "A": timeline[1]}, 2*time.Second)
+	require.Contains(t, describe, "drifted more than 2s")
+	require.Contains(t, describe, "\tA: drift of -4.000s at 2022-01-10T10:02:00Z\n\tB: drift of 10.000s at 2022-01-10T10:20:00Z\n")
+	require.Equal(t, "", describeClockDrift(nil, time.Second))
+}
@@ -0,0 +1,118 @@
+package testsuite
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestFrozenClock(t *testing.T) {
+	start := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	c := NewFrozenClock(start)
+	require.Equal(t, start, c.Now())
+	c.Advance(time.Minute)
+	require.Equal(t, start.Add(time.Minute), c.Now())
+	c.Set(start)
+	require.Equal(t, start, c.Now())
+}
+
+func TestScaledClock(t *testing.T) {
+	start := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	base := NewFrozenClock(start)
+	c := newScaledClock(base, 60)
+
+	// Same as the base clock till started.
+	base.Advance(time.Second)
+	require.Equal(t, start.Add(time.Second), c.Now())
+
+	c.start(base.Now())
+	base.Advance(time.Second)
+	require.Equal(t, start.Add(time.Second+time.Minute), c.Now())
+	base.Advance(500 * time.Millisecond)
+	require.Equal(t, start.Add(time.Second+90*time.Second), c.Now())
+}
+
+// replayExpectedAlerts sends the expected alerts of the test case to the alerts server via HTTP, each with the
+// frozen clock at its expected time plus the given delay, like a correct alert generator would send them.
+// The evaluations that change the state of the alerts are a second after the expected times.
+func replayExpectedAlerts(t *testing.T, as *alertsServer, clock *FrozenClock, c cases.TestCase, delay time.Duration) {
+	for _, ea := range c.ExpectedAlerts() {
+		now := ea.Ts.Add(delay)
+		clock.Set(now)
+		a := *ea.Alert
+		a.StartsAt = a.StartsAt.Add(time.Second)
+		a.EndsAt = now.Add(ea.EndsAtDelta)
+		if ea.Resolved {
+			a.EndsAt = ea.ResolvedTime.Add(time.Second)
+		}
+		b, err := json.Marshal([]notifier.Alert{a})
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		as.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+}
+
+func TestAlertsServerFrozenClock(t *testing.T) {
+	zeroTime := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		delay   time.Duration
+		expErrs bool
+	}{
+		{name: "within tolerance", delay: time.Second},
+		{name: "late", delay: time.Minute, expErrs: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := cases.ExactThreshold()
+			c.SamplesToRemoteWrite()
+			c.Init(timestamp.FromTime(zeroTime))
+			gn, _ := c.Describe()
+
+			clock := NewFrozenClock(zeroTime)
+			as := newAlertsServer("", log.NewNopLogger())
+			as.clock = clock
+			as.addExpectedAlerts(c.ExpectedAlerts()...)
+			replayExpectedAlerts(t, as, clock, c, tc.delay)
+
+			require.Equal(t, tc.expErrs, as.groupsFacingErrors()[gn])
+		})
+	}
+}
+
+func TestTestSuiteClock(t *testing.T) {
+	opts := TestSuiteOptions{
+		Logger:          log.NewNopLogger(),
+		Cases:           []cases.TestCase{cases.PendingAndFiringAndResolved()},
+		RemoteWriteURL:  "http://localhost:9090/api/v1/write",
+		BaseAPIURL:      "http://localhost:9090",
+		PromQLBaseURL:   "http://localhost:9090",
+		AlertServerPort: "8080",
+	}
+	ts, err := NewTestSuite(opts)
+	require.NoError(t, err)
+	require.Equal(t, realClock{}, ts.clock)
+	require.Equal(t, realClock{}, ts.as.clock)
+
+	clock := NewFrozenClock(time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC))
+	opts.Clock = clock
+	ts, err = NewTestSuite(opts)
+	require.NoError(t, err)
+	require.Equal(t, clock, ts.as.clock)
+
+	// The replay speed only applies to the fixtures.
+	opts.ReplaySpeed = 60
+	_, err = NewTestSuite(opts)
+	require.EqualError(t, err, `validate options: replay speed can only be set for the fixtures, "PendingAndFiringAndResolved" is a built-in test case`)
+}
@@ -0,0 +1,679 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/promlog"
+	"github.com/prometheus/prometheus/model/timestamp"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite"
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func main() {
+	remoteWriteURL := flag.String("remote-write-url", "", "URL to remote write the samples to.")
+	apiBaseURL := flag.String("api-base-url", "", "Base URL of the alert generator to query GET <url>/api/v1/rules and <url>/api/v1/alerts.")
+	promqlBaseURL := flag.String("promql-base-url", "", "Base URL to query the ALERTS series via GET <url>/api/v1/query.")
+	alertServerPort := flag.String("alert-server-port", "8080", "Port at which the alerts from the alert generator are received. "+
+		"The health of the receiver is served at /-/healthy and its metrics, e.g. of the alerts received and the requests that could not be decoded, at /metrics on the same port.")
+	alertmanagerURL := flag.String("alertmanager-url", "", "Optional URL of an Alertmanager that sits between the alert generator and this test suite. "+
+		"If set, the alerts are also verified via GET <url>/api/v2/alerts of the Alertmanager. "+
+		"The alert generator must send the alerts to both the Alertmanager and this test suite.")
+	userAgent := flag.String("user-agent", testsuite.DefaultUserAgent, "User-Agent to set in all the requests made by the test suite.")
+	requestIDs := flag.Bool("request-ids", true, "Attach a unique X-Request-ID header to every request made by the test suite. The IDs are logged with the requests and reused on retries, which are logged with the attempt number.")
+	validateCases := flag.Bool("validate-cases", false, "Only validate that the expected alerts of all the test cases are internally consistent and exit. No alert generator is needed for this.")
+	checkRuleLoadErrors := flag.Bool("check-rule-load-errors", false, "Only check that the alert generator reports the error of loading the invalid rules file "+
+		"written via -invalid-rules-file-path of rule_config_builder, and exit. Add the file to the rule files of the alert generator and reload its configuration before. "+
+		"The check needs GET <api-base-url>/api/v1/status/runtimeinfo to report reloadConfigSuccess as false and GET <api-base-url>/api/v1/rules to have none of the invalid rule groups.")
+	listCases := flag.Bool("list-cases", false, "Only list the test cases with the series and the samples that they remote write, their peak of firing alerts and "+
+		"what makes their evaluation expensive, with the total of all the test cases to size the alert generator before the test, and exit. "+
+		"The series and the samples are derived from the test cases, and the peak firing alerts from their expected alerts, where the cases all start together.")
+	dumpReportSchema := flag.Bool("dump-report-schema", false, "Only write the JSON Schema of the score file of -score-file and of the lines of -stream-results to stdout, and exit.")
+	grafanaDashboard := flag.String("grafana-dashboard", "", "Only write the JSON of a Grafana dashboard charting the compliance score and the pass rate of every test case over the runs "+
+		"from the compliance_score and compliance_case_result series written via -results-textfile to the given path, and exit. The Prometheus data source is a variable of the dashboard.")
+	alertTrace := flag.String("alert-trace", "", "Optional path of a file to write all the alerts received from the alert generator as newline delimited JSON, to be replayed via -replay-trace.")
+	replayTrace := flag.String("replay-trace", "", "Only match the alerts in the given file written via -alert-trace with the expected alerts of the test cases, and exit. "+
+		"No alert generator is needed for this. This reproduces the checks of the received alerts of a previous run.")
+	shuffle := flag.Bool("shuffle", false, "Run the test cases in a random order decided by -seed, where the cases start one after the other in that order. "+
+		"Pass the same -shuffle and -seed to rule_config_builder to also shuffle the rule groups in the rules file.")
+	shard := flag.String("shard", "", "Optional shard of the test cases to run of the form <index>/<count>, e.g. 2/4 for the second of four shards, to split the test across several runners of a CI. "+
+		"The test cases are partitioned by the hash of their group name, hence a shard always runs the same test cases. -list-cases only lists the test cases of the shard. "+
+		"Every shard needs its own alert generator with the rules file of all the test cases. Merge the files of -score-file of the shards with -merge-scores.")
+	mergeScores := flag.String("merge-scores", "", "Only merge the comma separated score files written via -score-file by the runs of the shards of -shard into the score of all their test cases, "+
+		"print it and write it to -score-file and -results-textfile if given, and exit. The exit code is non-zero if a test case failed.")
+	seed := flag.Int64("seed", 0, "Seed for -shuffle and the ingestion faults. If 0, a time based seed is used. The seed used is logged and printed in the report to reproduce a run.")
+	ingestDropRate := flag.Float64("ingest-drop-rate", 0, fmt.Sprintf("Probability of dropping a batch of samples while remote writing, between 0 and %.2f. "+
+		"Only applies to the test cases that tolerate ingestion faults.", cases.MaxIngestDropRate))
+	ingestDelay := flag.Duration("ingest-delay", 0, fmt.Sprintf("Max random delay added to a batch of samples while remote writing, at most %s. "+
+		"Only applies to the test cases that tolerate ingestion faults.", cases.MaxIngestDelay))
+	seedWithPastData := flag.Bool("seed-with-past-data", false, "Remote write a lead-in of samples before the start of the test for the test cases that declare a warmup, "+
+		"so that their range vector selectors like rate() have a full lookback of samples from the first evaluation. The samples are written together when the test starts.")
+	replicaLag := flag.Duration("replica-lag", 0, "Max lag of the state visible via -api-base-url and -promql-base-url behind the alert generator that sends the alerts, "+
+		"when those point to a read replica or a query frontend in a HA setup. The checks of the APIs tolerate this lag. It can be at most the smallest group interval of the test cases.")
+	queryCacheStaleness := flag.Duration("query-cache-staleness", 0, "Max staleness of the cached query results when the alert generator evaluates the rules through a caching query frontend, "+
+		"which delays the state changes of the alerts. The checks of the APIs and the PromQL queries tolerate this delay, and the alerts received can be this much later, "+
+		"hence firing and resolving up to this late is not caught. It can be at most the smallest group interval of the test cases.")
+	verifySelfMetrics := flag.Bool("verify-self-metrics", false, "Scrape GET <api-base-url>/metrics of the alert generator at the start and the end of the test to cross-check "+
+		"prometheus_notifications_sent_total with the alerts received, and per rule group prometheus_rule_evaluations_total with the group intervals, "+
+		"prometheus_rule_evaluation_failures_total with no failures and prometheus_rule_group_rules with the rules in the group. Discrepancies are reported as warnings.")
+	strictSelfMetrics := flag.Bool("strict-self-metrics", false, "Fail the test on the discrepancies found by -verify-self-metrics instead of only warning.")
+	verifyAlertsTimeline := flag.Bool("verify-alerts-timeline", false, "At the end of the test, query the ALERTS series of every test case over its entire duration "+
+		"via GET <promql-base-url>/api/v1/query_range and check the alert state at every second, which catches the wrong states shorter than the interval of the periodic checks.")
+	httpMaxIdleConns := flag.Int("http-max-idle-conns", testsuite.DefaultMaxIdleConnsPerHost, "Max number of idle keep-alive connections per host kept for reuse by the HTTP client "+
+		"used for the remote write and the API checks. Raise it for the test cases with many series or short intervals to avoid opening new connections all the time.")
+	httpTimeout := flag.Duration("http-timeout", testsuite.DefaultHTTPTimeout, "Timeout of the requests made by the test suite. The remote write requests are also bound by the delivery deadline of the samples.")
+	forceHTTP2 := flag.Bool("force-http2", false, "Make all the requests of the test suite over HTTP/2 without falling back to HTTP/1.1, with h2c (prior knowledge) for http URLs and h2 for https URLs. "+
+		"Without it, HTTP/2 is used only when the server negotiates it over TLS.")
+	readGeneratorFlags := flag.Bool("read-generator-flags", false, "Read the query engine flags of the alert generator via GET <api-base-url>/api/v1/status/flags at the start of the test. "+
+		"The expectations of the test cases that depend on the lookback delta are adjusted to query.lookback-delta, the ones that depend on the max samples to query.max-samples, "+
+		"and the differences of query.max-samples and query.timeout from the defaults are warned.")
+	requireAlertLabels := flag.String("require-alert-labels", "", "Optional comma separated list of labels that every alert received from the alert generator must have with a non empty value. "+
+		"A violation fails the test and is reported separately.")
+	maxAnnotationLength := flag.Int("max-annotation-length", 0, "If positive, the max length in bytes of the value of every annotation of the alerts received from the alert generator. "+
+		"A violation fails the test and is reported separately.")
+	expectedExternalURL := flag.String("expected-external-url", cases.DefaultExternalURL, "External URL that the alert generator is configured with, e.g. via --web.external-url for Prometheus, "+
+		"which the test cases that template the external URL into the annotations expect.")
+	sampleEpsilon := flag.Float64("sample-epsilon", cases.DefaultSampleEpsilon, "Relative tolerance of the comparison of the values of the ALERTS series and the other series checked by the test cases, "+
+		"so that the floating point results that differ in the last bits because of the order of summation still match.")
+	detectDuplicateSends := flag.Bool("detect-duplicate-sends", false, "Fail the rule groups whose alerts are received more than once with the same labels, StartsAt and EndsAt within a resend cycle, "+
+		"which happens when the alert generator sends the same alert twice, e.g. to the same Alertmanager configured twice.")
+	strictResendCount := flag.Bool("strict-resend-count", false, "Fail the test cases whose alerts are sent a number of times other than expected while firing, "+
+		"i.e. the initial firing alert and a resend after every resend delay, which catches the alert generators that resend too eagerly or too lazily.")
+	allowedMissedResends := flag.Int("allowed-missed-resends", 1, "Number of resends of a firing alert that can be missed per firing episode without failing the test case, "+
+		"since a correct alert generator sends the alert again after the resend delay, e.g. when the alert receiving server drops a request while overwhelmed. "+
+		"The initial firing alert and the resolved alerts must never be missed. Set to 0 to fail on any missed alert.")
+	assertBatchByGroup := flag.Bool("assert-batch-by-group", false, "Fail the test cases whose alerts of a single evaluation are received in more than one request, "+
+		"which catches the alert generators that split the batch of notifications of a rule group. Prometheus sends the alerts of every alerting rule on their own, "+
+		"which can split the alerts of a rule group with more than one alerting rule.")
+	maxSeries := flag.Int("max-series", 100000, "Max number of distinct series remote written by all the test cases together, above which the test does not start "+
+		"and the number of series of every test case is printed, to guard the alert generator against a runaway cardinality of a test case or a fixture. Set to 0 for no limit.")
+	maxBatchSize := flag.Int("max-batch-size", 0, "If positive, fail the test cases whose alerts are received in a request with more alerts than this, "+
+		"to check the batching of the notifications of the alert generator, e.g. 64 for the default of Prometheus.")
+	maxP99SendLatency := flag.Duration("max-p99-send-latency", 0, "If positive, fail the test cases whose p99 latency of the firing alerts is more than this, "+
+		"where the latency of an alert is the time it was received after it was expected to be sent. The distribution of the latencies of every test case "+
+		"is in the score file regardless.")
+	assertFrom := flag.Duration("assert-from", 0, "Offset from the start of every test case from which it is checked, to debug a single transition of a test case without the noise before it. "+
+		"The samples are still remote written from the start so that the alert generator has the full context.")
+	assertUntil := flag.Duration("assert-until", 0, "Offset from the start of every test case at which its checks end, to debug a single transition of a test case "+
+		"without waiting out the rest of it. 0 means the end of the test case.")
+	metricsSource := flag.String("metrics-source", string(testsuite.MetricsSourceQuery), fmt.Sprintf("Where the ALERTS series are read from for the metrics checks, one of %q and %q. "+
+		"%q runs an instant query via GET <promql-base-url>/api/v1/query. %q scrapes GET <promql-base-url>/federate?match[]=ALERTS, for the alert generators that support federation "+
+		"while their query API differs, which checks the ALERTS series at the time of the scrape with the lag of the APIs, and skips the other queries of the test cases.",
+		testsuite.MetricsSourceQuery, testsuite.MetricsSourceFederate, testsuite.MetricsSourceQuery, testsuite.MetricsSourceFederate))
+	queryStepAlignment := flag.String("query-step-alignment", string(cases.QueryStepAlignmentNone), fmt.Sprintf("How the alert generator aligns the instant of GET <promql-base-url>/api/v1/query, "+
+		"which is the timestamp of the ALERTS samples and the other series checked by the test cases, one of %q, %q and %q. "+
+		"%q evaluates at the requested instant like Prometheus, %q rounds it to the nearest second, and %q aligns it down to a multiple of -query-step-interval, "+
+		"e.g. for the alert generators that only evaluate at the boundaries of their scrape interval. Not used with -metrics-source=%s.",
+		cases.QueryStepAlignmentNone, cases.QueryStepAlignmentSecond, cases.QueryStepAlignmentInterval,
+		cases.QueryStepAlignmentNone, cases.QueryStepAlignmentSecond, cases.QueryStepAlignmentInterval, testsuite.MetricsSourceFederate))
+	queryStepInterval := flag.Duration("query-step-interval", cases.DefaultStepInterval, "The step that the instant of the queries is aligned to with -query-step-alignment="+
+		string(cases.QueryStepAlignmentInterval)+".")
+	apiCompat := flag.String("api-compat", string(testsuite.APICompatStrict), fmt.Sprintf("How strictly the responses of the rules and alerts APIs of the alert generator are decoded, one of %q and %q. "+
+		"%q tolerates the differences of the alert generators whose responses differ from Prometheus in the cosmetics of the schema, which are then not verified: "+
+		"the case of the type, health and state of the rules and the state of the alerts, a missing type of a rule and a number as the value of the alerts. "+
+		"The fields unknown to the test suite, e.g. keepFiringSince, are always ignored.", testsuite.APICompatStrict, testsuite.APICompatRelaxed, testsuite.APICompatRelaxed))
+	strictRuleGroup := flag.Bool("strict-rulegroup", false, "Also verify the fields of the rule groups of GET <api-base-url>/api/v1/rules that the test cases do not expect, "+
+		"for the alert generators that must be compatible with the API of Prometheus field for field: the file of the group, the evaluationTime and lastEvaluation of the group and every rule, "+
+		"and that the alerts of every rule are its own, are not active after its lastEvaluation and have their value formatted like Prometheus. "+
+		"The fields unknown to the test suite are still ignored. It cannot be used with -api-compat="+string(testsuite.APICompatRelaxed)+".")
+	cleanup := flag.Bool("cleanup", false, "After the test, mark all the series written by the test cases stale and wait for their alerts to be gone from the alert generator, "+
+		"so that a subsequent run against the same alert generator starts from a clean baseline without restarting it. A failed cleanup is logged and does not fail the test.")
+	cleanupURL := flag.String("cleanup-url", "", "Optional URL of an endpoint of the alert generator that resets its state, which is sent a POST request by -cleanup after marking the series stale.")
+	caseWeights := flag.String("case-weights", "", "Optional path of a YAML file with a map of the group name of a test case to its weight in the compliance score, "+
+		"overriding the default weight of the test case.")
+	scoreFile := flag.String("score-file", "", "Optional path of a file to write the compliance score of the test as JSON, with the result and weight of every test case.")
+	resultsTextfile := flag.String("results-textfile", "", "Optional path of a file to write the compliance_case_result series, 1 if the test case passed and 0 if not, "+
+		"and the compliance_score series of the test to in the Prometheus text format, e.g. in the directory of the textfile collector of the node exporter, "+
+		"to chart the runs with the dashboard of -grafana-dashboard. The series have the name of the generator in the generator label. "+
+		"The file is per generator like -score-file.")
+	baseline := flag.String("baseline", "", "Optional path of a score file written via -score-file by a previous run to compare this run with, per test case and per check. "+
+		"The regressions, fixes and the test cases added or removed since the baseline are printed, and the exit code is non-zero only if there are regressions.")
+	streamResults := flag.String("stream-results", "", "Optional destination to stream the results of the test cases to as newline delimited JSON as soon as they are known, "+
+		"which is \"-\" for stdout or the path of a Unix socket to connect to. A line is written when a check of a test case fails and when a test case finishes without failures. "+
+		"The report at the end of the test is still printed to stdout after the streamed lines.")
+	generatorsFile := flag.String("generators-file", "", "Optional path of a YAML file listing several named alert generators with their own endpoints and headers, "+
+		"to run the test suite against each of them one after the other instead of the one given by -remote-write-url, -api-base-url, -promql-base-url and -alertmanager-url. "+
+		"The report of each is followed by a matrix comparing the test cases across them. The files of -alert-trace, -score-file and -baseline are per generator, "+
+		"with the name of the generator before the extension, e.g. score.prometheus.json.")
+	preflight := flag.Bool("preflight", false, "Probe the endpoints and features of the alert generator before the test, e.g. the rules and alerts APIs, the ALERTS and ALERTS_FOR_STATE series "+
+		"and the remote write, and skip the test cases that need one that is not supported. The capabilities found are shown at the top of the report.")
+	preflightConnectivity := flag.Bool("preflight-connectivity", false, "Only check that the endpoints of the test suite are configured correctly, and exit, to not wait out a test "+
+		"to find a typo in a URL or missing credentials. The remote write endpoint must accept a single sample of the alert_generator_test_suite_connectivity series, "+
+		"the rules and alerts APIs and the PromQL endpoint must respond with the shape of Prometheus, the Alertmanager must list its alerts if given, "+
+		"and the port of -alert-server-port must be free to serve the alerts. The status of every endpoint is printed with a hint of what is likely misconfigured. "+
+		"With -generators-file, the endpoints of every generator are checked.")
+	calibrate := flag.Bool("calibrate", false, "Measure the evaluation cadence, the notification latency and the resend delay of the alert generator before the test "+
+		"with an always firing alert, which must be loaded into the alert generator from the file written by -calibration-rules-file-path of rule_config_builder. "+
+		"The notification latency beyond the assumed one is added to the time tolerance of the alerts, and the other timings are warned about when they differ from the assumed ones. "+
+		"The timings measured are shown at the top of the report. This delays the test by "+testsuite.CalibrationDuration.String()+".")
+	clockDriftThreshold := flag.Duration("clock-drift-threshold", 0, "If positive, periodically measure the drift of the clock of the alert generator from the clock of the test suite "+
+		"during the test from the last evaluation of the rule groups, and annotate the test cases that were running when the drift was more than this, "+
+		"since their timing failures may be due to the clock, e.g. NTP adjustments or a paused VM. The drift timeline is in the score file.")
+	profileCPU := flag.String("profile-cpu", "", "Optional path of a file to write the CPU profile of the test suite itself to, covering the run from the generation of the samples of the test cases "+
+		"to the report, for the performance work on the test suite. Inspect it with \"go tool pprof -top -cum <binary> <file>\", where the matching of the alerts is under "+
+		"cases.checkExpectedAlerts, cases.checkExpectedRuleGroup and cases.checkExpectedSamples for the API checks and cases.(*ExpectedAlert).Matches for the alerts received, "+
+		"and the generation of the samples under the SamplesToRemoteWrite of the test cases. The file is per generator like -score-file.")
+	profileMem := flag.String("profile-mem", "", "Optional path of a file to write the heap profile of the test suite itself to at the end of the run, like -profile-cpu. "+
+		"Inspect it with \"go tool pprof -sample_index=alloc_space -top <binary> <file>\" for the allocations of the whole run, e.g. of the combinations of the expected alerts "+
+		"built by the checks of the test cases with many alerts. The file is per generator like -score-file.")
+	printScore := flag.Bool("print-score", false, "Print the compliance score after the test result. The score is the percentage of the total weight of the test cases that passed.")
+	fromRulesFile := flag.String("from-rules-file", "", "Optional path of a unit test file for \"promtool test rules\" to test the rules used by it instead of the built-in test cases. "+
+		"The input series are remote-written and the firing alerts of its alert_rule_test are checked. The rules file must be generated by rule_config_builder with the same flag.")
+	replaySpeed := flag.Float64("replay-speed", 1, "Speed relative to the real time at which the input series of -from-rules-file are replayed, e.g. 60 to replay an hour of samples in a minute, "+
+		"or 0.5 to slow it down for observation. The expectations are checked at the time in the replay. The timestamps of the samples are not changed, hence the clock of the alert generator "+
+		"must also run at this speed from the start of the remote write, else the samples are in its future or past. Only applies with -from-rules-file.")
+	seedDataFromPrometheus := flag.String("seed-data-from-prometheus", "", "Only capture the recent samples of -seed-data-query from the Prometheus at the given base URL via GET <url>/api/v1/query_range, "+
+		"write them as the input series of a unit test file for \"promtool test rules\" with the timestamps relative to the start of the range, and exit. "+
+		"Add the rules to test and the expected alerts to the file to use it with -from-rules-file.")
+	seedDataQuery := flag.String("seed-data-query", "", "PromQL expression whose samples are captured by -seed-data-from-prometheus, usually a selector of the series used by the rules.")
+	seedDataRange := flag.Duration("seed-data-range", time.Hour, "How far back from now the samples are captured by -seed-data-from-prometheus.")
+	seedDataStep := flag.Duration("seed-data-step", 15*time.Second, "Step of the range query of -seed-data-from-prometheus, which is the interval of the captured input series.")
+	seedDataOutput := flag.String("seed-data-output", "", "Path of the file to write the captured samples of -seed-data-from-prometheus to. Written to stdout if empty.")
+	flag.Parse()
+	log := promlog.New(&promlog.Config{})
+
+	if *dumpReportSchema {
+		b, err := testsuite.ReportSchema()
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to generate the report schema", "err", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(b))
+		return
+	}
+
+	if *mergeScores != "" {
+		var scores []testsuite.Score
+		for _, path := range strings.Split(*mergeScores, ",") {
+			s, err := testsuite.LoadScore(path)
+			if err != nil {
+				level.Error(log).Log("msg", "Failed to load the score of a shard", "path", path, "err", err)
+				os.Exit(1)
+			}
+			scores = append(scores, s)
+		}
+		merged, err := testsuite.MergeScores(scores)
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to merge the scores", "err", err)
+			os.Exit(1)
+		}
+		fmt.Println(merged.String())
+		if *scoreFile != "" {
+			b, err := json.MarshalIndent(merged, "", "  ")
+			if err == nil {
+				err = ioutil.WriteFile(*scoreFile, b, 0o644)
+			}
+			if err != nil {
+				level.Error(log).Log("msg", "Failed to write the score file", "err", err)
+				os.Exit(1)
+			}
+		}
+		if *resultsTextfile != "" {
+			if err := testsuite.WriteResultsTextfile(*resultsTextfile, merged, ""); err != nil {
+				level.Error(log).Log("msg", "Failed to write the results textfile", "err", err)
+				os.Exit(1)
+			}
+		}
+		for _, c := range merged.Cases {
+			if !c.Passed {
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
+	if *seedDataFromPrometheus != "" {
+		b, err := testsuite.SeedDataFromPrometheus(testsuite.TestSuiteOptions{
+			Logger:                  log,
+			UserAgent:               *userAgent,
+			RequestIDs:              *requestIDs,
+			HTTPMaxIdleConnsPerHost: *httpMaxIdleConns,
+			HTTPTimeout:             *httpTimeout,
+			HTTPForceHTTP2:          *forceHTTP2,
+		}, testsuite.SeedData{
+			PrometheusURL: *seedDataFromPrometheus,
+			Query:         *seedDataQuery,
+			Range:         *seedDataRange,
+			Step:          *seedDataStep,
+		})
+		if err == nil {
+			if *seedDataOutput == "" {
+				_, err = os.Stdout.Write(b)
+			} else {
+				err = ioutil.WriteFile(*seedDataOutput, b, 0o644)
+			}
+		}
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to capture the samples from Prometheus", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cs := cases.AllCases
+	if *fromRulesFile != "" {
+		var err error
+		cs, err = cases.PromtoolTestCases(*fromRulesFile)
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to load the test cases from the promtool test file", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	sh, err := testsuite.ParseShard(*shard)
+	if err != nil {
+		level.Error(log).Log("msg", "Invalid shard", "err", err)
+		os.Exit(1)
+	}
+	if sh.Count > 0 {
+		level.Info(log).Log("msg", "Running only the test cases of a shard", "shard", sh, "cases", len(testsuite.ShardCases(cs, sh)), "of", len(cs))
+	}
+
+	if *shuffle || *ingestDropRate > 0 || *ingestDelay > 0 {
+		*seed = cases.PickSeed(*seed)
+	}
+
+	if *validateCases {
+		failed := false
+		zeroTime := timestamp.FromTime(time.Now())
+		for _, c := range cs {
+			groupName, _ := c.Describe()
+			if err := cases.ValidateExpectedAlerts(c, zeroTime); err != nil {
+				level.Error(log).Log("msg", "Invalid expected alerts for a test case", "rulegroup", groupName, "err", err)
+				failed = true
+				continue
+			}
+			level.Info(log).Log("msg", "Expected alerts are valid for a test case", "rulegroup", groupName)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *listCases {
+		fmt.Print(testsuite.ListCases(testsuite.ShardCases(cs, sh)))
+		return
+	}
+
+	if *grafanaDashboard != "" {
+		b, err := testsuite.GrafanaDashboard(cs)
+		if err == nil {
+			err = ioutil.WriteFile(*grafanaDashboard, b, 0o644)
+		}
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to write the Grafana dashboard", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *checkRuleLoadErrors {
+		yes, describe, err := testsuite.CheckRuleLoadErrors(testsuite.TestSuiteOptions{
+			Logger:                  log,
+			BaseAPIURL:              *apiBaseURL,
+			UserAgent:               *userAgent,
+			RequestIDs:              *requestIDs,
+			HTTPMaxIdleConnsPerHost: *httpMaxIdleConns,
+			HTTPTimeout:             *httpTimeout,
+			HTTPForceHTTP2:          *forceHTTP2,
+			APICompat:               testsuite.APICompat(*apiCompat),
+		})
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to check the rule load errors", "err", err)
+			os.Exit(1)
+		}
+		fmt.Println(describe)
+		if !yes {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *replayTrace != "" {
+		f, err := os.Open(*replayTrace)
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to open the alert trace", "err", err)
+			os.Exit(1)
+		}
+		yes, describe, err := testsuite.ReplayAlertTrace(f, cs, log)
+		f.Close()
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to replay the alert trace", "err", err)
+			os.Exit(1)
+		}
+		fmt.Println(describe)
+		if !yes {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var weights map[string]float64
+	if *caseWeights != "" {
+		var err error
+		weights, err = testsuite.LoadCaseWeights(*caseWeights)
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to load the case weights", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	var validators []testsuite.AlertValidator
+	if *requireAlertLabels != "" {
+		validators = append(validators, testsuite.RequiredLabelsValidator{Labels: strings.Split(*requireAlertLabels, ",")})
+	}
+	if *maxAnnotationLength > 0 {
+		validators = append(validators, testsuite.AnnotationLengthValidator{MaxLength: *maxAnnotationLength})
+	}
+
+	var resultStream io.Writer
+	switch *streamResults {
+	case "":
+	case "-":
+		resultStream = os.Stdout
+	default:
+		conn, err := net.Dial("unix", *streamResults)
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to connect to the Unix socket to stream the results", "err", err)
+			os.Exit(1)
+		}
+		resultStream = conn
+	}
+
+	opts := testsuite.TestSuiteOptions{
+		Logger:                  log,
+		Cases:                   cs,
+		Shard:                   sh,
+		RemoteWriteURL:          *remoteWriteURL,
+		BaseAPIURL:              *apiBaseURL,
+		PromQLBaseURL:           *promqlBaseURL,
+		AlertServerPort:         *alertServerPort,
+		AlertmanagerURL:         *alertmanagerURL,
+		UserAgent:               *userAgent,
+		RequestIDs:              *requestIDs,
+		Shuffle:                 *shuffle,
+		Seed:                    *seed,
+		IngestDropRate:          *ingestDropRate,
+		IngestDelay:             *ingestDelay,
+		MaxSeries:               *maxSeries,
+		SeedWithPastData:        *seedWithPastData,
+		ReplicaLag:              *replicaLag,
+		QueryCacheStaleness:     *queryCacheStaleness,
+		ReplaySpeed:             *replaySpeed,
+		AlertTraceFile:          *alertTrace,
+		VerifySelfMetrics:       *verifySelfMetrics || *strictSelfMetrics,
+		ClockDriftThreshold:     *clockDriftThreshold,
+		StrictSelfMetrics:       *strictSelfMetrics,
+		VerifyAlertsTimeline:    *verifyAlertsTimeline,
+		HTTPMaxIdleConnsPerHost: *httpMaxIdleConns,
+		HTTPTimeout:             *httpTimeout,
+		HTTPForceHTTP2:          *forceHTTP2,
+		ReadGeneratorFlags:      *readGeneratorFlags,
+		CaseWeights:             weights,
+		AlertValidators:         validators,
+		ExpectedExternalURL:     *expectedExternalURL,
+		SampleEpsilon:           *sampleEpsilon,
+		DetectDuplicateSends:    *detectDuplicateSends,
+		AllowedMissedResends:    *allowedMissedResends,
+		StrictResendCount:       *strictResendCount,
+		AssertBatchByGroup:      *assertBatchByGroup,
+		MaxBatchSize:            *maxBatchSize,
+		MaxP99SendLatency:       *maxP99SendLatency,
+		AssertFrom:              *assertFrom,
+		AssertUntil:             *assertUntil,
+		APICompat:               testsuite.APICompat(*apiCompat),
+		StrictRuleGroup:         *strictRuleGroup,
+		MetricsSource:           testsuite.MetricsSource(*metricsSource),
+		QueryStepAlignment:      cases.QueryStepAlignment(*queryStepAlignment),
+		QueryStepInterval:       *queryStepInterval,
+		CleanupURL:              *cleanupURL,
+		ResultStream:            resultStream,
+		Preflight:               *preflight,
+		Calibrate:               *calibrate,
+	}
+
+	var generators []testsuite.GeneratorConfig
+	if *generatorsFile != "" {
+		var err error
+		generators, err = testsuite.LoadGenerators(*generatorsFile)
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to load the generators", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	if *preflightConnectivity {
+		allOK := true
+		if len(generators) == 0 {
+			generators = []testsuite.GeneratorConfig{{}}
+		}
+		for _, g := range generators {
+			gOpts := opts
+			if g.Name != "" {
+				gOpts = g.Options(opts)
+				fmt.Println("Generator: " + g.Name)
+			}
+			yes, describe, err := testsuite.CheckConnectivity(gOpts)
+			if err != nil {
+				level.Error(log).Log("msg", "Failed to check the connectivity", "generator", g.Name, "err", err)
+				os.Exit(1)
+			}
+			fmt.Println(describe)
+			allOK = allOK && yes
+		}
+		if !allOK {
+			os.Exit(1)
+		}
+		return
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		term := make(chan os.Signal, 1)
+		signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+		<-term
+		level.Info(log).Log("msg", "Received termination signal, stopping the test suite")
+		close(stop)
+	}()
+
+	// report prints the result of a run and writes its score, and tells whether the run is a success,
+	// which is decided by the regressions from the baseline if a baseline is given.
+	report := func(name string, yes bool, describe string, score testsuite.Score) bool {
+		fmt.Println(describe)
+		if *printScore {
+			fmt.Println(score.String())
+		}
+		if *scoreFile != "" {
+			b, err := json.MarshalIndent(score, "", "  ")
+			if err == nil {
+				err = ioutil.WriteFile(generatorPath(*scoreFile, name), b, 0o644)
+			}
+			if err != nil {
+				level.Error(log).Log("msg", "Failed to write the score file", "err", err)
+				os.Exit(1)
+			}
+		}
+		if *resultsTextfile != "" {
+			if err := testsuite.WriteResultsTextfile(generatorPath(*resultsTextfile, name), score, name); err != nil {
+				level.Error(log).Log("msg", "Failed to write the results textfile", "err", err)
+				os.Exit(1)
+			}
+		}
+		if *baseline != "" {
+			base, err := testsuite.LoadScore(generatorPath(*baseline, name))
+			if err != nil {
+				level.Error(log).Log("msg", "Failed to load the baseline score", "err", err)
+				os.Exit(1)
+			}
+			diff := testsuite.DiffScores(base, score)
+			fmt.Println(diff.String())
+			return len(diff.Regressions) == 0
+		}
+		return yes
+	}
+
+	if len(generators) == 0 {
+		yes, describe, score, err := runTestSuite(opts, stop, *cleanup, profiles{cpu: *profileCPU, mem: *profileMem})
+		if err != nil {
+			level.Error(log).Log("msg", "Error in running the test suite", "err", err)
+			os.Exit(1)
+		}
+		if !report("", yes, describe, score) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	allPassed := true
+	var results []testsuite.GeneratorResult
+Generators:
+	for _, g := range generators {
+		select {
+		case <-stop:
+			level.Info(log).Log("msg", "Skipping the remaining generators", "from", g.Name)
+			allPassed = false
+			break Generators
+		default:
+		}
+
+		gOpts := g.Options(opts)
+		if gOpts.AlertTraceFile != "" {
+			gOpts.AlertTraceFile = generatorPath(gOpts.AlertTraceFile, g.Name)
+		}
+		level.Info(log).Log("msg", "Running the test suite against a generator", "generator", g.Name)
+		gProfiles := profiles{cpu: *profileCPU, mem: *profileMem}
+		if gProfiles.cpu != "" {
+			gProfiles.cpu = generatorPath(gProfiles.cpu, g.Name)
+		}
+		if gProfiles.mem != "" {
+			gProfiles.mem = generatorPath(gProfiles.mem, g.Name)
+		}
+		yes, describe, score, err := runTestSuite(gOpts, stop, *cleanup, gProfiles)
+		if err != nil {
+			level.Error(log).Log("msg", "Error in running the test suite", "generator", g.Name, "err", err)
+			allPassed = false
+			results = append(results, testsuite.GeneratorResult{Name: g.Name})
+			continue
+		}
+		fmt.Println("==========================================")
+		fmt.Println("Generator: " + g.Name)
+		if !report(g.Name, yes, describe, score) {
+			allPassed = false
+		}
+		results = append(results, testsuite.GeneratorResult{Name: g.Name, Passed: yes, Score: score})
+	}
+	fmt.Println(testsuite.CompareGenerators(results))
+	if !allPassed {
+		os.Exit(1)
+	}
+}
+
+// runTestSuite runs the test suite until it is over or stop is closed, and returns whether the test passed,
+// its report and its score. The alert generator is cleaned up after the test if cleanup is true.
+// The test suite itself is profiled from its creation, which generates the samples, till the report.
+func runTestSuite(opts testsuite.TestSuiteOptions, stop <-chan struct{}, cleanup bool, p profiles) (bool, string, testsuite.Score, error) {
+	stopProfiles, err := p.start()
+	if err != nil {
+		return false, "", testsuite.Score{}, errors.Wrap(err, "start the profiles")
+	}
+	defer func() {
+		if err := stopProfiles(); err != nil {
+			level.Warn(opts.Logger).Log("msg", "Failed to write the profiles of the test suite", "err", err)
+		}
+	}()
+
+	ts, err := testsuite.NewTestSuite(opts)
+	if err != nil {
+		return false, "", testsuite.Score{}, errors.Wrap(err, "create the test suite")
+	}
+
+	ts.Start()
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+			ts.Stop()
+		case <-done:
+		}
+	}()
+	ts.Wait()
+	close(done)
+
+	if cleanup {
+		if err := ts.Cleanup(); err != nil {
+			level.Warn(opts.Logger).Log("msg", "Failed to clean up the alert generator", "err", err)
+		}
+	}
+
+	if err := ts.Error(); err != nil {
+		return false, "", testsuite.Score{}, err
+	}
+	yes, describe := ts.WasTestSuccessful()
+	return yes, describe, ts.Score(), nil
+}
+
+// generatorPath returns the path of the file for the given generator, with the name of the generator
+// before the extension, e.g. score.json becomes score.prometheus.json. The path is unchanged without a name.
+func generatorPath(path, name string) string {
+	if name == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + name + ext
+}
+
+// profiles are the paths of the files to write the pprof profiles of the test suite itself to. Empty for no profile.
+type profiles struct {
+	cpu, mem string
+}
+
+// start starts the CPU profile and returns the function that stops it and writes the heap profile.
+func (p profiles) start() (stop func() error, err error) {
+	var cpuFile *os.File
+	if p.cpu != "" {
+		cpuFile, err = os.Create(p.cpu)
+		if err != nil {
+			return nil, errors.Wrap(err, "create the CPU profile")
+		}
+		if err := pprof.StartCPUProfile(cpuFile); err != nil {
+			cpuFile.Close()
+			return nil, errors.Wrap(err, "start the CPU profile")
+		}
+	}
+	return func() error {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			if err := cpuFile.Close(); err != nil {
+				return errors.Wrap(err, "close the CPU profile")
+			}
+		}
+		if p.mem == "" {
+			return nil
+		}
+		f, err := os.Create(p.mem)
+		if err != nil {
+			return errors.Wrap(err, "create the heap profile")
+		}
+		defer f.Close()
+		// The heap profile is of the last garbage collection, hence the one of the end of the run is forced.
+		runtime.GC()
+		return errors.Wrap(pprof.WriteHeapProfile(f), "write the heap profile")
+	}, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"io/fs"
 	"io/ioutil"
 	"os"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/common/promlog"
+	"github.com/prometheus/compliance/alert_generator/testsuite"
 	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
 	"github.com/prometheus/prometheus/model/rulefmt"
 	yaml "gopkg.in/yaml.v3"
@@ -16,13 +18,37 @@ import (
 
 func main() {
 	rulesFilePath := flag.String("rules-file-path", "./rules.yaml", "File path to write the rules file.")
+	shuffle := flag.Bool("shuffle", false, "Write the rule groups in a random order decided by -seed.")
+	seed := flag.Int64("seed", 0, "Seed for -shuffle. If 0, a time based seed is used. The seed used is logged and written in the rules file. "+
+		"Pass the same seed to alert_generator_compliance_tester to run the cases in the same order.")
+	fromRulesFile := flag.String("from-rules-file", "", "Optional path of a unit test file for \"promtool test rules\" to write the rules used by it instead of the built-in test cases, "+
+		"with the rulegroup label added. Pass the same flag to alert_generator_compliance_tester.")
+	invalidRulesFilePath := flag.String("invalid-rules-file-path", "", "Optional file path to also write a rules file that the alert generator must fail to load, "+
+		"with a malformed expr and an unparseable 'for'. See -check-rule-load-errors of alert_generator_compliance_tester.")
+	calibrationRulesFilePath := flag.String("calibration-rules-file-path", "", "Optional file path to also write a rules file with an always firing alert, "+
+		"to be loaded into the alert generator together with the rules file. See -calibrate of alert_generator_compliance_tester.")
 	flag.Parse()
 	log := promlog.New(&promlog.Config{})
 
+	cs := cases.AllCases
+	if *fromRulesFile != "" {
+		var err error
+		cs, err = cases.PromtoolTestCases(*fromRulesFile)
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to load the test cases from the promtool test file", "err", err)
+			os.Exit(1)
+		}
+	}
+	if *shuffle {
+		*seed = cases.PickSeed(*seed)
+		cs = cases.Shuffle(cs, *seed)
+		level.Info(log).Log("msg", "Shuffled the rule groups", "seed", *seed)
+	}
+
 	rgs := rulefmt.RuleGroups{
-		Groups: make([]rulefmt.RuleGroup, 0, len(cases.AllCases)),
+		Groups: make([]rulefmt.RuleGroup, 0, len(cs)),
 	}
-	for _, c := range cases.AllCases {
+	for _, c := range cs {
 		rg, err := c.RuleGroup()
 		if err != nil {
 			title, _ := c.Describe()
@@ -37,6 +63,10 @@ func main() {
 		level.Error(log).Log("msg", "Failed to marshal the rules", "err", err)
 		os.Exit(1)
 	}
+	if *shuffle {
+		// Record the seed to be able to reproduce the run.
+		b = append([]byte(fmt.Sprintf("# Rule groups shuffled with -seed=%d\n", *seed)), b...)
+	}
 
 	path, err := filepath.Abs(*rulesFilePath)
 	if err != nil {
@@ -51,4 +81,30 @@ func main() {
 	}
 
 	level.Info(log).Log("msg", "Rules file successfully generated", "path", path)
+
+	if *invalidRulesFilePath != "" {
+		path, err := filepath.Abs(*invalidRulesFilePath)
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to get absolute path for the invalid rules file", "path_from_flag", *invalidRulesFilePath, "err", err)
+			os.Exit(1)
+		}
+		if err := ioutil.WriteFile(path, []byte(testsuite.InvalidRules), fs.ModePerm); err != nil {
+			level.Error(log).Log("msg", "Failed to write the invalid rules file", "err", err)
+			os.Exit(1)
+		}
+		level.Info(log).Log("msg", "Invalid rules file successfully generated", "path", path)
+	}
+
+	if *calibrationRulesFilePath != "" {
+		path, err := filepath.Abs(*calibrationRulesFilePath)
+		if err != nil {
+			level.Error(log).Log("msg", "Failed to get absolute path for the calibration rules file", "path_from_flag", *calibrationRulesFilePath, "err", err)
+			os.Exit(1)
+		}
+		if err := ioutil.WriteFile(path, []byte(testsuite.CalibrationRules), fs.ModePerm); err != nil {
+			level.Error(log).Log("msg", "Failed to write the calibration rules file", "err", err)
+			os.Exit(1)
+		}
+		level.Info(log).Log("msg", "Calibration rules file successfully generated", "path", path)
+	}
 }
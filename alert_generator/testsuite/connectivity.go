@@ -0,0 +1,195 @@
+package testsuite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// connectivitySeriesName is the name of the series of the test write of the connectivity check. It is not
+// selected by the rules of the test cases.
+const connectivitySeriesName = "alert_generator_test_suite_connectivity"
+
+// endpointStatus is the result of checking the connectivity of a single endpoint.
+type endpointStatus struct {
+	endpoint string
+	url      string
+	err      error
+}
+
+// CheckConnectivity is a dry run that checks that the endpoints of the test suite are configured correctly before
+// a long test, and returns whether they all are with a table of the status of every endpoint:
+// * The remote write endpoint accepts a write of a single sample of a series that no test case selects.
+// * GET /api/v1/rules and GET /api/v1/alerts of the alert generator respond with the shape of Prometheus,
+//   decoded with the given APICompat.
+// * The PromQL endpoint answers a query, or a federation of ALERTS with MetricsSourceFederate.
+// * The alerts of the Alertmanager can be listed, if one is given.
+// * The port of the alert receiving server can be bound and its health served. Whether the alert generator can
+//   reach it is only known once it sends an alert, e.g. during -calibrate.
+// The errors of the endpoints tell what is likely misconfigured, e.g. the credentials for a 401 response.
+// An error is returned if the test suite cannot be created with the options.
+func CheckConnectivity(opts TestSuiteOptions) (yes bool, describe string, err error) {
+	// Nothing is received in a dry run.
+	opts.AlertTraceFile = ""
+	ts, err := NewTestSuite(opts)
+	if err != nil {
+		return false, "", err
+	}
+	statuses := ts.checkConnectivity()
+
+	yes = true
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENDPOINT\tURL\tSTATUS")
+	for _, s := range statuses {
+		status := "ok"
+		if s.err != nil {
+			status = "failed: " + describeConnectivityError(s.err)
+			yes = false
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.endpoint, s.url, status)
+	}
+	w.Flush()
+	return yes, buf.String(), nil
+}
+
+func (ts *TestSuite) checkConnectivity() []endpointStatus {
+	get := func(u string, parse func([]byte) error) error {
+		b, err := ts.client.Get(u)
+		if err != nil {
+			return err
+		}
+		if err := parse(b); err != nil {
+			return shapeError{err: err}
+		}
+		return nil
+	}
+
+	statuses := []endpointStatus{
+		{
+			endpoint: "remote write",
+			url:      ts.opts.RemoteWriteURL,
+			err: func() error {
+				req, err := buildWriteRequest([]prompb.TimeSeries{{
+					Labels:  []prompb.Label{{Name: labels.MetricName, Value: connectivitySeriesName}},
+					Samples: []prompb.Sample{{Timestamp: timestamp.FromTime(ts.clock.Now()), Value: 1}},
+				}}, nil)
+				if err != nil {
+					return err
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+				defer cancel()
+				_, err = ts.remoteWriter.store(ctx, req)
+				return err
+			}(),
+		},
+		{
+			endpoint: "rules API",
+			url:      ts.rulesAPIURL,
+			err: get(ts.rulesAPIURL, func(b []byte) error {
+				_, err := parseAndGroupRulesCompat(b, ts.opts.APICompat)
+				return err
+			}),
+		},
+		{
+			endpoint: "alerts API",
+			url:      ts.alertsAPIURL,
+			err: get(ts.alertsAPIURL, func(b []byte) error {
+				_, err := parseAndGroupAlertsCompat(b, ts.opts.APICompat)
+				return err
+			}),
+		},
+	}
+	if ts.opts.MetricsSource == MetricsSourceFederate {
+		_, err := ts.federateMetrics("ALERTS")
+		statuses = append(statuses, endpointStatus{endpoint: "federation", url: ts.opts.PromQLBaseURL, err: err})
+	} else {
+		_, err := ts.queryMetrics("vector(1)", timestamp.FromTime(ts.clock.Now()))
+		statuses = append(statuses, endpointStatus{endpoint: "PromQL", url: ts.opts.PromQLBaseURL, err: err})
+	}
+	if ts.ac != nil {
+		statuses = append(statuses, endpointStatus{
+			endpoint: "Alertmanager",
+			url:      ts.amAlertsURL,
+			err: get(ts.amAlertsURL, func(b []byte) error {
+				_, err := ParseAndGroupAlertmanagerAlerts(b)
+				return err
+			}),
+		})
+	}
+	return append(statuses, endpointStatus{
+		endpoint: "alert receiver",
+		url:      ts.as.server.Addr,
+		err:      ts.as.checkServable(),
+	})
+}
+
+// checkServable checks that the port of the alert receiving server can be bound, and that its health is
+// served on it.
+func (as *alertsServer) checkServable() error {
+	l, err := net.Listen("tcp", as.server.Addr)
+	if err != nil {
+		return errors.Wrap(err, "bind the port")
+	}
+	srv := &http.Server{Handler: as, ReadTimeout: as.server.ReadTimeout, WriteTimeout: as.server.WriteTimeout}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	client := &http.Client{Timeout: preflightTimeout}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d%s", l.Addr().(*net.TCPAddr).Port, receiverHealthPath))
+	if err != nil {
+		return errors.Wrap(err, "get the health of the alert receiver")
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected response code %d for the health of the alert receiver", resp.StatusCode)
+	}
+	return nil
+}
+
+// shapeError is the error of a response that does not decode as the response of the API.
+type shapeError struct {
+	err error
+}
+
+func (e shapeError) Error() string {
+	return "parse response: " + e.err.Error()
+}
+
+// describeConnectivityError returns the error with a hint of what is likely misconfigured.
+func describeConnectivityError(err error) string {
+	hint := ""
+	switch cause := errors.Cause(err).(type) {
+	case statusError:
+		switch cause.code {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			hint = "check the credentials, e.g. the Authorization header of the generator in -generators-file"
+		case http.StatusNotFound:
+			hint = "check the path of the URL"
+		}
+	case *url.Error:
+		hint = "check the host and the port of the URL"
+		if cause.Timeout() {
+			hint = "the endpoint did not respond in time, check that the URL is reachable from the test suite"
+		}
+	case *net.OpError:
+		if cause.Op == "listen" {
+			hint = "the port is used by another process or not allowed, pick another with -alert-server-port"
+		}
+	case shapeError:
+		hint = "the response does not have the shape of the API of Prometheus, check the path of the URL or try -api-compat=" + string(APICompatRelaxed)
+	}
+	if hint == "" {
+		return err.Error()
+	}
+	return fmt.Sprintf("%s (%s)", err.Error(), hint)
+}
@@ -0,0 +1,87 @@
+package testsuite
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestCheckConnectivity(t *testing.T) {
+	// The rules API needs the credentials, and the alerts API responds with a different shape without them.
+	var written []prompb.TimeSeries
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/write":
+			compressed, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			b, err := snappy.Decode(nil, compressed)
+			require.NoError(t, err)
+			var req prompb.WriteRequest
+			require.NoError(t, proto.Unmarshal(b, &req))
+			written = append(written, req.Timeseries...)
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/v1/rules":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":{"groups":[]}}`))
+		case "/api/v1/alerts":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				_, _ = w.Write([]byte(`{"status":"success","data":{"alerts":{}}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":{"alerts":[]}}`))
+		case "/api/v1/query":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	// The port of the alert receiving server is taken.
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	opts := TestSuiteOptions{
+		Logger:          log.NewNopLogger(),
+		Cases:           []cases.TestCase{cases.PendingAndFiringAndResolved()},
+		RemoteWriteURL:  srv.URL + "/api/v1/write",
+		BaseAPIURL:      srv.URL,
+		PromQLBaseURL:   srv.URL,
+		AlertServerPort: strconv.Itoa(l.Addr().(*net.TCPAddr).Port),
+	}
+	yes, describe, err := CheckConnectivity(opts)
+	require.NoError(t, err)
+	require.False(t, yes)
+	require.Regexp(t, `remote write +\S+/api/v1/write +ok\n`, describe)
+	require.Regexp(t, `rules API +\S+/api/v1/rules +failed: .*non 2xx response code 401: .*\(check the credentials`, describe)
+	require.Regexp(t, `alerts API +\S+/api/v1/alerts +failed: .*\(the response does not have the shape of the API of Prometheus`, describe)
+	require.Regexp(t, `PromQL +\S+ +ok\n`, describe)
+	require.Regexp(t, `alert receiver +:\d+ +failed: bind the port: .*\(the port is used by another process`, describe)
+
+	// Only the series of the connectivity check is written.
+	require.Len(t, written, 1)
+	require.Equal(t, []prompb.Label{{Name: "__name__", Value: connectivitySeriesName}}, written[0].Labels)
+
+	// All good with the credentials and a free port.
+	opts.HTTPHeaders = map[string]string{"Authorization": "Bearer secret"}
+	opts.AlertServerPort = "0"
+	yes, describe, err = CheckConnectivity(opts)
+	require.NoError(t, err)
+	require.True(t, yes, describe)
+	require.NotContains(t, describe, "failed")
+}
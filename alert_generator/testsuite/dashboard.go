@@ -0,0 +1,235 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// The metrics of the results of the test suite that the Grafana dashboard charts, written by WriteResultsTextfile.
+// Both have a generator label with the name of the alert generator, which is empty without one.
+const (
+	// caseResultMetric is 1 if the test case passed and 0 if it failed, with the group name of the test case
+	// in the rulegroup label.
+	caseResultMetric = "compliance_case_result"
+	// scoreMetric is the Score.Percentage of the run.
+	scoreMetric = "compliance_score"
+)
+
+const (
+	dashboardWidth       = 24 // The width of the grid of a Grafana dashboard.
+	dashboardCasePanelsW = 8
+	dashboardCasePanelsH = 6
+	// dashboardPassRateRange is the range over which the pass rate of a test case is charted.
+	dashboardPassRateRange = "1d"
+)
+
+type dashboard struct {
+	Title         string             `json:"title"`
+	UID           string             `json:"uid"`
+	Description   string             `json:"description"`
+	Tags          []string           `json:"tags"`
+	Editable      bool               `json:"editable"`
+	SchemaVersion int                `json:"schemaVersion"`
+	Time          dashboardTime      `json:"time"`
+	Templating    dashboardTemplates `json:"templating"`
+	Panels        []dashboardPanel   `json:"panels"`
+}
+
+type dashboardTime struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type dashboardTemplates struct {
+	List []dashboardVariable `json:"list"`
+}
+
+type dashboardVariable struct {
+	Name       string `json:"name"`
+	Label      string `json:"label"`
+	Type       string `json:"type"`
+	Query      string `json:"query"`
+	Datasource string `json:"datasource,omitempty"`
+	Refresh    int    `json:"refresh,omitempty"`
+	Multi      bool   `json:"multi,omitempty"`
+	IncludeAll bool   `json:"includeAll,omitempty"`
+	AllValue   string `json:"allValue,omitempty"`
+}
+
+type dashboardPanel struct {
+	ID          int                   `json:"id"`
+	Type        string                `json:"type"`
+	Title       string                `json:"title"`
+	Description string                `json:"description,omitempty"`
+	Datasource  string                `json:"datasource,omitempty"`
+	GridPos     dashboardGridPos      `json:"gridPos"`
+	FieldConfig *dashboardFieldConfig `json:"fieldConfig,omitempty"`
+	Targets     []dashboardTarget     `json:"targets,omitempty"`
+}
+
+type dashboardGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type dashboardFieldConfig struct {
+	Defaults struct {
+		Unit string  `json:"unit"`
+		Min  float64 `json:"min"`
+		Max  float64 `json:"max"`
+	} `json:"defaults"`
+}
+
+type dashboardTarget struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+	Instant      bool   `json:"instant,omitempty"`
+}
+
+// GrafanaDashboard returns the JSON of a Grafana dashboard that charts the compliance score and the pass rate of
+// each of the given test cases over the runs of the test suite, from the compliance_score and compliance_case_result
+// series written by WriteResultsTextfile. The Prometheus data source and the alert generators are variables of the dashboard, so that it can be
+// imported as it is.
+func GrafanaDashboard(cs []cases.TestCase) ([]byte, error) {
+	const (
+		datasource = "${datasource}"
+		generators = `generator=~"$generator"`
+	)
+	fieldConfig := func(unit string, max float64) *dashboardFieldConfig {
+		fc := &dashboardFieldConfig{}
+		fc.Defaults.Unit = unit
+		fc.Defaults.Max = max
+		return fc
+	}
+
+	d := dashboard{
+		Title:         "Alert generator compliance",
+		UID:           "alert-generator-compliance",
+		Description:   "Results of the alert generator compliance test suite over its runs.",
+		Tags:          []string{"compliance"},
+		Editable:      true,
+		SchemaVersion: 30,
+		Time:          dashboardTime{From: "now-30d", To: "now"},
+		Templating: dashboardTemplates{List: []dashboardVariable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+			{
+				Name:       "generator",
+				Label:      "Alert generator",
+				Type:       "query",
+				Query:      fmt.Sprintf("label_values(%s, generator)", caseResultMetric),
+				Datasource: datasource,
+				Refresh:    2, // On time range change.
+				Multi:      true,
+				IncludeAll: true,
+				AllValue:   ".*", // Also matches the runs without a generator name.
+			},
+		}},
+	}
+
+	y := 0
+	addPanel := func(p dashboardPanel) {
+		p.ID = len(d.Panels) + 1
+		if p.Type != "row" {
+			p.Datasource = datasource
+		}
+		d.Panels = append(d.Panels, p)
+	}
+	addPanel(dashboardPanel{
+		Type:        "timeseries",
+		Title:       "Compliance score",
+		Description: "The percentage of the total weight of the test cases that passed in a run.",
+		GridPos:     dashboardGridPos{H: 8, W: dashboardWidth, Y: y},
+		FieldConfig: fieldConfig("percent", 100),
+		Targets: []dashboardTarget{{
+			RefID:        "A",
+			Expr:         fmt.Sprintf("%s{%s}", scoreMetric, generators),
+			LegendFormat: "{{generator}}",
+		}},
+	})
+	y += 8
+
+	summaryH := len(cs)/2 + 2
+	if summaryH < 8 {
+		summaryH = 8
+	}
+	addPanel(dashboardPanel{
+		Type:        "bargauge",
+		Title:       "Pass rate per test case",
+		Description: "The fraction of the runs in the time range of the dashboard in which the test case passed.",
+		GridPos:     dashboardGridPos{H: summaryH, W: dashboardWidth, Y: y},
+		FieldConfig: fieldConfig("percentunit", 1),
+		Targets: []dashboardTarget{{
+			RefID:        "A",
+			Expr:         fmt.Sprintf("avg by (rulegroup) (avg_over_time(%s{%s}[$__range]))", caseResultMetric, generators),
+			LegendFormat: "{{rulegroup}}",
+			Instant:      true,
+		}},
+	})
+	y += summaryH
+
+	addPanel(dashboardPanel{
+		Type:    "row",
+		Title:   "Test cases",
+		GridPos: dashboardGridPos{H: 1, W: dashboardWidth, Y: y},
+	})
+	y++
+
+	for i, c := range cs {
+		groupName, description := c.Describe()
+		addPanel(dashboardPanel{
+			Type:        "timeseries",
+			Title:       groupName,
+			Description: description,
+			GridPos: dashboardGridPos{
+				H: dashboardCasePanelsH,
+				W: dashboardCasePanelsW,
+				X: (i * dashboardCasePanelsW) % dashboardWidth,
+				Y: y + (i*dashboardCasePanelsW)/dashboardWidth*dashboardCasePanelsH,
+			},
+			FieldConfig: fieldConfig("percentunit", 1),
+			Targets: []dashboardTarget{{
+				RefID: "A",
+				Expr: fmt.Sprintf("avg_over_time(%s{rulegroup=%q, %s}[%s])",
+					caseResultMetric, groupName, generators, dashboardPassRateRange),
+				LegendFormat: "{{generator}}",
+			}},
+		})
+	}
+
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// WriteResultsTextfile writes the result of every test case of the score and the score itself to the given path
+// as the caseResultMetric and scoreMetric series in the Prometheus text format, e.g. into the directory of the
+// textfile collector of the node exporter, so that the runs can be charted by the dashboard of GrafanaDashboard.
+// The file is replaced atomically.
+func WriteResultsTextfile(path string, s Score, generator string) error {
+	reg := prometheus.NewRegistry()
+	caseResult := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: caseResultMetric,
+		Help: "1 if the test case passed in the last run of the alert generator compliance test suite, 0 if it failed.",
+	}, []string{"rulegroup", "generator"})
+	score := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: scoreMetric,
+		Help: "The compliance score of the last run of the alert generator compliance test suite, from 0 to 100.",
+	}, []string{"generator"})
+	reg.MustRegister(caseResult, score)
+
+	for _, c := range s.Cases {
+		v := 0.0
+		if c.Passed {
+			v = 1
+		}
+		caseResult.WithLabelValues(c.GroupName, generator).Set(v)
+	}
+	score.WithLabelValues(generator).Set(s.Percentage)
+
+	return prometheus.WriteToTextfile(path, reg)
+}
@@ -0,0 +1,83 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestGrafanaDashboard(t *testing.T) {
+	cs := []cases.TestCase{cases.PendingAndFiringAndResolved(), cases.ZeroFor_SmallFor(), cases.NeverResolves(), cases.WideLabels()}
+	b, err := GrafanaDashboard(cs)
+	require.NoError(t, err)
+
+	var d dashboard
+	require.NoError(t, json.Unmarshal(b, &d))
+	require.Equal(t, []string{"datasource", "generator"}, []string{d.Templating.List[0].Name, d.Templating.List[1].Name})
+	require.Equal(t, "prometheus", d.Templating.List[0].Query)
+
+	// The score, the pass rate of all the test cases, a row and a panel per test case.
+	require.Len(t, d.Panels, 3+len(cs))
+	ids := make(map[int]bool)
+	for _, p := range d.Panels {
+		require.False(t, ids[p.ID], "duplicate panel id %d", p.ID)
+		ids[p.ID] = true
+		if p.Type != "row" {
+			require.Equal(t, "${datasource}", p.Datasource, p.Title)
+		}
+		require.LessOrEqual(t, p.GridPos.X+p.GridPos.W, dashboardWidth, p.Title)
+	}
+	require.Equal(t, `compliance_score{generator=~"$generator"}`, d.Panels[0].Targets[0].Expr)
+
+	for i, c := range cs {
+		groupName, _ := c.Describe()
+		p := d.Panels[3+i]
+		require.Equal(t, groupName, p.Title)
+		require.Equal(t, `avg_over_time(compliance_case_result{rulegroup="`+groupName+`", generator=~"$generator"}[1d])`, p.Targets[0].Expr)
+	}
+	// Three test cases per line.
+	require.Equal(t, dashboardGridPos{H: 6, W: 8, X: 0, Y: d.Panels[3].GridPos.Y + 6}, d.Panels[6].GridPos)
+}
+
+func TestWriteResultsTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "compliance.prom")
+	require.NoError(t, WriteResultsTextfile(path, Score{
+		Percentage: 75,
+		Cases: []CaseScore{
+			{GroupName: "PendingAndFiringAndResolved", Weight: 3, Passed: true},
+			{GroupName: "TopKChurn", Weight: 1, FailedChecks: []string{"rules_api"}},
+		},
+	}, "prometheus"))
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	series := make(map[string]float64)
+	p := textparse.NewPromParser(b)
+	for {
+		et, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if et != textparse.EntrySeries {
+			continue
+		}
+		_, _, v := p.Series()
+		var lset labels.Labels
+		p.Metric(&lset)
+		series[lset.String()] = v
+	}
+	require.Equal(t, map[string]float64{
+		`{__name__="compliance_case_result", generator="prometheus", rulegroup="PendingAndFiringAndResolved"}`: 1,
+		`{__name__="compliance_case_result", generator="prometheus", rulegroup="TopKChurn"}`:                   0,
+		`{__name__="compliance_score", generator="prometheus"}`:                                                75,
+	}, series)
+}
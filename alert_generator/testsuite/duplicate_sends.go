@@ -0,0 +1,50 @@
+package testsuite
+
+import (
+	"time"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+	"github.com/prometheus/prometheus/notifier"
+)
+
+// duplicateSendWindow is the window within which an alert received again with the same labels, StartsAt
+// and EndsAt is a duplicate send. The resends of an alert are at least cases.ResendDelay apart, and the EndsAt
+// of a firing alert changes with every evaluation, hence the same alert within this window was sent twice.
+const duplicateSendWindow = cases.ResendDelay / 2
+
+type sentAlert struct {
+	t                time.Time
+	startsAt, endsAt time.Time
+}
+
+type duplicateErr struct {
+	t, prevT time.Time
+	alert    notifier.Alert
+}
+
+// detectDuplicateSends records the alerts that were received again within duplicateSendWindow with the
+// same labels, StartsAt and EndsAt as duplicate sends of their rule group.
+// It must be called with expectedAlertsMtx held.
+func (as *alertsServer) detectDuplicateSends(now time.Time, alerts []notifier.Alert) {
+	if !as.detectDuplicates {
+		return
+	}
+
+	for _, al := range alerts {
+		if as.ignoredGroups[al.Labels.Get("rulegroup")] {
+			continue
+		}
+		id := al.Labels.String()
+		prev, ok := as.lastSent[id]
+		if ok && now.Sub(prev.t) < duplicateSendWindow && prev.startsAt.Equal(al.StartsAt) && prev.endsAt.Equal(al.EndsAt) &&
+			as.inAssertWindow(al.Labels.Get("rulegroup"), now) {
+			errs := as.getErr(al.Labels.Get("rulegroup"))
+			errs.duplicateSends = append(errs.duplicateSends, duplicateErr{
+				t:     now,
+				prevT: prev.t,
+				alert: al,
+			})
+		}
+		as.lastSent[id] = sentAlert{t: now, startsAt: al.StartsAt, endsAt: al.EndsAt}
+	}
+}
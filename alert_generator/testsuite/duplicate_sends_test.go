@@ -0,0 +1,57 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestAlertsServerDuplicateSends(t *testing.T) {
+	now := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	firing := func(name string, ts time.Time) notifier.Alert {
+		return notifier.Alert{
+			Labels:   labels.FromStrings("alertname", name, "rulegroup", "G"),
+			StartsAt: now,
+			EndsAt:   ts.Add(4 * cases.ResendDelay),
+		}
+	}
+	resolved := notifier.Alert{
+		Labels:   labels.FromStrings("alertname", "R", "rulegroup", "G"),
+		StartsAt: now,
+		EndsAt:   now.Add(time.Minute),
+	}
+
+	for _, detect := range []bool{false, true} {
+		as := newAlertsServer("", log.NewNopLogger())
+		as.detectDuplicates = detect
+
+		// Sent twice within the same evaluation.
+		as.processAlerts(now, []notifier.Alert{firing("A", now), firing("B", now)})
+		as.processAlerts(now.Add(time.Second), []notifier.Alert{firing("A", now)})
+		// The resends after the resend delay are not duplicates, even with the same StartsAt and EndsAt.
+		as.processAlerts(now.Add(cases.ResendDelay), []notifier.Alert{firing("B", now.Add(cases.ResendDelay)), resolved})
+		as.processAlerts(now.Add(2*cases.ResendDelay), []notifier.Alert{resolved, firing("B", now.Add(2*cases.ResendDelay))})
+		// A different EndsAt within the window is a new evaluation and not a duplicate.
+		as.processAlerts(now.Add(2*cases.ResendDelay+time.Second), []notifier.Alert{firing("B", now.Add(2*cases.ResendDelay+time.Second))})
+
+		errs := as.getErr("G")
+		if !detect {
+			require.Len(t, errs.duplicateSends, 0)
+			continue
+		}
+		require.Len(t, errs.duplicateSends, 1)
+		require.Equal(t, "A", errs.duplicateSends[0].alert.Labels.Get("alertname"))
+		require.Equal(t, now, errs.duplicateSends[0].prevT)
+		require.Equal(t, now.Add(time.Second), errs.duplicateSends[0].t)
+		require.True(t, as.groupsFacingErrors()["G"])
+
+		describe := describeAlertReceptionErrors(as.groupsFacingErrors(), as.groupError())
+		require.Contains(t, describe, "Reason: Alerts sent more than once within a resend cycle")
+	}
+}
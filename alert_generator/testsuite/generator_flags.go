@@ -0,0 +1,122 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+const (
+	lookbackDeltaFlag = "query.lookback-delta"
+	maxSamplesFlag    = "query.max-samples"
+	queryTimeoutFlag  = "query.timeout"
+
+	// defaultQueryTimeout is the default of Prometheus assumed by the test cases.
+	defaultQueryTimeout = 2 * time.Minute
+)
+
+// generatorFlags are the query engine flags of the alert generator that affect the rule evaluation.
+type generatorFlags struct {
+	lookbackDelta time.Duration
+	maxSamples    int64
+	queryTimeout  time.Duration
+}
+
+func defaultGeneratorFlags() generatorFlags {
+	return generatorFlags{
+		lookbackDelta: cases.DefaultLookbackDelta,
+		maxSamples:    cases.DefaultMaxSamples,
+		queryTimeout:  defaultQueryTimeout,
+	}
+}
+
+// parseGeneratorFlags parses the response of GET /api/v1/status/flags. The flags that are not present keep the default.
+func parseGeneratorFlags(b []byte) (generatorFlags, error) {
+	f := defaultGeneratorFlags()
+	res := struct {
+		Status string            `json:"status"`
+		Data   map[string]string `json:"data"`
+	}{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return f, err
+	}
+	if res.Status != "success" {
+		return f, errors.Errorf("expected the status to be success, got %q", res.Status)
+	}
+
+	if v, ok := res.Data[lookbackDeltaFlag]; ok {
+		d, err := model.ParseDuration(v)
+		if err != nil {
+			return f, errors.Wrapf(err, "parse %s", lookbackDeltaFlag)
+		}
+		if d <= 0 {
+			return f, errors.Errorf("non positive %s %s", lookbackDeltaFlag, v)
+		}
+		f.lookbackDelta = time.Duration(d)
+	}
+	if v, ok := res.Data[maxSamplesFlag]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, errors.Wrapf(err, "parse %s", maxSamplesFlag)
+		}
+		f.maxSamples = n
+	}
+	if v, ok := res.Data[queryTimeoutFlag]; ok {
+		d, err := model.ParseDuration(v)
+		if err != nil {
+			return f, errors.Wrapf(err, "parse %s", queryTimeoutFlag)
+		}
+		f.queryTimeout = time.Duration(d)
+	}
+	return f, nil
+}
+
+// readGeneratorFlags fetches the query engine flags of the alert generator. The defaults are used
+// if they cannot be fetched, e.g. when the alert generator does not serve the flags API.
+func (ts *TestSuite) readGeneratorFlags() generatorFlags {
+	b, err := ts.client.Get(ts.flagsAPIURL)
+	if err != nil {
+		level.Warn(ts.logger).Log("msg", "Error in fetching the flags of the alert generator, assuming the defaults", "url", ts.flagsAPIURL, "err", err)
+		return defaultGeneratorFlags()
+	}
+	f, err := parseGeneratorFlags(b)
+	if err != nil {
+		level.Warn(ts.logger).Log("msg", "Error in parsing the flags of the alert generator, assuming the defaults", "url", ts.flagsAPIURL, "err", err)
+		return defaultGeneratorFlags()
+	}
+	return f
+}
+
+// applyGeneratorFlags adjusts the expectations of the test cases to the query engine flags of the alert generator,
+// and warns about the flags that the test cases assume to be the default.
+func (ts *TestSuite) applyGeneratorFlags(f generatorFlags) {
+	level.Info(ts.logger).Log("msg", "Query engine flags of the alert generator", "lookback_delta", f.lookbackDelta, "max_samples", f.maxSamples, "query_timeout", f.queryTimeout)
+	if f.lookbackDelta != cases.DefaultLookbackDelta {
+		for _, gn := range ts.caseOrder {
+			if ld, ok := ts.ruleGroupTests[gn].(cases.LookbackDependent); ok {
+				ld.SetLookbackDelta(f.lookbackDelta)
+				level.Info(ts.logger).Log("msg", "Adjusted the expectations of a rule group to the lookback delta", "rulegroup", gn, "lookback_delta", f.lookbackDelta)
+			}
+		}
+	}
+	if f.maxSamples != cases.DefaultMaxSamples {
+		for _, gn := range ts.caseOrder {
+			if ms, ok := ts.ruleGroupTests[gn].(cases.MaxSamplesDependent); ok {
+				ms.SetMaxSamples(f.maxSamples)
+				level.Info(ts.logger).Log("msg", "Adjusted the expectations of a rule group to the max samples", "rulegroup", gn, "max_samples", f.maxSamples)
+			}
+		}
+	}
+	if f.maxSamples < cases.DefaultMaxSamples {
+		level.Warn(ts.logger).Log("msg", "The other test cases assume the default max samples of a query, the alert generator has fewer", "flag", maxSamplesFlag, "default", cases.DefaultMaxSamples, "got", f.maxSamples)
+	}
+	if f.queryTimeout < defaultQueryTimeout {
+		level.Warn(ts.logger).Log("msg", "The test cases assume the default query timeout, the alert generator has a shorter one", "flag", queryTimeoutFlag, "default", defaultQueryTimeout, "got", f.queryTimeout)
+	}
+}
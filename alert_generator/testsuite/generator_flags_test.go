@@ -0,0 +1,69 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestParseGeneratorFlags(t *testing.T) {
+	f, err := parseGeneratorFlags([]byte(`{"status":"success","data":{
+		"query.lookback-delta":"1m","query.max-samples":"1000","query.timeout":"30s","rules.alert.resend-delay":"1m"
+	}}`))
+	require.NoError(t, err)
+	require.Equal(t, generatorFlags{lookbackDelta: time.Minute, maxSamples: 1000, queryTimeout: 30 * time.Second}, f)
+
+	// The flags not present keep the defaults.
+	f, err = parseGeneratorFlags([]byte(`{"status":"success","data":{"query.lookback-delta":"10m"}}`))
+	require.NoError(t, err)
+	require.Equal(t, generatorFlags{lookbackDelta: 10 * time.Minute, maxSamples: cases.DefaultMaxSamples, queryTimeout: defaultQueryTimeout}, f)
+
+	_, err = parseGeneratorFlags([]byte(`{"status":"success","data":{"query.lookback-delta":"0s"}}`))
+	require.Error(t, err)
+	_, err = parseGeneratorFlags([]byte(`{"status":"success","data":{"query.max-samples":"many"}}`))
+	require.Error(t, err)
+	_, err = parseGeneratorFlags([]byte(`{"status":"error"}`))
+	require.Error(t, err)
+}
+
+func TestApplyGeneratorFlags(t *testing.T) {
+	zeroTime := timestamp.FromTime(time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC))
+	for _, lookbackDelta := range []time.Duration{time.Minute, cases.DefaultLookbackDelta, 10 * time.Minute} {
+		t.Run(lookbackDelta.String(), func(t *testing.T) {
+			ts := &TestSuite{
+				logger:         log.NewNopLogger(),
+				ruleGroupTests: make(map[string]cases.TestCase),
+			}
+			testUntils := make(map[string]int64)
+			for _, c := range []cases.TestCase{cases.NeverResolves(), cases.RecordingRuleStaleness(), cases.LabelJoin()} {
+				gn, _ := c.Describe()
+				ts.caseOrder = append(ts.caseOrder, gn)
+				ts.ruleGroupTests[gn] = c
+				c.SamplesToRemoteWrite()
+				c.Init(zeroTime)
+				testUntils[gn] = c.TestUntil()
+			}
+
+			f := defaultGeneratorFlags()
+			f.lookbackDelta = lookbackDelta
+			ts.applyGeneratorFlags(f)
+
+			for _, gn := range ts.caseOrder {
+				c := ts.ruleGroupTests[gn]
+				require.NoError(t, cases.ValidateExpectedAlerts(c, zeroTime), gn)
+				diff := time.Duration(c.TestUntil()-testUntils[gn]) * time.Millisecond
+				if gn == "RecordingRuleStaleness" {
+					// The resolution is after the lookback, hence the test is longer or shorter with it.
+					require.Equal(t, lookbackDelta-cases.DefaultLookbackDelta, diff)
+					continue
+				}
+				require.Equal(t, time.Duration(0), diff, gn)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package testsuite
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// GeneratorConfig is an alert generator to run the test suite against, when testing several of them one after
+// the other. See LoadGenerators.
+type GeneratorConfig struct {
+	// Name identifies the alert generator in the reports. It can only have letters, digits, '_' and '-'
+	// since it is also used in the names of the files written per alert generator.
+	Name            string `yaml:"name"`
+	RemoteWriteURL  string `yaml:"remote_write_url"`
+	APIBaseURL      string `yaml:"api_base_url"`
+	PromQLBaseURL   string `yaml:"promql_base_url"`
+	AlertmanagerURL string `yaml:"alertmanager_url,omitempty"`
+	// ExternalURL is the external URL that the alert generator is configured with, if it differs from the
+	// TestSuiteOptions.ExpectedExternalURL.
+	ExternalURL string `yaml:"external_url,omitempty"`
+	// APICompat is how strictly the responses of the APIs of the alert generator are decoded, if it differs from
+	// the TestSuiteOptions.APICompat.
+	APICompat APICompat `yaml:"api_compat,omitempty"`
+	// CleanupURL is the endpoint of the alert generator that resets its state. See TestSuiteOptions.CleanupURL.
+	CleanupURL string `yaml:"cleanup_url,omitempty"`
+	// Headers are set in all the requests to the alert generator, e.g. for the authentication.
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+var generatorNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Options returns the given options of the test suite with the name, the endpoints, the headers,
+// the external URL and the API compat of the alert generator.
+func (g GeneratorConfig) Options(opts TestSuiteOptions) TestSuiteOptions {
+	opts.GeneratorName = g.Name
+	opts.RemoteWriteURL = g.RemoteWriteURL
+	opts.BaseAPIURL = g.APIBaseURL
+	opts.PromQLBaseURL = g.PromQLBaseURL
+	opts.AlertmanagerURL = g.AlertmanagerURL
+	opts.CleanupURL = g.CleanupURL
+	opts.HTTPHeaders = g.Headers
+	if g.ExternalURL != "" {
+		opts.ExpectedExternalURL = g.ExternalURL
+	}
+	if g.APICompat != "" {
+		opts.APICompat = g.APICompat
+	}
+	return opts
+}
+
+// LoadGenerators reads the alert generators to run the test suite against from a YAML file. For example:
+//   generators:
+//     - name: prometheus
+//       remote_write_url: http://localhost:9090/api/v1/write
+//       api_base_url: http://localhost:9090
+//       promql_base_url: http://localhost:9090
+//     - name: mimir
+//       remote_write_url: http://localhost:9009/api/v1/push
+//       api_base_url: http://localhost:9009/prometheus
+//       promql_base_url: http://localhost:9009/prometheus
+//       headers:
+//         X-Scope-OrgID: compliance
+func LoadGenerators(path string) ([]GeneratorConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Generators []GeneratorConfig `yaml:"generators"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, errors.Wrap(err, "unmarshal generators")
+	}
+	if len(cfg.Generators) == 0 {
+		return nil, errors.New("no generators found")
+	}
+
+	seen := make(map[string]bool, len(cfg.Generators))
+	for _, g := range cfg.Generators {
+		if !generatorNameRe.MatchString(g.Name) {
+			return nil, errors.Errorf("invalid generator name %q, must match %s", g.Name, generatorNameRe)
+		}
+		if seen[g.Name] {
+			return nil, errors.Errorf("generator name cannot repeat, %q has been used more than once", g.Name)
+		}
+		seen[g.Name] = true
+		if g.RemoteWriteURL == "" || g.APIBaseURL == "" || g.PromQLBaseURL == "" {
+			return nil, errors.Errorf("generator %q needs remote_write_url, api_base_url and promql_base_url", g.Name)
+		}
+		if err := validateAPICompat(g.APICompat); err != nil {
+			return nil, errors.Wrapf(err, "generator %q", g.Name)
+		}
+	}
+	return cfg.Generators, nil
+}
+
+// GeneratorResult is the result of the test suite run against an alert generator.
+type GeneratorResult struct {
+	Name   string
+	Passed bool
+	Score  Score
+}
+
+// CompareGenerators returns a matrix of the results of the test cases per alert generator, with the test cases
+// as the rows in the order they first appear in the results and the alert generators as the columns.
+// A failed test case shows its failed checks.
+func CompareGenerators(results []GeneratorResult) string {
+	var (
+		groupNames []string
+		byGen      = make([]map[string]CaseScore, len(results))
+	)
+	seen := make(map[string]bool)
+	for i, r := range results {
+		byGen[i] = make(map[string]CaseScore, len(r.Score.Cases))
+		for _, c := range r.Score.Cases {
+			byGen[i][c.GroupName] = c
+			if !seen[c.GroupName] {
+				seen[c.GroupName] = true
+				groupNames = append(groupNames, c.GroupName)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	header := "Test case"
+	for _, r := range results {
+		header += "\t" + r.Name
+	}
+	fmt.Fprintln(w, header)
+	for _, gn := range groupNames {
+		row := gn
+		for i := range results {
+			c, ok := byGen[i][gn]
+			switch {
+			case !ok:
+				row += "\t-"
+			case c.Passed:
+				row += "\tpass"
+			default:
+				row += "\tFAIL (" + strings.Join(c.FailedChecks, ", ") + ")"
+			}
+		}
+		fmt.Fprintln(w, row)
+	}
+	row := "Score"
+	for _, r := range results {
+		row += fmt.Sprintf("\t%.2f%%", r.Score.Percentage)
+	}
+	fmt.Fprintln(w, row)
+	row = "Result"
+	for _, r := range results {
+		if r.Passed {
+			row += "\tpass"
+		} else {
+			row += "\tFAIL"
+		}
+	}
+	fmt.Fprintln(w, row)
+	_ = w.Flush()
+
+	return "------------------------------------------\n" +
+		fmt.Sprintf("Comparison of the %d alert generators:\n", len(results)) +
+		buf.String()
+}
@@ -0,0 +1,106 @@
+package testsuite
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadGenerators(t *testing.T) {
+	load := func(content string) ([]GeneratorConfig, error) {
+		path := filepath.Join(t.TempDir(), "generators.yaml")
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0o644))
+		return LoadGenerators(path)
+	}
+
+	gs, err := load(`generators:
+  - name: prometheus
+    remote_write_url: http://localhost:9090/api/v1/write
+    api_base_url: http://localhost:9090
+    promql_base_url: http://localhost:9090
+  - name: mimir
+    remote_write_url: http://localhost:9009/api/v1/push
+    api_base_url: http://localhost:9009/prometheus
+    promql_base_url: http://localhost:9009/prometheus
+    alertmanager_url: http://localhost:9093
+    cleanup_url: http://localhost:9009/reset
+    external_url: http://mimir.example/prometheus
+    api_compat: relaxed
+    headers:
+      X-Scope-OrgID: compliance
+`)
+	require.NoError(t, err)
+	require.Len(t, gs, 2)
+
+	opts := gs[1].Options(TestSuiteOptions{BaseAPIURL: "http://other:9090", Shuffle: true})
+	require.Equal(t, TestSuiteOptions{
+		GeneratorName:       "mimir",
+		RemoteWriteURL:      "http://localhost:9009/api/v1/push",
+		BaseAPIURL:          "http://localhost:9009/prometheus",
+		PromQLBaseURL:       "http://localhost:9009/prometheus",
+		AlertmanagerURL:     "http://localhost:9093",
+		CleanupURL:          "http://localhost:9009/reset",
+		ExpectedExternalURL: "http://mimir.example/prometheus",
+		APICompat:           APICompatRelaxed,
+		HTTPHeaders:         map[string]string{"X-Scope-OrgID": "compliance"},
+		Shuffle:             true,
+	}, opts)
+
+	for _, c := range []struct {
+		content, err string
+	}{
+		{
+			content: "generators: []\n",
+			err:     "no generators found",
+		},
+		{
+			content: "generators:\n  - name: a/b\n",
+			err:     `invalid generator name "a/b", must match ^[a-zA-Z0-9_-]+$`,
+		},
+		{
+			content: "generators:\n  - name: a\n    api_base_url: http://localhost:9090\n",
+			err:     `generator "a" needs remote_write_url, api_base_url and promql_base_url`,
+		},
+		{
+			content: "generators:\n  - name: a\n    remote_write_url: x\n    api_base_url: x\n    promql_base_url: x\n    api_compat: loose\n",
+			err:     `generator "a": unknown API compat "loose", must be one of "strict" and "relaxed"`,
+		},
+		{
+			content: "generators:\n  - name: a\n    remote_write_url: x\n    api_base_url: x\n    promql_base_url: x\n  - name: a\n",
+			err:     `generator name cannot repeat, "a" has been used more than once`,
+		},
+	} {
+		_, err := load(c.content)
+		require.EqualError(t, err, c.err)
+	}
+	_, err = load("generators:\n  - name: a\n    api_url: http://localhost:9090\n")
+	require.Error(t, err)
+}
+
+func TestCompareGenerators(t *testing.T) {
+	results := []GeneratorResult{
+		{Name: "prometheus", Passed: true, Score: Score{Percentage: 100, Cases: []CaseScore{
+			{GroupName: "PendingAndFiringAndResolved", Passed: true},
+			{GroupName: "TemplateFunctions", Passed: true},
+		}}},
+		{Name: "custom", Score: Score{Percentage: 25, Cases: []CaseScore{
+			{GroupName: "PendingAndFiringAndResolved", Passed: true},
+			{GroupName: "TemplateFunctions", FailedChecks: []string{"alert_reception", "alerts_api"}},
+			{GroupName: "TopKChurn", FailedChecks: []string{"preflight"}},
+		}}},
+		// Failed to run.
+		{Name: "broken"},
+	}
+
+	require.Equal(t, `------------------------------------------
+Comparison of the 3 alert generators:
+Test case                    prometheus  custom                              broken
+PendingAndFiringAndResolved  pass        pass                                -
+TemplateFunctions            pass        FAIL (alert_reception, alerts_api)  -
+TopKChurn                    -           FAIL (preflight)                    -
+Score                        100.00%     25.00%                              0.00%
+Result                       pass        FAIL                                FAIL
+`, CompareGenerators(results))
+}
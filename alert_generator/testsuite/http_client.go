@@ -0,0 +1,279 @@
+package testsuite
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+)
+
+// Version is the version of the test suite. It is meant to be set during build time via -ldflags.
+var Version = "dev"
+
+// DefaultUserAgent is the User-Agent used in all the requests made by the test suite
+// if none is configured.
+var DefaultUserAgent = "prometheus-alert-compliance/" + Version
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// requestAttemptHeader is set on the retries of a request to tell them apart from the first attempt.
+	requestAttemptHeader = "X-Request-Attempt"
+
+	// maxRetries is the number of times a failed request is retried.
+	maxRetries = 2
+	// retryBackoff is the time to wait before retrying a failed request.
+	retryBackoff = 200 * time.Millisecond
+
+	// DefaultMaxIdleConnsPerHost is the default of HTTPClientOptions.MaxIdleConnsPerHost. The remote write
+	// and the checks of all the APIs run concurrently against the same hosts, which is more than the
+	// 2 idle connections per host kept by Go by default, causing new connections all the time.
+	DefaultMaxIdleConnsPerHost = 32
+	// DefaultHTTPTimeout is the default of HTTPClientOptions.Timeout.
+	DefaultHTTPTimeout = 10 * time.Second
+)
+
+type HTTPClientOptions struct {
+	// UserAgent is the User-Agent header set in all the requests. DefaultUserAgent is used if empty.
+	UserAgent string
+	// RequestIDs when true attaches a unique X-Request-ID header to every request, which is also
+	// logged with the request. The same ID is used on the retries of a request, which are marked
+	// with the X-Request-Attempt header and logged with the attempt number.
+	RequestIDs bool
+	// MaxIdleConnsPerHost is the max number of idle keep-alive connections kept per host to be reused.
+	// DefaultMaxIdleConnsPerHost is used if 0.
+	MaxIdleConnsPerHost int
+	// Timeout is the max time of a single attempt of a request, and of all the attempts for Get().
+	// DefaultHTTPTimeout is used if 0.
+	Timeout time.Duration
+	// ForceHTTP2 when true makes all the requests over HTTP/2 without falling back to HTTP/1.1, i.e. h2 for https
+	// and h2c with prior knowledge for http URLs. Otherwise HTTP/2 is only used when negotiated over TLS.
+	// MaxIdleConnsPerHost does not apply to HTTP/2, where the requests share a connection per host.
+	ForceHTTP2 bool
+	// Headers are the additional headers set in all the requests, e.g. Authorization or X-Scope-OrgID
+	// for a multi-tenant alert generator. The headers set by the test suite take precedence.
+	Headers map[string]string
+}
+
+// HTTPClient is used for all the requests that the test suite makes to the alert generator,
+// the remote write endpoint and the query APIs.
+type HTTPClient struct {
+	client *http.Client
+	opts   HTTPClientOptions
+	logger log.Logger
+}
+
+func NewHTTPClient(opts HTTPClientOptions, logger log.Logger) *HTTPClient {
+	if opts.UserAgent == "" {
+		opts.UserAgent = DefaultUserAgent
+	}
+	if opts.MaxIdleConnsPerHost == 0 {
+		opts.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultHTTPTimeout
+	}
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	// The transport is shared by all the requests so that the keep-alive connections are reused.
+	var transport http.RoundTripper
+	if opts.ForceHTTP2 {
+		transport = newHTTP2Transport()
+	} else {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		if t.MaxIdleConns < opts.MaxIdleConnsPerHost {
+			t.MaxIdleConns = opts.MaxIdleConnsPerHost
+		}
+		// Negotiate HTTP/2 over TLS via ALPN when the server supports it.
+		t.ForceAttemptHTTP2 = true
+		transport = t
+	}
+	return &HTTPClient{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   opts.Timeout,
+		},
+		opts:   opts,
+		logger: log.With(logger, "component", "http_client"),
+	}
+}
+
+// http2Transport makes the requests over HTTP/2 only, with h2c for the http URLs.
+type http2Transport struct {
+	h2, h2c *http2.Transport
+}
+
+func newHTTP2Transport() *http2Transport {
+	return &http2Transport{
+		h2: &http2.Transport{},
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			// Dial without TLS for the h2c connections.
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+}
+
+func (t *http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.h2c.RoundTrip(req)
+	}
+	return t.h2.RoundTrip(req)
+}
+
+// Get does a GET request on the given URL and returns the response body.
+// It returns an error if the response code is not 2xx.
+func (c *HTTPClient) Get(u string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+
+	b, _, err := c.Do(ctx, http.MethodGet, u, nil, nil)
+	return b, err
+}
+
+// defaultHTTPClient is the client of DoGetRequest.
+var defaultHTTPClient = NewHTTPClient(HTTPClientOptions{}, nil)
+
+// DoGetRequest does a GET request on the given URL with the default options of HTTPClient and returns the
+// response body. It returns an error if the response code is not 2xx.
+//
+// Deprecated: Use HTTPClient.Get with the options of the test suite instead.
+func DoGetRequest(u string) ([]byte, error) {
+	return defaultHTTPClient.Get(u)
+}
+
+// Do does a request with the given method, body and additional headers, and returns the response body
+// and the request ID used (empty if request IDs are disabled). Failed requests because of network errors
+// or a 5xx or 429 response code are retried with the same request ID.
+// It returns an error if the final response code is not 2xx.
+func (c *HTTPClient) Do(ctx context.Context, method, u string, body []byte, header http.Header) ([]byte, string, error) {
+	reqID := ""
+	if c.opts.RequestIDs {
+		reqID = newRequestID()
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, reqID, errors.Wrapf(ctx.Err(), "request %s %s (request_id=%q)", method, u, reqID)
+			case <-time.After(retryBackoff):
+			}
+		}
+
+		var retryable bool
+		b, retryable, err = c.doOnce(ctx, method, u, body, header, reqID, attempt)
+		c.logRequest(method, u, reqID, attempt, err)
+		if err == nil || !retryable {
+			break
+		}
+	}
+	if err != nil {
+		return nil, reqID, errors.Wrapf(err, "request %s %s (request_id=%q)", method, u, reqID)
+	}
+	return b, reqID, nil
+}
+
+// doOnce does a single request. The returned bool is true if the request can be retried on error.
+func (c *HTTPClient) doOnce(ctx context.Context, method, u string, body []byte, header http.Header, reqID string, attempt int) ([]byte, bool, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bodyReader)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "create request")
+	}
+	for k, v := range c.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, vs := range header {
+		req.Header.Del(k)
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+	if reqID != "" {
+		req.Header.Set(requestIDHeader, reqID)
+	}
+	if attempt > 0 {
+		req.Header.Set(requestAttemptHeader, strconv.Itoa(attempt+1))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, errors.Wrap(err, "do request")
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, errors.Wrap(err, "read body")
+	}
+
+	if resp.StatusCode/100 != 2 {
+		retryable := resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retryable, statusError{code: resp.StatusCode, body: string(b)}
+	}
+
+	return b, false, nil
+}
+
+// statusError is the error of a request whose response code is not 2xx.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("non 2xx response code %d: %s", e.code, e.body)
+}
+
+// logRequest logs the request with its ID. The attempt number is logged only for the retries.
+// Without the request IDs, the requests are only logged at debug level.
+func (c *HTTPClient) logRequest(method, u, reqID string, attempt int, err error) {
+	logger := level.Debug(c.logger)
+	if reqID != "" {
+		logger = level.Info(c.logger)
+	}
+	keyvals := []interface{}{"msg", "HTTP request", "method", method, "url", u, "request_id", reqID}
+	if attempt > 0 {
+		keyvals = append(keyvals, "attempt", attempt+1)
+	}
+	if err != nil {
+		keyvals = append(keyvals, "err", err)
+	}
+	logger.Log(keyvals...)
+}
+
+// newRequestID returns a random ID to be used in the X-Request-ID header.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// Fallback to a time based ID. It is only used for tracing the requests.
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,187 @@
+package testsuite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestHTTPClientRequestIDs(t *testing.T) {
+	var (
+		userAgents []string
+		reqIDs     []string
+		attempts   []string
+	)
+	failures := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.UserAgent())
+		reqIDs = append(reqIDs, r.Header.Get(requestIDHeader))
+		attempts = append(attempts, r.Header.Get(requestAttemptHeader))
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	c := NewHTTPClient(HTTPClientOptions{RequestIDs: true}, log.NewLogfmtLogger(&logs))
+
+	// The retry uses the same request ID and is marked with the attempt.
+	b, reqID, err := c.Do(context.Background(), http.MethodGet, srv.URL, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(b))
+	require.NotEmpty(t, reqID)
+	require.Equal(t, []string{reqID, reqID}, reqIDs)
+	require.Equal(t, []string{"", "2"}, attempts)
+	require.Equal(t, []string{DefaultUserAgent, DefaultUserAgent}, userAgents)
+	logLines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	require.Len(t, logLines, 2)
+	require.Contains(t, logLines[0], "level=info")
+	require.Contains(t, logLines[0], "request_id="+reqID)
+	require.NotContains(t, logLines[0], "attempt=")
+	require.Contains(t, logLines[1], "request_id="+reqID)
+	require.Contains(t, logLines[1], "attempt=2")
+
+	// A new request gets a new request ID.
+	_, reqID2, err := c.Do(context.Background(), http.MethodGet, srv.URL, nil, nil)
+	require.NoError(t, err)
+	require.NotEqual(t, reqID, reqID2)
+	require.Equal(t, reqID2, reqIDs[2])
+
+	// Custom User-Agent and no request IDs.
+	userAgents, reqIDs = nil, nil
+	c = NewHTTPClient(HTTPClientOptions{UserAgent: "custom/1.0"}, nil)
+	_, err = c.Get(srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, []string{"custom/1.0"}, userAgents)
+	require.Equal(t, []string{""}, reqIDs)
+}
+
+func TestHTTPClientForceHTTP2(t *testing.T) {
+	var protos []string
+	// The server only speaks HTTP/2 via h2c, like a generator behind a gateway that requires HTTP/2.
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos = append(protos, r.Proto)
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		_, _ = w.Write(append([]byte("ok"), b...))
+	}), &http2.Server{}))
+	defer srv.Close()
+
+	c := NewHTTPClient(HTTPClientOptions{}, nil)
+	_, err := c.Get(srv.URL)
+	require.Error(t, err)
+	require.Equal(t, "HTTP/1.1", protos[0])
+
+	protos = nil
+	c = NewHTTPClient(HTTPClientOptions{ForceHTTP2: true}, nil)
+	b, err := c.Get(srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(b))
+	b, _, err = c.Do(context.Background(), http.MethodPost, srv.URL, []byte("-body"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "ok-body", string(b))
+	require.Equal(t, []string{"HTTP/2.0", "HTTP/2.0"}, protos)
+}
+
+func TestHTTPClientHeaders(t *testing.T) {
+	var headers []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+	}))
+	defer srv.Close()
+
+	c := NewHTTPClient(HTTPClientOptions{Headers: map[string]string{
+		"X-Scope-OrgID": "compliance",
+		"Content-Type":  "text/plain",
+		"User-Agent":    "custom/1.0",
+	}}, nil)
+	_, err := c.Get(srv.URL)
+	require.NoError(t, err)
+	_, _, err = c.Do(context.Background(), http.MethodPost, srv.URL, []byte("body"), http.Header{"Content-Type": []string{"application/x-protobuf"}})
+	require.NoError(t, err)
+
+	require.Len(t, headers, 2)
+	require.Equal(t, "compliance", headers[0].Get("X-Scope-OrgID"))
+	require.Equal(t, "text/plain", headers[0].Get("Content-Type"))
+	require.Equal(t, DefaultUserAgent, headers[0].Get("User-Agent"))
+	// The headers of the test suite take precedence.
+	require.Equal(t, "compliance", headers[1].Get("X-Scope-OrgID"))
+	require.Equal(t, []string{"application/x-protobuf"}, headers[1].Values("Content-Type"))
+}
+
+func TestDoGetRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	b, err := DoGetRequest(srv.URL + "/ok")
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(b))
+	_, err = DoGetRequest(srv.URL + "/missing")
+	require.Error(t, err)
+}
+
+// BenchmarkHTTPClientConnections makes bursts of concurrent requests to the same host, like the remote write
+// of a test case with many series together with the API checks, and reports the new connections per burst.
+func BenchmarkHTTPClientConnections(b *testing.B) {
+	const concurrency = 16
+	for _, maxIdle := range []int{2, DefaultMaxIdleConnsPerHost} {
+		b.Run(fmt.Sprintf("max_idle_conns=%d", maxIdle), func(b *testing.B) {
+			var newConns int64
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = ioutil.ReadAll(r.Body)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt64(&newConns, 1)
+				}
+			}
+			srv.Start()
+			defer srv.Close()
+
+			c := NewHTTPClient(HTTPClientOptions{MaxIdleConnsPerHost: maxIdle}, nil)
+			body := bytes.Repeat([]byte("x"), 1024)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for j := 0; j < concurrency; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if _, _, err := c.Do(context.Background(), http.MethodPost, srv.URL, body, nil); err != nil {
+							b.Error(err)
+						}
+					}()
+				}
+				wg.Wait()
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&newConns))/float64(b.N), "conns/op")
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package testsuite
+
+import (
+	"bytes"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/prometheus/model/timestamp"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// ListCases returns a table of the given test cases with the resources that they put on the alert generator
+// (see cases.Resources), followed by the total of all the test cases, to size the alert generator before the test.
+func ListCases(cs []cases.TestCase) string {
+	zeroTime := timestamp.FromTime(time.Now())
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RULE GROUP\tSERIES\tSAMPLES\tPEAK FIRING ALERTS\tEVALUATION COMPLEXITY")
+	for _, c := range cs {
+		groupName, _ := c.Describe()
+		r := cases.CaseResources(c, zeroTime)
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", groupName, r.Series, r.Samples, r.PeakFiringAlerts, r.EvalComplexity)
+	}
+	total := cases.TotalResources(cs, zeroTime)
+	fmt.Fprintf(w, "Total of %d test cases\t%d\t%d\t%d\t\n", len(cs), total.Series, total.Samples, total.PeakFiringAlerts)
+	w.Flush()
+	return buf.String()
+}
@@ -0,0 +1,22 @@
+package testsuite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestListCases(t *testing.T) {
+	out := ListCases([]cases.TestCase{cases.PendingAndFiringAndResolved(), cases.MaxSamplesExceeded()})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 4)
+	require.Equal(t, []string{"RULE", "GROUP", "SERIES", "SAMPLES", "PEAK", "FIRING", "ALERTS", "EVALUATION", "COMPLEXITY"}, strings.Fields(lines[0]))
+	require.Equal(t, []string{"PendingAndFiringAndResolved", "1", "150", "1"}, strings.Fields(lines[1]))
+	require.True(t, strings.HasPrefix(lines[2], "MaxSamplesExceeded "))
+	require.Contains(t, lines[2], "subquery over 40 series")
+	// The alerts of the two test cases never fire at the same time.
+	require.Equal(t, []string{"Total", "of", "2", "test", "cases", "41", "1879", "1"}, strings.Fields(lines[3]))
+}
@@ -0,0 +1,121 @@
+package testsuite
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/promql"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// MetricsSource is where the ALERTS series of the alert generator are read from for the metrics checks.
+type MetricsSource string
+
+const (
+	// MetricsSourceQuery runs an instant query via GET <PromQLBaseURL>/api/v1/query. It is the default.
+	MetricsSourceQuery MetricsSource = "query"
+	// MetricsSourceFederate scrapes GET <PromQLBaseURL>/federate?match[]=ALERTS, for the alert generators that
+	// expose the ALERTS series via federation while their query API differs from Prometheus.
+	// The federated samples carry the timestamp of the evaluation that produced them instead of the time of the
+	// scrape, and the latest state cannot be read as of an earlier time. Hence the ALERTS series are checked at the
+	// time of the scrape with the same lag as the rules and alerts APIs, and the tolerance of the checks for the
+	// evaluation that happened up to a group interval before the check covers the age of the samples.
+	// The federated series get the external labels of the alert generator, so it must have none.
+	// The queries of the cases.QueryChecker test cases are not checked since PromQL expressions cannot be federated.
+	MetricsSourceFederate MetricsSource = "federate"
+)
+
+func validateMetricsSource(s MetricsSource) error {
+	switch s {
+	case "", MetricsSourceQuery, MetricsSourceFederate:
+		return nil
+	}
+	return fmt.Errorf("unknown metrics source %q, must be one of %q and %q", s, MetricsSourceQuery, MetricsSourceFederate)
+}
+
+func validateQueryStepAlignment(a cases.QueryStepAlignment, interval time.Duration) error {
+	switch a {
+	case "", cases.QueryStepAlignmentNone, cases.QueryStepAlignmentSecond, cases.QueryStepAlignmentInterval:
+	default:
+		return fmt.Errorf("unknown query step alignment %q, must be one of %q, %q and %q",
+			a, cases.QueryStepAlignmentNone, cases.QueryStepAlignmentSecond, cases.QueryStepAlignmentInterval)
+	}
+	if interval < 0 {
+		return fmt.Errorf("query step interval cannot be negative, got %s", interval)
+	}
+	return nil
+}
+
+// fetchAlertsMetric returns the ALERTS series grouped by the rulegroup label from the metrics source, with the time
+// to check them at and the lag of the state behind that time.
+func (ts *TestSuite) fetchAlertsMetric() (mappedMetrics map[string][]promql.Sample, nowTs int64, lag time.Duration, err error) {
+	if ts.opts.MetricsSource == MetricsSourceFederate {
+		nowTs = timestamp.FromTime(ts.clock.Now())
+		mappedMetrics, err = ts.federateMetrics("ALERTS")
+		return mappedMetrics, nowTs, ts.apiLag(), err
+	}
+
+	// The replica has all the samples until the lag, hence we query at that time instead of now.
+	nowTs = timestamp.FromTime(ts.clock.Now().Add(-ts.opts.ReplicaLag))
+	mappedMetrics, err = ts.queryMetrics("ALERTS", nowTs)
+	// The replica lag is already accounted for by the time of the query.
+	return mappedMetrics, nowTs, ts.opts.QueryCacheStaleness, err
+}
+
+// federateMetrics scrapes the series that match the given selector via the federation endpoint and returns them
+// grouped by the rulegroup label.
+func (ts *TestSuite) federateMetrics(match string) (map[string][]promql.Sample, error) {
+	u := *ts.federateURL
+	q := u.Query()
+	q.Set("match[]", match)
+	u.RawQuery = q.Encode()
+
+	b, err := ts.client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	mappedMetrics, err := parseAndGroupFederatedMetrics(b)
+	return mappedMetrics, errors.Wrap(err, "parse federation response")
+}
+
+// parseAndGroupFederatedMetrics parses the series in the Prometheus text format as served by the federation
+// endpoint and groups them by the rulegroup label, like ParseAndGroupMetrics. The timestamps of the samples
+// are in seconds like in the query API, and 0 if the series has no timestamp.
+func parseAndGroupFederatedMetrics(b []byte) (map[string][]promql.Sample, error) {
+	mappedMetrics := make(map[string][]promql.Sample)
+	p := textparse.NewPromParser(b)
+	for {
+		et, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if et != textparse.EntrySeries {
+			continue
+		}
+
+		_, tsMs, v := p.Series()
+		var lset labels.Labels
+		p.Metric(&lset)
+		var t int64
+		if tsMs != nil {
+			t = *tsMs / 1000
+		}
+		groupName := lset.Get("rulegroup")
+		mappedMetrics[groupName] = append(mappedMetrics[groupName], promql.Sample{
+			Point:  promql.Point{T: t, V: v},
+			Metric: lset,
+		})
+	}
+
+	return mappedMetrics, nil
+}
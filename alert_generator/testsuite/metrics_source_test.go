@@ -0,0 +1,128 @@
+package testsuite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestMetricsSourceFederate(t *testing.T) {
+	federated := `# TYPE ALERTS untyped
+ALERTS{alertname="A",alertstate="firing",rulegroup="G"} 1 1641808790000
+ALERTS{alertname="B",alertstate="pending",rulegroup="H"} 1 1641808795000
+ALERTS{alertname="C",alertstate="pending",rulegroup="H"} 1
+`
+	var gotMatch []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/prom/federate":
+			gotMatch = r.URL.Query()["match[]"]
+			_, _ = w.Write([]byte(federated))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	opts := TestSuiteOptions{
+		Logger:              log.NewNopLogger(),
+		Cases:               []cases.TestCase{cases.PendingAndFiringAndResolved(), cases.ErroringRecordingRule()},
+		RemoteWriteURL:      srv.URL + "/api/v1/write",
+		BaseAPIURL:          srv.URL,
+		PromQLBaseURL:       srv.URL + "/prom",
+		AlertServerPort:     "8080",
+		MetricsSource:       MetricsSourceFederate,
+		ReplicaLag:          2 * time.Second,
+		QueryCacheStaleness: time.Second,
+		Clock:               NewFrozenClock(now),
+	}
+	ts, err := NewTestSuite(opts)
+	require.NoError(t, err)
+
+	mapped, nowTs, lag, err := ts.fetchAlertsMetric()
+	require.NoError(t, err)
+	require.Equal(t, []string{"ALERTS"}, gotMatch)
+	// Checked at the time of the scrape with the lag of the APIs.
+	require.Equal(t, timestamp.FromTime(now), nowTs)
+	require.Equal(t, 3*time.Second, lag)
+	require.Equal(t, map[string][]promql.Sample{
+		"G": {
+			{Point: promql.Point{T: 1641808790, V: 1}, Metric: labels.FromStrings("__name__", "ALERTS", "alertname", "A", "alertstate", "firing", "rulegroup", "G")},
+		},
+		"H": {
+			{Point: promql.Point{T: 1641808795, V: 1}, Metric: labels.FromStrings("__name__", "ALERTS", "alertname", "B", "alertstate", "pending", "rulegroup", "H")},
+			{Point: promql.Point{T: 0, V: 1}, Metric: labels.FromStrings("__name__", "ALERTS", "alertname", "C", "alertstate", "pending", "rulegroup", "H")},
+		},
+	}, mapped)
+
+	// The test case that runs its own queries does not need the query API since they are not checked.
+	require.Equal(t, []string{capRemoteWrite, capRulesAPI, capAlertsAPI, capAlertsMetric}, requiredCapabilities(cases.ErroringRecordingRule(), false, false))
+
+	_, err = parseAndGroupFederatedMetrics([]byte("ALERTS{alertname=\"A\" 1\n"))
+	require.Error(t, err)
+
+	opts.MetricsSource = "remote_read"
+	_, err = NewTestSuite(opts)
+	require.EqualError(t, err, `validate options: unknown metrics source "remote_read", must be one of "query" and "federate"`)
+}
+
+func TestQueryStepAlignment(t *testing.T) {
+	// The alert generator rounds the instant of the query to the nearest second.
+	var gotTime string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/prom/api/v1/query":
+			gotTime = r.URL.Query().Get("time")
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"ALERTS","rulegroup":"G"},"value":[1641808805,"1"]}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Date(2022, 1, 10, 10, 0, 4, 700*int(time.Millisecond), time.UTC)
+	opts := TestSuiteOptions{
+		Logger:             log.NewNopLogger(),
+		Cases:              []cases.TestCase{cases.PendingAndFiringAndResolved()},
+		RemoteWriteURL:     srv.URL + "/api/v1/write",
+		BaseAPIURL:         srv.URL,
+		PromQLBaseURL:      srv.URL + "/prom",
+		AlertServerPort:    "8080",
+		QueryStepAlignment: cases.QueryStepAlignmentSecond,
+		Clock:              NewFrozenClock(now),
+	}
+	ts, err := NewTestSuite(opts)
+	require.NoError(t, err)
+
+	mapped, nowTs, _, err := ts.fetchAlertsMetric()
+	require.NoError(t, err)
+	// The instant is requested to the millisecond.
+	require.Equal(t, "1641808804.700", gotTime)
+
+	// The timestamps of the samples are checked at the time of the query, and set to the expected ones for the
+	// earlier times within the lag.
+	samples := ts.samplesToCheck(mapped["G"], nowTs, nowTs)
+	require.Equal(t, int64(1641808805), samples[0].T)
+	require.Equal(t, ts.checkOpts.SampleTimestamp(nowTs), samples[0].T)
+	samples = ts.samplesToCheck(mapped["G"], nowTs, nowTs-2000)
+	require.Equal(t, int64(1641808803), samples[0].T)
+
+	opts.QueryStepAlignment = "minute"
+	_, err = NewTestSuite(opts)
+	require.EqualError(t, err, `validate options: unknown query step alignment "minute", must be one of "none", "second" and "interval"`)
+
+	opts.QueryStepAlignment = cases.QueryStepAlignmentInterval
+	opts.QueryStepInterval = -time.Second
+	_, err = NewTestSuite(opts)
+	require.EqualError(t, err, `validate options: query step interval cannot be negative, got -1s`)
+}
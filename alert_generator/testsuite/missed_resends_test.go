@@ -0,0 +1,84 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestAlertsServerAllowedMissedResends(t *testing.T) {
+	now := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	lbls := labels.FromStrings("alertname", "A", "rulegroup", "G")
+	resolvedAt := now.Add(10 * cases.ResendDelay)
+	expected := func() []cases.ExpectedAlert {
+		var exp []cases.ExpectedAlert
+		for i := 0; i < 8; i++ {
+			exp = append(exp, cases.ExpectedAlert{
+				OrderingID:    i + 1,
+				TimeTolerance: 10 * time.Second,
+				Ts:            now.Add(time.Duration(i) * cases.ResendDelay),
+				Resend:        i != 0,
+				NextState:     resolvedAt,
+				ResolvedTime:  resolvedAt,
+				EndsAtDelta:   4 * cases.ResendDelay,
+				Alert:         &notifier.Alert{Labels: lbls, StartsAt: now},
+			})
+		}
+		return exp
+	}
+	send := func(as *alertsServer, ts time.Time) {
+		as.processAlerts(ts, []notifier.Alert{{
+			Labels:   lbls,
+			StartsAt: now.Add(time.Second),
+			EndsAt:   ts.Add(4*cases.ResendDelay + time.Second),
+		}})
+	}
+
+	for _, tc := range []struct {
+		name         string
+		allowed      int
+		dropped      map[int]bool // Resends that the alerts server does not get.
+		expTolerated int
+		expMissed    bool
+	}{
+		{name: "no drop", allowed: 1},
+		{name: "tolerated drop", allowed: 1, dropped: map[int]bool{2: true}, expTolerated: 1},
+		{name: "drop not allowed", allowed: 0, dropped: map[int]bool{2: true}, expMissed: true},
+		{name: "second drop", allowed: 1, dropped: map[int]bool{2: true, 4: true}, expTolerated: 1, expMissed: true},
+		{name: "initial alert", allowed: 1, dropped: map[int]bool{0: true}, expMissed: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			as := newAlertsServer("", log.NewNopLogger())
+			as.allowedMissedResends = tc.allowed
+			as.addExpectedAlerts(expected()...)
+
+			for i := 0; i < 6; i++ {
+				if !tc.dropped[i] {
+					send(as, now.Add(time.Duration(i)*cases.ResendDelay+time.Second))
+				}
+			}
+
+			errs := as.getErr("G")
+			require.Len(t, errs.matchingErrs, 0)
+			require.Len(t, errs.toleratedMissedResends, tc.expTolerated)
+			require.Equal(t, tc.expMissed, len(errs.missedAlerts) > 0)
+			require.Equal(t, tc.expMissed, as.groupsFacingErrors()["G"])
+			if !tc.expMissed {
+				require.Len(t, errs.unexpectedAlerts, 0)
+			}
+
+			describe := describeToleratedMissedResends(as.groupError())
+			if tc.expTolerated == 0 {
+				require.Empty(t, describe)
+				return
+			}
+			require.Contains(t, describe, "Group Name: G\n")
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package testsuite
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/timestamp"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// The capabilities of the alert generator probed by the preflight.
+const (
+	capRemoteWrite    = "remote_write"
+	capRulesAPI       = "rules_api"
+	capAlertsAPI      = "alerts_api"
+	capPromQL         = "promql"
+	capAlertsMetric   = "alerts_metric"
+	capAlertsForState = "alerts_for_state"
+	capFlagsAPI       = "flags_api"
+	capSelfMetrics    = "self_metrics"
+	capAlertmanager   = "alertmanager"
+)
+
+// checkNamePreflight is the check reported in CaseScore.FailedChecks for the test cases skipped
+// because the alert generator lacks a capability that they need.
+const checkNamePreflight = "preflight"
+
+// preflightTimeout bounds each probe of the preflight so that an unresponsive endpoint does not hold up the test.
+const preflightTimeout = 10 * time.Second
+
+// capability is the result of probing a single capability of the alert generator.
+type capability struct {
+	name      string
+	supported bool
+	detail    string // The error if not supported.
+}
+
+// capabilities are the results of the preflight in the order they were probed.
+type capabilities []capability
+
+func (cs capabilities) supported(name string) bool {
+	for _, c := range cs {
+		if c.name == name {
+			return c.supported
+		}
+	}
+	// Not probed, e.g. the Alertmanager when it is not configured.
+	return true
+}
+
+// missing returns the given capabilities that are not supported, sorted.
+func (cs capabilities) missing(names []string) []string {
+	var m []string
+	for _, n := range names {
+		if !cs.supported(n) {
+			m = append(m, n)
+		}
+	}
+	sort.Strings(m)
+	return m
+}
+
+// String returns the capability matrix as shown in the report.
+func (cs capabilities) String() string {
+	s := "Capabilities of the alert generator found by the preflight:\n"
+	for _, c := range cs {
+		if c.supported {
+			s += fmt.Sprintf("\t%-17s yes\n", c.name)
+		} else {
+			s += fmt.Sprintf("\t%-17s no (%s)\n", c.name, c.detail)
+		}
+	}
+	return s
+}
+
+// requiredCapabilities returns the capabilities without which the checks of the test case are not meaningful.
+// The other probed capabilities are only informational. withQueries is false when the queries of the test cases
+// are not checked, see MetricsSourceFederate.
+func requiredCapabilities(c cases.TestCase, withAlertmanager, withQueries bool) []string {
+	req := []string{capRemoteWrite, capRulesAPI, capAlertsAPI, capAlertsMetric}
+	if _, ok := c.(cases.QueryChecker); ok && withQueries {
+		req = append(req, capPromQL)
+	}
+	if _, ok := c.(cases.NotificationsUnchecked); withAlertmanager && !ok {
+		req = append(req, capAlertmanager)
+	}
+	return req
+}
+
+// preflight probes the endpoints and features of the alert generator that the test suite relies on.
+// It does not depend on any timing and writes no samples of the test cases, only an empty remote write request.
+func (ts *TestSuite) preflight() capabilities {
+	probe := func(name string, f func() error) capability {
+		err := f()
+		if err != nil {
+			return capability{name: name, detail: err.Error()}
+		}
+		return capability{name: name, supported: true}
+	}
+	get := func(u string, parse func([]byte) error) func() error {
+		return func() error {
+			b, err := ts.client.Get(u)
+			if err != nil {
+				return err
+			}
+			return errors.Wrap(parse(b), "parse response")
+		}
+	}
+	query := func(q string) func() error {
+		return func() error {
+			_, err := ts.queryMetrics(q, timestamp.FromTime(ts.clock.Now()))
+			return err
+		}
+	}
+
+	alertsMetric := query("ALERTS")
+	if ts.opts.MetricsSource == MetricsSourceFederate {
+		alertsMetric = func() error {
+			_, err := ts.federateMetrics("ALERTS")
+			return err
+		}
+	}
+
+	cs := capabilities{
+		probe(capRemoteWrite, func() error {
+			req, err := buildWriteRequest(nil, nil)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+			defer cancel()
+			_, err = ts.remoteWriter.store(ctx, req)
+			return err
+		}),
+		probe(capRulesAPI, get(ts.rulesAPIURL, func(b []byte) error {
+			_, err := parseAndGroupRulesCompat(b, ts.opts.APICompat)
+			return err
+		})),
+		probe(capAlertsAPI, get(ts.alertsAPIURL, func(b []byte) error {
+			_, err := parseAndGroupAlertsCompat(b, ts.opts.APICompat)
+			return err
+		})),
+		probe(capPromQL, query("vector(1)")),
+		probe(capAlertsMetric, alertsMetric),
+		probe(capAlertsForState, query("ALERTS_FOR_STATE")),
+		probe(capFlagsAPI, get(ts.flagsAPIURL, func(b []byte) error {
+			_, err := parseGeneratorFlags(b)
+			return err
+		})),
+		probe(capSelfMetrics, get(ts.selfMetricsURL, func(b []byte) error {
+			_, err := parseSelfMetrics(b)
+			return err
+		})),
+	}
+	if ts.ac != nil {
+		cs = append(cs, probe(capAlertmanager, get(ts.amAlertsURL, func(b []byte) error {
+			_, err := ParseAndGroupAlertmanagerAlerts(b)
+			return err
+		})))
+	}
+	return cs
+}
+
+// runPreflight runs the preflight and skips the test cases that need a capability that the alert generator lacks.
+// The skipped test cases fail with the checkNamePreflight check.
+func (ts *TestSuite) runPreflight() {
+	ts.capabilities = ts.preflight()
+	for _, c := range ts.capabilities {
+		if c.supported {
+			level.Info(ts.logger).Log("msg", "Preflight found a capability of the alert generator", "capability", c.name)
+		} else {
+			level.Warn(ts.logger).Log("msg", "Preflight did not find a capability of the alert generator", "capability", c.name, "err", c.detail)
+		}
+	}
+
+	groupsToSkip := make(map[string]error)
+	for _, gn := range ts.caseOrder {
+		missing := ts.capabilities.missing(requiredCapabilities(ts.ruleGroupTests[gn], ts.ac != nil, ts.opts.MetricsSource != MetricsSourceFederate))
+		if len(missing) > 0 {
+			groupsToSkip[gn] = checkError{
+				check: checkNamePreflight,
+				err:   errors.Errorf("skipped because the alert generator lacks the capabilities: %s", strings.Join(missing, ", ")),
+			}
+		}
+	}
+	ts.removeGroups(groupsToSkip)
+}
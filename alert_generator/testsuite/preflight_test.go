@@ -0,0 +1,74 @@
+package testsuite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestPreflight(t *testing.T) {
+	// The alert generator serves everything except the flags API, and its query API fails on the
+	// queries other than ALERTS, as if only the ALERTS series were exposed.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/write":
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/v1/rules":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"groups":[]}}`))
+		case "/api/v1/alerts":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"alerts":[]}}`))
+		case "/api/v1/query":
+			if r.URL.Query().Get("query") != "ALERTS" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"status":"error","error":"unsupported"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		case "/metrics":
+			_, _ = w.Write([]byte("prometheus_notifications_sent_total 0\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ts, err := NewTestSuite(TestSuiteOptions{
+		Logger:          log.NewNopLogger(),
+		Cases:           []cases.TestCase{cases.PendingAndFiringAndResolved(), cases.ErroringRecordingRule()},
+		RemoteWriteURL:  srv.URL + "/api/v1/write",
+		BaseAPIURL:      srv.URL,
+		PromQLBaseURL:   srv.URL,
+		AlertServerPort: "8080",
+	})
+	require.NoError(t, err)
+
+	ts.runPreflight()
+	got := make(map[string]bool)
+	for _, c := range ts.capabilities {
+		got[c.name] = c.supported
+	}
+	require.Equal(t, map[string]bool{
+		capRemoteWrite:    true,
+		capRulesAPI:       true,
+		capAlertsAPI:      true,
+		capPromQL:         false,
+		capAlertsMetric:   true,
+		capAlertsForState: false,
+		capFlagsAPI:       false,
+		capSelfMetrics:    true,
+	}, got)
+	require.Contains(t, ts.capabilities.String(), "alerts_metric     yes\n")
+
+	// Only the test case that runs its own queries needs the query API beyond ALERTS.
+	require.Contains(t, ts.ruleGroupTests, "PendingAndFiringAndResolved")
+	require.NotContains(t, ts.ruleGroupTests, "ErroringRecordingRule")
+	errs := ts.ruleGroupTestErrors["ErroringRecordingRule"]
+	require.Len(t, errs, 1)
+	require.Equal(t, checkNamePreflight, checkNameOf(errs[0]))
+	require.EqualError(t, errs[0], "skipped because the alert generator lacks the capabilities: promql")
+}
@@ -0,0 +1,49 @@
+package testsuite
+
+import (
+	"time"
+
+	"github.com/prometheus/prometheus/promql"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// withQueryCacheStaleness returns the expected alerts with the query cache staleness added to their time tolerance.
+// A stale cached result delays the state changes of the alerts by up to the staleness, hence the alerts can be
+// sent that much later, and their StartsAt and the EndsAt of the resolved alerts can be that much later too.
+func withQueryCacheStaleness(eas []cases.ExpectedAlert, staleness time.Duration) []cases.ExpectedAlert {
+	if staleness <= 0 {
+		return eas
+	}
+	res := make([]cases.ExpectedAlert, len(eas))
+	for i, ea := range eas {
+		ea.TimeTolerance += staleness
+		res[i] = ea
+	}
+	return res
+}
+
+// samplesToCheck returns the samples of an instant query at nowTs to check against the expected samples at t.
+// Their timestamps are only checked at the time of the query with MetricsSourceQuery, since the query was not
+// evaluated at the earlier times within the lag, and the federated samples have the time of their evaluation.
+func (ts *TestSuite) samplesToCheck(samples []promql.Sample, nowTs, t int64) []promql.Sample {
+	if t == nowTs && ts.opts.MetricsSource != MetricsSourceFederate {
+		return samples
+	}
+	return samplesAtTime(samples, t, ts.checkOpts)
+}
+
+// samplesAtTime returns a copy of the samples of an instant query with their timestamp set to the one expected
+// for ts with the options, so that they can be checked against the expected samples of another time, e.g. an
+// earlier time within the lag.
+func samplesAtTime(samples []promql.Sample, ts int64, opts cases.CheckOptions) []promql.Sample {
+	if samples == nil {
+		return nil
+	}
+	res := make([]promql.Sample, len(samples))
+	for i, s := range samples {
+		s.T = opts.SampleTimestamp(ts)
+		res[i] = s
+	}
+	return res
+}
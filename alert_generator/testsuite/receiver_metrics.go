@@ -0,0 +1,56 @@
+package testsuite
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The paths of the alert receiving server that are not for the alerts. The alerts can be sent to any other path.
+const (
+	receiverHealthPath  = "/-/healthy"
+	receiverMetricsPath = "/metrics"
+)
+
+// receiverMetrics are the metrics of the alert receiving server itself, to monitor if it keeps up with the alert
+// generator, e.g. in a long running deployment of the test suite. A receiver that falls behind can make the test
+// suite report missed alerts that the alert generator did send.
+type receiverMetrics struct {
+	alertsReceived   prometheus.Counter
+	requests         prometheus.Counter
+	decodeErrors     prometheus.Counter
+	droppedRequests  prometheus.Counter
+	requestsInFlight prometheus.Gauge
+
+	handler http.Handler // Serves the metrics.
+}
+
+func newReceiverMetrics() *receiverMetrics {
+	reg := prometheus.NewRegistry()
+	m := &receiverMetrics{
+		alertsReceived: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "compliance_receiver_alerts_received_total",
+			Help: "Total number of alerts received from the alert generator.",
+		}),
+		requests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "compliance_receiver_requests_total",
+			Help: "Total number of requests with alerts received from the alert generator.",
+		}),
+		decodeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "compliance_receiver_decode_errors_total",
+			Help: "Total number of requests whose body could not be decoded as alerts.",
+		}),
+		droppedRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "compliance_receiver_dropped_requests_total",
+			Help: "Total number of requests whose alerts were not checked because the body could not be read or decoded.",
+		}),
+		requestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "compliance_receiver_requests_in_flight",
+			Help: "Number of requests with alerts that are being read or are waiting to be checked.",
+		}),
+	}
+	reg.MustRegister(m.alertsReceived, m.requests, m.decodeErrors, m.droppedRequests, m.requestsInFlight)
+	m.handler = promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	return m
+}
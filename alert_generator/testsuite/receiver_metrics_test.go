@@ -0,0 +1,53 @@
+package testsuite
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiverMetrics(t *testing.T) {
+	as := newAlertsServer("", log.NewNopLogger())
+	as.ignoreGroup("G")
+	srv := httptest.NewServer(as)
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+	post := func(body string) int {
+		resp, err := http.Post(srv.URL+"/api/v2/alerts", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	code, _ := get(receiverHealthPath)
+	require.Equal(t, http.StatusOK, code)
+
+	require.Equal(t, http.StatusOK, post(`[{"labels":{"alertname":"A","rulegroup":"G"}},{"labels":{"alertname":"B","rulegroup":"G"}}]`))
+	require.Equal(t, http.StatusBadRequest, post(`[{"labels":`))
+	require.Equal(t, 2, as.numReceived())
+
+	code, metrics := get(receiverMetricsPath)
+	require.Equal(t, http.StatusOK, code)
+	for _, l := range []string{
+		"compliance_receiver_alerts_received_total 2",
+		"compliance_receiver_requests_total 2",
+		"compliance_receiver_decode_errors_total 1",
+		"compliance_receiver_dropped_requests_total 1",
+		"compliance_receiver_requests_in_flight 0",
+	} {
+		require.Contains(t, metrics, l+"\n")
+	}
+}
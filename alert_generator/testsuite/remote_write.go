@@ -2,6 +2,9 @@ package testsuite
 
 import (
 	"context"
+	"math"
+	"math/rand"
+	"net/http"
 	"net/url"
 	"sort"
 	"sync"
@@ -11,42 +14,53 @@ import (
 	"github.com/go-kit/log/level"
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
-	"github.com/prometheus/common/config"
-	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/prompb"
-	"github.com/prometheus/prometheus/storage/remote"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
 )
 
-func NewRemoteWriter(rwURL string, logger log.Logger) (*RemoteWriter, error) {
+func NewRemoteWriter(rwURL string, client *HTTPClient, logger log.Logger) (*RemoteWriter, error) {
 	u, err := url.Parse(rwURL)
 	if err != nil {
 		return nil, err
 	}
-	client, err := remote.NewWriteClient("alert-generator-test-suite", &remote.ClientConfig{
-		URL:              &config.URL{URL: u},
-		Timeout:          model.Duration(1 * time.Second),
-		RetryOnRateLimit: true,
-	})
-	if err != nil {
-		return nil, err
-	}
 	return &RemoteWriter{
+		url:    u.String(),
 		client: client,
+		speed:  1,
 		stopc:  make(chan struct{}),
 		errc:   make(chan error, 1),
 		log:    log.With(logger, "component", "remote_write"),
 	}, nil
 }
 
+// IngestFaults describes the faults injected while remote writing the time series
+// provided via AddFaultyTimeSeries().
+type IngestFaults struct {
+	// DropRate is the probability of dropping a batch of samples.
+	// At most cases.MaxIngestConsecutiveDrops batches are dropped in a row.
+	DropRate float64
+	// Delay is the max random delay added to a batch of samples.
+	// The batches are still written in the order of their timestamps.
+	Delay time.Duration
+	// Seed is the seed for the random drops and delays.
+	Seed int64
+}
+
 // RemoteWriter remote writes the time series provided AddTimeSeries()
 // in sorted fashion w.r.t. the timestamps.
 type RemoteWriter struct {
-	client remote.WriteClient
+	url    string
+	client *HTTPClient
+	faults IngestFaults
+	speed  float64 // Replay speed, 1 if not set.
 
-	timeSeries   []prompb.TimeSeries
-	allSamples   []sample // Flattened samples from timeSeries.
-	totalSamples int
+	timeSeries       []prompb.TimeSeries
+	faultyTimeSeries []prompb.TimeSeries
+	timedBatches     []cases.TimedBatch
+	allSamples       []sample // Flattened samples from timeSeries, faultyTimeSeries and timedBatches.
+	totalSamples     int
 
 	stopc chan struct{}
 	errc  chan error
@@ -59,6 +73,14 @@ type RemoteWriter struct {
 type sample struct {
 	labels []prompb.Label
 	s      prompb.Sample
+	sendAt int64 // The timestamp of the sample unless it is from a timed batch.
+	faulty bool  // Subject to the ingestion faults.
+}
+
+// delayedBatch is a batch of faulty samples waiting to be remote written.
+type delayedBatch struct {
+	sendAt int64
+	series []prompb.TimeSeries
 }
 
 // AddTimeSeries adds more timeseries to the queue. The timestamp of the samples should be 0 based.
@@ -70,23 +92,107 @@ func (rw *RemoteWriter) AddTimeSeries(ts []prompb.TimeSeries) {
 	rw.timeSeries = append(rw.timeSeries, ts...)
 }
 
+// shiftTimeSeries returns a copy of the timeseries with the timestamp of all the samples moved by the given offset.
+func shiftTimeSeries(tss []prompb.TimeSeries, offset time.Duration) []prompb.TimeSeries {
+	offsetMs := int64(offset / time.Millisecond)
+	shifted := make([]prompb.TimeSeries, 0, len(tss))
+	for _, ts := range tss {
+		samples := make([]prompb.Sample, 0, len(ts.Samples))
+		for _, s := range ts.Samples {
+			s.Timestamp += offsetMs
+			samples = append(samples, s)
+		}
+		shifted = append(shifted, prompb.TimeSeries{Labels: ts.Labels, Samples: samples})
+	}
+	return shifted
+}
+
+// shiftTimedBatches returns a copy of the batches with their SendAt and the timestamp of all the samples moved
+// by the given offset.
+func shiftTimedBatches(batches []cases.TimedBatch, offset time.Duration) []cases.TimedBatch {
+	shifted := make([]cases.TimedBatch, 0, len(batches))
+	for _, b := range batches {
+		shifted = append(shifted, cases.TimedBatch{
+			SendAt: b.SendAt + offset,
+			Series: shiftTimeSeries(b.Series, offset),
+		})
+	}
+	return shifted
+}
+
+// AddFaultyTimeSeries is like AddTimeSeries but the samples of these timeseries are subject to
+// the ingestion faults set via SetIngestFaults().
+// It should not be called after calling Start().
+func (rw *RemoteWriter) AddFaultyTimeSeries(ts []prompb.TimeSeries) {
+	for _, s := range ts {
+		rw.totalSamples += len(s.Samples)
+	}
+	rw.faultyTimeSeries = append(rw.faultyTimeSeries, ts...)
+}
+
+// AddTimedBatches is like AddTimeSeries but the samples are remote written at the SendAt of their batch
+// instead of their timestamp. The samples are not subject to the ingestion faults.
+// It should not be called after calling Start().
+func (rw *RemoteWriter) AddTimedBatches(batches []cases.TimedBatch) {
+	for _, b := range batches {
+		for _, s := range b.Series {
+			rw.totalSamples += len(s.Samples)
+		}
+	}
+	rw.timedBatches = append(rw.timedBatches, batches...)
+}
+
+// SetIngestFaults sets the faults to inject for the timeseries added via AddFaultyTimeSeries().
+// It should not be called after calling Start().
+func (rw *RemoteWriter) SetIngestFaults(f IngestFaults) {
+	rw.faults = f
+}
+
+// SetReplaySpeed makes the samples to be written at the given speed relative to the real time, i.e. a sample
+// is written when (time since the start * speed) has passed since the 0 timestamp. The timestamps of the samples
+// are not changed, hence the clock of the receiver must also run at this speed from the start.
+// It should not be called after calling Start().
+func (rw *RemoteWriter) SetReplaySpeed(speed float64) {
+	rw.speed = speed
+}
+
 // Start starts remote-writing the given timeseries. It returns the time corresponding to the 0 timestamp.
 func (rw *RemoteWriter) Start() time.Time {
 	now := time.Now().UTC()
 	nowMs := timestamp.FromTime(now)
 
-	// Flatten all samples from the timeSeries and sort by timestamp.
+	// Flatten all samples from the timeSeries and the timedBatches, and sort by the time to send them.
 	rw.allSamples = make([]sample, 0, rw.totalSamples)
-	for _, ts := range rw.timeSeries {
-		for _, s := range ts.Samples {
-			s.Timestamp += nowMs // Making 0 based timestamp relative to the current time.
-			rw.allSamples = append(rw.allSamples, sample{
-				labels: ts.Labels,
-				s:      s,
-			})
+	for i, allTs := range [][]prompb.TimeSeries{rw.timeSeries, rw.faultyTimeSeries} {
+		for _, ts := range allTs {
+			for _, s := range ts.Samples {
+				s.Timestamp += nowMs // Making 0 based timestamp relative to the current time.
+				rw.allSamples = append(rw.allSamples, sample{
+					labels: ts.Labels,
+					s:      s,
+					sendAt: s.Timestamp,
+					faulty: i == 1,
+				})
+			}
+		}
+	}
+	for _, b := range rw.timedBatches {
+		sendAt := nowMs + int64(b.SendAt/time.Millisecond)
+		for _, ts := range b.Series {
+			for _, s := range ts.Samples {
+				s.Timestamp += nowMs
+				rw.allSamples = append(rw.allSamples, sample{
+					labels: ts.Labels,
+					s:      s,
+					sendAt: sendAt,
+				})
+			}
 		}
 	}
-	sort.Slice(rw.allSamples, func(i, j int) bool {
+	sort.SliceStable(rw.allSamples, func(i, j int) bool {
+		if rw.allSamples[i].sendAt != rw.allSamples[j].sendAt {
+			return rw.allSamples[i].sendAt < rw.allSamples[j].sendAt
+		}
 		return rw.allSamples[i].s.Timestamp < rw.allSamples[j].s.Timestamp
 	})
 
@@ -98,30 +204,72 @@ func (rw *RemoteWriter) Start() time.Time {
 			idx int
 			buf []byte
 			err error
+
+			rng = rand.New(rand.NewSource(rw.faults.Seed))
+			// Number of batches of faulty samples dropped in a row.
+			consecutiveDrops int
+			// Batches of faulty samples waiting for their delay, in the order of their timestamps.
+			delayed []delayedBatch
 		)
 
 	Outer:
-		for idx < len(allSamples) {
-			// We wait till it's time for the next sample.
-			nextT := allSamples[idx].s.Timestamp
-			currT := timestamp.FromTime(time.Now().UTC())
-			sleepDuration := time.Duration(nextT-currT) * time.Millisecond
+		for idx < len(allSamples) || len(delayed) > 0 {
+			// We wait till it's time for the next sample or the next delayed batch.
+			nextT := int64(math.MaxInt64)
+			if idx < len(allSamples) {
+				nextT = allSamples[idx].sendAt
+			}
+			if len(delayed) > 0 && delayed[0].sendAt < nextT {
+				nextT = delayed[0].sendAt
+			}
+			// The time in the replay, which is the real time unless the replay speed is set.
+			currT := nowMs + int64(float64(timestamp.FromTime(time.Now().UTC())-nowMs)*rw.speed)
+			sleepDuration := time.Duration(float64(nextT-currT)/rw.speed) * time.Millisecond
 
 			select {
 			case <-rw.stopc:
 				break Outer
 			case <-time.After(sleepDuration):
-				var writeSeries []prompb.TimeSeries
-				currT := allSamples[idx].s.Timestamp
-				// Batch all samples for this timestamp together.
-				// Assumes that at a given timestamp a single series will have only 1 sample.
-				for idx < len(allSamples) && allSamples[idx].s.Timestamp == currT {
-					writeSeries = append(writeSeries, prompb.TimeSeries{
+				var writeSeries, faultySeries []prompb.TimeSeries
+				currT := nextT
+				// Batch all samples to send at this time together. All the historical samples (before the start)
+				// are batched together so that the alert generator does not see a partial history.
+				// A series has more than 1 sample in a batch only with the timed batches, in the order of their timestamps.
+				for idx < len(allSamples) && (allSamples[idx].sendAt == currT || allSamples[idx].sendAt < nowMs) {
+					ts := prompb.TimeSeries{
 						Labels:  allSamples[idx].labels,
 						Samples: []prompb.Sample{allSamples[idx].s},
-					})
+					}
+					if allSamples[idx].faulty {
+						faultySeries = append(faultySeries, ts)
+					} else {
+						writeSeries = append(writeSeries, ts)
+					}
 					idx++
 				}
+
+				if len(faultySeries) > 0 {
+					if rng.Float64() < rw.faults.DropRate && consecutiveDrops < cases.MaxIngestConsecutiveDrops {
+						consecutiveDrops++
+						level.Debug(rw.log).Log("msg", "Dropping a batch of samples on purpose", "timestamp", currT, "total_series", len(faultySeries))
+					} else {
+						consecutiveDrops = 0
+						sendAt := currT + rng.Int63n(int64(rw.faults.Delay/time.Millisecond)+1)
+						if n := len(delayed); n > 0 && delayed[n-1].sendAt > sendAt {
+							// Keep the order of the batches so that the samples are not out of order.
+							sendAt = delayed[n-1].sendAt
+						}
+						delayed = append(delayed, delayedBatch{sendAt: sendAt, series: faultySeries})
+					}
+				}
+				for len(delayed) > 0 && delayed[0].sendAt <= currT {
+					writeSeries = append(writeSeries, delayed[0].series...)
+					delayed = delayed[1:]
+				}
+				if len(writeSeries) == 0 {
+					break
+				}
+
 				buf, err = buildWriteRequest(writeSeries, buf)
 				if err != nil {
 					rw.errc <- err
@@ -130,17 +278,17 @@ func (rw *RemoteWriter) Start() time.Time {
 
 				level.Debug(rw.log).Log("msg", "Remote writing", "timestamp", currT, "total_series", len(writeSeries))
 				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-				err = rw.client.Store(ctx, buf)
+				reqID, err := rw.store(ctx, buf)
 				if err != nil {
 					cancel()
 					rw.errc <- err
-					level.Debug(rw.log).Log("msg", "Error in remote writing", "timestamp", currT, "total_series", len(writeSeries), "err", err)
+					level.Debug(rw.log).Log("msg", "Error in remote writing", "timestamp", currT, "total_series", len(writeSeries), "request_id", reqID, "err", err)
 					break
 				}
 				if err := ctx.Err(); err != nil {
 					cancel()
 					rw.errc <- err
-					level.Debug(rw.log).Log("msg", "Error in remote writing", "timestamp", currT, "total_series", len(writeSeries), "err", err)
+					level.Debug(rw.log).Log("msg", "Error in remote writing", "timestamp", currT, "total_series", len(writeSeries), "request_id", reqID, "err", err)
 					break
 				}
 				cancel()
@@ -152,6 +300,17 @@ func (rw *RemoteWriter) Start() time.Time {
 	return now
 }
 
+// store sends a snappy compressed write request to the remote write endpoint.
+// It returns the request ID used for the request.
+func (rw *RemoteWriter) store(ctx context.Context, req []byte) (string, error) {
+	header := http.Header{}
+	header.Set("Content-Encoding", "snappy")
+	header.Set("Content-Type", "application/x-protobuf")
+	header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	_, reqID, err := rw.client.Do(ctx, http.MethodPost, rw.url, req, header)
+	return reqID, err
+}
+
 func (rw *RemoteWriter) Error() error {
 	if rw.err != nil {
 		return rw.err
@@ -0,0 +1,330 @@
+package testsuite
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestRemoteWriterIngestFaults(t *testing.T) {
+	written := runRemoteWriter(t, IngestFaults{DropRate: 0.2, Delay: 30 * time.Millisecond, Seed: 1})
+
+	require.Len(t, written["normal"], 50)
+	// Some batches are dropped, but the rest are still written in order.
+	require.Less(t, len(written["faulty"]), 50)
+	require.Greater(t, len(written["faulty"]), 25)
+	require.IsIncreasing(t, written["faulty"])
+}
+
+func TestRemoteWriterMaxConsecutiveDrops(t *testing.T) {
+	written := runRemoteWriter(t, IngestFaults{DropRate: 0.99, Seed: 1})
+
+	require.Len(t, written["normal"], 50)
+	require.Greater(t, len(written["faulty"]), 50/(cases.MaxIngestConsecutiveDrops+1)-1)
+	// The samples are 10ms apart, hence no gap can be more than MaxIngestConsecutiveDrops samples.
+	prev := written["normal"][0] - 10
+	for _, ts := range written["faulty"] {
+		require.LessOrEqual(t, ts-prev, int64(10*(cases.MaxIngestConsecutiveDrops+1)))
+		prev = ts
+	}
+}
+
+// runRemoteWriter remote writes 50 samples of a "normal" and a "faulty" series with the given
+// faults, and returns the timestamps written for each series.
+func runRemoteWriter(t *testing.T, faults IngestFaults) map[string][]int64 {
+	var (
+		mtx     sync.Mutex
+		written = make(map[string][]int64) // Series name -> timestamps written.
+		errs    []error                    // Errors in the handler, checked after the writer is done.
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		req, err := decodeWriteRequest(r)
+		if err != nil {
+			errs = append(errs, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, ts := range req.Timeseries {
+			for _, s := range ts.Samples {
+				written[ts.Labels[0].Value] = append(written[ts.Labels[0].Value], s.Timestamp)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	rw, err := NewRemoteWriter(srv.URL, NewHTTPClient(HTTPClientOptions{}, nil), log.NewNopLogger())
+	require.NoError(t, err)
+	rw.SetIngestFaults(faults)
+
+	series := func(name string) []prompb.TimeSeries {
+		ts := prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: name}}}
+		for i := int64(0); i < 50; i++ {
+			ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: 10 * i, Value: 1})
+		}
+		return []prompb.TimeSeries{ts}
+	}
+	rw.AddTimeSeries(series("normal"))
+	rw.AddFaultyTimeSeries(series("faulty"))
+
+	rw.Start()
+	rw.Wait()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.Empty(t, errs)
+	require.NoError(t, rw.Error())
+	return written
+}
+
+func decodeWriteRequest(r *http.Request) (*prompb.WriteRequest, error) {
+	compressed, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, err
+	}
+	var req prompb.WriteRequest
+	return &req, proto.Unmarshal(b, &req)
+}
+
+func TestShiftTimeSeries(t *testing.T) {
+	org := []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "a"}},
+			Samples: []prompb.Sample{{Timestamp: 0, Value: 1}, {Timestamp: 5000, Value: 2}},
+		},
+	}
+
+	shifted := shiftTimeSeries(org, 1500*time.Millisecond)
+	require.Equal(t, []prompb.Sample{{Timestamp: 1500, Value: 1}, {Timestamp: 6500, Value: 2}}, shifted[0].Samples)
+	require.Equal(t, org[0].Labels, shifted[0].Labels)
+	// The original samples are not modified.
+	require.Equal(t, []prompb.Sample{{Timestamp: 0, Value: 1}, {Timestamp: 5000, Value: 2}}, org[0].Samples)
+}
+
+func TestRemoteWriterTimedBatches(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		requests []map[string][]int64 // Series name -> timestamps written, per request.
+		errs     []error
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		req, err := decodeWriteRequest(r)
+		if err != nil {
+			errs = append(errs, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		written := make(map[string][]int64)
+		for _, ts := range req.Timeseries {
+			for _, s := range ts.Samples {
+				written[ts.Labels[0].Value] = append(written[ts.Labels[0].Value], s.Timestamp)
+			}
+		}
+		requests = append(requests, written)
+	}))
+	defer srv.Close()
+
+	rw, err := NewRemoteWriter(srv.URL, NewHTTPClient(HTTPClientOptions{}, nil), log.NewNopLogger())
+	require.NoError(t, err)
+
+	series := func(name string, ts ...int64) prompb.TimeSeries {
+		s := prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: name}}}
+		for _, t := range ts {
+			s.Samples = append(s.Samples, prompb.Sample{Timestamp: t, Value: 1})
+		}
+		return s
+	}
+	rw.AddTimeSeries([]prompb.TimeSeries{series("normal", 0, 20, 40, 60)})
+	// A pause after the first sample, and then a burst of the samples held back with the next one.
+	rw.AddTimedBatches([]cases.TimedBatch{
+		{SendAt: 0, Series: []prompb.TimeSeries{series("timed", 0)}},
+		{SendAt: 40 * time.Millisecond, Series: []prompb.TimeSeries{series("timed", 20, 30, 40)}},
+	})
+
+	startMs := timestamp.FromTime(rw.Start())
+	rw.Wait()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.Empty(t, errs)
+	require.NoError(t, rw.Error())
+	rel := func(ts ...int64) []int64 {
+		for i := range ts {
+			ts[i] += startMs
+		}
+		return ts
+	}
+	require.Equal(t, []map[string][]int64{
+		{"normal": rel(0), "timed": rel(0)},
+		{"normal": rel(20)},
+		{"normal": rel(40), "timed": rel(20, 30, 40)},
+		{"normal": rel(60)},
+	}, requests)
+
+	shifted := shiftTimedBatches([]cases.TimedBatch{{SendAt: time.Second, Series: []prompb.TimeSeries{series("timed", 0)}}}, time.Second)
+	require.Equal(t, 2*time.Second, shifted[0].SendAt)
+	require.Equal(t, []prompb.Sample{{Timestamp: 1000, Value: 1}}, shifted[0].Series[0].Samples)
+}
+
+// smallCase is a test case with the given samples instead of the ones of the embedded test case.
+type smallCase struct {
+	cases.TestCase
+	samples []prompb.TimeSeries
+}
+
+func (tc smallCase) SamplesToRemoteWrite() []prompb.TimeSeries {
+	return tc.samples
+}
+
+// scheduledSmallCase is a smallCase with the given ScheduledSamples().
+type scheduledSmallCase struct {
+	smallCase
+	batches []cases.TimedBatch
+}
+
+func (tc scheduledSmallCase) ScheduledSamples() []cases.TimedBatch {
+	return tc.batches
+}
+
+func TestTestSuiteScheduledIngestion(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		timed [][]int64 // Timestamps of the scheduled series written, per request.
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		req, err := decodeWriteRequest(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var written []int64
+		for _, ts := range req.Timeseries {
+			if ts.Labels[0].Value != "timed" {
+				continue
+			}
+			for _, s := range ts.Samples {
+				written = append(written, s.Timestamp)
+			}
+		}
+		if written != nil {
+			timed = append(timed, written)
+		}
+	}))
+	defer srv.Close()
+
+	series := func(name string, ts ...int64) prompb.TimeSeries {
+		s := prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: name}}}
+		for _, t := range ts {
+			s.Samples = append(s.Samples, prompb.Sample{Timestamp: t, Value: 1})
+		}
+		return s
+	}
+	// A pause after the first sample, and then a burst of the samples held back with the next one.
+	scheduled := scheduledSmallCase{
+		smallCase: smallCase{TestCase: cases.PendingAndFiringAndResolved(), samples: []prompb.TimeSeries{series("timed", 0, 20, 30, 40)}},
+		batches: []cases.TimedBatch{
+			{SendAt: 0, Series: []prompb.TimeSeries{series("timed", 0)}},
+			{SendAt: 40 * time.Millisecond, Series: []prompb.TimeSeries{series("timed", 20, 30, 40)}},
+		},
+	}
+	normal := smallCase{TestCase: cases.TemplateFunctions(), samples: []prompb.TimeSeries{series("normal", 0, 20, 40)}}
+
+	// Shuffled, the test case started second is offset by the gap, and so are its batches.
+	opts := TestSuiteOptions{
+		Logger:          log.NewNopLogger(),
+		Cases:           []cases.TestCase{scheduled, normal},
+		RemoteWriteURL:  srv.URL,
+		BaseAPIURL:      srv.URL,
+		PromQLBaseURL:   srv.URL,
+		AlertServerPort: "8080",
+		Shuffle:         true,
+		Seed:            1,
+	}
+	var offset int64
+	if gn, _ := cases.Shuffle(opts.Cases, opts.Seed)[1].Describe(); gn == "PendingAndFiringAndResolved" {
+		offset = int64(shuffledCasesStartGap / time.Millisecond)
+	}
+	ts, err := NewTestSuite(opts)
+	require.NoError(t, err)
+
+	startMs := timestamp.FromTime(ts.remoteWriter.Start())
+	ts.remoteWriter.Wait()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.NoError(t, ts.remoteWriter.Error())
+	rel := func(ts ...int64) []int64 {
+		for i := range ts {
+			ts[i] += startMs + offset
+		}
+		return ts
+	}
+	require.Equal(t, [][]int64{rel(0), rel(20, 30, 40)}, timed)
+}
+
+func TestRemoteWriterReplaySpeed(t *testing.T) {
+	var (
+		mtx     sync.Mutex
+		written []int64
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		req, err := decodeWriteRequest(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, ts := range req.Timeseries {
+			for _, s := range ts.Samples {
+				written = append(written, s.Timestamp)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	rw, err := NewRemoteWriter(srv.URL, NewHTTPClient(HTTPClientOptions{}, nil), log.NewNopLogger())
+	require.NoError(t, err)
+	rw.AddTimeSeries([]prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "replayed"}},
+		Samples: []prompb.Sample{{Timestamp: 0, Value: 1}, {Timestamp: 2000, Value: 2}, {Timestamp: 4000, Value: 3}},
+	}})
+	// 4s of samples in 200ms.
+	rw.SetReplaySpeed(20)
+
+	start := time.Now()
+	startMs := timestamp.FromTime(rw.Start())
+	rw.Wait()
+	elapsed := time.Since(start)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.NoError(t, rw.Error())
+	require.GreaterOrEqual(t, int64(elapsed), int64(200*time.Millisecond))
+	require.Less(t, int64(elapsed), int64(2*time.Second))
+	// The timestamps of the samples are not changed.
+	require.Equal(t, []int64{startMs, startMs + 2000, startMs + 4000}, written)
+}
@@ -0,0 +1,125 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reportSchemaID is the $id of the JSON Schema returned by ReportSchema.
+const reportSchemaID = "https://github.com/prometheus/compliance/alert_generator/testsuite/report.schema.json"
+
+// ReportSchema returns the JSON Schema of the JSON reports of the test suite, i.e. the Score written to the score file
+// and the CheckReport lines of TestSuiteOptions.ResultStream, for the tools that consume them. It is generated from
+// the Go types via reflection, so it is always in sync with them. Every type is a definition in $defs, and a document
+// is valid if it is either of the reports. The fields with omitempty are optional and the others are required.
+func ReportSchema() ([]byte, error) {
+	g := &schemaGenerator{defs: map[string]interface{}{}}
+	score := g.ref(reflect.TypeOf(Score{}))
+	checkReport := g.ref(reflect.TypeOf(CheckReport{}))
+	if g.err != nil {
+		return nil, g.err
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     reportSchemaID,
+		"title":   "Reports of the alert generator compliance test suite",
+		"anyOf":   []interface{}{score, checkReport},
+		"$defs":   g.defs,
+	}, "", "  ")
+}
+
+// schemaGenerator generates the JSON Schema of the Go types as encoding/json marshals them.
+type schemaGenerator struct {
+	defs map[string]interface{} // Type name -> schema of the struct.
+	err  error                  // The first type that has no schema.
+}
+
+// ref returns a reference to the definition of the struct type, adding the definition if it is new.
+func (g *schemaGenerator) ref(t reflect.Type) map[string]interface{} {
+	if _, ok := g.defs[t.Name()]; !ok {
+		// Added before the fields so that a recursive type refers to itself.
+		g.defs[t.Name()] = nil
+		g.defs[t.Name()] = g.object(t)
+	}
+	return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+}
+
+// object returns the schema of the struct type, where the fields of the embedded structs are promoted like encoding/json does.
+func (g *schemaGenerator) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	g.addFields(t, props, &required)
+	sort.Strings(required)
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (g *schemaGenerator) addFields(t reflect.Type, props map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.addFields(f.Type, props, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// schema returns the schema of the type.
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Struct:
+		return g.ref(t)
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		if g.err == nil {
+			g.err = fmt.Errorf("no JSON Schema for the type %s", t)
+		}
+		return map[string]interface{}{}
+	}
+}
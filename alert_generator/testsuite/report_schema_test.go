@@ -0,0 +1,109 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// validateSchema is a minimal validator of the JSON document against the schema generated by ReportSchema,
+// covering only the keywords that it uses.
+func validateSchema(defs map[string]interface{}, schema map[string]interface{}, doc interface{}, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		return validateSchema(defs, defs[ref[len("#/$defs/"):]].(map[string]interface{}), doc, path)
+	}
+	switch schema["type"] {
+	case "object":
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %T", path, doc)
+		}
+		if props, ok := schema["properties"].(map[string]interface{}); ok {
+			for k, v := range obj {
+				p, ok := props[k]
+				if !ok {
+					return fmt.Errorf("%s: unknown property %q", path, k)
+				}
+				if err := validateSchema(defs, p.(map[string]interface{}), v, path+"."+k); err != nil {
+					return err
+				}
+			}
+			for _, r := range schema["required"].([]interface{}) {
+				if _, ok := obj[r.(string)]; !ok {
+					return fmt.Errorf("%s: missing required property %q", path, r)
+				}
+			}
+		}
+	case "array":
+		arr, ok := doc.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array, got %T", path, doc)
+		}
+		for i, v := range arr {
+			if err := validateSchema(defs, schema["items"].(map[string]interface{}), v, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := doc.(string); !ok {
+			return fmt.Errorf("%s: expected a string, got %T", path, doc)
+		}
+	case "boolean":
+		if _, ok := doc.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean, got %T", path, doc)
+		}
+	case "integer", "number":
+		if _, ok := doc.(float64); !ok {
+			return fmt.Errorf("%s: expected a number, got %T", path, doc)
+		}
+	default:
+		return fmt.Errorf("%s: unknown type %v", path, schema["type"])
+	}
+	return nil
+}
+
+func TestReportSchema(t *testing.T) {
+	b, err := ReportSchema()
+	require.NoError(t, err)
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &schema))
+	defs := schema["$defs"].(map[string]interface{})
+	require.ElementsMatch(t, []string{"Score", "CaseScore", "CheckReport", "SendLatency", "ClockDrift"}, keys(defs))
+
+	validate := func(def string, v interface{}) error {
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		var doc interface{}
+		require.NoError(t, json.Unmarshal(b, &doc))
+		return validateSchema(defs, defs[def].(map[string]interface{}), doc, def)
+	}
+
+	// Every field of the reports is in the schema, with all the optional fields set.
+	caseScore := CaseScore{
+		GroupName:    "Group",
+		Weight:       1,
+		FailedChecks: []string{checkNameAlertsAPI},
+		SendLatency:  newSendLatency([]time.Duration{time.Second}),
+		ClockDrift:   &ClockDrift{Time: time.Now(), Drift: 3},
+	}
+	require.NoError(t, validate("Score", Score{Percentage: 50, PassedWeight: 1, TotalWeight: 2, Cases: []CaseScore{caseScore, {GroupName: "Other", Passed: true}},
+		ClockDrift: []ClockDrift{{Time: time.Now(), Drift: -0.5}}}))
+	require.NoError(t, validate("CheckReport", CheckReport{Time: time.Now(), Generator: "prometheus", Check: checkNameAlertsAPI, Error: "err", CaseScore: caseScore}))
+	require.NoError(t, validate("CheckReport", CheckReport{Time: time.Now(), CaseScore: CaseScore{GroupName: "Group"}}))
+
+	// The embedded CaseScore is promoted into the CheckReport.
+	require.Contains(t, defs["CheckReport"].(map[string]interface{})["properties"], "group_name")
+	// A document without the required fields is invalid.
+	require.Error(t, validateSchema(defs, defs["Score"].(map[string]interface{}), map[string]interface{}{"percentage": 1.0}, "Score"))
+}
+
+func keys(m map[string]interface{}) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
@@ -0,0 +1,167 @@
+package testsuite
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/notifier"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// resendEpisode is a firing episode of an expected alert whose firing notifications are counted
+// with the strict resend count.
+type resendEpisode struct {
+	labels             labels.Labels
+	startsAt, resolved time.Time
+	interval           time.Duration // The group interval, which is the tolerance of the initial firing alert.
+}
+
+// firingSend is the number of firing notifications received for an alert with the given StartsAt.
+type firingSend struct {
+	startsAt time.Time
+	count    int
+}
+
+type resendCountErr struct {
+	labels             labels.Labels
+	startsAt           time.Time
+	window             time.Duration
+	minCount, maxCount int
+	count              int
+}
+
+func (e resendCountErr) expected() string {
+	if e.minCount == e.maxCount {
+		return fmt.Sprintf("%d", e.minCount)
+	}
+	return fmt.Sprintf("%d to %d", e.minCount, e.maxCount)
+}
+
+// expectedFiringSends returns the range of the number of firing notifications, i.e. the initial one and the
+// resends, that an alert firing for the given window sends when evaluated at the given interval.
+// An alert is resent at the first evaluation after the resend delay since it was last sent, which is the
+// evaluation at exactly the resend delay or the one after it depending on the alert generator, e.g. Prometheus
+// resends only once the resend delay has passed strictly. The evaluations that make the alert fire and resolve
+// can be up to an interval after the times expected by the test case, which changes the window by an interval
+// either way.
+func expectedFiringSends(window, interval time.Duration) (minCount, maxCount int) {
+	ceilDiv := func(a, b time.Duration) int {
+		if a <= 0 {
+			return 0
+		}
+		return int((a + b - 1) / b)
+	}
+	minPeriod := time.Duration(ceilDiv(cases.ResendDelay, interval)) * interval
+	maxPeriod := (cases.ResendDelay/interval + 1) * interval
+
+	minCount = ceilDiv(window-interval, maxPeriod)
+	if minCount < 1 {
+		// The initial firing alert is always sent.
+		minCount = 1
+	}
+	maxCount = ceilDiv(window+interval, minPeriod)
+	return minCount, maxCount
+}
+
+// addResendEpisodes registers the firing episodes of the expected alerts that get resolved, from their initial
+// firing alert. Registering an episode again has no effect.
+func (as *alertsServer) addResendEpisodes(alerts []cases.ExpectedAlert) {
+	if !as.strictResendCount {
+		return
+	}
+	for _, ea := range alerts {
+		if ea.Resend || ea.Resolved || ea.ResolvedTime.IsZero() {
+			continue
+		}
+		as.resendEpisodes[firingEpisode(ea)] = resendEpisode{
+			labels:   ea.Alert.Labels,
+			startsAt: ea.Alert.StartsAt,
+			resolved: ea.ResolvedTime,
+			interval: ea.TimeTolerance,
+		}
+	}
+}
+
+// countFiringSends counts the firing notifications received per alert and StartsAt.
+// It must be called with expectedAlertsMtx held.
+func (as *alertsServer) countFiringSends(now time.Time, alerts []notifier.Alert) {
+	if !as.strictResendCount {
+		return
+	}
+	for _, al := range alerts {
+		if as.ignoredGroups[al.Labels.Get("rulegroup")] || al.ResolvedAt(now) {
+			continue
+		}
+		id := al.Labels.String()
+		sends := as.firingSends[id]
+		found := false
+		for i := range sends {
+			if sends[i].startsAt.Equal(al.StartsAt) {
+				sends[i].count++
+				found = true
+				break
+			}
+		}
+		if !found {
+			sends = append(sends, firingSend{startsAt: al.StartsAt, count: 1})
+		}
+		as.firingSends[id] = sends
+	}
+}
+
+// checkResendCounts records the firing episodes resolved before now whose number of firing notifications is out of
+// the range given by expectedFiringSends as errors of their rule group. The notifications of the alert are matched
+// to the episode by the StartsAt within an interval of the expected StartsAt. The tolerated missed resends count
+// as received.
+func (as *alertsServer) checkResendCounts(now time.Time) {
+	if !as.strictResendCount {
+		return
+	}
+
+	as.expectedAlertsMtx.Lock()
+	defer as.expectedAlertsMtx.Unlock()
+
+	keys := make([]string, 0, len(as.resendEpisodes))
+	for key := range as.resendEpisodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		ep := as.resendEpisodes[key]
+		rg := ep.labels.Get("rulegroup")
+		if as.ignoredGroups[rg] {
+			continue
+		}
+		if ep.resolved.Add(ep.interval).After(now) {
+			// Not resolved yet, e.g. the test was stopped early.
+			continue
+		}
+		if !as.inAssertWindow(rg, ep.resolved) {
+			// Resolved before the assertion window.
+			continue
+		}
+		count := as.missedResends[key]
+		for _, s := range as.firingSends[ep.labels.String()] {
+			if !s.startsAt.Before(ep.startsAt) && s.startsAt.Before(ep.startsAt.Add(ep.interval)) {
+				count += s.count
+			}
+		}
+		window := ep.resolved.Sub(ep.startsAt)
+		minCount, maxCount := expectedFiringSends(window, ep.interval)
+		if count >= minCount && count <= maxCount {
+			continue
+		}
+		errs := as.getErr(rg)
+		errs.resendCountErrs = append(errs.resendCountErrs, resendCountErr{
+			labels:   ep.labels,
+			startsAt: ep.startsAt,
+			window:   window,
+			minCount: minCount,
+			maxCount: maxCount,
+			count:    count,
+		})
+	}
+}
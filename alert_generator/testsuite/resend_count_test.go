@@ -0,0 +1,91 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestExpectedFiringSends(t *testing.T) {
+	for _, c := range []struct {
+		window, interval   time.Duration
+		minCount, maxCount int
+	}{
+		// Resent every 60s or 70s.
+		{window: 90 * time.Second, interval: 10 * time.Second, minCount: 2, maxCount: 2},
+		{window: 150 * time.Second, interval: 10 * time.Second, minCount: 2, maxCount: 3},
+		// Shorter than an interval.
+		{window: 5 * time.Second, interval: 10 * time.Second, minCount: 1, maxCount: 1},
+		// Resent at every evaluation when the interval is longer than the resend delay.
+		{window: 5 * time.Minute, interval: 2 * time.Minute, minCount: 2, maxCount: 4},
+	} {
+		minCount, maxCount := expectedFiringSends(c.window, c.interval)
+		require.Equal(t, []int{c.minCount, c.maxCount}, []int{minCount, maxCount}, "window %s, interval %s", c.window, c.interval)
+	}
+}
+
+func TestAlertsServerStrictResendCount(t *testing.T) {
+	now := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	lbls := labels.FromStrings("alertname", "A", "rulegroup", "G")
+	interval := 10 * time.Second
+	resolvedAt := now.Add(90 * time.Second)
+	firing := func(ts time.Time) notifier.Alert {
+		return notifier.Alert{Labels: lbls, StartsAt: now.Add(time.Second), EndsAt: ts.Add(4 * cases.ResendDelay)}
+	}
+
+	for _, c := range []struct {
+		name  string
+		sends []time.Duration // Times of the firing notifications after now.
+		fails bool
+	}{
+		{name: "initial and a resend", sends: []time.Duration{time.Second, 71 * time.Second}},
+		{name: "no resend", sends: []time.Duration{time.Second}, fails: true},
+		{name: "resent at every evaluation", sends: []time.Duration{time.Second, 11 * time.Second, 21 * time.Second, 31 * time.Second}, fails: true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			as := newAlertsServer("", log.NewNopLogger())
+			as.strictResendCount = true
+			as.addExpectedAlerts(cases.ExpectedAlert{
+				TimeTolerance: interval,
+				Ts:            now,
+				NextState:     resolvedAt,
+				ResolvedTime:  resolvedAt,
+				EndsAtDelta:   4 * cases.ResendDelay,
+				Alert:         &notifier.Alert{Labels: lbls, StartsAt: now},
+			})
+
+			as.expectedAlertsMtx.Lock()
+			for _, d := range c.sends {
+				as.countFiringSends(now.Add(d), []notifier.Alert{firing(now.Add(d))})
+			}
+			// The resolved alert is not counted.
+			as.countFiringSends(resolvedAt.Add(time.Second), []notifier.Alert{{Labels: lbls, StartsAt: now.Add(time.Second), EndsAt: resolvedAt}})
+			as.expectedAlertsMtx.Unlock()
+
+			// Not resolved yet.
+			as.checkResendCounts(resolvedAt)
+			require.Len(t, as.getErr("G").resendCountErrs, 0)
+
+			as.checkResendCounts(resolvedAt.Add(time.Minute))
+			errs := as.getErr("G").resendCountErrs
+			if !c.fails {
+				require.Len(t, errs, 0)
+				return
+			}
+			require.Len(t, errs, 1)
+			require.Equal(t, len(c.sends), errs[0].count)
+			require.Equal(t, "2", errs[0].expected())
+			require.Equal(t, 90*time.Second, errs[0].window)
+			require.True(t, as.groupsFacingErrors()["G"])
+
+			describe := describeAlertReceptionErrors(as.groupsFacingErrors(), as.groupError())
+			require.Contains(t, describe, "Firing window: 1m30s, Expected: 2, Got: ")
+		})
+	}
+}
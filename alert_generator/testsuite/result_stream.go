@@ -0,0 +1,70 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// CheckReport is the result of a test case streamed via TestSuiteOptions.ResultStream as soon as it is known,
+// as newline delimited JSON. It is streamed when a check of the test case fails, and when the test case
+// finishes without any failed check. The final result of the test cases is in the Score.
+type CheckReport struct {
+	Time time.Time `json:"time"`
+	// Generator is the TestSuiteOptions.GeneratorName, if any.
+	Generator string `json:"generator,omitempty"`
+	// Check is the check that failed, one of the CaseScore.FailedChecks. Empty if the test case finished.
+	Check string `json:"check,omitempty"`
+	// Error is the error of the failed check.
+	Error string `json:"error,omitempty"`
+	CaseScore
+}
+
+type resultStreamer struct {
+	logger log.Logger
+
+	mtx sync.Mutex
+	enc *json.Encoder
+}
+
+func newResultStreamer(w io.Writer, logger log.Logger) *resultStreamer {
+	return &resultStreamer{
+		logger: logger,
+		enc:    json.NewEncoder(w),
+	}
+}
+
+// streamResult streams the result of the test case for the given error of a check, where a nil error means
+// that the test case finished. It does nothing if the results are not streamed.
+func (ts *TestSuite) streamResult(c cases.TestCase, err error) {
+	if ts.rs == nil {
+		return
+	}
+	groupName, _ := c.Describe()
+	r := CheckReport{
+		Time:      time.Now().UTC(),
+		Generator: ts.opts.GeneratorName,
+		CaseScore: CaseScore{
+			GroupName: groupName,
+			Weight:    caseWeight(c, ts.opts.CaseWeights),
+			Passed:    err == nil,
+		},
+	}
+	if err != nil {
+		r.Check = checkNameOf(err)
+		r.Error = err.Error()
+		r.FailedChecks = []string{r.Check}
+	}
+
+	ts.rs.mtx.Lock()
+	defer ts.rs.mtx.Unlock()
+	if err := ts.rs.enc.Encode(r); err != nil {
+		level.Error(ts.rs.logger).Log("msg", "Error in streaming the result", "rulegroup", groupName, "err", err)
+	}
+}
@@ -0,0 +1,54 @@
+package testsuite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestStreamResults(t *testing.T) {
+	var buf bytes.Buffer
+	ts := &TestSuite{
+		logger:              log.NewNopLogger(),
+		opts:                TestSuiteOptions{CaseWeights: map[string]float64{"TopKChurn": 2}},
+		ruleGroupTests:      make(map[string]cases.TestCase),
+		ruleGroupTestErrors: make(map[string][]error),
+		rs:                  newResultStreamer(&buf, log.NewNopLogger()),
+	}
+	for _, c := range []cases.TestCase{cases.PendingAndFiringAndResolved(), cases.TopKChurn()} {
+		gn, _ := c.Describe()
+		ts.ruleGroupTests[gn] = c
+	}
+
+	ts.removeGroups(map[string]error{"TopKChurn": checkError{check: checkNameRulesAPI, err: errors.New("rules do not match")}})
+	ts.removeGroups(map[string]error{"PendingAndFiringAndResolved": nil})
+	// Already removed test cases are not streamed again.
+	ts.removeGroups(map[string]error{"TopKChurn": checkError{check: checkNameAlertsAPI, err: errors.New("alerts mismatch")}})
+
+	var reports []CheckReport
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var r CheckReport
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &r), sc.Text())
+		require.False(t, r.Time.IsZero())
+		r.Time = r.Time.UTC()
+		reports = append(reports, r)
+	}
+	require.NoError(t, sc.Err())
+	require.Len(t, reports, 2)
+
+	require.Equal(t, "rules_api", reports[0].Check)
+	require.Equal(t, "rules do not match", reports[0].Error)
+	require.Equal(t, CaseScore{GroupName: "TopKChurn", Weight: 2, FailedChecks: []string{"rules_api"}}, reports[0].CaseScore)
+
+	require.Equal(t, "", reports[1].Check)
+	require.Equal(t, "", reports[1].Error)
+	require.Equal(t, CaseScore{GroupName: "PendingAndFiringAndResolved", Weight: 3, Passed: true}, reports[1].CaseScore)
+}
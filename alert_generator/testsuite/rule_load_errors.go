@@ -0,0 +1,116 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// InvalidRules is a rule file that an alert generator must fail to load, with a malformed expr in the
+// InvalidRules_Expr group and an unparseable 'for' in the InvalidRules_For group. It is written by the
+// rule_config_builder via -invalid-rules-file-path, to be checked with CheckRuleLoadErrors.
+const InvalidRules = `groups:
+  - name: InvalidRules_Expr
+    interval: 10s
+    rules:
+      - alert: InvalidRules_Expr_Alert
+        expr: sum(alert_generator_test_suite{rulegroup="InvalidRules_Expr"} > 10
+        labels:
+          rulegroup: InvalidRules_Expr
+  - name: InvalidRules_For
+    interval: 10s
+    rules:
+      - alert: InvalidRules_For_Alert
+        expr: alert_generator_test_suite{rulegroup="InvalidRules_For"} > 10
+        for: 5 parsecs
+        labels:
+          rulegroup: InvalidRules_For
+`
+
+// invalidRuleGroups are the names of the rule groups in InvalidRules.
+var invalidRuleGroups = []string{"InvalidRules_Expr", "InvalidRules_For"}
+
+// CheckRuleLoadErrors checks that the alert generator reports the error of loading InvalidRules instead of silently
+// ignoring the invalid rules or crashing. It is meant to be run after the rule file has been added to the rule files
+// of the alert generator and its configuration reloaded, e.g. via SIGHUP or POST /-/reload for Prometheus,
+// which keeps running with the previous configuration when the reload fails. It inspects the following endpoints:
+// * GET <BaseAPIURL>/api/v1/status/runtimeinfo, where reloadConfigSuccess must be false.
+// * GET <BaseAPIURL>/api/v1/rules, where none of the rule groups of InvalidRules must be loaded.
+// An alert generator that does not answer these has crashed or does not have the APIs, which fails the check.
+func CheckRuleLoadErrors(opts TestSuiteOptions) (yes bool, describe string, err error) {
+	u, err := url.Parse(opts.BaseAPIURL)
+	if err != nil {
+		return false, "", err
+	}
+	orgPath := u.Path
+	u.Path = path.Join(orgPath, "/api/v1/status/runtimeinfo")
+	runtimeInfoURL := u.String()
+	u.Path = path.Join(orgPath, "/api/v1/rules")
+	rulesURL := u.String()
+
+	client := NewHTTPClient(HTTPClientOptions{
+		UserAgent:           opts.UserAgent,
+		RequestIDs:          opts.RequestIDs,
+		MaxIdleConnsPerHost: opts.HTTPMaxIdleConnsPerHost,
+		Timeout:             opts.HTTPTimeout,
+		ForceHTTP2:          opts.HTTPForceHTTP2,
+		Headers:             opts.HTTPHeaders,
+	}, opts.Logger)
+
+	var problems []string
+	b, err := client.Get(runtimeInfoURL)
+	if err != nil {
+		return false, "", errors.Wrap(err, "get the runtime info")
+	}
+	reloadSuccess, err := parseReloadConfigSuccess(b)
+	if err != nil {
+		return false, "", errors.Wrap(err, "parse the runtime info")
+	}
+	if reloadSuccess {
+		problems = append(problems, "The runtime info reports that the last configuration reload was successful.")
+	}
+
+	b, err = client.Get(rulesURL)
+	if err != nil {
+		return false, "", errors.Wrap(err, "get the rules")
+	}
+	groups, err := parseAndGroupRulesCompat(b, opts.APICompat)
+	if err != nil {
+		return false, "", errors.Wrap(err, "parse the rules")
+	}
+	for _, gn := range invalidRuleGroups {
+		if _, ok := groups[gn]; ok {
+			problems = append(problems, fmt.Sprintf("The invalid rule group %q is loaded.", gn))
+		}
+	}
+
+	if len(problems) == 0 {
+		return true, "The alert generator reports the error of loading the invalid rules and did not load any of them.", nil
+	}
+	return false, "The alert generator does not report the error of loading the invalid rules:\n\t" + strings.Join(problems, "\n\t"), nil
+}
+
+// parseReloadConfigSuccess parses the response of GET /api/v1/status/runtimeinfo for whether the last
+// configuration reload was successful.
+func parseReloadConfigSuccess(b []byte) (bool, error) {
+	res := struct {
+		Status string `json:"status"`
+		Data   struct {
+			ReloadConfigSuccess *bool `json:"reloadConfigSuccess"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return false, err
+	}
+	if res.Status != "success" {
+		return false, errors.Errorf("expected the status to be success, got %q", res.Status)
+	}
+	if res.Data.ReloadConfigSuccess == nil {
+		return false, errors.New("no reloadConfigSuccess found")
+	}
+	return *res.Data.ReloadConfigSuccess, nil
+}
@@ -0,0 +1,81 @@
+package testsuite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidRules(t *testing.T) {
+	_, errs := rulefmt.Parse([]byte(InvalidRules))
+	require.NotEmpty(t, errs)
+
+	// The expr is invalid on its own too, with a valid 'for'.
+	_, errs = rulefmt.Parse([]byte(strings.Replace(InvalidRules, "5 parsecs", "5m", 1)))
+	require.NotEmpty(t, errs)
+	require.Contains(t, errs[0].Error(), "InvalidRules_Expr")
+}
+
+func TestCheckRuleLoadErrors(t *testing.T) {
+	for _, c := range []struct {
+		name        string
+		runtimeInfo string
+		groups      string
+		yes         bool
+		problem     string
+		err         string
+	}{
+		{
+			name:        "reported",
+			runtimeInfo: `{"status":"success","data":{"reloadConfigSuccess":false}}`,
+			groups:      `[{"name":"Other","rules":[]}]`,
+			yes:         true,
+		},
+		{
+			name:        "reload reported as successful",
+			runtimeInfo: `{"status":"success","data":{"reloadConfigSuccess":true}}`,
+			groups:      `[]`,
+			problem:     "last configuration reload was successful",
+		},
+		{
+			name:        "invalid group loaded",
+			runtimeInfo: `{"status":"success","data":{"reloadConfigSuccess":false}}`,
+			groups:      `[{"name":"InvalidRules_For","rules":[]}]`,
+			problem:     `The invalid rule group "InvalidRules_For" is loaded.`,
+		},
+		{
+			name:        "no reload status",
+			runtimeInfo: `{"status":"success","data":{}}`,
+			groups:      `[]`,
+			err:         "parse the runtime info: no reloadConfigSuccess found",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/prometheus/api/v1/status/runtimeinfo":
+					_, _ = w.Write([]byte(c.runtimeInfo))
+				case "/prometheus/api/v1/rules":
+					_, _ = w.Write([]byte(`{"status":"success","data":{"groups":` + c.groups + `}}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			yes, describe, err := CheckRuleLoadErrors(TestSuiteOptions{Logger: log.NewNopLogger(), BaseAPIURL: srv.URL + "/prometheus"})
+			if c.err != "" {
+				require.EqualError(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.yes, yes)
+			require.Contains(t, describe, c.problem)
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// Score is the compliance score of a test run. It is computed as
+//   100 * (sum of the weights of the test cases that passed) / (sum of the weights of all the test cases)
+// where a test case passed if none of its API, metrics or Alertmanager checks failed and all its alerts
+// were received as expected. The weight of a test case is cases.DefaultWeight unless it implements
+// cases.Weighted, and it can be overridden via TestSuiteOptions.CaseWeights.
+type Score struct {
+	// Percentage is between 0 and 100. It is 0 if the total weight is 0.
+	Percentage   float64     `json:"percentage"`
+	PassedWeight float64     `json:"passed_weight"`
+	TotalWeight  float64     `json:"total_weight"`
+	Cases        []CaseScore `json:"cases"`
+	// ClockDrift is the timeline of the drift of the clock of the alert generator measured during the test.
+	// Nil if TestSuiteOptions.ClockDriftThreshold is not set.
+	ClockDrift []ClockDrift `json:"clock_drift,omitempty"`
+}
+
+// CaseScore is the result of a single test case in the Score.
+type CaseScore struct {
+	GroupName string  `json:"group_name"`
+	Weight    float64 `json:"weight"`
+	Passed    bool    `json:"passed"`
+	// FailedChecks are the checks of the test case that failed, sorted. A test case is not checked anymore
+	// after one of its API, metrics or Alertmanager checks fails, hence those fail at most once.
+	FailedChecks []string `json:"failed_checks,omitempty"`
+	// SendLatency is the distribution of the latencies of the firing alerts received. Nil if none was received.
+	SendLatency *SendLatency `json:"send_latency,omitempty"`
+	// ClockDrift is the drift with the largest magnitude above TestSuiteOptions.ClockDriftThreshold measured
+	// while the test case was running, if any, which its timing failures may be due to.
+	ClockDrift *ClockDrift `json:"clock_drift,omitempty"`
+}
+
+// The checks of a test case as reported in CaseScore.FailedChecks.
+const (
+	checkNameAlertsAPI      = "alerts_api"
+	checkNameRulesAPI       = "rules_api"
+	checkNameAlertsMetric   = "alerts_metric"
+	checkNameQueries        = "queries"
+	checkNameAlertmanager   = "alertmanager"
+	checkNameAlertReception = "alert_reception"
+	checkNameAlertsTimeline = "alerts_timeline"
+)
+
+// checkError is the error of a failed check of a test case. The error message is the one of the check.
+type checkError struct {
+	check string
+	err   error
+}
+
+func (e checkError) Error() string {
+	return e.err.Error()
+}
+
+func (e checkError) Cause() error {
+	return e.err
+}
+
+// checkNameOf returns the name of the check that failed with the given error.
+func checkNameOf(err error) string {
+	if ce, ok := err.(checkError); ok {
+		return ce.check
+	}
+	return "unknown"
+}
+
+func (s Score) String() string {
+	passed := 0
+	for _, c := range s.Cases {
+		if c.Passed {
+			passed++
+		}
+	}
+	return fmt.Sprintf("Compliance score: %.2f%% (weight %g of %g passed, %d of %d test cases passed)",
+		s.Percentage, s.PassedWeight, s.TotalWeight, passed, len(s.Cases))
+}
+
+// Score returns the compliance score of the test. Same as WasTestSuccessful(), it must be called
+// after the test has finished.
+func (ts *TestSuite) Score() Score {
+	failed := make(map[string][]string)
+	for gn, errs := range ts.ruleGroupTestErrors {
+		for _, err := range errs {
+			failed[gn] = append(failed[gn], checkNameOf(err))
+		}
+	}
+	for gn := range ts.as.groupsFacingErrors() {
+		failed[gn] = append(failed[gn], checkNameAlertReception)
+	}
+	s := computeScore(ts.opts.Cases, ts.opts.CaseWeights, failed)
+	latencies := ts.as.sendLatencyDistributions()
+	drifts := ts.caseClockDrifts()
+	for i := range s.Cases {
+		s.Cases[i].SendLatency = latencies[s.Cases[i].GroupName]
+		if d, ok := drifts[s.Cases[i].GroupName]; ok {
+			s.Cases[i].ClockDrift = &d
+		}
+	}
+	if ts.clockDrifts != nil {
+		s.ClockDrift = ts.clockDrifts.all()
+	}
+	return s
+}
+
+// computeScore returns the score of the given test cases, where failed has the failed checks of the
+// test cases that failed by group name and weights has the overridden weights by group name.
+func computeScore(cs []cases.TestCase, weights map[string]float64, failed map[string][]string) Score {
+	s := Score{}
+	for _, c := range cs {
+		groupName, _ := c.Describe()
+		cScore := CaseScore{
+			GroupName:    groupName,
+			Weight:       caseWeight(c, weights),
+			Passed:       len(failed[groupName]) == 0,
+			FailedChecks: uniqueSorted(failed[groupName]),
+		}
+		s.TotalWeight += cScore.Weight
+		if cScore.Passed {
+			s.PassedWeight += cScore.Weight
+		}
+		s.Cases = append(s.Cases, cScore)
+	}
+	if s.TotalWeight > 0 {
+		s.Percentage = 100 * s.PassedWeight / s.TotalWeight
+	}
+	return s
+}
+
+func uniqueSorted(ss []string) []string {
+	if len(ss) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(ss))
+	var res []string
+	for _, s := range ss {
+		if !seen[s] {
+			seen[s] = true
+			res = append(res, s)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// caseWeight returns the weight of the test case, where weights has the overridden weights by group name.
+func caseWeight(c cases.TestCase, weights map[string]float64) float64 {
+	groupName, _ := c.Describe()
+	if w, ok := weights[groupName]; ok {
+		return w
+	}
+	if wc, ok := c.(cases.Weighted); ok {
+		return wc.Weight()
+	}
+	return cases.DefaultWeight
+}
+
+// LoadCaseWeights reads the weights of the test cases to be set in TestSuiteOptions.CaseWeights from
+// a YAML file, which is a map of the group name of the test case to its weight. For example:
+//   PendingAndFiringAndResolved: 5
+//   TemplateFunctions: 0.5
+func LoadCaseWeights(path string) (map[string]float64, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	weights := make(map[string]float64)
+	if err := yaml.Unmarshal(b, &weights); err != nil {
+		return nil, errors.Wrap(err, "unmarshal case weights")
+	}
+	return weights, nil
+}
+
+// validateCaseWeights checks that the weights are not negative, including the ones of the test cases,
+// and that the overridden weights are for the given test cases.
+func validateCaseWeights(cs []cases.TestCase, weights map[string]float64) error {
+	known := make(map[string]bool, len(cs))
+	for _, c := range cs {
+		groupName, _ := c.Describe()
+		known[groupName] = true
+		if w := caseWeight(c, weights); w < 0 {
+			return fmt.Errorf("weight of the test case %q cannot be negative, got %g", groupName, w)
+		}
+	}
+	for gn := range weights {
+		if !known[gn] {
+			return fmt.Errorf("weight given for an unknown test case %q", gn)
+		}
+	}
+	return nil
+}
+
+// LoadScore reads a score written as JSON, e.g. by a previous run to be used as the baseline of DiffScores.
+func LoadScore(path string) (Score, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Score{}, err
+	}
+	var s Score
+	if err := json.Unmarshal(b, &s); err != nil {
+		return Score{}, errors.Wrap(err, "unmarshal score")
+	}
+	return s, nil
+}
+
+// BaselineDiff is the difference of the results of the test cases of a run from a baseline run.
+type BaselineDiff struct {
+	// Regressions are the test cases that passed in the baseline and fail now.
+	Regressions []CaseDiff
+	// Fixes are the test cases that failed in the baseline and pass now.
+	Fixes []CaseDiff
+	// Changed are the test cases that fail in both the runs, but with different checks. These are not
+	// regressions, since a test case is not checked anymore after a failed check.
+	Changed []CaseDiff
+	// Added and Removed are the group names of the test cases only in the current run and only in the baseline.
+	Added, Removed []string
+}
+
+// CaseDiff is the difference of the result of a test case from the baseline.
+type CaseDiff struct {
+	GroupName string
+	// NewlyFailedChecks failed in the current run and not in the baseline.
+	NewlyFailedChecks []string
+	// NewlyPassedChecks failed in the baseline and not in the current run.
+	NewlyPassedChecks []string
+}
+
+// DiffScores returns the difference of the current score from the baseline, per test case and per check.
+// The test cases are in the order of the current score, followed by the removed ones in the order of the baseline.
+func DiffScores(baseline, current Score) BaselineDiff {
+	var d BaselineDiff
+	base := make(map[string]CaseScore, len(baseline.Cases))
+	for _, c := range baseline.Cases {
+		base[c.GroupName] = c
+	}
+	seen := make(map[string]bool, len(current.Cases))
+	for _, c := range current.Cases {
+		seen[c.GroupName] = true
+		b, ok := base[c.GroupName]
+		if !ok {
+			d.Added = append(d.Added, c.GroupName)
+			continue
+		}
+		cd := CaseDiff{
+			GroupName:         c.GroupName,
+			NewlyFailedChecks: subtractChecks(c.FailedChecks, b.FailedChecks),
+			NewlyPassedChecks: subtractChecks(b.FailedChecks, c.FailedChecks),
+		}
+		switch {
+		case b.Passed && !c.Passed:
+			d.Regressions = append(d.Regressions, cd)
+		case !b.Passed && c.Passed:
+			d.Fixes = append(d.Fixes, cd)
+		case !b.Passed && !c.Passed && len(cd.NewlyFailedChecks)+len(cd.NewlyPassedChecks) > 0:
+			d.Changed = append(d.Changed, cd)
+		}
+	}
+	for _, c := range baseline.Cases {
+		if !seen[c.GroupName] {
+			d.Removed = append(d.Removed, c.GroupName)
+		}
+	}
+	return d
+}
+
+// subtractChecks returns the checks in a that are not in b.
+func subtractChecks(a, b []string) []string {
+	var res []string
+Outer:
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				continue Outer
+			}
+		}
+		res = append(res, x)
+	}
+	return res
+}
+
+func (d BaselineDiff) String() string {
+	describe := "------------------------------------------\n"
+	describe += fmt.Sprintf("Compared with the baseline: %d regressions, %d fixes, %d changed, %d added and %d removed test cases\n",
+		len(d.Regressions), len(d.Fixes), len(d.Changed), len(d.Added), len(d.Removed))
+	for _, section := range []struct {
+		title string
+		diffs []CaseDiff
+	}{
+		{"Regressions (passed in the baseline, fail now)", d.Regressions},
+		{"Fixes (failed in the baseline, pass now)", d.Fixes},
+		{"Changed (fail in both, with different checks)", d.Changed},
+	} {
+		if len(section.diffs) == 0 {
+			continue
+		}
+		describe += "\n" + section.title + ":\n"
+		for _, cd := range section.diffs {
+			describe += "\t" + cd.GroupName
+			if len(cd.NewlyFailedChecks) > 0 {
+				describe += ", newly failed checks: " + strings.Join(cd.NewlyFailedChecks, ", ")
+			}
+			if len(cd.NewlyPassedChecks) > 0 {
+				describe += ", newly passed checks: " + strings.Join(cd.NewlyPassedChecks, ", ")
+			}
+			describe += "\n"
+		}
+	}
+	if len(d.Added) > 0 {
+		describe += "\nAdded (not in the baseline): " + strings.Join(d.Added, ", ") + "\n"
+	}
+	if len(d.Removed) > 0 {
+		describe += "\nRemoved (only in the baseline): " + strings.Join(d.Removed, ", ") + "\n"
+	}
+	return describe
+}
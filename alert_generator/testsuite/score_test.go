@@ -0,0 +1,107 @@
+package testsuite
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestComputeScore(t *testing.T) {
+	cs := []cases.TestCase{
+		cases.PendingAndFiringAndResolved(), // Weight 3.
+		cases.TemplateFunctions(),
+		cases.TopKChurn(),
+	}
+
+	s := computeScore(cs, nil, map[string][]string{"TemplateFunctions": {checkNameRulesAPI, checkNameAlertReception, checkNameRulesAPI}})
+	require.Equal(t, 4.0, s.PassedWeight)
+	require.Equal(t, 5.0, s.TotalWeight)
+	require.Equal(t, 80.0, s.Percentage)
+	require.Equal(t, []CaseScore{
+		{GroupName: "PendingAndFiringAndResolved", Weight: 3, Passed: true},
+		{GroupName: "TemplateFunctions", Weight: 1, Passed: false, FailedChecks: []string{"alert_reception", "rules_api"}},
+		{GroupName: "TopKChurn", Weight: 1, Passed: true},
+	}, s.Cases)
+	require.Equal(t, "Compliance score: 80.00% (weight 4 of 5 passed, 2 of 3 test cases passed)", s.String())
+
+	// Overridden weights.
+	s = computeScore(cs, map[string]float64{"PendingAndFiringAndResolved": 1, "TemplateFunctions": 2}, map[string][]string{"TemplateFunctions": {checkNameRulesAPI, checkNameAlertReception, checkNameRulesAPI}})
+	require.Equal(t, 50.0, s.Percentage)
+
+	// No weight at all.
+	s = computeScore(cs, map[string]float64{"PendingAndFiringAndResolved": 0, "TemplateFunctions": 0, "TopKChurn": 0}, nil)
+	require.Equal(t, 0.0, s.Percentage)
+
+	require.NoError(t, validateCaseWeights(cs, map[string]float64{"TopKChurn": 0}))
+	require.EqualError(t, validateCaseWeights(cs, map[string]float64{"TopKChurn": -1}), `weight of the test case "TopKChurn" cannot be negative, got -1`)
+	require.EqualError(t, validateCaseWeights(cs, map[string]float64{"Unknown": 1}), `weight given for an unknown test case "Unknown"`)
+}
+
+func TestLoadCaseWeights(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weights.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("PendingAndFiringAndResolved: 5\nTemplateFunctions: 0.5\n"), 0o644))
+
+	weights, err := LoadCaseWeights(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"PendingAndFiringAndResolved": 5, "TemplateFunctions": 0.5}, weights)
+}
+
+func TestDiffScores(t *testing.T) {
+	baseline := Score{Cases: []CaseScore{
+		{GroupName: "Regressed", Passed: true},
+		{GroupName: "Fixed", FailedChecks: []string{"rules_api"}},
+		{GroupName: "StillFailing", FailedChecks: []string{"alert_reception", "rules_api"}},
+		{GroupName: "SameFailure", FailedChecks: []string{"alerts_api"}},
+		{GroupName: "StillPassing", Passed: true},
+		{GroupName: "Removed", Passed: true},
+	}}
+	current := Score{Cases: []CaseScore{
+		{GroupName: "Added", FailedChecks: []string{"alerts_api"}},
+		{GroupName: "StillPassing", Passed: true},
+		{GroupName: "Regressed", FailedChecks: []string{"alert_reception", "queries"}},
+		{GroupName: "Fixed", Passed: true},
+		{GroupName: "StillFailing", FailedChecks: []string{"alert_reception", "alerts_metric"}},
+		{GroupName: "SameFailure", FailedChecks: []string{"alerts_api"}},
+	}}
+
+	d := DiffScores(baseline, current)
+	require.Equal(t, BaselineDiff{
+		Regressions: []CaseDiff{{GroupName: "Regressed", NewlyFailedChecks: []string{"alert_reception", "queries"}}},
+		Fixes:       []CaseDiff{{GroupName: "Fixed", NewlyPassedChecks: []string{"rules_api"}}},
+		Changed:     []CaseDiff{{GroupName: "StillFailing", NewlyFailedChecks: []string{"alerts_metric"}, NewlyPassedChecks: []string{"rules_api"}}},
+		Added:       []string{"Added"},
+		Removed:     []string{"Removed"},
+	}, d)
+
+	describe := d.String()
+	require.Contains(t, describe, "1 regressions, 1 fixes, 1 changed, 1 added and 1 removed test cases")
+	require.Contains(t, describe, "\tRegressed, newly failed checks: alert_reception, queries\n")
+	require.Contains(t, describe, "\tStillFailing, newly failed checks: alerts_metric, newly passed checks: rules_api\n")
+	require.NotContains(t, describe, "SameFailure")
+
+	require.Equal(t, BaselineDiff{}, DiffScores(current, current))
+}
+
+func TestLoadScore(t *testing.T) {
+	cs := []cases.TestCase{cases.PendingAndFiringAndResolved(), cases.TemplateFunctions()}
+	s := computeScore(cs, nil, map[string][]string{"TemplateFunctions": {checkNameAlertmanager}})
+	b, err := json.Marshal(s)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "score.json")
+	require.NoError(t, ioutil.WriteFile(path, b, 0o644))
+
+	loaded, err := LoadScore(path)
+	require.NoError(t, err)
+	require.Equal(t, s, loaded)
+
+	// The scores written before the failed checks were reported have none.
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"cases":[{"group_name":"TemplateFunctions","weight":1,"passed":false}]}`), 0o644))
+	loaded, err = LoadScore(path)
+	require.NoError(t, err)
+	require.Equal(t, []CaseScore{{GroupName: "TemplateFunctions", Weight: 1}}, loaded.Cases)
+}
@@ -0,0 +1,93 @@
+package testsuite
+
+import (
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/promql"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// maxSeedDataPoints is the max number of points per series of a range query allowed by Prometheus.
+const maxSeedDataPoints = 11000
+
+// SeedData is what to capture from a live Prometheus with SeedDataFromPrometheus.
+type SeedData struct {
+	// PrometheusURL is the base URL of the Prometheus to query via GET <url>/api/v1/query_range.
+	PrometheusURL string
+	// Query is the PromQL expression whose result is captured, usually a selector of the series
+	// that the rules to test are based on.
+	Query string
+	// Range is how far back from End the samples are captured, and Step is the interval between them,
+	// which becomes the interval of the input series.
+	Range, Step time.Duration
+	// End is the end of the captured range, which is rounded down to the Step. The current time if zero.
+	End time.Time
+}
+
+// SeedDataFromPrometheus captures the recent samples of the query from a live Prometheus via a range query
+// and returns them as the input series of a unit test file of `promtool test rules` (see cases.PromtoolFixture),
+// where the first step of the range is the zero time. Adding the rules and their alert_rule_test to the file
+// allows to test the rules against production-shaped data with TestSuiteOptions.Cases from cases.PromtoolTestCases.
+// Only the HTTP client settings of the options are used.
+func SeedDataFromPrometheus(opts TestSuiteOptions, sd SeedData) ([]byte, error) {
+	if sd.Query == "" {
+		return nil, errors.New("no query to capture the samples of")
+	}
+	if sd.Step <= 0 || sd.Range <= 0 {
+		return nil, errors.Errorf("the range %s and the step %s must be positive", sd.Range, sd.Step)
+	}
+	if points := sd.Range / sd.Step; points >= maxSeedDataPoints {
+		return nil, errors.Errorf("the range %s has %d steps of %s, more than the %d points allowed by Prometheus", sd.Range, points, sd.Step, maxSeedDataPoints)
+	}
+	u, err := url.Parse(sd.PrometheusURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, "/api/v1/query_range")
+
+	end := sd.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	end = end.Truncate(sd.Step)
+	start := end.Add(-sd.Range)
+
+	q := u.Query()
+	q.Set("query", sd.Query)
+	q.Set("start", start.Format(time.RFC3339Nano))
+	q.Set("end", end.Format(time.RFC3339Nano))
+	q.Set("step", model.Duration(sd.Step).String())
+	u.RawQuery = q.Encode()
+
+	client := NewHTTPClient(HTTPClientOptions{
+		UserAgent:           opts.UserAgent,
+		RequestIDs:          opts.RequestIDs,
+		MaxIdleConnsPerHost: opts.HTTPMaxIdleConnsPerHost,
+		Timeout:             opts.HTTPTimeout,
+		ForceHTTP2:          opts.HTTPForceHTTP2,
+		Headers:             opts.HTTPHeaders,
+	}, opts.Logger)
+	b, err := client.Get(u.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "range query")
+	}
+	mappedSeries, err := ParseAndGroupMatrix(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse range query response")
+	}
+
+	var series []promql.Series
+	for _, ss := range mappedSeries {
+		series = append(series, ss...)
+	}
+	if len(series) == 0 {
+		return nil, errors.Errorf("no series found for the query %q", sd.Query)
+	}
+	return cases.PromtoolFixture(series, timestamp.FromTime(start), sd.Step)
+}
@@ -0,0 +1,50 @@
+package testsuite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedDataFromPrometheus(t *testing.T) {
+	var gotQuery, gotStart, gotEnd, gotStep string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/prom/api/v1/query_range", r.URL.Path)
+		q := r.URL.Query()
+		gotQuery, gotStart, gotEnd, gotStep = q.Get("query"), q.Get("start"), q.Get("end"), q.Get("step")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"__name__":"up","job":"api"},"values":[[1641808740,"1"],[1641808755,"1"],[1641808770,"1"],[1641808785,"0"]]}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	b, err := SeedDataFromPrometheus(TestSuiteOptions{}, SeedData{
+		PrometheusURL: srv.URL + "/prom",
+		Query:         `up{job="api"}`,
+		Range:         time.Minute,
+		Step:          15 * time.Second,
+		// Rounded down to 2022-01-10T10:00:00Z.
+		End: time.Date(2022, 1, 10, 10, 0, 7, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	require.Equal(t, `up{job="api"}`, gotQuery)
+	require.Equal(t, "2022-01-10T09:59:00Z", gotStart)
+	require.Equal(t, "2022-01-10T10:00:00Z", gotEnd)
+	require.Equal(t, "15s", gotStep)
+	require.Equal(t, `rule_files: []
+evaluation_interval: 15s
+tests:
+    - interval: 15s
+      input_series:
+        - series: up{job="api"}
+          values: 1x2 0
+`, string(b))
+
+	_, err = SeedDataFromPrometheus(TestSuiteOptions{}, SeedData{PrometheusURL: srv.URL, Query: "up", Range: 48 * time.Hour, Step: 15 * time.Second})
+	require.Error(t, err)
+	_, err = SeedDataFromPrometheus(TestSuiteOptions{}, SeedData{PrometheusURL: srv.URL, Range: time.Hour, Step: 15 * time.Second})
+	require.Error(t, err)
+}
@@ -0,0 +1,135 @@
+package testsuite
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+)
+
+const (
+	notificationsSentMetric      = "prometheus_notifications_sent_total"
+	ruleEvaluationsMetric        = "prometheus_rule_evaluations_total"
+	ruleEvaluationFailuresMetric = "prometheus_rule_evaluation_failures_total"
+	ruleGroupRulesMetric         = "prometheus_rule_group_rules"
+
+	// selfMetricsTolerance is the allowed relative difference between what the metrics of the
+	// alert generator say and what the test suite saw. The correspondence is not exact because
+	// the metrics are scraped at slightly different times than the test starts and ends.
+	selfMetricsTolerance = 0.1
+	// selfMetricsMinSlack is the allowed absolute difference irrespective of selfMetricsTolerance.
+	// For the rule evaluations, it is per rule in the group.
+	selfMetricsMinSlack = 2
+)
+
+// selfMetrics is a snapshot of the metrics exposed by the alert generator that are
+// relevant for the test suite.
+type selfMetrics struct {
+	// notificationsSent is the max of prometheus_notifications_sent_total across all the Alertmanagers,
+	// since the test suite is one of them (and there can be another Alertmanager in the end-to-end mode).
+	notificationsSent float64
+	// The following are per rule group, i.e. group name -> value. The rule_group label of
+	// these metrics is of the form "<file>;<groupName>".
+	ruleEvaluations        map[string]float64 // prometheus_rule_evaluations_total.
+	ruleEvaluationFailures map[string]float64 // prometheus_rule_evaluation_failures_total.
+	groupRules             map[string]float64 // prometheus_rule_group_rules.
+}
+
+// parseSelfMetrics parses the metrics in the Prometheus text format.
+func parseSelfMetrics(b []byte) (selfMetrics, error) {
+	sm := selfMetrics{
+		ruleEvaluations:        make(map[string]float64),
+		ruleEvaluationFailures: make(map[string]float64),
+		groupRules:             make(map[string]float64),
+	}
+	p := textparse.NewPromParser(b)
+	for {
+		et, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return sm, errors.Wrap(err, "parse metrics")
+		}
+		if et != textparse.EntrySeries {
+			continue
+		}
+
+		_, _, v := p.Series()
+		var lset labels.Labels
+		p.Metric(&lset)
+		rg := lset.Get("rule_group")
+		groupName := rg[strings.LastIndex(rg, ";")+1:]
+		switch lset.Get(labels.MetricName) {
+		case notificationsSentMetric:
+			sm.notificationsSent = math.Max(sm.notificationsSent, v)
+		case ruleEvaluationsMetric:
+			sm.ruleEvaluations[groupName] += v
+		case ruleEvaluationFailuresMetric:
+			sm.ruleEvaluationFailures[groupName] += v
+		case ruleGroupRulesMetric:
+			sm.groupRules[groupName] += v
+		}
+	}
+
+	return sm, nil
+}
+
+// groupEvaluation is the information about a rule group to calculate its expected number of evaluations.
+type groupEvaluation struct {
+	name     string
+	interval time.Duration
+	numRules int
+}
+
+// compareSelfMetrics compares the increase in the metrics of the alert generator between the
+// start and end snapshot with what the test suite saw in that duration. The rule metrics are compared
+// per rule group of the cases. The notifications are compared in total since they are not per rule group.
+// It returns the discrepancies found, if any.
+func compareSelfMetrics(start, end selfMetrics, elapsed time.Duration, alertsReceived int, groups []groupEvaluation) []string {
+	var discrepancies []string
+
+	sent := end.notificationsSent - start.notificationsSent
+	if !withinTolerance(sent, float64(alertsReceived), selfMetricsMinSlack) {
+		discrepancies = append(discrepancies, fmt.Sprintf(
+			"%s increased by %.0f while the test suite received %d alerts", notificationsSentMetric, sent, alertsReceived))
+	}
+
+	for _, g := range groups {
+		endEvals, ok := end.ruleEvaluations[g.name]
+		if !ok {
+			discrepancies = append(discrepancies, fmt.Sprintf("%s not found for the group %q", ruleEvaluationsMetric, g.name))
+			continue
+		}
+		evals := endEvals - start.ruleEvaluations[g.name]
+		expEvals := float64(elapsed/g.interval) * float64(g.numRules)
+		if !withinTolerance(evals, expEvals, float64(selfMetricsMinSlack*g.numRules)) {
+			discrepancies = append(discrepancies, fmt.Sprintf(
+				"%s increased by %.0f for the group %q while %.0f were expected in %s at an interval of %s with %d rules",
+				ruleEvaluationsMetric, evals, g.name, expEvals, elapsed.Round(time.Second), g.interval, g.numRules))
+		}
+
+		if failures := end.ruleEvaluationFailures[g.name] - start.ruleEvaluationFailures[g.name]; failures > 0 {
+			discrepancies = append(discrepancies, fmt.Sprintf(
+				"%s increased by %.0f for the group %q while the rules are not expected to fail",
+				ruleEvaluationFailuresMetric, failures, g.name))
+		}
+
+		if rules, ok := end.groupRules[g.name]; ok && rules != float64(g.numRules) {
+			discrepancies = append(discrepancies, fmt.Sprintf(
+				"%s is %.0f for the group %q while it has %d rules", ruleGroupRulesMetric, rules, g.name, g.numRules))
+		}
+	}
+
+	return discrepancies
+}
+
+func withinTolerance(act, exp, minSlack float64) bool {
+	slack := math.Max(minSlack, selfMetricsTolerance*exp)
+	return math.Abs(act-exp) <= slack
+}
@@ -0,0 +1,68 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAndCompareSelfMetrics(t *testing.T) {
+	parse := func(notifications, evals string) selfMetrics {
+		sm, err := parseSelfMetrics([]byte(`# HELP prometheus_notifications_sent_total Total number of alerts sent.
+# TYPE prometheus_notifications_sent_total counter
+prometheus_notifications_sent_total{alertmanager="http://localhost:8080/"} ` + notifications + `
+prometheus_notifications_sent_total{alertmanager="http://localhost:9093/api/v2/alerts"} 3
+# HELP prometheus_rule_evaluations_total The total number of rule evaluations.
+# TYPE prometheus_rule_evaluations_total counter
+prometheus_rule_evaluations_total{rule_group="/etc/rules.yaml;GroupA"} ` + evals + `
+prometheus_rule_evaluations_total{rule_group="/etc/rules.yaml;GroupB"} 5
+# HELP prometheus_rule_evaluation_failures_total The total number of rule evaluation failures.
+# TYPE prometheus_rule_evaluation_failures_total counter
+prometheus_rule_evaluation_failures_total{rule_group="/etc/rules.yaml;GroupA"} 0
+prometheus_rule_evaluation_failures_total{rule_group="/etc/rules.yaml;GroupB"} 1
+# HELP prometheus_rule_group_rules The number of rules.
+# TYPE prometheus_rule_group_rules gauge
+prometheus_rule_group_rules{rule_group="/etc/rules.yaml;GroupA"} 2
+prometheus_rule_group_rules{rule_group="/etc/rules.yaml;GroupB"} 1
+`))
+		require.NoError(t, err)
+		return sm
+	}
+
+	start := parse("10", "100")
+	require.Equal(t, 10.0, start.notificationsSent)
+	require.Equal(t, map[string]float64{"GroupA": 100, "GroupB": 5}, start.ruleEvaluations)
+	require.Equal(t, map[string]float64{"GroupA": 0, "GroupB": 1}, start.ruleEvaluationFailures)
+	require.Equal(t, map[string]float64{"GroupA": 2, "GroupB": 1}, start.groupRules)
+
+	groups := []groupEvaluation{
+		{name: "GroupA", interval: 10 * time.Second, numRules: 2},
+		{name: "GroupB", interval: 10 * time.Second, numRules: 1},
+	}
+
+	// 10m at 10s interval is 60 evaluations of each rule.
+	end := parse("50", "220")
+	end.ruleEvaluations["GroupB"] = 64
+	require.Empty(t, compareSelfMetrics(start, end, 10*time.Minute, 41, groups))
+
+	// Too few alerts received and too many evaluations.
+	end.ruleEvaluations["GroupB"] = 80
+	require.Len(t, compareSelfMetrics(start, end, 10*time.Minute, 20, groups), 2)
+
+	// Group is missing from the metrics.
+	delete(end.ruleEvaluations, "GroupA")
+	require.Len(t, compareSelfMetrics(start, end, 10*time.Minute, 40, groups), 2)
+
+	// Failed evaluations and wrong number of rules are per group.
+	end = parse("50", "220")
+	end.ruleEvaluations["GroupB"] = 64
+	end.ruleEvaluationFailures["GroupB"] = 3
+	end.groupRules["GroupA"] = 1
+	discrepancies := compareSelfMetrics(start, end, 10*time.Minute, 41, groups)
+	require.Len(t, discrepancies, 2)
+	require.Contains(t, discrepancies[0], `for the group "GroupA"`)
+	require.Contains(t, discrepancies[0], ruleGroupRulesMetric)
+	require.Contains(t, discrepancies[1], `for the group "GroupB"`)
+	require.Contains(t, discrepancies[1], ruleEvaluationFailuresMetric)
+}
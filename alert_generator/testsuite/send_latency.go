@@ -0,0 +1,97 @@
+package testsuite
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// SendLatency is the distribution of the latencies of the firing alerts of a test case, where the latency of
+// an alert is the time it was received after it was expected to be sent, i.e. after the Ts of the expected
+// alert it matched. The latencies are within the time tolerance of the alerts as the later alerts do not match.
+type SendLatency struct {
+	Count int `json:"count"`
+	// The latencies are in seconds, and the quantiles are the nearest rank of the latencies.
+	Min float64 `json:"min_seconds"`
+	P50 float64 `json:"p50_seconds"`
+	P90 float64 `json:"p90_seconds"`
+	P99 float64 `json:"p99_seconds"`
+	Max float64 `json:"max_seconds"`
+}
+
+// newSendLatency returns the distribution of the given latencies, nil if there are none. It sorts the latencies.
+func newSendLatency(latencies []time.Duration) *SendLatency {
+	if len(latencies) == 0 {
+		return nil
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return &SendLatency{
+		Count: len(latencies),
+		Min:   latencies[0].Seconds(),
+		P50:   latencyQuantile(latencies, 0.5).Seconds(),
+		P90:   latencyQuantile(latencies, 0.9).Seconds(),
+		P99:   latencyQuantile(latencies, 0.99).Seconds(),
+		Max:   latencies[len(latencies)-1].Seconds(),
+	}
+}
+
+// latencyQuantile returns the nearest rank quantile of the sorted latencies.
+func latencyQuantile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(math.Ceil(q * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+type sendLatencyErr struct {
+	p99, budget time.Duration
+	count       int
+}
+
+func (e sendLatencyErr) String() string {
+	return fmt.Sprintf("p99 latency of %d firing alerts is %s, budget is %s", e.count, e.p99, e.budget)
+}
+
+// recordSendLatency records the latency of a firing alert received at now that matched the expected alert
+// sent at expTs. It must be called with expectedAlertsMtx held.
+func (as *alertsServer) recordSendLatency(rg string, expTs, now time.Time) {
+	as.sendLatencies[rg] = append(as.sendLatencies[rg], now.Sub(expTs))
+}
+
+// sendLatencyDistributions returns the distribution of the latencies of the firing alerts by group name.
+func (as *alertsServer) sendLatencyDistributions() map[string]*SendLatency {
+	as.expectedAlertsMtx.Lock()
+	defer as.expectedAlertsMtx.Unlock()
+
+	res := make(map[string]*SendLatency, len(as.sendLatencies))
+	for rg, latencies := range as.sendLatencies {
+		res[rg] = newSendLatency(latencies)
+	}
+	return res
+}
+
+// checkSendLatencies records the rule groups whose p99 latency of the firing alerts is more than
+// maxP99SendLatency as errors of the rule groups. No-op if maxP99SendLatency is not positive.
+func (as *alertsServer) checkSendLatencies() {
+	if as.maxP99SendLatency <= 0 {
+		return
+	}
+
+	as.expectedAlertsMtx.Lock()
+	defer as.expectedAlertsMtx.Unlock()
+
+	for rg, latencies := range as.sendLatencies {
+		if as.ignoredGroups[rg] || len(latencies) == 0 {
+			continue
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		p99 := latencyQuantile(latencies, 0.99)
+		if p99 <= as.maxP99SendLatency {
+			continue
+		}
+		errs := as.getErr(rg)
+		errs.sendLatencyErr = &sendLatencyErr{p99: p99, budget: as.maxP99SendLatency, count: len(latencies)}
+	}
+}
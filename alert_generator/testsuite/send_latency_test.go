@@ -0,0 +1,82 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestNewSendLatency(t *testing.T) {
+	require.Nil(t, newSendLatency(nil))
+
+	var latencies []time.Duration
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*100*time.Millisecond)
+	}
+	require.Equal(t, &SendLatency{Count: 100, Min: 0.1, P50: 5, P90: 9, P99: 9.9, Max: 10}, newSendLatency(latencies))
+
+	require.Equal(t, &SendLatency{Count: 1, Min: 2, P50: 2, P90: 2, P99: 2, Max: 2}, newSendLatency([]time.Duration{2 * time.Second}))
+}
+
+func TestAlertsServerSendLatency(t *testing.T) {
+	now := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	lbls := labels.FromStrings("alertname", "A", "rulegroup", "G")
+	resolvedAt := now.Add(10 * cases.ResendDelay)
+	var expected []cases.ExpectedAlert
+	for i := 0; i < 8; i++ {
+		expected = append(expected, cases.ExpectedAlert{
+			OrderingID:    i + 1,
+			TimeTolerance: 10 * time.Second,
+			Ts:            now.Add(time.Duration(i) * cases.ResendDelay),
+			Resend:        i != 0,
+			NextState:     resolvedAt,
+			ResolvedTime:  resolvedAt,
+			EndsAtDelta:   4 * cases.ResendDelay,
+			Alert:         &notifier.Alert{Labels: lbls, StartsAt: now},
+		})
+	}
+
+	for _, tc := range []struct {
+		name   string
+		budget time.Duration
+		expErr *sendLatencyErr
+	}{
+		{name: "no budget"},
+		{name: "within budget", budget: 3 * time.Second},
+		{name: "over budget", budget: 2500 * time.Millisecond, expErr: &sendLatencyErr{p99: 3 * time.Second, budget: 2500 * time.Millisecond, count: 4}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			as := newAlertsServer("", log.NewNopLogger())
+			as.maxP99SendLatency = tc.budget
+			as.addExpectedAlerts(expected...)
+
+			// The initial firing alert is 3s late, and the resends are expected MaxRTT before a resend delay
+			// after the previous one was received.
+			recv := now.Add(3 * time.Second)
+			for i := 0; i < 4; i++ {
+				as.processAlerts(recv, []notifier.Alert{{Labels: lbls, StartsAt: now.Add(time.Second), EndsAt: recv.Add(4 * cases.ResendDelay)}})
+				recv = recv.Add(cases.ResendDelay)
+			}
+			as.checkSendLatencies()
+
+			require.Equal(t, map[string]*SendLatency{
+				"G": {Count: 4, Min: 2, P50: 2, P90: 3, P99: 3, Max: 3},
+			}, as.sendLatencyDistributions())
+			errs := as.getErr("G")
+			require.Len(t, errs.matchingErrs, 0)
+			require.Equal(t, tc.expErr, errs.sendLatencyErr)
+			require.Equal(t, tc.expErr != nil, as.groupsFacingErrors()["G"])
+			if tc.expErr != nil {
+				describe := describeAlertReceptionErrors(as.groupsFacingErrors(), as.groupError())
+				require.Contains(t, describe, "Reason: Firing alerts sent slower than the latency budget\n")
+				require.Contains(t, describe, "p99 latency of 4 firing alerts is 3s, budget is 2.5s")
+			}
+		})
+	}
+}
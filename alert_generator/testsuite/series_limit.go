@@ -0,0 +1,77 @@
+package testsuite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// seriesCounter counts the distinct series remote written by the test cases, in total and by test case, to guard
+// the alert generator against a runaway cardinality of the test cases and the fixtures. See TestSuiteOptions.MaxSeries.
+type seriesCounter struct {
+	all    map[string]bool // Labels of the series of all the test cases.
+	byCase map[string]int  // Group name -> number of series of the test case.
+}
+
+func newSeriesCounter() *seriesCounter {
+	return &seriesCounter{
+		all:    make(map[string]bool),
+		byCase: make(map[string]int),
+	}
+}
+
+// add counts the distinct series of the given test case.
+func (sc *seriesCounter) add(groupName string, series []prompb.TimeSeries) {
+	seen := make(map[string]bool, len(series))
+	for _, s := range series {
+		key := seriesKey(s.Labels)
+		seen[key] = true
+		sc.all[key] = true
+	}
+	sc.byCase[groupName] += len(seen)
+}
+
+func (sc *seriesCounter) total() int {
+	return len(sc.all)
+}
+
+// check returns an error with the number of series by test case if there are more than maxSeries in total.
+// No limit if maxSeries is 0.
+func (sc *seriesCounter) check(maxSeries int) error {
+	if maxSeries <= 0 || sc.total() <= maxSeries {
+		return nil
+	}
+	return fmt.Errorf("the test cases have %d series in total, more than the max of %d, series by test case: %s",
+		sc.total(), maxSeries, sc.String())
+}
+
+// String returns the number of series by test case, the test cases with the most series first.
+func (sc *seriesCounter) String() string {
+	groupNames := make([]string, 0, len(sc.byCase))
+	for gn := range sc.byCase {
+		groupNames = append(groupNames, gn)
+	}
+	sort.Slice(groupNames, func(i, j int) bool {
+		if sc.byCase[groupNames[i]] != sc.byCase[groupNames[j]] {
+			return sc.byCase[groupNames[i]] > sc.byCase[groupNames[j]]
+		}
+		return groupNames[i] < groupNames[j]
+	})
+	counts := make([]string, 0, len(groupNames))
+	for _, gn := range groupNames {
+		counts = append(counts, fmt.Sprintf("%s=%d", gn, sc.byCase[gn]))
+	}
+	return strings.Join(counts, ",")
+}
+
+// seriesKey returns a key of the labels of a series that is unique to the label set regardless of the order of the labels.
+func seriesKey(lbls []prompb.Label) string {
+	pairs := make([]string, 0, len(lbls))
+	for _, l := range lbls {
+		pairs = append(pairs, l.Name+"\xff"+l.Value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\xfe")
+}
@@ -0,0 +1,66 @@
+package testsuite
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestSeriesCounter(t *testing.T) {
+	series := func(lbls ...string) prompb.TimeSeries {
+		var s prompb.TimeSeries
+		for i := 0; i < len(lbls); i += 2 {
+			s.Labels = append(s.Labels, prompb.Label{Name: lbls[i], Value: lbls[i+1]})
+		}
+		return s
+	}
+
+	sc := newSeriesCounter()
+	sc.add("A", []prompb.TimeSeries{
+		series("__name__", "a", "rulegroup", "A"),
+		// The same series with the labels in another order.
+		series("rulegroup", "A", "__name__", "a"),
+		series("__name__", "a", "rulegroup", "A", "instance", "1"),
+	})
+	sc.add("B", []prompb.TimeSeries{series("__name__", "b", "rulegroup", "B")})
+	sc.add("C", []prompb.TimeSeries{series("__name__", "c", "rulegroup", "C")})
+	require.Equal(t, 4, sc.total())
+	require.Equal(t, "A=2,B=1,C=1", sc.String())
+
+	require.NoError(t, sc.check(0))
+	require.NoError(t, sc.check(4))
+	require.EqualError(t, sc.check(3), "the test cases have 4 series in total, more than the max of 3, series by test case: A=2,B=1,C=1")
+}
+
+func TestMaxSeries(t *testing.T) {
+	opts := TestSuiteOptions{
+		Logger:          log.NewNopLogger(),
+		Cases:           []cases.TestCase{cases.PendingAndFiringAndResolved(), cases.ManyToManyMatch()},
+		RemoteWriteURL:  "http://localhost:9090/api/v1/write",
+		BaseAPIURL:      "http://localhost:9090",
+		PromQLBaseURL:   "http://localhost:9090",
+		AlertServerPort: "8080",
+	}
+	ts, err := NewTestSuite(opts)
+	require.NoError(t, err)
+	total := ts.seriesCounter.total()
+	require.Greater(t, total, 1)
+
+	opts.MaxSeries = total
+	_, err = NewTestSuite(opts)
+	require.NoError(t, err)
+
+	opts.MaxSeries = total - 1
+	_, err = NewTestSuite(opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "series by test case: ")
+	require.Contains(t, err.Error(), "ManyToManyMatch=")
+
+	opts.MaxSeries = -1
+	_, err = NewTestSuite(opts)
+	require.EqualError(t, err, "validate options: max series cannot be negative, got -1")
+}
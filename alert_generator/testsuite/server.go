@@ -26,13 +26,48 @@ type alertsServer struct {
 
 	expectedAlertsMtx sync.Mutex
 	expectedAlerts    map[string]*expectedAlerts
+	ignoredGroups     map[string]bool         // Groups whose alerts are not checked.
+	assertWindows     map[string]assertWindow // Groups whose alerts are only checked within a window.
+	detectDuplicates  bool
+	lastSent          map[string]sentAlert // Labels string of the alert -> last time it was received. Only with detectDuplicates.
+	// allowedMissedResends is the number of missed resends of a firing alert tolerated per firing episode.
+	allowedMissedResends int
+	missedResends        map[string]int // Firing episode -> number of missed resends tolerated so far.
+	strictResendCount    bool
+	resendEpisodes       map[string]resendEpisode // Firing episode -> episode. Only with strictResendCount.
+	firingSends          map[string][]firingSend  // Labels string of the alert -> firing notifications received. Only with strictResendCount.
+	batchByGroup         bool
+	maxBatchSize         int                        // No limit if 0.
+	lastBatch            map[string]time.Time       // Group name -> last time its alerts were received. Only with batchByGroup.
+	sendLatencies        map[string][]time.Duration // Group name -> latencies of the firing alerts received.
+	maxP99SendLatency    time.Duration              // No budget if 0.
+	calibrating          bool
+	calibrationReceived  []time.Time // Times the firing calibration alert was received. Only while calibrating.
 
 	errsMtx sync.Mutex
 	errs    map[string]*allErrs
 
+	receivedMtx sync.Mutex
+	received    int // Total number of alerts received.
+
+	metrics *receiverMetrics
+	clock   Clock // Tells the time at which the alerts are received.
+
+	trace *alertTrace // nil if the alerts are not traced.
+
+	validators    []AlertValidator
+	violationsMtx sync.Mutex
+	violations    map[string]map[string]alertViolation // Validator name -> labels string of the alert -> first violation.
+
 	wg sync.WaitGroup
 }
 
+// assertWindow is the time range within which the alerts of a group are checked. The alerts are still matched
+// outside it so that the expected times of the resends are adjusted, but no error is recorded.
+type assertWindow struct {
+	from, until time.Time
+}
+
 type expectedAlerts struct {
 	lastSeen time.Time
 	alerts   []cases.ExpectedAlert
@@ -46,6 +81,23 @@ type allErrs struct {
 	unexpectedAlerts []unexpectedErr
 
 	matchingErrs []matchingErr
+
+	// Alerts that were received again with the same StartsAt and EndsAt within a resend cycle.
+	// Only detected when opted in.
+	duplicateSends []duplicateErr
+
+	// Resends of firing alerts that were missed but tolerated as the next resend covers them.
+	// These do not fail the rule group.
+	toleratedMissedResends []cases.ExpectedAlert
+
+	// Firing episodes with a number of firing notifications other than expected. Only checked when opted in.
+	resendCountErrs []resendCountErr
+
+	// Requests whose batching of the alerts was other than asserted. Only checked when opted in.
+	batchErrs []batchErr
+
+	// The p99 latency of the firing alerts when it was over the budget. Only checked when opted in.
+	sendLatencyErr *sendLatencyErr
 }
 
 type matchingErr struct {
@@ -65,6 +117,17 @@ func newAlertsServer(port string, logger log.Logger) *alertsServer {
 		logger:         log.With(logger, "component", "alertsServer"),
 		errs:           make(map[string]*allErrs),
 		expectedAlerts: make(map[string]*expectedAlerts),
+		ignoredGroups:  map[string]bool{calibrationGroup: true},
+		assertWindows:  make(map[string]assertWindow),
+		lastSent:       make(map[string]sentAlert),
+		missedResends:  make(map[string]int),
+		resendEpisodes: make(map[string]resendEpisode),
+		firingSends:    make(map[string][]firingSend),
+		lastBatch:      make(map[string]time.Time),
+		sendLatencies:  make(map[string][]time.Duration),
+		violations:     make(map[string]map[string]alertViolation),
+		metrics:        newReceiverMetrics(),
+		clock:          realClock{},
 	}
 	as.server = &http.Server{
 		Addr:         ":" + port, // TODO: take this as a config.
@@ -76,10 +139,24 @@ func newAlertsServer(port string, logger log.Logger) *alertsServer {
 }
 
 func (as *alertsServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	now := time.Now().UTC()
+	switch req.URL.Path {
+	case receiverHealthPath:
+		res.WriteHeader(http.StatusOK)
+		_, _ = res.Write([]byte("Healthy.\n"))
+		return
+	case receiverMetricsPath:
+		as.metrics.handler.ServeHTTP(res, req)
+		return
+	}
+
+	now := as.clock.Now().UTC()
+	as.metrics.requests.Inc()
+	as.metrics.requestsInFlight.Inc()
+	defer as.metrics.requestsInFlight.Dec()
 	b, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		level.Error(as.logger).Log("msg", "Error in reading request body", "err", err.Error())
+		as.metrics.droppedRequests.Inc()
 		res.WriteHeader(http.StatusBadRequest) // Or is it 500?
 		return
 	}
@@ -88,13 +165,39 @@ func (as *alertsServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	err = json.Unmarshal(b, &alerts)
 	if err != nil {
 		level.Error(as.logger).Log("msg", "Error in unmarshaling request body", "err", err.Error())
+		as.metrics.decodeErrors.Inc()
+		as.metrics.droppedRequests.Inc()
 		res.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
 	level.Info(as.logger).Log("msg", "Received alerts", "num_alerts", len(alerts))
+	as.receivedMtx.Lock()
+	as.received += len(alerts)
+	as.receivedMtx.Unlock()
+	as.metrics.alertsReceived.Add(float64(len(alerts)))
+
+	if as.trace != nil {
+		if err := as.trace.writeAlerts(now, alerts); err != nil {
+			level.Error(as.logger).Log("msg", "Error in writing the alert trace", "err", err)
+		}
+	}
+
+	as.processAlerts(now, alerts)
+
+	res.WriteHeader(http.StatusOK)
+}
+
+// processAlerts matches the alerts received at the given time with the expected alerts.
+func (as *alertsServer) processAlerts(now time.Time, alerts []notifier.Alert) {
+	as.validateAlerts(now, alerts)
+
 	as.expectedAlertsMtx.Lock()
 
+	as.detectDuplicateSends(now, alerts)
+	as.checkBatching(now, alerts)
+	as.countFiringSends(now, alerts)
+
 	var addBack []cases.ExpectedAlert
 	var missedAlerts []cases.ExpectedAlert
 
@@ -102,10 +205,20 @@ func (as *alertsServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	success := make(map[string]cases.ExpectedAlert)
 	for _, al := range alerts {
 		fmt.Println("GOT ALERT", al)
+		if as.calibrating && al.Labels.Get("rulegroup") == calibrationGroup && !al.ResolvedAt(now) {
+			as.calibrationReceived = append(as.calibrationReceived, now)
+		}
+		if as.ignoredGroups[al.Labels.Get("rulegroup")] {
+			continue
+		}
 		id := al.Labels.String()
 		exp := as.getPossibleAlert(now, id)
 		errs := as.getErr(al.Labels.Get("rulegroup"))
+		inWindow := as.inAssertWindow(al.Labels.Get("rulegroup"), now)
 		if len(exp) == 0 {
+			if !inWindow {
+				continue
+			}
 			errs.unexpectedAlerts = append(errs.unexpectedAlerts, unexpectedErr{
 				t:     now,
 				alert: al,
@@ -120,6 +233,9 @@ func (as *alertsServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 			if err == nil {
 				// We found a match.
 				success[id] = ex
+				if !ex.Resolved && inWindow {
+					as.recordSendLatency(al.Labels.Get("rulegroup"), ex.Ts, now)
+				}
 				idx = i
 				me = nil
 				break
@@ -158,7 +274,9 @@ func (as *alertsServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		} else {
 			// None matches. Put back the alerts to match future alerts.
 			addBack = append(addBack, exp...)
-			errs.matchingErrs = append(errs.matchingErrs, *me)
+			if inWindow {
+				errs.matchingErrs = append(errs.matchingErrs, *me)
+			}
 		}
 	}
 	as.addExpectedAlerts(addBack...)
@@ -186,8 +304,6 @@ Outer2:
 	}
 
 	as.expectedAlertsMtx.Unlock()
-
-	res.WriteHeader(http.StatusOK)
 }
 
 func (as *alertsServer) getErr(rg string) *allErrs {
@@ -202,6 +318,27 @@ func (as *alertsServer) getErr(rg string) *allErrs {
 	return ae
 }
 
+// ignoreGroup makes the alerts of the given group not to be checked.
+func (as *alertsServer) ignoreGroup(groupName string) {
+	as.expectedAlertsMtx.Lock()
+	defer as.expectedAlertsMtx.Unlock()
+	as.ignoredGroups[groupName] = true
+}
+
+// setAssertWindow makes the errors in the alerts of the given group to be recorded only within the given times.
+func (as *alertsServer) setAssertWindow(groupName string, from, until time.Time) {
+	as.expectedAlertsMtx.Lock()
+	defer as.expectedAlertsMtx.Unlock()
+	as.assertWindows[groupName] = assertWindow{from: from, until: until}
+}
+
+// inAssertWindow tells if the errors of the given group at the given time are to be recorded.
+// It must be called with expectedAlertsMtx held.
+func (as *alertsServer) inAssertWindow(groupName string, t time.Time) bool {
+	w, ok := as.assertWindows[groupName]
+	return !ok || (!t.Before(w.from) && !t.After(w.until))
+}
+
 func (as *alertsServer) addExpectedAlerts(alerts ...cases.ExpectedAlert) {
 	seen := make(map[string]struct{})
 	for _, a := range alerts {
@@ -220,6 +357,7 @@ func (as *alertsServer) addExpectedAlerts(alerts ...cases.ExpectedAlert) {
 			return ea.alerts[i].OrderingID < ea.alerts[j].OrderingID
 		})
 	}
+	as.addResendEpisodes(alerts)
 }
 
 // getPossibleAlert gives possible alerts for the given time and labels and removes
@@ -229,20 +367,34 @@ func (as *alertsServer) getPossibleAlert(now time.Time, lblsString string) []cas
 
 	// The additional allocations for every call is a design choice to keep the code simple
 	// since the absolute size of total allocations will be tiny.
-	var missedAlerts []cases.ExpectedAlert
+	var missedAlerts, toleratedAlerts []cases.ExpectedAlert
 
 	for id, eas := range as.expectedAlerts {
 		var newExpAlerts []cases.ExpectedAlert
+		// Firing episode -> time when the resend after a tolerated missed resend is expected.
+		nextResend := make(map[string]time.Time)
 		for _, ea := range eas.alerts {
+			if t, ok := nextResend[firingEpisode(ea)]; ok && ea.Resend && !ea.Resolved && ea.Ts.Before(t) {
+				// The resends were adjusted to the time of the missed resend. The alert generator sends the next
+				// one a resend delay after the missed one, which itself could have been late by the tolerance.
+				ea.Ts = t
+				ea.TimeTolerance *= 2
+			}
 			// TODO: 2*cases.MaxAlertSendDelay because of some edge case. Like missed by some milli/micro seconds. Fix it.
 			if ea.ShouldBeIgnored() {
 				continue
 			}
 			if ea.Ts.Add(ea.TimeTolerance + (2 * cases.MaxRTT)).Before(now) {
 				fmt.Println("Missed 2")
-				if !ea.CanBeIgnored() {
-					missedAlerts = append(missedAlerts, ea)
+				if ea.CanBeIgnored() {
+					continue
+				}
+				if as.canTolerateMissedResend(ea) {
+					toleratedAlerts = append(toleratedAlerts, ea)
+					nextResend[firingEpisode(ea)] = ea.Ts.Add(cases.ResendDelay)
+					continue
 				}
+				missedAlerts = append(missedAlerts, ea)
 			} else if id == lblsString && now.After(ea.Ts) && now.Before(ea.Ts.Add(ea.TimeTolerance+(2*cases.MaxRTT))) {
 				alerts = append(alerts, ea)
 			} else {
@@ -253,15 +405,54 @@ func (as *alertsServer) getPossibleAlert(now time.Time, lblsString string) []cas
 	}
 
 	as.addMissedAlerts(missedAlerts)
+	as.addToleratedMissedResends(toleratedAlerts)
 
 	return alerts
 }
 
+// addMissedAlerts records the missed alerts, except the resends of firing alerts within the allowed missed resends.
 func (as *alertsServer) addMissedAlerts(missedAlerts []cases.ExpectedAlert) {
+	var tolerated []cases.ExpectedAlert
 	for _, sa := range missedAlerts {
+		if !as.inAssertWindow(sa.Alert.Labels.Get("rulegroup"), sa.Ts) {
+			continue
+		}
+		if as.canTolerateMissedResend(sa) {
+			tolerated = append(tolerated, sa)
+			continue
+		}
 		errs := as.getErr(sa.Alert.Labels.Get("rulegroup"))
 		errs.missedAlerts = append(errs.missedAlerts, sa)
 	}
+	as.addToleratedMissedResends(tolerated)
+}
+
+func (as *alertsServer) addToleratedMissedResends(tolerated []cases.ExpectedAlert) {
+	for _, sa := range tolerated {
+		level.Warn(as.logger).Log("msg", "Tolerating a missed resend of a firing alert", "alert", sa.Alert.Labels.String(), "expected_at", sa.Ts)
+		errs := as.getErr(sa.Alert.Labels.Get("rulegroup"))
+		errs.toleratedMissedResends = append(errs.toleratedMissedResends, sa)
+	}
+}
+
+// canTolerateMissedResend tells if the missed alert is a resend of a firing alert within the allowed missed resends
+// of its firing episode, and counts it if so. The initial firing alert and the resolved alerts are never tolerated.
+// It must be called with expectedAlertsMtx held.
+func (as *alertsServer) canTolerateMissedResend(ea cases.ExpectedAlert) bool {
+	if !ea.Resend || ea.Resolved {
+		return false
+	}
+	episode := firingEpisode(ea)
+	if as.missedResends[episode] >= as.allowedMissedResends {
+		return false
+	}
+	as.missedResends[episode]++
+	return true
+}
+
+// firingEpisode identifies the firing episode of the expected alert by its labels and StartsAt.
+func firingEpisode(ea cases.ExpectedAlert) string {
+	return ea.Alert.Labels.String() + "@" + ea.Alert.StartsAt.String()
 }
 
 func (as *alertsServer) Start() {
@@ -293,6 +484,13 @@ func (as *alertsServer) runningError() error {
 	).Err()
 }
 
+// numReceived returns the total number of alerts received so far.
+func (as *alertsServer) numReceived() int {
+	as.receivedMtx.Lock()
+	defer as.receivedMtx.Unlock()
+	return as.received
+}
+
 func (as *alertsServer) groupError() map[string]*allErrs {
 	return as.errs
 }
@@ -303,7 +501,7 @@ func (as *alertsServer) groupsFacingErrors() map[string]bool {
 
 	g := make(map[string]bool, len(as.errs))
 	for rg, err := range as.errs {
-		if len(err.missedAlerts)+len(err.unexpectedAlerts)+len(err.matchingErrs) > 0 {
+		if len(err.missedAlerts)+len(err.unexpectedAlerts)+len(err.matchingErrs)+len(err.duplicateSends)+len(err.resendCountErrs)+len(err.batchErrs) > 0 || err.sendLatencyErr != nil {
 			g[rg] = true
 		}
 	}
@@ -0,0 +1,117 @@
+package testsuite
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+// Shard is a part of the test cases to run, to parallelize the test across several runners, e.g. of a CI.
+// The test cases are partitioned by the hash of their group name modulo Count, hence a shard always has the same
+// test cases whatever the order of the test cases and across the versions of the test suite, unless the cases
+// are renamed. The zero value is all the test cases.
+type Shard struct {
+	// Index is from 1 to Count.
+	Index, Count int
+}
+
+// ParseShard parses a shard of the form "<index>/<count>", e.g. "2/4" for the second of four shards.
+// The empty string is all the test cases.
+func ParseShard(s string) (Shard, error) {
+	if s == "" {
+		return Shard{}, nil
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return Shard{}, errors.Errorf("shard %q is not of the form <index>/<count>", s)
+	}
+	index, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Shard{}, errors.Wrapf(err, "index of the shard %q", s)
+	}
+	count, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Shard{}, errors.Wrapf(err, "count of the shard %q", s)
+	}
+	sh := Shard{Index: index, Count: count}
+	return sh, sh.validate()
+}
+
+func (s Shard) String() string {
+	if s.Count == 0 {
+		return "all"
+	}
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+func (s Shard) validate() error {
+	if s == (Shard{}) {
+		return nil
+	}
+	if s.Count < 1 || s.Index < 1 || s.Index > s.Count {
+		return fmt.Errorf("shard must be from 1/<count> to <count>/<count> with a positive count, got %s", s)
+	}
+	return nil
+}
+
+// Has tells whether the test case of the given group name is in the shard.
+func (s Shard) Has(groupName string) bool {
+	if s.Count == 0 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(groupName))
+	return int(h.Sum32()%uint32(s.Count)) == s.Index-1
+}
+
+// ShardCases returns the test cases of the shard in their order.
+func ShardCases(cs []cases.TestCase, s Shard) []cases.TestCase {
+	if s.Count == 0 {
+		return cs
+	}
+	var res []cases.TestCase
+	for _, c := range cs {
+		if gn, _ := c.Describe(); s.Has(gn) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// MergeScores merges the scores of the shards of a test, e.g. read via LoadScore, into the score of all their test
+// cases sorted by group name, as if they were run together. The clock drifts are merged in the order of their time.
+// A test case must be in a single score.
+func MergeScores(scores []Score) (Score, error) {
+	merged := Score{}
+	seen := make(map[string]bool)
+	for _, s := range scores {
+		for _, c := range s.Cases {
+			if seen[c.GroupName] {
+				return Score{}, fmt.Errorf("test case %q is in more than one score", c.GroupName)
+			}
+			seen[c.GroupName] = true
+			merged.TotalWeight += c.Weight
+			if c.Passed {
+				merged.PassedWeight += c.Weight
+			}
+			merged.Cases = append(merged.Cases, c)
+		}
+		merged.ClockDrift = append(merged.ClockDrift, s.ClockDrift...)
+	}
+	if merged.TotalWeight > 0 {
+		merged.Percentage = 100 * merged.PassedWeight / merged.TotalWeight
+	}
+	sort.Slice(merged.Cases, func(i, j int) bool {
+		return merged.Cases[i].GroupName < merged.Cases[j].GroupName
+	})
+	sort.SliceStable(merged.ClockDrift, func(i, j int) bool {
+		return merged.ClockDrift[i].Time.Before(merged.ClockDrift[j].Time)
+	})
+	return merged, nil
+}
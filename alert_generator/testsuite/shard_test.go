@@ -0,0 +1,115 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestParseShard(t *testing.T) {
+	sh, err := ParseShard("2/4")
+	require.NoError(t, err)
+	require.Equal(t, Shard{Index: 2, Count: 4}, sh)
+	require.Equal(t, "2/4", sh.String())
+
+	sh, err = ParseShard("")
+	require.NoError(t, err)
+	require.Equal(t, Shard{}, sh)
+	require.Equal(t, "all", sh.String())
+
+	_, err = ParseShard("2")
+	require.EqualError(t, err, `shard "2" is not of the form <index>/<count>`)
+	_, err = ParseShard("a/4")
+	require.Error(t, err)
+	_, err = ParseShard("0/4")
+	require.EqualError(t, err, "shard must be from 1/<count> to <count>/<count> with a positive count, got 0/4")
+	_, err = ParseShard("5/4")
+	require.EqualError(t, err, "shard must be from 1/<count> to <count>/<count> with a positive count, got 5/4")
+}
+
+func TestShardCases(t *testing.T) {
+	require.Equal(t, len(cases.AllCases), len(ShardCases(cases.AllCases, Shard{})))
+
+	// Every test case is in exactly one shard, the same one whatever the order of the test cases.
+	reversed := make([]cases.TestCase, len(cases.AllCases))
+	for i, c := range cases.AllCases {
+		reversed[len(reversed)-1-i] = c
+	}
+	shardOf := make(map[string]int)
+	for i := 1; i <= 4; i++ {
+		sh := Shard{Index: i, Count: 4}
+		inShard := ShardCases(cases.AllCases, sh)
+		require.NotEmpty(t, inShard)
+		for _, c := range inShard {
+			gn, _ := c.Describe()
+			_, ok := shardOf[gn]
+			require.False(t, ok, gn)
+			shardOf[gn] = i
+		}
+		for _, c := range ShardCases(reversed, sh) {
+			gn, _ := c.Describe()
+			require.Equal(t, i, shardOf[gn], gn)
+		}
+	}
+	require.Equal(t, len(cases.AllCases), len(shardOf))
+
+	// The weights are validated against all the test cases, not only the ones of the shard.
+	opts := TestSuiteOptions{
+		Logger:          log.NewNopLogger(),
+		Cases:           cases.AllCases,
+		CaseWeights:     map[string]float64{"PendingAndFiringAndResolved": 1, "TopKChurn": 1},
+		RemoteWriteURL:  "http://localhost:9090/api/v1/write",
+		BaseAPIURL:      "http://localhost:9090",
+		PromQLBaseURL:   "http://localhost:9090",
+		AlertServerPort: "8080",
+		Shard:           Shard{Index: 3, Count: 4},
+	}
+	ts, err := NewTestSuite(opts)
+	require.NoError(t, err)
+	require.Equal(t, ShardCases(cases.AllCases, opts.Shard), ts.opts.Cases)
+
+	opts.Shard = Shard{Index: 1, Count: -1}
+	_, err = NewTestSuite(opts)
+	require.EqualError(t, err, "validate options: shard must be from 1/<count> to <count>/<count> with a positive count, got 1/-1")
+}
+
+func TestMergeScores(t *testing.T) {
+	t0 := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	merged, err := MergeScores([]Score{
+		{
+			Cases: []CaseScore{
+				{GroupName: "TopKChurn", Weight: 1, Passed: true},
+				{GroupName: "PendingAndFiringAndResolved", Weight: 3, Passed: true},
+			},
+			ClockDrift: []ClockDrift{{Time: t0.Add(time.Minute), Drift: 1}},
+		},
+		{
+			Cases: []CaseScore{
+				{GroupName: "TemplateFunctions", Weight: 1, FailedChecks: []string{"rules_api"}},
+			},
+			ClockDrift: []ClockDrift{{Time: t0, Drift: 2}},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, Score{
+		Percentage:   80,
+		PassedWeight: 4,
+		TotalWeight:  5,
+		Cases: []CaseScore{
+			{GroupName: "PendingAndFiringAndResolved", Weight: 3, Passed: true},
+			{GroupName: "TemplateFunctions", Weight: 1, FailedChecks: []string{"rules_api"}},
+			{GroupName: "TopKChurn", Weight: 1, Passed: true},
+		},
+		ClockDrift: []ClockDrift{{Time: t0, Drift: 2}, {Time: t0.Add(time.Minute), Drift: 1}},
+	}, merged)
+
+	_, err = MergeScores([]Score{
+		{Cases: []CaseScore{{GroupName: "TopKChurn", Passed: true}}},
+		{Cases: []CaseScore{{GroupName: "TopKChurn"}}},
+	})
+	require.EqualError(t, err, `test case "TopKChurn" is in more than one score`)
+}
@@ -2,9 +2,12 @@ package testsuite
 
 import (
 	"fmt"
+	"io"
 	"net/url"
 	"path"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,6 +17,7 @@ import (
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/rulefmt"
 	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/promql"
 
 	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
 )
@@ -24,17 +28,42 @@ type TestSuite struct {
 	opts                      TestSuiteOptions
 	alertsAPIURL, rulesAPIURL string
 	promqlURL                 *url.URL
+	federateURL               *url.URL
+	amAlertsURL               string
+	selfMetricsURL            string
+	flagsAPIURL               string
+	client                    *HTTPClient
+	clock                     Clock
+	scaledClock               *scaledClock // Set if the fixtures are replayed at a speed other than the real time.
 
 	remoteWriter         *RemoteWriter
 	remoteWriteStartTime time.Time
 
 	as *alertsServer
+	ac *alertmanagerChecker // nil if no Alertmanager is configured.
+	rs *resultStreamer      // nil if the results are not streamed.
+
+	capabilities capabilities // nil if the preflight was not run.
+	calibration  *calibration // nil if the calibration was not run or failed.
+	clockDrifts  *clockDrifts // nil if the clock drift is not watched.
 
 	ruleGroupTestsMtx   sync.RWMutex
 	ruleGroupTests      map[string]cases.TestCase // Group name -> TestCase.
+	caseOrder           []string                  // Group names in the order the cases are run.
+	caseOffsets         map[string]time.Duration  // Group name -> start of the case w.r.t. the remote write start.
+	caseStartTimes      map[string]int64          // Group name -> zero time of the case. Set in Start().
 	ruleGroupTestErrors map[string][]error        // Group name -> slice of errors in them.
+	checkOpts           cases.CheckOptions        // Passed to the checks of the test cases.
 
 	minGroupInterval model.Duration
+	groupEvaluations []groupEvaluation
+	seriesCounter    *seriesCounter
+
+	selfMetricsMtx           sync.Mutex
+	selfMetricsStart         *selfMetrics // nil if the metrics were not scraped at the start.
+	selfMetricsStartTime     time.Time
+	selfMetricsStartReceived int
+	selfMetricsDiscrepancies []string
 
 	stopc chan struct{}
 	wg    sync.WaitGroup
@@ -42,8 +71,14 @@ type TestSuite struct {
 
 type TestSuiteOptions struct {
 	Logger log.Logger
+	// GeneratorName is the optional name of the alert generator under test, which is added to the logs and the
+	// streamed results to tell the runs apart when testing several alert generators. See GeneratorConfig.
+	GeneratorName string
 	// All the test cases to test.
 	Cases []cases.TestCase
+	// Shard when set only tests the test cases of Cases in the shard, e.g. to split the test across the runners
+	// of a CI. The weights of CaseWeights are still validated against all the test cases.
+	Shard Shard
 	// RemoteWriteURL is URL to remote write samples.
 	RemoteWriteURL string
 	// BaseAPIURL is the URL to query the GET <BaseApiURL>/api/v1/rules and <BaseApiURL>/api/v1/alerts.
@@ -52,6 +87,166 @@ type TestSuiteOptions struct {
 	PromQLBaseURL string
 	// AlertServerPort is the port at which the alert receiving server will be run.
 	AlertServerPort string
+	// AlertmanagerURL is the optional URL of an Alertmanager that also receives the alerts from
+	// the alert generator. If set, the alerts in the Alertmanager are queried via
+	// GET <AlertmanagerURL>/api/v2/alerts to verify that they made it through the Alertmanager intact.
+	// This is in addition to the alerts received by the alert receiving server.
+	AlertmanagerURL string
+	// UserAgent is the User-Agent set in all the requests made by the test suite.
+	// DefaultUserAgent is used if empty.
+	UserAgent string
+	// RequestIDs when true attaches a unique X-Request-ID header to every request made by the test suite.
+	RequestIDs bool
+	// Shuffle when true runs the cases in a random order decided by Seed instead of the order in Cases.
+	// The cases are started shuffledCasesStartGap apart in that order instead of all together.
+	// A generator that only passes in a fixed order likely leaks state between the rule groups.
+	Shuffle bool
+	// Seed is the seed used to shuffle the cases and to inject the ingestion faults.
+	// The same seed gives the same order for the same cases.
+	Seed int64
+	// IngestDropRate is the probability of dropping a batch of samples of the test cases that implement
+	// cases.IngestFaultTolerant. It can be at most cases.MaxIngestDropRate.
+	IngestDropRate float64
+	// IngestDelay is the max random delay added to a batch of samples of the test cases that implement
+	// cases.IngestFaultTolerant. It can be at most cases.MaxIngestDelay.
+	IngestDelay time.Duration
+	// MaxSeries if positive is the max number of distinct series of all the test cases together, above which
+	// the test suite is not created, to guard the alert generator against a runaway cardinality of a test case
+	// or a fixture. The error has the number of series by test case.
+	MaxSeries int
+	// SeedWithPastData when true remote-writes the warmup samples of the test cases that implement
+	// cases.Warmup when the test starts, so that their range vector selectors have a full lookback
+	// of samples from the first evaluation.
+	SeedWithPastData bool
+	// ReplicaLag is how far behind the alert generator that sends the alerts (the leader) the state visible
+	// via BaseAPIURL and PromQLBaseURL can be, when those point to a read replica or a query frontend.
+	// The API checks pass if they pass at any time within the lag, and the PromQL queries are made at the
+	// time of the check minus the lag. It can be at most the smallest group interval of the cases.
+	ReplicaLag time.Duration
+	// QueryCacheStaleness is how stale the results of the queries of the alert generator can be, when it evaluates
+	// the rules through a caching query frontend, which delays the state changes of the alerts by up to this.
+	// The API checks and the checks of the PromQL queries pass if they pass at any time within it (in addition
+	// to ReplicaLag), and it is added to the time tolerance of the alerts received, which loosens the assertions
+	// on when the alerts fire and get resolved by this much. It can be at most the smallest group interval of the cases.
+	QueryCacheStaleness time.Duration
+	// ReplaySpeed is the speed relative to the real time at which the samples of the test cases that are fixtures
+	// (see cases.Fixture) are replayed, e.g. 60 replays an hour of samples in a minute and 0.5 replays them at half
+	// the speed for observation. The expectations are checked at the time in the replay, hence the timing is
+	// consistent at any speed. The timestamps of the samples are not changed, hence the clock of the alert generator
+	// must run at the same speed from the start of the remote write, i.e. its time must be the start plus the real
+	// time since then times ReplaySpeed, else the samples are in its future or past. The real time is used if 0 or 1.
+	// It cannot be set for the built-in test cases.
+	ReplaySpeed float64
+	// AlertTraceFile is the optional path of a file to write all the alerts received as newline delimited JSON,
+	// which can be replayed later via ReplayAlertTrace() to reproduce the alert checks without the alert generator.
+	AlertTraceFile string
+	// VerifySelfMetrics when true scrapes GET <BaseAPIURL>/metrics of the alert generator at the start and
+	// the end of the test, and cross-checks prometheus_notifications_sent_total with the alerts received
+	// and prometheus_rule_evaluations_total with the group intervals. The discrepancies are reported as warnings.
+	VerifySelfMetrics bool
+	// StrictSelfMetrics when true fails the test on the discrepancies found by VerifySelfMetrics.
+	StrictSelfMetrics bool
+	// VerifyAlertsTimeline when true checks the ALERTS series of every test case over its entire duration
+	// via a range query at the end of the test, in addition to the periodic checks of the ALERTS series.
+	VerifyAlertsTimeline bool
+	// HTTPMaxIdleConnsPerHost is the max number of idle keep-alive connections per host kept by the HTTP client
+	// of the test suite. DefaultMaxIdleConnsPerHost is used if 0.
+	HTTPMaxIdleConnsPerHost int
+	// HTTPTimeout is the timeout of the requests made by the test suite. DefaultHTTPTimeout is used if 0.
+	HTTPTimeout time.Duration
+	// HTTPForceHTTP2 makes all the requests of the test suite over HTTP/2 only. See HTTPClientOptions.ForceHTTP2.
+	HTTPForceHTTP2 bool
+	// HTTPHeaders are the additional headers set in all the requests of the test suite. See HTTPClientOptions.Headers.
+	HTTPHeaders map[string]string
+	// ReadGeneratorFlags when true reads the query engine flags of the alert generator via GET <BaseAPIURL>/api/v1/status/flags
+	// at the start of the test, to adjust the expectations of the cases to its lookback delta (see cases.LookbackDependent)
+	// and its max samples of a query (see cases.MaxSamplesDependent), and to warn about the flags that differ from the defaults assumed by the cases.
+	ReadGeneratorFlags bool
+	// ExpectedExternalURL is the external URL that the alert generator is configured with, which the expectations
+	// of the cases that implement cases.ExternalURLDependent are adjusted to. cases.DefaultExternalURL is assumed if empty.
+	ExpectedExternalURL string
+	// SampleEpsilon is the relative tolerance of the comparison of the values of the samples in the metric checks.
+	// cases.DefaultSampleEpsilon is used if 0. See cases.CheckOptions.
+	SampleEpsilon float64
+	// DetectDuplicateSends when true fails the rule groups whose alerts are received more than once with the
+	// same labels, StartsAt and EndsAt within a resend cycle, e.g. when the alert generator sends to the test
+	// suite twice because of a misconfiguration of its Alertmanagers.
+	DetectDuplicateSends bool
+	// AllowedMissedResends is the number of resends of a firing alert that can be missed per firing episode
+	// without failing the rule group, e.g. when the alert receiving server drops a request while overwhelmed,
+	// since a correct alert generator sends the alert again after the resend delay. The initial firing alert and
+	// the resolved alerts must never be missed.
+	AllowedMissedResends int
+	// StrictResendCount when true fails the rule groups whose alerts are sent a number of times other than
+	// expected while firing, i.e. the initial firing alert and a resend after every resend delay, which catches
+	// the alert generators that resend too eagerly or too lazily.
+	StrictResendCount bool
+	// AssertBatchByGroup when true fails the rule groups whose alerts of a single evaluation are received in more
+	// than one request, i.e. the alert generator split the batch of its notifications for the rule group.
+	// Note that Prometheus sends the alerts of every alerting rule of a group on their own, which can split
+	// the alerts of the groups with more than one alerting rule.
+	AssertBatchByGroup bool
+	// MaxBatchSize if positive fails the rule groups whose alerts are received in a request with more alerts than this.
+	MaxBatchSize int
+	// MaxP99SendLatency if positive fails the rule groups whose p99 latency of the firing alerts is more than this,
+	// where the latency of an alert is the time it was received after it was expected to be sent. The latencies
+	// are reported in the Score regardless. It is only meaningful below the time tolerance of the alerts, since
+	// the alerts received later do not match and fail the rule groups anyway.
+	MaxP99SendLatency time.Duration
+	// AlertValidators are the custom checks run against every alert received from the alert generator.
+	// Any violation fails the test. See AlertValidator.
+	AlertValidators []AlertValidator
+	// ResultStream is an optional writer to stream the results of the test cases to as newline delimited JSON
+	// as soon as they are known, e.g. for a controlling process to react to the failures in real time. See CheckReport.
+	ResultStream io.Writer
+	// Preflight when true probes the endpoints and features of the alert generator before the test starts,
+	// e.g. the rules and alerts APIs, the ALERTS series and the remote write, and skips the test cases that need
+	// one that is not supported. The capabilities found are logged and shown at the top of the report.
+	// The skipped test cases fail with the "preflight" check.
+	Preflight bool
+	// Calibrate when true measures the evaluation cadence, the notification latency and the resend delay of the alert
+	// generator before the test with the always firing alert of CalibrationRules, which must be loaded into the alert
+	// generator. The notification latency beyond what the test cases allow is added to the time tolerance of all the
+	// expected alerts. The evaluation cadence and the resend delay are assumed by the expectations of the test cases,
+	// hence they are only warned about when they differ. The timings measured are shown at the top of the report.
+	Calibrate bool
+	// ClockDriftThreshold if positive runs a watchdog during the test that periodically measures the drift of the
+	// clock of the alert generator from the clock of the test suite, from the last evaluation of the rule groups.
+	// The drift is reported in the Score, and the test cases that were running when it was more than this
+	// are annotated with it, since their timing failures may be due to the clock and not the alert generator.
+	ClockDriftThreshold time.Duration
+	// CaseWeights optionally overrides the weights of the test cases in the compliance score by their group name.
+	// See Score for how the score is computed.
+	CaseWeights map[string]float64
+	// AssertFrom and AssertUntil restrict the checks of every test case to the window between them, as offsets from
+	// the zero time of the test case, to debug a single transition without waiting out the whole test case.
+	// The samples are still remote written from the start so that the alert generator has the full context, but
+	// nothing before AssertFrom is checked and the test case ends at AssertUntil. AssertUntil of 0 means the end
+	// of the test case.
+	AssertFrom, AssertUntil time.Duration
+	// APICompat is how strictly the responses of the rules and alerts APIs of the alert generator are decoded.
+	// APICompatStrict is used if empty. See APICompat for what is not verified by the relaxed levels.
+	APICompat APICompat
+	// StrictRuleGroup makes the checks of the rules API also verify the fields of the rule groups and the rules that
+	// are not expected by the test cases, for the alert generators that must be compatible with the API of Prometheus
+	// field for field. See cases.CheckOptions.StrictRuleGroup. It cannot be used with APICompatRelaxed.
+	StrictRuleGroup bool
+	// MetricsSource is where the ALERTS series are read from for the metrics checks. MetricsSourceQuery is used
+	// if empty. See MetricsSourceFederate for how the checks differ with federation.
+	MetricsSource MetricsSource
+	// QueryStepAlignment is how the alert generator aligns the instant of the instant queries, which is the timestamp
+	// of the samples checked with MetricsSourceQuery. cases.QueryStepAlignmentNone, the behavior of Prometheus,
+	// is used if empty. See cases.QueryStepAlignment for the modes.
+	QueryStepAlignment cases.QueryStepAlignment
+	// QueryStepInterval is the step that the instant is aligned to with cases.QueryStepAlignmentInterval, e.g. the
+	// scrape interval of the alert generator. cases.DefaultStepInterval is used if 0.
+	QueryStepInterval time.Duration
+	// Clock tells the current time to the test suite, which is the time of the checks and at which the alerts are
+	// received. The wall clock is used if nil. The checks are still paced by the wall clock, and so is the remote write.
+	Clock Clock
+	// CleanupURL is the optional URL of an endpoint of the alert generator that resets its state, e.g. drops its series
+	// and alerts, which Cleanup() makes a POST request to after marking the series of the test cases stale.
+	CleanupURL string
 }
 
 func NewTestSuite(opts TestSuiteOptions) (*TestSuite, error) {
@@ -59,25 +254,118 @@ func NewTestSuite(opts TestSuiteOptions) (*TestSuite, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "validate options")
 	}
+	opts.Cases = ShardCases(opts.Cases, opts.Shard)
 
+	if opts.GeneratorName != "" {
+		opts.Logger = log.With(opts.Logger, "generator", opts.GeneratorName)
+	}
 	m := &TestSuite{
 		logger:              log.With(opts.Logger, "component", "testsuite"),
 		opts:                opts,
 		ruleGroupTests:      make(map[string]cases.TestCase, len(opts.Cases)),
+		caseOffsets:         make(map[string]time.Duration, len(opts.Cases)),
+		caseStartTimes:      make(map[string]int64, len(opts.Cases)),
 		ruleGroupTestErrors: make(map[string][]error),
 		stopc:               make(chan struct{}),
 		as:                  newAlertsServer(opts.AlertServerPort, opts.Logger),
+		client: NewHTTPClient(HTTPClientOptions{
+			UserAgent:           opts.UserAgent,
+			RequestIDs:          opts.RequestIDs,
+			MaxIdleConnsPerHost: opts.HTTPMaxIdleConnsPerHost,
+			Timeout:             opts.HTTPTimeout,
+			ForceHTTP2:          opts.HTTPForceHTTP2,
+			Headers:             opts.HTTPHeaders,
+		}, opts.Logger),
 	}
 
-	m.remoteWriter, err = NewRemoteWriter(opts.RemoteWriteURL, opts.Logger)
+	m.checkOpts = cases.CheckOptions{
+		SampleEpsilon:   opts.SampleEpsilon,
+		StrictRuleGroup: opts.StrictRuleGroup,
+		StepAlignment:   opts.QueryStepAlignment,
+		StepInterval:    opts.QueryStepInterval,
+	}
+	m.clock = opts.Clock
+	if m.clock == nil {
+		m.clock = realClock{}
+	}
+	if opts.ReplaySpeed != 0 && opts.ReplaySpeed != 1 {
+		m.scaledClock = newScaledClock(m.clock, opts.ReplaySpeed)
+		m.clock = m.scaledClock
+	}
+	m.as.clock = m.clock
+	m.as.validators = opts.AlertValidators
+	m.as.detectDuplicates = opts.DetectDuplicateSends
+	m.as.allowedMissedResends = opts.AllowedMissedResends
+	m.as.strictResendCount = opts.StrictResendCount
+	m.as.batchByGroup = opts.AssertBatchByGroup
+	m.as.maxBatchSize = opts.MaxBatchSize
+	m.as.maxP99SendLatency = opts.MaxP99SendLatency
+	if opts.ResultStream != nil {
+		m.rs = newResultStreamer(opts.ResultStream, opts.Logger)
+	}
+
+	if opts.AlertTraceFile != "" {
+		m.as.trace, err = newAlertTrace(opts.AlertTraceFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "create alert trace")
+		}
+	}
+
+	m.remoteWriter, err = NewRemoteWriter(opts.RemoteWriteURL, m.client, opts.Logger)
 	if err != nil {
 		return nil, errors.Wrap(err, "create remote writer")
 	}
+	m.remoteWriter.SetIngestFaults(IngestFaults{
+		DropRate: opts.IngestDropRate,
+		Delay:    opts.IngestDelay,
+		Seed:     opts.Seed,
+	})
+	if m.scaledClock != nil {
+		m.remoteWriter.SetReplaySpeed(opts.ReplaySpeed)
+	}
+
+	if opts.ClockDriftThreshold > 0 {
+		m.clockDrifts = &clockDrifts{}
+	}
 
-	for i, c := range opts.Cases {
-		m.remoteWriter.AddTimeSeries(c.SamplesToRemoteWrite())
+	m.seriesCounter = newSeriesCounter()
+	cs := opts.Cases
+	if opts.Shuffle {
+		cs = cases.Shuffle(cs, opts.Seed)
+	}
+	for i, c := range cs {
+		// When shuffled, the cases start one after the other in the shuffled order
+		// instead of all together, so that the order affects the execution.
+		var offset time.Duration
+		if opts.Shuffle {
+			offset = time.Duration(i) * shuffledCasesStartGap
+		}
 		groupName, _ := c.Describe()
+		if eu, ok := c.(cases.ExternalURLDependent); ok && opts.ExpectedExternalURL != "" {
+			eu.SetExternalURL(opts.ExpectedExternalURL)
+		}
+		samples := c.SamplesToRemoteWrite()
+		if opts.SeedWithPastData {
+			samples = cases.WithWarmupSamples(c, samples)
+		}
+		if err := cases.ValidateSamples(samples); err != nil {
+			return nil, errors.Wrapf(err, "invalid samples for the rule group %q", groupName)
+		}
+		if err := cases.ValidateSchedule(c, samples); err != nil {
+			return nil, errors.Wrapf(err, "invalid schedule of the samples for the rule group %q", groupName)
+		}
+		m.seriesCounter.add(groupName, samples)
+		series := shiftTimeSeries(samples, offset)
+		if sc, ok := c.(cases.ScheduledIngestion); ok {
+			m.remoteWriter.AddTimedBatches(shiftTimedBatches(sc.ScheduledSamples(), offset))
+		} else if _, ok := c.(cases.IngestFaultTolerant); ok {
+			m.remoteWriter.AddFaultyTimeSeries(series)
+		} else {
+			m.remoteWriter.AddTimeSeries(series)
+		}
 		m.ruleGroupTests[groupName] = c
+		m.caseOrder = append(m.caseOrder, groupName)
+		m.caseOffsets[groupName] = offset
 
 		rg, err := c.RuleGroup()
 		if err != nil {
@@ -86,6 +374,21 @@ func NewTestSuite(opts TestSuiteOptions) (*TestSuite, error) {
 		if i == 0 || rg.Interval < m.minGroupInterval {
 			m.minGroupInterval = rg.Interval
 		}
+		m.groupEvaluations = append(m.groupEvaluations, groupEvaluation{
+			name:     groupName,
+			interval: time.Duration(rg.Interval),
+			numRules: len(rg.Rules),
+		})
+	}
+
+	if err := m.seriesCounter.check(opts.MaxSeries); err != nil {
+		return nil, err
+	}
+	if opts.ReplicaLag > time.Duration(m.minGroupInterval) {
+		return nil, errors.Errorf("replica lag must be at most the smallest group interval %s, got %s", m.minGroupInterval, opts.ReplicaLag)
+	}
+	if opts.QueryCacheStaleness > time.Duration(m.minGroupInterval) {
+		return nil, errors.Errorf("query cache staleness must be at most the smallest group interval %s, got %s", m.minGroupInterval, opts.QueryCacheStaleness)
 	}
 
 	{
@@ -98,6 +401,10 @@ func NewTestSuite(opts TestSuiteOptions) (*TestSuite, error) {
 		m.alertsAPIURL = u.String()
 		u.Path = path.Join(orgPath, "/api/v1/rules")
 		m.rulesAPIURL = u.String()
+		u.Path = path.Join(orgPath, "/metrics")
+		m.selfMetricsURL = u.String()
+		u.Path = path.Join(orgPath, "/api/v1/status/flags")
+		m.flagsAPIURL = u.String()
 	}
 
 	{
@@ -105,10 +412,23 @@ func NewTestSuite(opts TestSuiteOptions) (*TestSuite, error) {
 		if err != nil {
 			return nil, err
 		}
+		m.federateURL = &url.URL{}
+		*m.federateURL = *u
+		m.federateURL.Path = path.Join(u.Path, "/federate")
 		u.Path = path.Join(u.Path, "/api/v1/query")
 		m.promqlURL = u
 	}
 
+	if opts.AlertmanagerURL != "" {
+		u, err := url.Parse(opts.AlertmanagerURL)
+		if err != nil {
+			return nil, err
+		}
+		u.Path = path.Join(u.Path, "/api/v2/alerts")
+		m.amAlertsURL = u.String()
+		m.ac = newAlertmanagerChecker()
+	}
+
 	return m, nil
 }
 
@@ -118,6 +438,14 @@ func NewTestSuite(opts TestSuiteOptions) (*TestSuite, error) {
 // TODO: set this.
 const minConfiguredGroupInterval = model.Duration(0 * time.Second)
 
+// replicaLagCheckStep is the step at which the checks are retried within the replica lag and the query cache staleness.
+const replicaLagCheckStep = time.Second
+
+// shuffledCasesStartGap is the gap between the start of the consecutive cases when the cases are shuffled.
+// It is not a multiple of the remote write intervals so that the samples of the cases interleave differently
+// with each order.
+const shuffledCasesStartGap = 1500 * time.Millisecond
+
 // TODO(codesome): verify the validation.
 func validateOpts(opts TestSuiteOptions) error {
 	if opts.RemoteWriteURL == "" {
@@ -140,9 +468,92 @@ func validateOpts(opts TestSuiteOptions) error {
 	if p > 65535 {
 		return fmt.Errorf("provided alert server port %q must be less than 65535", opts.AlertServerPort)
 	}
+	if opts.IngestDropRate < 0 || opts.IngestDropRate > cases.MaxIngestDropRate {
+		return fmt.Errorf("ingest drop rate must be between 0 and %.2f, got %.2f", cases.MaxIngestDropRate, opts.IngestDropRate)
+	}
+	if opts.IngestDelay < 0 || opts.IngestDelay > cases.MaxIngestDelay {
+		return fmt.Errorf("ingest delay must be between 0 and %s, got %s", cases.MaxIngestDelay, opts.IngestDelay)
+	}
+	if _, err := url.Parse(opts.ExpectedExternalURL); err != nil {
+		return fmt.Errorf("provided expected external URL %q does not parse: %v", opts.ExpectedExternalURL, err)
+	}
+	if opts.SampleEpsilon < 0 {
+		return fmt.Errorf("sample epsilon cannot be negative, got %g", opts.SampleEpsilon)
+	}
+	if opts.ReplicaLag < 0 {
+		return fmt.Errorf("replica lag cannot be negative, got %s", opts.ReplicaLag)
+	}
+	if opts.QueryCacheStaleness < 0 {
+		return fmt.Errorf("query cache staleness cannot be negative, got %s", opts.QueryCacheStaleness)
+	}
+	if opts.ReplaySpeed < 0 {
+		return fmt.Errorf("replay speed cannot be negative, got %g", opts.ReplaySpeed)
+	}
+	if opts.ReplaySpeed != 0 && opts.ReplaySpeed != 1 {
+		for _, c := range opts.Cases {
+			if _, ok := c.(cases.Fixture); !ok {
+				gn, _ := c.Describe()
+				return fmt.Errorf("replay speed can only be set for the fixtures, %q is a built-in test case", gn)
+			}
+		}
+	}
+	if opts.HTTPMaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("max idle HTTP connections per host cannot be negative, got %d", opts.HTTPMaxIdleConnsPerHost)
+	}
+	if opts.AllowedMissedResends < 0 {
+		return fmt.Errorf("allowed missed resends cannot be negative, got %d", opts.AllowedMissedResends)
+	}
+	if opts.MaxSeries < 0 {
+		return fmt.Errorf("max series cannot be negative, got %d", opts.MaxSeries)
+	}
+	if opts.MaxBatchSize < 0 {
+		return fmt.Errorf("max batch size cannot be negative, got %d", opts.MaxBatchSize)
+	}
+	if opts.MaxP99SendLatency < 0 {
+		return fmt.Errorf("max p99 send latency cannot be negative, got %s", opts.MaxP99SendLatency)
+	}
+	if opts.ClockDriftThreshold < 0 {
+		return fmt.Errorf("clock drift threshold cannot be negative, got %s", opts.ClockDriftThreshold)
+	}
+	if opts.HTTPTimeout < 0 {
+		return fmt.Errorf("HTTP timeout cannot be negative, got %s", opts.HTTPTimeout)
+	}
+	if opts.AssertFrom < 0 || opts.AssertUntil < 0 {
+		return fmt.Errorf("assertion window cannot be negative, got from %s until %s", opts.AssertFrom, opts.AssertUntil)
+	}
+	if opts.AssertUntil > 0 && opts.AssertUntil <= opts.AssertFrom {
+		return fmt.Errorf("assertion window must end after it starts, got from %s until %s", opts.AssertFrom, opts.AssertUntil)
+	}
+	if opts.StrictRuleGroup && opts.APICompat == APICompatRelaxed {
+		return fmt.Errorf("the strict rule group cannot be checked with the %q API compat, which does not verify some of its fields", APICompatRelaxed)
+	}
+	if err := validateAPICompat(opts.APICompat); err != nil {
+		return err
+	}
+	if err := validateMetricsSource(opts.MetricsSource); err != nil {
+		return err
+	}
+	if err := validateQueryStepAlignment(opts.QueryStepAlignment, opts.QueryStepInterval); err != nil {
+		return err
+	}
+	if err := validateCaseWeights(opts.Cases, opts.CaseWeights); err != nil {
+		return err
+	}
+	if err := opts.Shard.validate(); err != nil {
+		return err
+	}
+	seenValidators := make(map[string]bool)
+	for _, v := range opts.AlertValidators {
+		if v == nil {
+			return errors.New("nil alert validator")
+		}
+		if seenValidators[v.Name()] {
+			return fmt.Errorf("duplicate alert validator name %q", v.Name())
+		}
+		seenValidators[v.Name()] = true
+	}
 
 	seenRuleGroups := make(map[string]bool)
-	seenAlertNames := make(map[string]bool)
 
 	for _, c := range opts.Cases {
 		rg, err := c.RuleGroup()
@@ -163,25 +574,36 @@ func validateOpts(opts TestSuiteOptions) error {
 		}
 		seenRuleGroups[rg.Name] = true
 
+		// The alert names can repeat across the groups since the alerts are told apart by the rulegroup label.
+		seenAlertNames := make(map[string]bool)
 		merr := NewMulti()
 		for i, r := range rg.Rules {
-			if r.Alert.Value == "" {
-				return fmt.Errorf("alert name cannot be empty, %q group has one empty", rg.Name)
-			}
-			if seenAlertNames[r.Alert.Value] {
-				return fmt.Errorf("alert name cannot repeat to make testing easy, %q has been used more than once", r.Alert.Value)
-			}
-			seenAlertNames[r.Alert.Value] = true
+			ruleName := r.Alert.Value
+			if r.Record.Value != "" {
+				// Recording rules are allowed to feed the alerting rules of the same group.
+				ruleName = r.Record.Value
+				if r.Labels["rulegroup"] != rg.Name {
+					return fmt.Errorf(`recording rule (with name %q) does not have rulegroup="<groupName>" label`, ruleName)
+				}
+			} else {
+				if ruleName == "" {
+					return fmt.Errorf("alert name cannot be empty, %q group has one empty", rg.Name)
+				}
+				if seenAlertNames[ruleName] {
+					return fmt.Errorf("alert name cannot repeat within a group to make testing easy, %q has been used more than once in %q", ruleName, rg.Name)
+				}
+				seenAlertNames[ruleName] = true
 
-			if r.Labels["rulegroup"] != rg.Name {
-				return fmt.Errorf(`alerting rule (with alert name %q) does not have rulegroup="<groupName>" label`, r.Alert.Value)
+				if r.Labels["rulegroup"] != rg.Name {
+					return fmt.Errorf(`alerting rule (with alert name %q) does not have rulegroup="<groupName>" label`, ruleName)
+				}
 			}
 
 			for _, node := range rg.Rules[i].Validate() {
 				merr.Add(&rulefmt.Error{
 					Group:    rg.Name,
 					Rule:     i + 1,
-					RuleName: r.Alert.Value,
+					RuleName: ruleName,
 					Err:      node,
 				})
 			}
@@ -202,14 +624,63 @@ func (ts *TestSuite) Start() {
 	level.Info(ts.logger).Log("msg", "Starting the alert receiving server", "port", ts.opts.AlertServerPort)
 	ts.as.Start()
 
-	level.Info(ts.logger).Log("msg", "Starting the remote writer", "url", ts.opts.RemoteWriteURL)
+	if ts.opts.Preflight {
+		level.Info(ts.logger).Log("msg", "Running the preflight")
+		ts.runPreflight()
+	}
+	if ts.opts.Calibrate {
+		level.Info(ts.logger).Log("msg", "Running the calibration", "duration", CalibrationDuration)
+		ts.runCalibration()
+	}
+
+	level.Info(ts.logger).Log("msg", "Starting the remote writer", "url", ts.opts.RemoteWriteURL, "series", ts.seriesCounter.total(), "series_by_case", ts.seriesCounter.String())
 	ts.remoteWriteStartTime = ts.remoteWriter.Start()
-	for _, c := range ts.ruleGroupTests {
-		gn, desc := c.Describe()
+	if ts.scaledClock != nil {
+		level.Info(ts.logger).Log("msg", "Replaying the fixtures at a speed other than the real time, the clock of the alert generator must run at the same speed", "speed", ts.opts.ReplaySpeed)
+		ts.scaledClock.start(ts.remoteWriteStartTime)
+	}
+	if ts.opts.Shuffle {
+		level.Info(ts.logger).Log("msg", "Running the cases in a shuffled order", "seed", ts.opts.Seed, "order", strings.Join(ts.caseOrder, ","), "start_gap", shuffledCasesStartGap)
+	}
+	if ts.ingestFaultsEnabled() {
+		level.Info(ts.logger).Log("msg", "Injecting faults in the remote write", "drop_rate", ts.opts.IngestDropRate, "max_delay", ts.opts.IngestDelay, "seed", ts.opts.Seed)
+	}
+	if ts.opts.ReadGeneratorFlags {
+		ts.applyGeneratorFlags(ts.readGeneratorFlags())
+	}
+	for _, gn := range ts.caseOrder {
+		c, ok := ts.ruleGroupTests[gn]
+		if !ok {
+			// Skipped by the preflight.
+			ts.as.ignoreGroup(gn)
+			continue
+		}
+		_, desc := c.Describe()
 		level.Info(ts.logger).Log("msg", "Starting test for a rule group", "rulegroup", gn, "description", desc)
 
-		c.Init(timestamp.FromTime(ts.remoteWriteStartTime))
-		ts.as.addExpectedAlerts(c.ExpectedAlerts()...)
+		zeroTime := timestamp.FromTime(ts.remoteWriteStartTime.Add(ts.caseOffsets[gn]))
+		ts.caseStartTimes[gn] = zeroTime
+		c.Init(zeroTime)
+		if _, ok := c.(cases.NotificationsUnchecked); ok {
+			ts.as.ignoreGroup(gn)
+		}
+		if ts.assertWindowSet() {
+			from, until := ts.assertWindow(gn, c)
+			level.Info(ts.logger).Log("msg", "Checking the rule group only within the assertion window", "rulegroup", gn, "from", ts.opts.AssertFrom, "until", time.Duration(until-zeroTime)*time.Millisecond)
+			ts.as.setAssertWindow(gn, timestamp.Time(from), timestamp.Time(until))
+		}
+		// The slack measured by the calibration loosens the time tolerance like the query cache staleness does.
+		expAlerts := withQueryCacheStaleness(c.ExpectedAlerts(), ts.timeToleranceSlack())
+		ts.as.addExpectedAlerts(expAlerts...)
+		if ts.ac != nil {
+			ts.ac.addExpectedAlerts(expAlerts...)
+		}
+	}
+
+	if ts.as.trace != nil {
+		if err := ts.as.trace.writeStart(ts.remoteWriteStartTime, ts.caseStartTimes, ts.timeToleranceSlack()); err != nil {
+			level.Error(ts.logger).Log("msg", "Error in writing the alert trace", "err", err)
+		}
 	}
 
 	ts.wg.Add(4)
@@ -217,21 +688,52 @@ func (ts *TestSuite) Start() {
 	go ts.checkRulesLoop()
 	go ts.checkMetricsLoop()
 	go ts.monitorAlertReception()
+	if ts.ac != nil {
+		ts.wg.Add(1)
+		go ts.checkAlertmanagerLoop()
+	}
+	if ts.clockDrifts != nil {
+		ts.wg.Add(1)
+		go ts.clockDriftLoop()
+	}
+	if ts.opts.VerifySelfMetrics {
+		ts.startSelfMetrics()
+	}
+}
+
+func (ts *TestSuite) assertWindowSet() bool {
+	return ts.opts.AssertFrom > 0 || ts.opts.AssertUntil > 0
+}
+
+// assertWindow returns the timestamps within which the given test case is checked. It must be called after the
+// zero time of the test case is set in Start().
+func (ts *TestSuite) assertWindow(groupName string, c cases.TestCase) (from, until int64) {
+	zeroTime := ts.caseStartTimes[groupName]
+	from = zeroTime + int64(ts.opts.AssertFrom/time.Millisecond)
+	until = c.TestUntil()
+	if ts.opts.AssertUntil > 0 && zeroTime+int64(ts.opts.AssertUntil/time.Millisecond) < until {
+		until = zeroTime + int64(ts.opts.AssertUntil/time.Millisecond)
+	}
+	return from, until
+}
+
+func (ts *TestSuite) ingestFaultsEnabled() bool {
+	return ts.opts.IngestDropRate > 0 || ts.opts.IngestDelay > 0
 }
 
 func (ts *TestSuite) checkAlertsLoop() {
 	defer ts.wg.Done()
 
 	ts.loopTillItsOver(func() {
-		nowTs := timestamp.FromTime(time.Now())
+		nowTs := timestamp.FromTime(ts.clock.Now())
 
-		b, err := DoGetRequest(ts.alertsAPIURL)
+		b, err := ts.client.Get(ts.alertsAPIURL)
 		if err != nil {
 			level.Error(ts.logger).Log("msg", "Error in fetching alerts", "url", ts.alertsAPIURL, "err", err)
 			return
 		}
 
-		mappedAlerts, err := ParseAndGroupAlerts(b)
+		mappedAlerts, err := parseAndGroupAlertsCompat(b, ts.opts.APICompat)
 		if err != nil {
 			level.Error(ts.logger).Log("msg", "Error in parsing alerts response", "url", ts.alertsAPIURL, "err", err)
 			return
@@ -240,13 +742,20 @@ func (ts *TestSuite) checkAlertsLoop() {
 		groupsToRemove := make(map[string]error)
 		ts.ruleGroupTestsMtx.RLock()
 		for groupName, c := range ts.ruleGroupTests {
-			if c.TestUntil() < nowTs {
+			from, until := ts.assertWindow(groupName, c)
+			if until < nowTs {
 				groupsToRemove[groupName] = nil
 				continue
 			}
-			err := c.CheckAlerts(nowTs, mappedAlerts[groupName])
+			if nowTs < from {
+				// Not started yet, or before the assertion window.
+				continue
+			}
+			err := ts.checkWithLag(nowTs, ts.apiLag(), func(t int64) error {
+				return c.CheckAlerts(t, mappedAlerts[groupName])
+			})
 			if err != nil {
-				groupsToRemove[groupName] = err
+				groupsToRemove[groupName] = checkError{check: checkNameAlertsAPI, err: err}
 			}
 		}
 		ts.ruleGroupTestsMtx.RUnlock()
@@ -259,15 +768,15 @@ func (ts *TestSuite) checkRulesLoop() {
 	defer ts.wg.Done()
 
 	ts.loopTillItsOver(func() {
-		nowTs := timestamp.FromTime(time.Now())
+		nowTs := timestamp.FromTime(ts.clock.Now())
 
-		b, err := DoGetRequest(ts.rulesAPIURL)
+		b, err := ts.client.Get(ts.rulesAPIURL)
 		if err != nil {
 			level.Error(ts.logger).Log("msg", "Error in fetching rules", "url", ts.rulesAPIURL, "err", err)
 			return
 		}
 
-		mappedGroups, err := ParseAndGroupRules(b)
+		mappedGroups, err := parseAndGroupRulesCompat(b, ts.opts.APICompat)
 		if err != nil {
 			level.Error(ts.logger).Log("msg", "Error in parsing rules response", "url", ts.rulesAPIURL, "err", err)
 			return
@@ -276,13 +785,20 @@ func (ts *TestSuite) checkRulesLoop() {
 		groupsToRemove := make(map[string]error)
 		ts.ruleGroupTestsMtx.RLock()
 		for groupName, c := range ts.ruleGroupTests {
-			if c.TestUntil() < nowTs {
+			from, until := ts.assertWindow(groupName, c)
+			if until < nowTs {
 				groupsToRemove[groupName] = nil
 				continue
 			}
-			err := c.CheckRuleGroup(nowTs, mappedGroups[groupName])
+			if nowTs < from {
+				// Not started yet, or before the assertion window.
+				continue
+			}
+			err := ts.checkWithLag(nowTs, ts.apiLag(), func(t int64) error {
+				return c.CheckRuleGroup(t, mappedGroups[groupName], ts.checkOpts)
+			})
 			if err != nil {
-				groupsToRemove[groupName] = err
+				groupsToRemove[groupName] = checkError{check: checkNameRulesAPI, err: err}
 			}
 		}
 		ts.ruleGroupTestsMtx.RUnlock()
@@ -295,36 +811,108 @@ func (ts *TestSuite) checkMetricsLoop() {
 	defer ts.wg.Done()
 
 	ts.loopTillItsOver(func() {
-		nowTs := timestamp.FromTime(time.Now())
+		mappedMetrics, nowTs, lag, err := ts.fetchAlertsMetric()
+		if err != nil {
+			level.Error(ts.logger).Log("msg", "Error in fetching metrics", "query", "ALERTS", "err", err)
+			return
+		}
 
-		u := ts.promqlURL
-		q := u.Query()
-		q.Set("query", "ALERTS")
-		q.Set("time", timestamp.Time(nowTs).Format(time.RFC3339))
-		u.RawQuery = q.Encode()
+		groupsToRemove := make(map[string]error)
+		ts.ruleGroupTestsMtx.RLock()
+		for groupName, c := range ts.ruleGroupTests {
+			from, until := ts.assertWindow(groupName, c)
+			if until < nowTs {
+				groupsToRemove[groupName] = nil
+				continue
+			}
+			if nowTs < from {
+				// Not started yet, or before the assertion window.
+				continue
+			}
+			err := ts.checkWithLag(nowTs, lag, func(t int64) error {
+				return c.CheckMetrics(t, ts.samplesToCheck(mappedMetrics[groupName], nowTs, t), ts.checkOpts)
+			})
+			if err != nil {
+				groupsToRemove[groupName] = checkError{check: checkNameAlertsMetric, err: err}
+				continue
+			}
+
+			qc, ok := c.(cases.QueryChecker)
+			if !ok || ts.opts.MetricsSource == MetricsSourceFederate {
+				continue
+			}
+			for _, query := range qc.Queries() {
+				mapped, err := ts.queryMetrics(query, nowTs)
+				if err != nil {
+					level.Error(ts.logger).Log("msg", "Error in fetching metrics", "query", query, "err", err)
+					continue
+				}
+				err = ts.checkWithLag(nowTs, ts.opts.QueryCacheStaleness, func(t int64) error {
+					return qc.CheckQuery(t, query, ts.samplesToCheck(mapped[groupName], nowTs, t), ts.checkOpts)
+				})
+				if err != nil {
+					groupsToRemove[groupName] = checkError{check: checkNameQueries, err: err}
+					break
+				}
+			}
+		}
+		ts.ruleGroupTestsMtx.RUnlock()
+
+		ts.removeGroups(groupsToRemove)
+	})
+}
+
+// queryMetrics runs the instant query at the given timestamp and returns the result grouped by the rulegroup label.
+func (ts *TestSuite) queryMetrics(query string, nowTs int64) (map[string][]promql.Sample, error) {
+	u := ts.promqlURL
+	q := u.Query()
+	q.Set("query", query)
+	// The instant is requested to the millisecond for the alert generator to align it, see cases.QueryStepAlignment.
+	q.Set("time", strconv.FormatFloat(float64(nowTs)/1000, 'f', 3, 64))
+	u.RawQuery = q.Encode()
+
+	b, err := ts.client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
 
-		b, err := DoGetRequest(u.String())
+	mappedMetrics, err := ParseAndGroupMetrics(b)
+	return mappedMetrics, errors.Wrap(err, "parse metrics response")
+}
+
+func (ts *TestSuite) checkAlertmanagerLoop() {
+	defer ts.wg.Done()
+
+	ts.loopTillItsOver(func() {
+		now := ts.clock.Now().UTC()
+		nowTs := timestamp.FromTime(now)
+
+		b, err := ts.client.Get(ts.amAlertsURL)
 		if err != nil {
-			level.Error(ts.logger).Log("msg", "Error in fetching metrics", "url", u.String(), "err", err)
+			level.Error(ts.logger).Log("msg", "Error in fetching alerts from Alertmanager", "url", ts.amAlertsURL, "err", err)
 			return
 		}
 
-		mappedMetrics, err := ParseAndGroupMetrics(b)
+		mappedAlerts, err := ParseAndGroupAlertmanagerAlerts(b)
 		if err != nil {
-			level.Error(ts.logger).Log("msg", "Error in parsing metrics response", "url", u.String(), "err", err)
+			level.Error(ts.logger).Log("msg", "Error in parsing Alertmanager alerts response", "url", ts.amAlertsURL, "err", err)
 			return
 		}
 
 		groupsToRemove := make(map[string]error)
 		ts.ruleGroupTestsMtx.RLock()
 		for groupName, c := range ts.ruleGroupTests {
-			if c.TestUntil() < nowTs {
+			from, until := ts.assertWindow(groupName, c)
+			if until < nowTs {
 				groupsToRemove[groupName] = nil
 				continue
 			}
-			err := c.CheckMetrics(nowTs, mappedMetrics[groupName])
+			if _, ok := c.(cases.NotificationsUnchecked); ok || nowTs < from {
+				continue
+			}
+			err := ts.ac.check(now, groupName, mappedAlerts[groupName])
 			if err != nil {
-				groupsToRemove[groupName] = err
+				groupsToRemove[groupName] = checkError{check: checkNameAlertmanager, err: errors.Wrap(err, "alertmanager")}
 			}
 		}
 		ts.ruleGroupTestsMtx.RUnlock()
@@ -333,20 +921,85 @@ func (ts *TestSuite) checkMetricsLoop() {
 	})
 }
 
+// startSelfMetrics scrapes the metrics of the alert generator at the start of the test.
+// endSelfMetrics compares them with the metrics at the end.
+func (ts *TestSuite) startSelfMetrics() {
+	startTime := ts.clock.Now()
+	startReceived := ts.as.numReceived()
+	start, err := ts.scrapeSelfMetrics()
+	if err != nil {
+		ts.addSelfMetricsDiscrepancies(fmt.Sprintf("failed to scrape the metrics at the start: %s", err))
+		return
+	}
+
+	ts.selfMetricsMtx.Lock()
+	defer ts.selfMetricsMtx.Unlock()
+	ts.selfMetricsStart = &start
+	ts.selfMetricsStartTime = startTime
+	ts.selfMetricsStartReceived = startReceived
+}
+
+// endSelfMetrics scrapes the metrics of the alert generator after the test is over, and compares their
+// increase per rule group with what the test suite saw since startSelfMetrics. It must be called before the
+// alert server is stopped, otherwise the failed notifications to it would also be counted.
+func (ts *TestSuite) endSelfMetrics() {
+	ts.selfMetricsMtx.Lock()
+	start, startTime, startReceived := ts.selfMetricsStart, ts.selfMetricsStartTime, ts.selfMetricsStartReceived
+	ts.selfMetricsMtx.Unlock()
+	if start == nil {
+		return
+	}
+
+	elapsed := ts.clock.Now().Sub(startTime)
+	received := ts.as.numReceived() - startReceived
+	end, err := ts.scrapeSelfMetrics()
+	if err != nil {
+		ts.addSelfMetricsDiscrepancies(fmt.Sprintf("failed to scrape the metrics at the end: %s", err))
+		return
+	}
+
+	ts.addSelfMetricsDiscrepancies(compareSelfMetrics(*start, end, elapsed, received, ts.groupEvaluations)...)
+}
+
+func (ts *TestSuite) scrapeSelfMetrics() (selfMetrics, error) {
+	b, err := ts.client.Get(ts.selfMetricsURL)
+	if err != nil {
+		return selfMetrics{}, err
+	}
+	return parseSelfMetrics(b)
+}
+
+func (ts *TestSuite) addSelfMetricsDiscrepancies(discrepancies ...string) {
+	ts.selfMetricsMtx.Lock()
+	defer ts.selfMetricsMtx.Unlock()
+	for _, d := range discrepancies {
+		level.Warn(ts.logger).Log("msg", "Discrepancy in the metrics of the alert generator", "url", ts.selfMetricsURL, "discrepancy", d)
+	}
+	ts.selfMetricsDiscrepancies = append(ts.selfMetricsDiscrepancies, discrepancies...)
+}
+
 func (ts *TestSuite) monitorAlertReception() {
 	defer ts.wg.Done()
 
 	ts.loopTillItsOver(func() {
 		groupsToRemove := make(map[string]error)
 		for groupName := range ts.as.groupsFacingErrors() {
-			groupsToRemove[groupName] = errors.New("error in alert reception")
+			groupsToRemove[groupName] = checkError{check: checkNameAlertReception, err: errors.New("error in alert reception")}
 		}
 
 		ts.removeGroups(groupsToRemove)
 	})
 }
 
-// loopTillItsOver runs the given function in intervals until the test has ended.
+// realDuration is the real time that the given duration in the replay takes at the replay speed.
+func (ts *TestSuite) realDuration(d time.Duration) time.Duration {
+	if ts.scaledClock == nil {
+		return d
+	}
+	return time.Duration(float64(d) / ts.opts.ReplaySpeed)
+}
+
+// loopTillItsOver runs the given function in intervals of the smallest group interval in the replay until the test has ended.
 func (ts *TestSuite) loopTillItsOver(f func()) {
 	defer ts.Stop()
 
@@ -354,21 +1007,46 @@ func (ts *TestSuite) loopTillItsOver(f func()) {
 		select {
 		case <-ts.stopc:
 			return
-		case <-time.After(time.Duration(ts.minGroupInterval)):
+		case <-time.After(ts.realDuration(time.Duration(ts.minGroupInterval))):
 			f()
 		}
 	}
 }
 
+// apiLag is how far behind the expected state the state visible via the APIs can be, which is the replica lag
+// plus the query cache staleness.
+func (ts *TestSuite) apiLag() time.Duration {
+	return ts.opts.ReplicaLag + ts.opts.QueryCacheStaleness
+}
+
+// checkWithLag runs the check at nowTs, and if it fails, at the earlier timestamps within the given lag
+// since a read replica can show an older state than the leader, and a stale cached query result can delay
+// the state changes. It returns the error of the check at nowTs if the check fails at all the timestamps.
+func (ts *TestSuite) checkWithLag(nowTs int64, lag time.Duration, check func(t int64) error) error {
+	err := check(nowTs)
+	if err == nil {
+		return nil
+	}
+	stepMs := int64(replicaLagCheckStep / time.Millisecond)
+	for t := nowTs - stepMs; t >= nowTs-int64(lag/time.Millisecond); t -= stepMs {
+		if check(t) == nil {
+			return nil
+		}
+	}
+	return err
+}
+
 func (ts *TestSuite) removeGroups(groupsToRemove map[string]error) {
 	ts.ruleGroupTestsMtx.Lock()
 	defer ts.ruleGroupTestsMtx.Unlock()
 	for gn, err := range groupsToRemove {
-		if _, ok := ts.ruleGroupTests[gn]; !ok {
+		c, ok := ts.ruleGroupTests[gn]
+		if !ok {
 			// Has been already removed.
 			continue
 		}
 		delete(ts.ruleGroupTests, gn)
+		ts.streamResult(c, err)
 		if err != nil {
 			ts.ruleGroupTestErrors[gn] = append(ts.ruleGroupTestErrors[gn], err)
 			level.Error(ts.logger).Log("msg", "Test failed for a rule group", "rulegroup", gn, "err", err)
@@ -391,7 +1069,20 @@ func (ts *TestSuite) Stop() {
 	default:
 		// TODO: there might still be a race in calling Stop twice. Low priority to fix it.
 		close(ts.stopc)
+		if ts.opts.VerifySelfMetrics {
+			ts.endSelfMetrics()
+		}
+		if ts.opts.VerifyAlertsTimeline {
+			ts.verifyAlertsTimeline()
+		}
+		ts.as.checkResendCounts(ts.clock.Now())
+		ts.as.checkSendLatencies()
 		ts.as.Stop()
+		if ts.as.trace != nil {
+			if err := ts.as.trace.close(); err != nil {
+				level.Error(ts.logger).Log("msg", "Error in closing the alert trace", "err", err)
+			}
+		}
 		ts.remoteWriter.Stop()
 	}
 }
@@ -427,14 +1118,51 @@ func (ts *TestSuite) WasTestSuccessful() (yes bool, describe string) {
 		return false, fmt.Sprintf("got some error in test execution: %q", err.Error())
 	}
 
+	if ts.capabilities != nil {
+		describe += ts.capabilities.String()
+	}
+	if ts.calibration != nil {
+		describe += ts.calibration.String()
+	}
+	if ts.opts.Shuffle {
+		describe += fmt.Sprintf("The cases were run in a shuffled order with seed %d, starting %s apart: %s\n",
+			ts.opts.Seed, shuffledCasesStartGap, strings.Join(ts.caseOrder, ", "))
+	}
+	if ts.ingestFaultsEnabled() {
+		describe += fmt.Sprintf("Faults were injected in the remote write of the fault tolerant cases with seed %d: drop rate %.2f, max delay %s\n",
+			ts.opts.Seed, ts.opts.IngestDropRate, ts.opts.IngestDelay)
+	}
+	describe += describeToleratedMissedResends(ts.as.groupError())
+	describe += describeClockDrift(ts.caseClockDrifts(), ts.opts.ClockDriftThreshold)
+
+	ts.selfMetricsMtx.Lock()
+	selfMetricsDescribe := ""
+	if len(ts.selfMetricsDiscrepancies) > 0 {
+		selfMetricsDescribe += "------------------------------------------\n"
+		if ts.opts.StrictSelfMetrics {
+			selfMetricsDescribe += "The metrics of the alert generator do not match what the test suite saw:\n"
+		} else {
+			selfMetricsDescribe += "Warning: The metrics of the alert generator do not match what the test suite saw:\n"
+		}
+		for i, d := range ts.selfMetricsDiscrepancies {
+			selfMetricsDescribe += fmt.Sprintf("\t%d: %s\n", i+1, d)
+		}
+	}
+	selfMetricsFailed := ts.opts.StrictSelfMetrics && len(ts.selfMetricsDiscrepancies) > 0
+	ts.selfMetricsMtx.Unlock()
+
 	groupsFacingErrors := ts.as.groupsFacingErrors()
-	if len(ts.ruleGroupTestErrors) == 0 && len(groupsFacingErrors) == 0 {
-		return true, "Congrats! All tests passed"
+	violationsDescribe := ts.as.describeViolations()
+	if len(ts.ruleGroupTestErrors) == 0 && len(groupsFacingErrors) == 0 && !selfMetricsFailed && violationsDescribe == "" {
+		if selfMetricsDescribe != "" {
+			selfMetricsDescribe += "------------------------------------------\n"
+		}
+		return true, describe + selfMetricsDescribe + "Congrats! All tests passed"
 	}
 
 	if len(ts.ruleGroupTestErrors) > 0 {
 		describe += "------------------------------------------\n"
-		describe += "The following rule groups failed the API and metrics check:\n"
+		describe += "The following rule groups failed the API, metrics or Alertmanager check:\n"
 		for gn, errs := range ts.ruleGroupTestErrors {
 			describe += "\nGroup Name: " + gn + "\n"
 			for i, err := range errs {
@@ -444,7 +1172,39 @@ func (ts *TestSuite) WasTestSuccessful() (yes bool, describe string) {
 	}
 
 	// TODO: check if there were more alerts that were expected and if they can be ignored.
-	alertServerErrors := ts.as.groupError()
+	describe += describeAlertReceptionErrors(groupsFacingErrors, ts.as.groupError())
+	describe += violationsDescribe
+
+	return false, describe + selfMetricsDescribe
+}
+
+// describeToleratedMissedResends describes the missed resends of the firing alerts that did not fail the rule groups
+// because of TestSuiteOptions.AllowedMissedResends.
+func describeToleratedMissedResends(alertServerErrors map[string]*allErrs) (describe string) {
+	var groupNames []string
+	for gn, errs := range alertServerErrors {
+		if len(errs.toleratedMissedResends) > 0 {
+			groupNames = append(groupNames, gn)
+		}
+	}
+	if len(groupNames) == 0 {
+		return ""
+	}
+	sort.Strings(groupNames)
+
+	describe += "------------------------------------------\n"
+	describe += "Warning: The following rule groups missed some resends of the firing alerts, which were tolerated (time is approx):\n"
+	for _, gn := range groupNames {
+		describe += "\nGroup Name: " + gn + "\n"
+		for i, ma := range alertServerErrors[gn].toleratedMissedResends {
+			describe += fmt.Sprintf("\t%d: Expected time: %s, Labels: %s\n", i+1, ma.Ts.Format(time.RFC3339Nano), ma.Alert.Labels.String())
+		}
+	}
+	return describe
+}
+
+// describeAlertReceptionErrors describes the errors of the given rule groups in receiving the alerts.
+func describeAlertReceptionErrors(groupsFacingErrors map[string]bool, alertServerErrors map[string]*allErrs) (describe string) {
 	if len(groupsFacingErrors) > 0 {
 		describe += "------------------------------------------\n"
 		describe += "The following rule groups faced alert reception issues:\n"
@@ -483,6 +1243,46 @@ func (ts *TestSuite) WasTestSuccessful() (yes bool, describe string) {
 				}
 			}
 
+			if len(errs.duplicateSends) > 0 {
+				describe += "\tReason: Alerts sent more than once within a resend cycle\n"
+				for i, dup := range errs.duplicateSends {
+					describe += fmt.Sprintf("\t\t%d: At %s and %s, Labels: %s, StartsAt: %s, EndsAt: %s\n",
+						i+1,
+						dup.prevT.Format(time.RFC3339Nano),
+						dup.t.Format(time.RFC3339Nano),
+						dup.alert.Labels.String(),
+						dup.alert.StartsAt.Format(time.RFC3339Nano),
+						dup.alert.EndsAt.Format(time.RFC3339Nano),
+					)
+				}
+			}
+
+			if len(errs.resendCountErrs) > 0 {
+				describe += "\tReason: Alerts sent a number of times other than expected while firing (the initial firing alert and the resends)\n"
+				for i, rc := range errs.resendCountErrs {
+					describe += fmt.Sprintf("\t\t%d: Labels: %s, StartsAt: %s, Firing window: %s, Expected: %s, Got: %d\n",
+						i+1,
+						rc.labels.String(),
+						rc.startsAt.Format(time.RFC3339Nano),
+						rc.window,
+						rc.expected(),
+						rc.count,
+					)
+				}
+			}
+
+			if len(errs.batchErrs) > 0 {
+				describe += "\tReason: Alerts batched in the requests other than asserted\n"
+				for i, be := range errs.batchErrs {
+					describe += fmt.Sprintf("\t\t%d: %s\n", i+1, be.String())
+				}
+			}
+
+			if errs.sendLatencyErr != nil {
+				describe += "\tReason: Firing alerts sent slower than the latency budget\n"
+				describe += fmt.Sprintf("\t\t%s\n", errs.sendLatencyErr.String())
+			}
+
 			if len(errs.unexpectedAlerts) > 0 {
 				describe += "\tReason: Unexpected alerts (Example: alerts that we didn't expect OR received outside expected time range OR duplicate alerts)\n"
 				for i, alert := range errs.unexpectedAlerts {
@@ -501,5 +1301,5 @@ func (ts *TestSuite) WasTestSuccessful() (yes bool, describe string) {
 		}
 	}
 
-	return false, describe
+	return describe
 }
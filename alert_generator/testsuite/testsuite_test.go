@@ -0,0 +1,141 @@
+package testsuite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/stretchr/testify/require"
+
+	"github.com/prometheus/compliance/alert_generator/testsuite/cases"
+)
+
+func TestValidateAllCases(t *testing.T) {
+	require.NoError(t, validateOpts(TestSuiteOptions{
+		Cases:           cases.AllCases,
+		RemoteWriteURL:  "http://localhost:9090/api/v1/write",
+		BaseAPIURL:      "http://localhost:9090",
+		PromQLBaseURL:   "http://localhost:9090",
+		AlertServerPort: "8080",
+	}))
+}
+
+func TestCheckWithLag(t *testing.T) {
+	// The check only passes at the state as of 3s before now.
+	nowTs := int64(100000)
+	check := func(ts int64) error {
+		if ts != nowTs-3000 {
+			return errors.Errorf("mismatch at %d", ts)
+		}
+		return nil
+	}
+
+	ts := &TestSuite{}
+	require.EqualError(t, ts.checkWithLag(nowTs, ts.apiLag(), check), "mismatch at 100000")
+
+	ts.opts.ReplicaLag = 2 * time.Second
+	require.EqualError(t, ts.checkWithLag(nowTs, ts.apiLag(), check), "mismatch at 100000")
+
+	ts.opts.ReplicaLag = 5 * time.Second
+	require.NoError(t, ts.checkWithLag(nowTs, ts.apiLag(), check))
+
+	// The query cache staleness adds to the replica lag for the APIs.
+	ts.opts.ReplicaLag = 2 * time.Second
+	ts.opts.QueryCacheStaleness = 1 * time.Second
+	require.NoError(t, ts.checkWithLag(nowTs, ts.apiLag(), check))
+	require.EqualError(t, ts.checkWithLag(nowTs, ts.opts.QueryCacheStaleness, check), "mismatch at 100000")
+}
+
+func TestExpectedExternalURL(t *testing.T) {
+	c := cases.ExternalURLTemplate()
+	_, err := NewTestSuite(TestSuiteOptions{
+		Logger:              log.NewNopLogger(),
+		Cases:               []cases.TestCase{c},
+		RemoteWriteURL:      "http://localhost:9090/api/v1/write",
+		BaseAPIURL:          "http://localhost:9090",
+		PromQLBaseURL:       "http://localhost:9090",
+		AlertServerPort:     "8080",
+		ExpectedExternalURL: "http://prometheus.example/prom/",
+	})
+	require.NoError(t, err)
+
+	c.Init(0)
+	exp := c.ExpectedAlerts()
+	require.NotEmpty(t, exp)
+	require.Equal(t, "http://prometheus.example/prom/alerts", exp[0].Alert.Annotations.Get("dashboard"))
+}
+
+func TestAssertWindow(t *testing.T) {
+	opts := TestSuiteOptions{
+		Cases:           []cases.TestCase{cases.PendingAndFiringAndResolved()},
+		RemoteWriteURL:  "http://localhost:9090/api/v1/write",
+		BaseAPIURL:      "http://localhost:9090",
+		PromQLBaseURL:   "http://localhost:9090",
+		AlertServerPort: "8080",
+		AssertFrom:      2 * time.Minute,
+		AssertUntil:     time.Minute,
+	}
+	require.EqualError(t, validateOpts(opts), "assertion window must end after it starts, got from 2m0s until 1m0s")
+	opts.AssertFrom = -time.Minute
+	require.EqualError(t, validateOpts(opts), "assertion window cannot be negative, got from -1m0s until 1m0s")
+
+	// The window ends at the end of the test case at the latest.
+	c := opts.Cases[0]
+	c.SamplesToRemoteWrite()
+	c.Init(100000)
+	ts := &TestSuite{caseStartTimes: map[string]int64{"PendingAndFiringAndResolved": 100000}}
+	ts.opts.AssertFrom = time.Minute
+	from, until := ts.assertWindow("PendingAndFiringAndResolved", c)
+	require.Equal(t, int64(160000), from)
+	require.Equal(t, c.TestUntil(), until)
+	ts.opts.AssertUntil = 2 * time.Minute
+	_, until = ts.assertWindow("PendingAndFiringAndResolved", c)
+	require.Equal(t, int64(220000), until)
+
+	// The alerts server records the errors only within the window. The resend at 1 is missed and the
+	// alert B is unexpected before the window.
+	now := time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)
+	lbls := labels.FromStrings("alertname", "A", "rulegroup", "G")
+	unexpected := func(at time.Time) notifier.Alert {
+		return notifier.Alert{Labels: labels.FromStrings("alertname", "B", "rulegroup", "G"), StartsAt: at}
+	}
+	for _, windowed := range []bool{false, true} {
+		as := newAlertsServer("", log.NewNopLogger())
+		if windowed {
+			as.setAssertWindow("G", now.Add(2*cases.ResendDelay+cases.ResendDelay/2), now.Add(10*cases.ResendDelay))
+		}
+		for i := 0; i < 6; i++ {
+			as.addExpectedAlerts(cases.ExpectedAlert{
+				OrderingID:    i + 1,
+				TimeTolerance: 10 * time.Second,
+				Ts:            now.Add(time.Duration(i) * cases.ResendDelay),
+				Resend:        i != 0,
+				NextState:     now.Add(10 * cases.ResendDelay),
+				ResolvedTime:  now.Add(10 * cases.ResendDelay),
+				EndsAtDelta:   4 * cases.ResendDelay,
+				Alert:         &notifier.Alert{Labels: lbls, StartsAt: now},
+			})
+		}
+		for _, i := range []int{0, 2} {
+			at := now.Add(time.Duration(i)*cases.ResendDelay + time.Second)
+			as.processAlerts(at, []notifier.Alert{
+				{Labels: lbls, StartsAt: now.Add(time.Second), EndsAt: at.Add(4*cases.ResendDelay + time.Second)},
+				unexpected(at),
+			})
+		}
+		require.Equal(t, !windowed, as.groupsFacingErrors()["G"])
+		if !windowed {
+			continue
+		}
+
+		at := now.Add(3 * cases.ResendDelay)
+		as.processAlerts(at, []notifier.Alert{unexpected(at)})
+		errs := as.getErr("G")
+		require.Len(t, errs.missedAlerts, 0)
+		require.Len(t, errs.unexpectedAlerts, 1)
+		require.Equal(t, at, errs.unexpectedAlerts[0].t)
+	}
+}
@@ -4,36 +4,17 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/notifier"
 	"github.com/prometheus/prometheus/promql"
 	v1 "github.com/prometheus/prometheus/web/api/v1"
 )
 
-// TODO: add retries and set some timeouts.
-func DoGetRequest(u string) ([]byte, error) {
-	resp, err := http.Get(u)
-	if err != nil {
-		return nil, errors.Wrap(err, "get request")
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("non 200 response code %q", resp.StatusCode)
-	}
-
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "read body")
-	}
-
-	return b, nil
-}
-
 // ParseAndGroupAlerts parses the alerts and groups by the rule group name.
 // The alerts are assumed to have a `rulegroup` label.
 func ParseAndGroupAlerts(b []byte) (map[string][]v1.Alert, error) {
@@ -66,6 +47,35 @@ type Alerts struct {
 	Alerts []v1.Alert `json:"alerts"`
 }
 
+// ParseAndGroupAlertmanagerAlerts parses the alerts from the Alertmanager's GET /api/v2/alerts
+// and groups by the rule group name. The alerts are assumed to have a `rulegroup` label.
+func ParseAndGroupAlertmanagerAlerts(b []byte) (map[string][]AlertmanagerAlert, error) {
+	var res []AlertmanagerAlert
+	err := json.Unmarshal(b, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal response into json")
+	}
+
+	// Group alerts based on group name via the "rulegroup" label.
+	mappedAlerts := make(map[string][]AlertmanagerAlert)
+	for _, al := range res {
+		groupName := al.Labels.Get("rulegroup")
+		mappedAlerts[groupName] = append(mappedAlerts[groupName], al)
+	}
+
+	return mappedAlerts, nil
+}
+
+// AlertmanagerAlert is an alert as returned by the Alertmanager's GET /api/v2/alerts.
+type AlertmanagerAlert struct {
+	notifier.Alert
+	Status AlertmanagerAlertStatus `json:"status"`
+}
+
+type AlertmanagerAlertStatus struct {
+	State string `json:"state"`
+}
+
 // ParseAndGroupRules parses the rules and groups by the rule group name.
 // The rules are assumed to have a `rulegroup` label.
 func ParseAndGroupRules(b []byte) (map[string]*v1.RuleGroup, error) {
@@ -89,8 +99,14 @@ func ParseAndGroupRules(b []byte) (map[string]*v1.RuleGroup, error) {
 			LastEvaluation: g.LastEvaluation.UTC(),
 		}
 		for _, r := range g.Rules {
-			r.LastEvaluation = r.LastEvaluation.UTC()
-			rg.Rules = append(rg.Rules, r)
+			switch rule := r.Rule.(type) {
+			case v1.AlertingRule:
+				rule.LastEvaluation = rule.LastEvaluation.UTC()
+				rg.Rules = append(rg.Rules, rule)
+			case v1.RecordingRule:
+				rule.LastEvaluation = rule.LastEvaluation.UTC()
+				rg.Rules = append(rg.Rules, rule)
+			}
 		}
 		mappedGroups[g.Name] = rg
 	}
@@ -108,12 +124,42 @@ type Data struct {
 }
 
 type RuleGroup struct {
-	Name           string            `json:"name"`
-	File           string            `json:"file"`
-	Rules          []v1.AlertingRule `json:"rules"`
-	Interval       float64           `json:"interval"`
-	EvaluationTime float64           `json:"evaluationTime"`
-	LastEvaluation time.Time         `json:"lastEvaluation"`
+	Name           string    `json:"name"`
+	File           string    `json:"file"`
+	Rules          []Rule    `json:"rules"`
+	Interval       float64   `json:"interval"`
+	EvaluationTime float64   `json:"evaluationTime"`
+	LastEvaluation time.Time `json:"lastEvaluation"`
+}
+
+// Rule is either a v1.AlertingRule or a v1.RecordingRule based on the type of the rule.
+type Rule struct {
+	v1.Rule
+}
+
+func (r *Rule) UnmarshalJSON(b []byte) error {
+	var t struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return err
+	}
+
+	switch t.Type {
+	case "recording":
+		var rr v1.RecordingRule
+		if err := json.Unmarshal(b, &rr); err != nil {
+			return err
+		}
+		r.Rule = rr
+	default:
+		var ar v1.AlertingRule
+		if err := json.Unmarshal(b, &ar); err != nil {
+			return err
+		}
+		r.Rule = ar
+	}
+	return nil
 }
 
 // ParseAndGroupMetrics parses samples and groups by the rule group name.
@@ -165,6 +211,56 @@ type Vector struct {
 	Value  [2]interface{} `json:"value"`
 }
 
+// ParseAndGroupMatrix parses the series of a range query and groups them by the rule group name.
+// The series are assumed to have a `rulegroup` label. The timestamps of the points are in milliseconds.
+func ParseAndGroupMatrix(b []byte) (map[string][]promql.Series, error) {
+	var res GETMatrixResponse
+	err := json.Unmarshal(b, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal response into json")
+	}
+
+	if res.Status != "success" {
+		return nil, errors.Errorf("got non success status %q", res.Status)
+	}
+
+	// Group series based on group name via the "rulegroup" label.
+	mappedSeries := make(map[string][]promql.Series)
+	for _, s := range res.Data.Result {
+		groupName := s.Metric.Get("rulegroup")
+		series := promql.Series{Metric: s.Metric}
+		for _, v := range s.Values {
+			ts, vs := v[0].(float64), v[1].(string)
+			val, err := strconv.ParseFloat(vs, 64)
+			if err != nil {
+				return nil, err
+			}
+			series.Points = append(series.Points, promql.Point{
+				T: timestamp.FromFloatSeconds(ts),
+				V: val,
+			})
+		}
+		mappedSeries[groupName] = append(mappedSeries[groupName], series)
+	}
+
+	return mappedSeries, nil
+}
+
+type GETMatrixResponse struct {
+	Status string `json:"status"`
+	Data   Matrix `json:"data"`
+}
+
+type Matrix struct {
+	ResultType string         `json:"resultType"`
+	Result     []MatrixSeries `json:"result"`
+}
+
+type MatrixSeries struct {
+	Metric labels.Labels    `json:"metric"`
+	Values [][2]interface{} `json:"values"`
+}
+
 // Copy pasted from github.com/prometheus/prometheus/tsdb/errors to prevent go.mod errors.
 
 // multiError type allows combining multiple errors into one.
@@ -2,8 +2,10 @@ package testsuite
 
 import (
 	"testing"
+	"time"
 
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/notifier"
 	"github.com/stretchr/testify/require"
 	"github.com/prometheus/prometheus/promql"
 )
@@ -70,3 +72,57 @@ func TestParseAndGroupMetrics(t *testing.T) {
 		require.Equal(t, c.expMetrics, act)
 	}
 }
+
+func TestParseAndGroupAlertmanagerAlerts(t *testing.T) {
+	response := `
+[
+	{
+		"labels": {"alertname":"PendingAndFiringAndResolved_SimpleAlert","foo":"bar","rulegroup":"PendingAndFiringAndResolved"},
+		"annotations": {"description":"SimpleAlert is firing"},
+		"startsAt": "2022-01-10T10:00:00Z",
+		"endsAt": "2022-01-10T10:04:00Z",
+		"generatorURL": "http://localhost:9090/graph",
+		"fingerprint": "0123456789abcdef",
+		"receivers": [{"name": "default"}],
+		"status": {"inhibitedBy": [], "silencedBy": [], "state": "active"},
+		"updatedAt": "2022-01-10T10:00:00Z"
+	},
+	{
+		"labels": {"alertname":"AnotherGroup_SimpleAlert","rulegroup":"AnotherGroup"},
+		"annotations": {},
+		"startsAt": "2022-01-10T10:01:00Z",
+		"endsAt": "2022-01-10T10:05:00Z",
+		"generatorURL": "http://localhost:9090/graph",
+		"status": {"inhibitedBy": [], "silencedBy": ["abc"], "state": "suppressed"}
+	}
+]`
+
+	act, err := ParseAndGroupAlertmanagerAlerts([]byte(response))
+	require.NoError(t, err)
+	require.Equal(t, map[string][]AlertmanagerAlert{
+		"PendingAndFiringAndResolved": {
+			{
+				Alert: notifier.Alert{
+					Labels:       labels.FromStrings("alertname", "PendingAndFiringAndResolved_SimpleAlert", "foo", "bar", "rulegroup", "PendingAndFiringAndResolved"),
+					Annotations:  labels.FromStrings("description", "SimpleAlert is firing"),
+					StartsAt:     time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC),
+					EndsAt:       time.Date(2022, 1, 10, 10, 4, 0, 0, time.UTC),
+					GeneratorURL: "http://localhost:9090/graph",
+				},
+				Status: AlertmanagerAlertStatus{State: "active"},
+			},
+		},
+		"AnotherGroup": {
+			{
+				Alert: notifier.Alert{
+					Labels:       labels.FromStrings("alertname", "AnotherGroup_SimpleAlert", "rulegroup", "AnotherGroup"),
+					Annotations:  labels.Labels{},
+					StartsAt:     time.Date(2022, 1, 10, 10, 1, 0, 0, time.UTC),
+					EndsAt:       time.Date(2022, 1, 10, 10, 5, 0, 0, time.UTC),
+					GeneratorURL: "http://localhost:9090/graph",
+				},
+				Status: AlertmanagerAlertStatus{State: "suppressed"},
+			},
+		},
+	}, act)
+}